@@ -2,9 +2,7 @@ package api
 
 import (
 	"context"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/binary"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -14,6 +12,7 @@ import (
 	"github.com/nk-nigeria/cgp-common/utilities"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -65,6 +64,17 @@ func RpcLinkUsername(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 	}
 }
 
+// saveLastLoginDevice device id used by giftcode per-device limit
+func saveLastLoginDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userID, deviceId string) {
+	if deviceId == "" {
+		return
+	}
+	query := `UPDATE users AS u SET metadata = u.metadata || jsonb_build_object('last_login_device_id', $2::text) WHERE id = $1`
+	if _, err := db.ExecContext(ctx, query, userID, deviceId); err != nil {
+		logger.Error("Update last login device user %s failed: %v", userID, err)
+	}
+}
+
 func AfterAuthDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *api.Session, in *api.AuthenticateDeviceRequest) error {
 	logger.Debug("AfterAuthDevice: %s", out.Token)
 
@@ -81,15 +91,27 @@ func AfterAuthDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk
 	}
 
 	if !exists {
-		sid := createSidFromUserID(userID)
-		_, err := db.ExecContext(ctx, "INSERT INTO users_ext (id, sid) VALUES ($1, $2)", userID, sid)
-		if err != nil {
+		if err := cgbdb.AddUserSid(ctx, logger, db, userID); err != nil {
 			logger.Error("Insert users_ext failed: %v", err)
 			return err
 		}
 		logger.Debug("Inserted users_ext for user %s", userID)
 	}
 
+	registerDevice(ctx, logger, db, userID, in.GetAccount().GetVars(), out)
+
+	saveLastLoginDevice(ctx, logger, db, userID, in.GetAccount().GetId())
+
+	// device and network used by refer fraud check
+	clientIP, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string)
+	fingerprints := entity.NetworkFingerprints(userID, clientIP)
+	if in.GetAccount().GetId() != "" {
+		fingerprints = append(fingerprints, &entity.UserFingerprint{UserId: userID, Kind: entity.FingerprintKindDevice, Value: in.GetAccount().GetId()})
+	}
+	if err := cgbdb.AddUserFingerprint(ctx, logger, db, fingerprints...); err != nil {
+		logger.Error("Add fingerprint user %s failed: %v", userID, err)
+	}
+
 	return nil
 }
 
@@ -117,9 +139,7 @@ func CreateSidForAllUsers(ctx context.Context, logger runtime.Logger, db *sql.DB
 		}
 
 		if !exists {
-			sid := createSidFromUserID(userID)
-			_, err = db.ExecContext(ctx, "INSERT INTO users_ext (id, sid) VALUES ($1, $2)", userID, sid)
-			if err != nil {
+			if err := cgbdb.AddUserSid(ctx, logger, db, userID); err != nil {
 				logger.Error("Insert users_ext failed for %s: %v", userID, err)
 				continue
 			}
@@ -140,6 +160,34 @@ func CreateSidForAllUsers(ctx context.Context, logger runtime.Logger, db *sql.DB
 var jwtSecret = []byte("YM0fahhp2aW9dcuqq2Z6gFj6AvyaJLAfMMofaCmJ91c=") // phải giống với giá trị `session.token_signing_key` trong nakama.yml
 
 func getUserIDFromToken(tokenStr string) (string, error) {
+	claims, err := parseSessionToken(tokenStr)
+	if err != nil {
+		return "", err
+	}
+	uid, ok := claims["uid"].(string)
+	if !ok {
+		return "", jwt.ErrInvalidKey
+	}
+	return uid, nil
+}
+
+// getUserDeviceFromToken user id and device id in session vars of token
+func getUserDeviceFromToken(tokenStr string) (string, string, error) {
+	claims, err := parseSessionToken(tokenStr)
+	if err != nil {
+		return "", "", err
+	}
+	uid, ok := claims["uid"].(string)
+	if !ok {
+		return "", "", jwt.ErrInvalidKey
+	}
+	vars, _ := claims["vrs"].(map[string]interface{})
+	deviceId, _ := vars[entity.DeviceVarId].(string)
+	deviceId, _ = entity.NormalizeDevice(deviceId, "")
+	return uid, deviceId, nil
+}
+
+func parseSessionToken(tokenStr string) (jwt.MapClaims, error) {
 	tokenStr = strings.TrimSpace(tokenStr)
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		// Nakama dùng HS256
@@ -149,26 +197,11 @@ func getUserIDFromToken(tokenStr string) (string, error) {
 		return jwtSecret, nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		uid, ok := claims["uid"].(string)
-		if !ok {
-			return "", jwt.ErrInvalidKey
-		}
-		return uid, nil
-	}
-	return "", jwt.ErrInvalidKey
-}
-
-func createSidFromUserID(userID string) int64 {
-	hash := sha256.Sum256([]byte(userID))
-	value := binary.BigEndian.Uint64(hash[:8])
-	sid := value % 1_000_000_000
-
-	if sid < 100_000_000 {
-		sid += 100_000_000
+		return claims, nil
 	}
-	return int64(sid)
+	return nil, jwt.ErrInvalidKey
 }
@@ -105,6 +105,7 @@ func RpcBankSendGift(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 			return "", presenter.ErrUnmarshal
 		}
 		// check sender
+		senderName := ""
 		{
 			profile, _, err := cgbdb.GetProfileUser(ctx, db, userID, nil)
 			if err != nil {
@@ -114,8 +115,15 @@ func RpcBankSendGift(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 			if profile.VipLevel < constant.MinLvAllowUseBank {
 				return "", presenter.ErrFuncDisableByVipLv
 			}
+			if err := checkSanction(ctx, logger, db, userID, entity.SanctionKindTransferBlock); err != nil {
+				return "", err
+			}
 			bank.SenderId = userID
 			bank.SenderSid = profile.UserSid
+			senderName = profile.GetDisplayName()
+			if senderName == "" {
+				senderName = profile.GetUserName()
+			}
 		}
 		// check recv
 		{
@@ -128,6 +136,9 @@ func RpcBankSendGift(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 					userSid = int64(id)
 				}
 			}
+			if userId == "" && !entity.ValidSid(userSid) {
+				return "", runtime.NewError(entity.ErrSidInvalid.Error(), presenter.ErrInvalidInput.Code)
+			}
 			account, err := cgbdb.GetAccount(ctx, db, userId, userSid)
 			if err != nil {
 				logger.WithField("recv id", userId).WithField("recv sid", userSid).Error("Recv user not found")
@@ -171,24 +182,11 @@ func RpcBankSendGift(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 			payload, _ := json.Marshal(metadata)
 			report.ReportEvent(ctx, "send-chip", userID, string(payload))
 		}
-		// todo send noti
-		noti := pb.Notification{
-			RecipientId: bank.RecipientId,
-			Type:        pb.TypeNotification_GIFT,
-			Title:       "Gift",
-			Content:     freeChip.GetContent(),
-			SenderId:    "",
-			Read:        false,
-		}
-		// noti := pb.Notification{
-		// 	RecipientId: bank.RecipientId,
-		// 	Type:        pb.TypeNotification_GIFT,
-		// 	Title:       "Freechip",
-		// 	Content:     "Freechip",
-		// 	SenderId:    "",
-		// 	Read:        false,
-		// }
-		err = cgbdb.AddNotification(ctx, logger, db, nk, &noti)
+		err = newNotiRenderer(logger, db).Send(ctx, nk, entity.NotiTplGift, bank.RecipientId, pb.TypeNotification_GIFT, entity.NotiCategoryTransfer,
+			map[string]interface{}{
+				"sender": senderName,
+				"chips":  freeChip.GetChips(),
+			})
 		if err != nil {
 			logger.Warn("Add freechip noti err %s, body %s",
 				err.Error(), freeChip.String())
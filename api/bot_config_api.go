@@ -4,15 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/cgp-common/define"
+	"github.com/nk-nigeria/lobby-module/botpolicy"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"google.golang.org/protobuf/proto"
 )
 
-// RpcGetBotConfig lấy cấu hình bot hiện tại
+// RpcGetBotConfig lấy cấu hình bot hiện tại, only rules in hour window of current hour
+// in default timezone, all_hours return all rules for admin
 func RpcGetBotConfig(marshaler *proto.MarshalOptions, unmarshaler *proto.UnmarshalOptions) func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 		// Parse request payload
@@ -34,6 +40,9 @@ func RpcGetBotConfig(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 			logger.Error("Failed to get bot config: %v", err)
 			return "", err
 		}
+		if allHours, _ := request["all_hours"].(bool); !allHours {
+			config = botpolicy.ActiveAt(config, time.Now().In(entity.DailyRewardLocation("", "")).Hour())
+		}
 
 		responseBytes, err := json.Marshal(config)
 		if err != nil {
@@ -61,6 +70,18 @@ func RpcUpdateBotConfig(marshaler *proto.MarshalOptions, unmarshaler *proto.Unma
 			return "", runtime.NewError("Invalid bot config: "+err.Error(), 3)
 		}
 
+		// Reject changed rules can never be reached with rules already saved
+		current, err := getBotConfigFromDB(ctx, logger, db, config.GameCode)
+		if err != nil {
+			logger.Error("Failed to get bot config: %v", err)
+			return "", err
+		}
+		maxPlayers := define.GetMaxSizeByGame(define.GameName(config.GameCode))
+		if err := botpolicy.ValidateChanged(mergeBotConfig(current, &config), &config, maxPlayers); err != nil {
+			logger.Error("Invalid bot config: %v", err)
+			return "", runtime.NewError("Invalid bot config: "+err.Error(), 3)
+		}
+
 		// Save to database
 		if err := saveBotConfigToDB(ctx, logger, db, &config); err != nil {
 			logger.Error("Failed to save bot config to database: %v", err)
@@ -123,6 +144,52 @@ func getBotConfigFromDB(ctx context.Context, logger runtime.Logger, db *sql.DB,
 	return config, nil
 }
 
+// mergeBotConfig rules of config after update saved config, rule with same id is replaced
+func mergeBotConfig(saved, update *cgbdb.BotConfig) *cgbdb.BotConfig {
+	merged := &cgbdb.BotConfig{GameCode: saved.GameCode}
+	joinIds := make(map[int]bool)
+	for _, r := range update.BotJoinRules {
+		joinIds[r.ID] = r.ID > 0
+		merged.BotJoinRules = append(merged.BotJoinRules, r)
+	}
+	for _, r := range saved.BotJoinRules {
+		if !joinIds[r.ID] {
+			merged.BotJoinRules = append(merged.BotJoinRules, r)
+		}
+	}
+	leaveIds := make(map[int]bool)
+	for _, r := range update.BotLeaveRules {
+		leaveIds[r.ID] = r.ID > 0
+		merged.BotLeaveRules = append(merged.BotLeaveRules, r)
+	}
+	for _, r := range saved.BotLeaveRules {
+		if !leaveIds[r.ID] {
+			merged.BotLeaveRules = append(merged.BotLeaveRules, r)
+		}
+	}
+	createIds := make(map[int]bool)
+	for _, r := range update.BotCreateTableRules {
+		createIds[r.ID] = r.ID > 0
+		merged.BotCreateTableRules = append(merged.BotCreateTableRules, r)
+	}
+	for _, r := range saved.BotCreateTableRules {
+		if !createIds[r.ID] {
+			merged.BotCreateTableRules = append(merged.BotCreateTableRules, r)
+		}
+	}
+	groupIds := make(map[int]bool)
+	for _, r := range update.BotGroupRules {
+		groupIds[r.ID] = r.ID > 0
+		merged.BotGroupRules = append(merged.BotGroupRules, r)
+	}
+	for _, r := range saved.BotGroupRules {
+		if !groupIds[r.ID] {
+			merged.BotGroupRules = append(merged.BotGroupRules, r)
+		}
+	}
+	return merged
+}
+
 // saveBotConfigToDB saves bot configuration to database
 func saveBotConfigToDB(ctx context.Context, logger runtime.Logger, db *sql.DB, config *cgbdb.BotConfig) error {
 	// Save bot join rules
@@ -223,3 +290,83 @@ func validateBotConfig(config *cgbdb.BotConfig) error {
 
 	return nil
 }
+
+type botRuleSimulateRequest struct {
+	GameCode string `json:"game_code"`
+	// candidate config, empty is saved config of game
+	Config   *cgbdb.BotConfig       `json:"config"`
+	Timeline []botpolicy.TableState `json:"timeline"`
+}
+
+// RpcBotRuleSimulate decisions of bot rules for each table state of a scripted timeline
+func RpcBotRuleSimulate() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		var request botRuleSimulateRequest
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			logger.Error("Failed to unmarshal bot rule simulate request: %v", err)
+			return "", err
+		}
+		if request.GameCode == "" {
+			return "", runtime.NewError("Invalid game_code", 3)
+		}
+		config := request.Config
+		if config == nil {
+			var err error
+			if config, err = getBotConfigFromDB(ctx, logger, db, request.GameCode); err != nil {
+				logger.Error("Failed to get bot config: %v", err)
+				return "", err
+			}
+		} else {
+			config.GameCode = request.GameCode
+			if err := validateBotConfig(config); err != nil {
+				return "", runtime.NewError("Invalid bot config: "+err.Error(), 3)
+			}
+		}
+		maxPlayers := define.GetMaxSizeByGame(define.GameName(request.GameCode))
+		engine := botpolicy.NewEngine(config, maxPlayers)
+		response := map[string]interface{}{
+			"game_code": request.GameCode,
+			"decisions": engine.Simulate(request.Timeline),
+		}
+		// candidate config is simulated even it has unreachable rules, warn admin
+		if err := botpolicy.Validate(config, maxPlayers); err != nil {
+			response["warning"] = err.Error()
+		}
+		responseBytes, err := json.Marshal(response)
+		if err != nil {
+			logger.Error("Failed to marshal response: %v", err)
+			return "", err
+		}
+		return string(responseBytes), nil
+	}
+}
+
+// RpcDeleteBotRule deactivate a rule, kind is join, leave, create_table or group
+func RpcDeleteBotRule() func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		var request struct {
+			Kind string `json:"kind"`
+			ID   int    `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(payload), &request); err != nil {
+			logger.Error("Failed to unmarshal delete bot rule request: %v", err)
+			return "", err
+		}
+		tableName, ok := cgbdb.BotRuleTables[request.Kind]
+		if !ok || request.ID <= 0 {
+			return "", runtime.NewError("Invalid kind or id", 3)
+		}
+		if err := cgbdb.DeleteBotRule(ctx, logger, db, tableName, request.ID); err != nil {
+			return "", err
+		}
+		return `{"success":true}`, nil
+	}
+}
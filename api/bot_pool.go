@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+// retry when generated user name of bot is taken
+const botPoolCreateMaxRetry = 5
+
+func botPoolError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrBotLeaseEmpty):
+		return runtime.NewError(err.Error(), presenter.ErrNotFound.Code)
+	case errors.Is(err, entity.ErrBotPoolGameCode), errors.Is(err, entity.ErrBotPoolCount), errors.Is(err, entity.ErrBotPoolVip),
+		errors.Is(err, entity.ErrBotLeaseMatchId), errors.Is(err, entity.ErrBotLeaseCount):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// RpcBotPoolCreate create count bots for game with generated name, avatar and vip/level
+func RpcBotPoolCreate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotPoolCreateRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Normalize(); err != nil {
+			return "", botPoolError(err)
+		}
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		bots := make([]*entity.PoolBot, 0, req.Count)
+		for len(bots) < req.Count {
+			var bot *entity.PoolBot
+			var err error
+			for retry := 0; retry < botPoolCreateMaxRetry; retry++ {
+				bot = entity.NewPoolBot(rng, req)
+				if err = cgbdb.AddPoolBot(ctx, logger, db, bot); !errors.Is(err, cgbdb.ErrBotNameExist) {
+					break
+				}
+			}
+			if err != nil {
+				// bots created before error are kept in pool
+				logger.Error("Create bot pool game %s stop at %d/%d, error %s", req.GameCode, len(bots), req.Count, err.Error())
+				break
+			}
+			bots = append(bots, bot)
+		}
+		out, _ := json.Marshal(&entity.ListPoolBot{Bots: bots})
+		return string(out), nil
+	}
+}
+
+// RpcBotPoolList bots of pool with number of bots per game by status
+func RpcBotPoolList() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotPoolListRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Limit <= 0 || req.Limit > entity.BotPoolMaxLimit {
+			req.Limit = entity.BotPoolDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		bots, err := cgbdb.ListPoolBot(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		stats, err := cgbdb.GetBotPoolStats(ctx, logger, db)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListPoolBot{Bots: bots, Stats: stats})
+		return string(out), nil
+	}
+}
+
+// RpcBotPoolRetire retire idle bots, leased bots are skipped and can be retired after returned
+func RpcBotPoolRetire() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotPoolRetireRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if len(req.UserIds) == 0 {
+			if req.GameCode == "" {
+				return "", botPoolError(entity.ErrBotPoolGameCode)
+			}
+			if req.Count <= 0 || req.Count > entity.BotPoolMaxCreate {
+				return "", botPoolError(entity.ErrBotPoolCount)
+			}
+		}
+		userIds, err := cgbdb.RetirePoolBot(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(map[string]interface{}{"user_ids": userIds})
+		return string(out), nil
+	}
+}
+
+// RpcBotPoolRebalance move idle bots between games to reach target active bots of each game
+func RpcBotPoolRebalance() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotPoolRebalanceRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		for game, target := range req.Targets {
+			if game == "" || target < 0 {
+				return "", presenter.ErrInvalidInput
+			}
+		}
+		stats, err := cgbdb.GetBotPoolStats(ctx, logger, db)
+		if err != nil {
+			return "", err
+		}
+		result := entity.PlanBotRebalance(stats, req.Targets)
+		if !req.DryRun {
+			for _, move := range result.Moves {
+				// bot may be leased since stats are read, move what is still idle
+				moved, err := cgbdb.MovePoolBot(ctx, logger, db, move)
+				if err != nil {
+					return "", err
+				}
+				if moved < move.Count {
+					result.Shortfall[move.To] += move.Count - moved
+					move.Count = moved
+				}
+			}
+		}
+		out, _ := json.Marshal(result)
+		return string(out), nil
+	}
+}
+
+// RpcBotLease match module check out idle bots of game for a match,
+// bot is not given to other lease until it is returned or lease expire
+func RpcBotLease() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotLeaseRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Normalize(); err != nil {
+			return "", botPoolError(err)
+		}
+		lease, err := cgbdb.LeasePoolBot(ctx, logger, db, req)
+		if err != nil {
+			return "", botPoolError(err)
+		}
+		out, _ := json.Marshal(lease)
+		return string(out), nil
+	}
+}
+
+// RpcBotLeaseRenew extend lease of a long match before it expire
+func RpcBotLeaseRenew() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotLeaseRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.LeaseId == "" {
+			return "", presenter.ErrInvalidInput
+		}
+		req.NormalizeTtl()
+		renewed, err := cgbdb.RenewPoolBotLease(ctx, logger, db, req.LeaseId, req.TtlSec)
+		if err != nil {
+			return "", err
+		}
+		if renewed == 0 {
+			return "", presenter.ErrNotFound
+		}
+		out, _ := json.Marshal(map[string]interface{}{
+			"lease_id":          req.LeaseId,
+			"renewed":           renewed,
+			"lease_expire_unix": time.Now().Add(time.Duration(req.TtlSec) * time.Second).Unix(),
+		})
+		return string(out), nil
+	}
+}
+
+// RpcBotLeaseReturn return bots of lease to pool when they leave match or match end
+func RpcBotLeaseReturn() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.BotLeaseRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.LeaseId == "" {
+			return "", presenter.ErrInvalidInput
+		}
+		userIds, err := cgbdb.ReturnPoolBot(ctx, logger, db, req.LeaseId, req.UserIds)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(map[string]interface{}{"user_ids": userIds})
+		return string(out), nil
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/cgp-common/lib"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+const (
+	// claim pending longer than this is picked by worker
+	claimOutboxRetryAfterSec = 30
+	claimOutboxBatch         = 100
+	// time a worker own the claims it leased, longer than wallet update and report of a batch
+	claimOutboxLeaseSec = 300
+)
+
+// ApplyClaimOutbox apply wallet update of a pending claim right after the claim committed.
+// If it fail, worker will retry.
+func ApplyClaimOutbox(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, id int64) error {
+	return processClaimOutbox(ctx, logger, db, nk, id)
+}
+
+// ProcessPendingClaimOutbox worker apply all claim still pending
+func ProcessPendingClaimOutbox(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	if err := processClaimOutbox(ctx, logger, db, nk, 0); err != nil {
+		logger.WithField("err", err).Error("process pending claim outbox failed")
+	}
+}
+
+// processClaimOutbox lease claims then apply them one by one without holding a transaction,
+// lease expire let other worker retry if this one crash.
+func processClaimOutbox(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, id int64) error {
+	ml, err := cgbdb.ClaimPendingClaimOutbox(ctx, logger, db, id, claimOutboxRetryAfterSec, claimOutboxBatch, claimOutboxLeaseSec)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, outbox := range ml {
+		// wallet already updated but claim not mark done (crash before mark)
+		applied, err := cgbdb.IsClaimOutboxInWallet(ctx, db, outbox.UserId, outbox.Id)
+		if err != nil {
+			logger.WithField("claim id", outbox.Id).WithField("err", err).Error("check claim in wallet ledger failed")
+			cgbdb.MarkClaimOutboxRetry(ctx, logger, db, outbox.Id, err.Error())
+			lastErr = err
+			continue
+		}
+		if !applied {
+			wallet := lib.Wallet{
+				Chips:  outbox.Chips,
+				UserId: outbox.UserId,
+			}
+			if err := entity.AddChipWalletUser(ctx, nk, logger, outbox.UserId, wallet, outbox.Metadata); err != nil {
+				logger.Error("Add chip user %s, claim %d error %s", outbox.UserId, outbox.Id, err.Error())
+				cgbdb.MarkClaimOutboxRetry(ctx, logger, db, outbox.Id, err.Error())
+				lastErr = err
+				continue
+			}
+			logger.Info("User %s claim %s %d chips", outbox.UserId, outbox.IdemKey, outbox.Chips)
+		}
+		if err := cgbdb.MarkClaimOutboxDone(ctx, logger, db, outbox.Id); err != nil {
+			lastErr = err
+			continue
+		}
+		if !applied {
+			reportClaimOutbox(ctx, logger, outbox)
+		}
+	}
+	return lastErr
+}
+
+// emit event to doris
+func reportClaimOutbox(ctx context.Context, logger runtime.Logger, outbox *entity.ClaimOutbox) {
+	metadata := make(map[string]interface{}, len(outbox.Metadata)+2)
+	for k, v := range outbox.Metadata {
+		metadata[k] = v
+	}
+	metadata["chips"] = strconv.Itoa(int(outbox.Chips))
+	metadata["user_id"] = outbox.UserId
+	payload, _ := json.Marshal(metadata)
+	report := lib.NewReportGame(ctx)
+	data, _, err := report.ReportEvent(ctx, "send-chip", outbox.UserId, string(payload))
+	logger.WithField("err", err).Info("Report event send-chip user %s , data %s, repsonse %s",
+		outbox.UserId, string(payload), string(data))
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/nk-nigeria/cgp-common/define"
 	api "github.com/nk-nigeria/cgp-common/proto"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
 )
 
 type players map[string]struct{}
@@ -81,6 +82,8 @@ func updateUserMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, evt
 			Bet:       lastBet,
 		})
 
+		trackPlaytime(ctx, logger, db, userId, entity.PlaytimeKindMatch, matchId, !isLeave)
+
 		if isLeave {
 			delete(playerSet, userId)
 		} else {
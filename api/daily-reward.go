@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"sort"
 	"time"
@@ -14,8 +15,9 @@ import (
 	"github.com/nk-nigeria/lobby-module/conf"
 	"github.com/nk-nigeria/lobby-module/constant"
 	"github.com/nk-nigeria/lobby-module/entity"
-	"github.com/nk-nigeria/cgp-common/lib"
 	pb "github.com/nk-nigeria/cgp-common/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -124,6 +126,10 @@ func RpcDailyRewardTemplate() func(context.Context, runtime.Logger, *sql.DB, run
 		if !ok {
 			return "", errors.New("Missing user ID.")
 		}
+		if template, err := cgbdb.GetActiveDailyRewardTemplate(ctx, logger, db); err == nil && template != nil {
+			out, _ := conf.MarshalerDefault.Marshal(template.ToPb())
+			return string(out), nil
+		}
 		objectIds := []*runtime.StorageRead{
 			{
 				Collection: kDailyRewardTemplateCollection,
@@ -142,20 +148,56 @@ func RpcDailyRewardTemplate() func(context.Context, runtime.Logger, *sql.DB, run
 	}
 }
 
-func canUserClaimDailyReward(d *pb.Reward) bool {
-	t := time.Now()
-	// return time.Unix(d.LastClaimUnix, 0).Before(t.Add(-5 * time.Second))
-	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
-	return time.Unix(d.LastClaimUnix, 0).Before(midnight)
+// getDailyRewardTemplate template from admin if any, else default template
+func getDailyRewardTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB) *pb.DailyRewardTemplate {
+	template, err := cgbdb.GetActiveDailyRewardTemplate(ctx, logger, db)
+	if err != nil || template == nil {
+		return DailyRewardTemplate
+	}
+	return template.ToPb()
+}
+
+// dailyRewardLocation reset daily reward at midnight of timezone pinned at first use,
+// change of user timezone apply after next reset.
+func dailyRewardLocation(ctx context.Context, logger runtime.Logger, db *sql.DB, userID string) *time.Location {
+	timezone, pinned, err := cgbdb.GetDailyRewardTimezone(ctx, db, userID)
+	if err != nil {
+		logger.Warn("Get timezone user %s error %s", userID, err.Error())
+		pinned = &entity.DailyRewardTimezone{}
+	}
+	appPackage := ""
+	if vars, ok := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string); ok {
+		appPackage = vars["app_package"]
+	}
+	userLoc := entity.DailyRewardLocation(timezone, appPackage)
+	if err != nil {
+		return userLoc
+	}
+	if pinned.Resolve(userLoc.String(), time.Now()) {
+		if err := cgbdb.SaveDailyRewardTimezone(ctx, db, userID, pinned); err != nil {
+			logger.Warn("Save daily reward timezone user %s error %s", userID, err.Error())
+		}
+	}
+	return pinned.Location()
 }
 
 func RpcCanClaimDailyReward() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		req := &entity.DailyRewardCalendarRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
 		reward, err := proccessDailyReward(ctx, logger, nk, db)
 		if err != nil {
 			logger.Error("proccessDailyReward error ", err.Error())
 			return "", err
 		}
+		if req.Calendar {
+			return dailyRewardCalendar(ctx, logger, db, nk, reward)
+		}
 		return RewardToString(reward, logger)
 	}
 }
@@ -176,8 +218,43 @@ func RpcClaimDailyReward() func(context.Context, runtime.Logger, *sql.DB, runtim
 			return "", err
 		}
 		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		// claim and day streak are saved with wallet update in claim outbox, worker retry if wallet fail
+		now := time.Now()
+		loc := dailyRewardLocation(ctx, logger, db, userID)
+		day := entity.DailyRewardDay(now, loc)
+		secFromMidnight := now.Unix() - entity.Midnight(now, loc).Unix()
+		freeze, err := readStreakFreeze(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Read streak freeze user %s error %s", userID, err.Error())
+			return "", presenter.ErrInternalError
+		}
+		metadata := make(map[string]interface{})
+		metadata["action"] = entity.WalletActionDailyReward
+		metadata["sender"] = constant.UUID_USER_SYSTEM
+		metadata["recv"] = userID
+		update, outbox, err := cgbdb.AddDailyRewardClaim(ctx, logger, db, userID, day, secFromMidnight, reward.Streak, reward.TotalChip,
+			freeze, metadata, func(update *entity.DailyRewardStreakUpdate) error {
+				return updateStreakFreeze(ctx, logger, nk, userID, update)
+			})
+		if status.Code(err) == codes.AlreadyExists {
+			// claim committed before but last claim not saved, apply it again instead of paying twice
+			claimErr := err
+			outbox, err = cgbdb.GetClaimOutboxByKey(ctx, logger, db, userID, entity.DailyRewardClaimKey(day, reward.Streak))
+			if err == nil && outbox == nil {
+				return "", runtime.NewError(status.Convert(claimErr).Message(), presenter.ErrInvalidInput.Code)
+			}
+		}
+		if err != nil {
+			logger.Error("Add daily reward claim user %s error %s", userID, err.Error())
+			return "", err
+		}
+		if update != nil {
+			logger.Info("Daily reward streak user %s day %s frozen %v grace %v reset %v earn freeze %v",
+				userID, update.Day, update.FrozenDays, update.Grace, update.Reset, update.EarnFreeze)
+		}
+
 		savelastClaim := &pb.LastClaimReward{
-			LastClaimUnix:  time.Now().Unix(),
+			LastClaimUnix:  now.Unix(),
 			NextClaimUnix:  0,
 			Streak:         reward.Streak,
 			LastSpinNumber: 0,
@@ -189,16 +266,10 @@ func RpcClaimDailyReward() func(context.Context, runtime.Logger, *sql.DB, runtim
 			version = lastClaimObject.GetVersion()
 		}
 		SaveLastClaimReward(ctx, nk, logger, savelastClaim, version, userID)
-		wallet := lib.Wallet{
-			Chips: reward.TotalChip,
+		if err := ApplyClaimOutbox(ctx, logger, db, nk, outbox.Id); err != nil {
+			logger.WithField("claim id", outbox.Id).WithField("err", err).Error("apply claim outbox failed, worker will retry")
 		}
 
-		metadata := make(map[string]interface{})
-		metadata["action"] = entity.WalletActionDailyReward
-		metadata["sender"] = constant.UUID_USER_SYSTEM
-		metadata["recv"] = userID
-		entity.AddChipWalletUser(ctx, nk, logger, userID, wallet, metadata)
-
 		reward, _ = proccessDailyReward(ctx, logger, nk, db)
 
 		reward.CanClaim = false
@@ -226,9 +297,10 @@ func proccessDailyReward(ctx context.Context, logger runtime.Logger, nk runtime.
 	if lastClaimObject != nil {
 		version = lastClaimObject.GetVersion()
 	}
-	t := time.Now()
-	midnightUnix := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local).Unix()
-	nextMidnightUnix := midnightUnix + 86400
+	midnight := entity.Midnight(time.Now(), dailyRewardLocation(ctx, logger, db, userID))
+	midnightUnix := midnight.Unix()
+	nextMidnightUnix := midnight.AddDate(0, 0, 1).Unix()
+	dailyRewardTemplate := getDailyRewardTemplate(ctx, logger, db)
 
 	needSaveLastClaim := false
 	if lastClaim.LastClaimUnix < midnightUnix {
@@ -247,7 +319,7 @@ func proccessDailyReward(ctx context.Context, logger runtime.Logger, nk runtime.
 	d.NumClaim = lastClaim.GetNumClaim()
 	// streak on ui start at 1, on sv start at 0
 	d.Streak = lastClaim.GetStreak() + 1
-	if d.NumClaim >= int64(len(DailyRewardTemplate.RewardTemplates)) ||
+	if d.NumClaim >= int64(len(dailyRewardTemplate.RewardTemplates)) ||
 		d.ReachMaxStreak {
 		if !d.ReachMaxStreak {
 			needSaveLastClaim = true
@@ -259,7 +331,7 @@ func proccessDailyReward(ctx context.Context, logger runtime.Logger, nk runtime.
 		}
 		return d, nil
 	}
-	if lastClaim.GetStreak() >= int64(len(DailyRewardTemplate.RewardTemplates)) {
+	if lastClaim.GetStreak() >= int64(len(dailyRewardTemplate.RewardTemplates)) {
 		d.NextClaimSec = 0
 		d.ReachMaxStreak = true
 		lastClaim.ReachMaxStreak = d.ReachMaxStreak
@@ -267,7 +339,11 @@ func proccessDailyReward(ctx context.Context, logger runtime.Logger, nk runtime.
 		return d, nil
 	}
 
-	rewardTemplate := DailyRewardTemplate.RewardTemplates[lastClaim.GetStreak()]
+	rewardTemplate := dailyRewardTemplate.RewardTemplates[lastClaim.GetStreak()]
+	// template may change after spin, spin again if slot not exist
+	if lastClaim.LastSpinNumber > int64(len(rewardTemplate.BasicChips)) {
+		lastClaim.LastSpinNumber = 0
+	}
 	if lastClaim.LastSpinNumber > 0 {
 		d.BasicChip = rewardTemplate.GetBasicChips()[lastClaim.LastSpinNumber-1]
 	} else {
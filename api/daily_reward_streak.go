@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/cgp-common/lib"
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/constant"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func dailyRewardCalendar(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, reward *pb.Reward) (string, error) {
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	today := entity.DailyRewardDay(time.Now(), dailyRewardLocation(ctx, logger, db, userID))
+	streak, err := getDailyRewardStreak(ctx, logger, db, nk, userID)
+	if err != nil {
+		return "", err
+	}
+	claimed, err := cgbdb.GetDailyRewardClaimHistory(ctx, logger, db, userID, entity.DailyRewardCalendarFrom(today))
+	if err != nil {
+		return "", err
+	}
+	calendar := &entity.DailyRewardCalendar{
+		Streak:         streak,
+		CanCatchUp:     streak.CanCatchUp(today),
+		CatchUpPrice:   entity.DailyRewardCatchUpPrice,
+		FreezePrice:    entity.DailyRewardFreezePrice,
+		Days:           entity.BuildDailyRewardCalendar(today, entity.DailyRewardCalendarDays, claimed),
+		CalendarToday:  today,
+		StreakGraceSec: entity.DailyRewardStreakGraceSec,
+	}
+	calendar.Reward, _ = protojson.Marshal(reward)
+	out, err := json.Marshal(calendar)
+	if err != nil {
+		logger.Error("Marshal daily reward calendar error %s", err.Error())
+		return "", presenter.ErrMarshal
+	}
+	return string(out), nil
+}
+
+// readStreakFreeze number of streak freeze in wallet of user
+func readStreakFreeze(ctx context.Context, nk runtime.NakamaModule, userID string) (int64, error) {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	wallet := make(map[string]int64)
+	if account.GetWallet() != "" {
+		if err := json.Unmarshal([]byte(account.GetWallet()), &wallet); err != nil {
+			return 0, err
+		}
+	}
+	return wallet[entity.WalletKeyStreakFreeze], nil
+}
+
+// getDailyRewardStreak streak from db with freeze from wallet
+func getDailyRewardStreak(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userID string) (*entity.DailyRewardStreak, error) {
+	streak, err := cgbdb.GetDailyRewardStreak(ctx, logger, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	streak.Freeze, err = readStreakFreeze(ctx, nk, userID)
+	if err != nil {
+		logger.Error("Read streak freeze user %s error %s", userID, err.Error())
+		return nil, presenter.ErrInternalError
+	}
+	return streak, nil
+}
+
+// updateStreakFreeze take freeze used to cover missed days and add freeze earned from wallet,
+// fail if user no longer own the freeze used.
+func updateStreakFreeze(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, update *entity.DailyRewardStreakUpdate) error {
+	change := -int64(len(update.FrozenDays))
+	if update.EarnFreeze {
+		change++
+	}
+	if change == 0 {
+		return nil
+	}
+	metadata := make(map[string]interface{})
+	metadata["action"] = entity.WalletActionDailyRewardStreak
+	metadata["sender"] = constant.UUID_USER_SYSTEM
+	metadata["recv"] = userID
+	metadata["item"] = entity.DailyRewardClaimKindFreeze
+	metadata["frozen_days"] = update.FrozenDays
+	if _, _, err := nk.WalletUpdate(ctx, userID, map[string]int64{entity.WalletKeyStreakFreeze: change}, metadata, true); err != nil {
+		logger.WithField("err", err).Error("Update streak freeze user %s error", userID)
+		return presenter.ErrInternalError
+	}
+	return nil
+}
+
+// payDailyRewardStreak deduct chips of user, return refund func to call if save streak fail
+func payDailyRewardStreak(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, chips int64, item string) (func(), error) {
+	metadata := make(map[string]interface{})
+	metadata["action"] = entity.WalletActionDailyRewardStreak
+	metadata["sender"] = userID
+	metadata["recv"] = constant.UUID_USER_SYSTEM
+	metadata["item"] = item
+	if err := entity.AddChipWalletUser(ctx, nk, logger, userID, lib.Wallet{Chips: -chips}, metadata); err != nil {
+		logger.Error("Pay %s user %s error %s", item, userID, err.Error())
+		return nil, presenter.ErrNotEnoughChip
+	}
+	refund := func() {
+		metadata := make(map[string]interface{})
+		metadata["action"] = entity.WalletActionDailyRewardStreak
+		metadata["sender"] = constant.UUID_USER_SYSTEM
+		metadata["recv"] = userID
+		metadata["item"] = item
+		metadata["refund"] = true
+		if err := entity.AddChipWalletUser(ctx, nk, logger, userID, lib.Wallet{Chips: chips}, metadata); err != nil {
+			logger.Error("Refund %s user %s chips %d error %s", item, userID, chips, err.Error())
+		}
+	}
+	return refund, nil
+}
+
+func dailyRewardStreakError(err error) error {
+	if status.Code(err) == codes.FailedPrecondition {
+		return runtime.NewError(status.Convert(err).Message(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// RpcDailyRewardCatchUp pay chips to restore yesterday if it is the only missed day
+func RpcDailyRewardCatchUp() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok {
+			return "", errors.New("Missing user ID.")
+		}
+		today := entity.DailyRewardDay(time.Now(), dailyRewardLocation(ctx, logger, db, userID))
+		var refund func()
+		streak, err := cgbdb.CatchUpDailyReward(ctx, logger, db, userID, today, func() error {
+			var err error
+			refund, err = payDailyRewardStreak(ctx, logger, nk, userID, entity.DailyRewardCatchUpPrice, entity.DailyRewardClaimKindCatchUp)
+			return err
+		})
+		if err != nil {
+			if refund != nil {
+				refund()
+			}
+			return "", dailyRewardStreakError(err)
+		}
+		streak.Freeze, _ = readStreakFreeze(ctx, nk, userID)
+		out, _ := json.Marshal(streak)
+		return string(out), nil
+	}
+}
+
+// RpcDailyRewardBuyFreeze pay chips for one streak freeze, freeze is kept in wallet
+func RpcDailyRewardBuyFreeze() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok {
+			return "", errors.New("Missing user ID.")
+		}
+		freeze, err := readStreakFreeze(ctx, nk, userID)
+		if err != nil {
+			logger.Error("Read streak freeze user %s error %s", userID, err.Error())
+			return "", presenter.ErrInternalError
+		}
+		if freeze >= entity.DailyRewardFreezeMax {
+			return "", runtime.NewError(entity.ErrDailyRewardFreezeFull.Error(), presenter.ErrInvalidInput.Code)
+		}
+		metadata := make(map[string]interface{})
+		metadata["action"] = entity.WalletActionDailyRewardStreak
+		metadata["sender"] = userID
+		metadata["recv"] = constant.UUID_USER_SYSTEM
+		metadata["item"] = entity.DailyRewardClaimKindFreeze
+		changeset := map[string]int64{
+			"chips":                      -entity.DailyRewardFreezePrice,
+			entity.WalletKeyStreakFreeze: 1,
+		}
+		updated, _, err := nk.WalletUpdate(ctx, userID, changeset, metadata, true)
+		if err != nil {
+			logger.Error("Pay %s user %s error %s", entity.DailyRewardClaimKindFreeze, userID, err.Error())
+			return "", presenter.ErrNotEnoughChip
+		}
+		// parallel buy pass the check above together, give back the extra one
+		if updated[entity.WalletKeyStreakFreeze] > entity.DailyRewardFreezeMax {
+			metadata["sender"] = constant.UUID_USER_SYSTEM
+			metadata["recv"] = userID
+			metadata["refund"] = true
+			changeset["chips"] = entity.DailyRewardFreezePrice
+			changeset[entity.WalletKeyStreakFreeze] = -1
+			if _, _, err := nk.WalletUpdate(ctx, userID, changeset, metadata, true); err != nil {
+				logger.Error("Refund %s user %s error %s", entity.DailyRewardClaimKindFreeze, userID, err.Error())
+			}
+			return "", runtime.NewError(entity.ErrDailyRewardFreezeFull.Error(), presenter.ErrInvalidInput.Code)
+		}
+		streak, err := getDailyRewardStreak(ctx, logger, db, nk, userID)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(streak)
+		return string(out), nil
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+// runtime env, default timezone of daily reward per app package, ex "com.app.a=Africa/Lagos,=Africa/Lagos"
+const envDailyRewardTimezone = "daily_reward_timezone"
+
+func InitDailyRewardTimezone(ctx context.Context, logger runtime.Logger) {
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	entity.DefaultTimezoneByAppPackage = entity.ParseTimezoneByAppPackage(env[envDailyRewardTimezone])
+	logger.Info("Daily reward default timezone %v", entity.DefaultTimezoneByAppPackage)
+}
+
+// RpcAddDailyRewardTemplate add new version of template, same name increase version
+func RpcAddDailyRewardTemplate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		template := &entity.DailyRewardTemplateVersion{}
+		if err := json.Unmarshal([]byte(payload), template); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if template.Name == "" {
+			return "", presenter.ErrInvalidInput
+		}
+		if err := entity.ValidateDailyRewardTiers(template.Tiers); err != nil {
+			logger.Error("Invalid daily reward template %s: %s", template.Name, err.Error())
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		if err := entity.ValidateDailyRewardSchedule(template.StartTimeUnix, template.EndTimeUnix); err != nil {
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		template, err := cgbdb.AddDailyRewardTemplate(ctx, logger, db, template)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(template)
+		return string(out), nil
+	}
+}
+
+// RpcScheduleDailyRewardTemplate set active window of a template version,
+// zero start and end make it default template.
+func RpcScheduleDailyRewardTemplate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.DailyRewardTemplateVersion{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.Id <= 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		if err := entity.ValidateDailyRewardSchedule(req.StartTimeUnix, req.EndTimeUnix); err != nil {
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		if err := cgbdb.ScheduleDailyRewardTemplate(ctx, logger, db, req.Id, req.StartTimeUnix, req.EndTimeUnix, req.Disabled); err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(req)
+		return string(out), nil
+	}
+}
+
+func RpcListDailyRewardTemplate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.DailyRewardTemplateVersion{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		ml, err := cgbdb.GetListDailyRewardTemplate(ctx, logger, db, req.Name)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListDailyRewardTemplateVersion{Templates: ml})
+		return string(out), nil
+	}
+}
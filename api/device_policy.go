@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+const (
+	kDevicePolicyCollection = "device-policy-collection"
+	kDevicePolicyKey        = "device-policy-key"
+	// policy changed by admin is used after this time
+	devicePolicyReload = time.Minute
+)
+
+var devicePolicyCache struct {
+	sync.Mutex
+	policy   *entity.DevicePolicy
+	loadTime time.Time
+}
+
+// getDevicePolicy policy from storage, default single device if not set. Keep old policy if reload fail.
+func getDevicePolicy(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) *entity.DevicePolicy {
+	devicePolicyCache.Lock()
+	defer devicePolicyCache.Unlock()
+	if devicePolicyCache.policy != nil && time.Since(devicePolicyCache.loadTime) < devicePolicyReload {
+		return devicePolicyCache.policy
+	}
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: kDevicePolicyCollection,
+		Key:        kDevicePolicyKey,
+	}})
+	if err != nil {
+		logger.WithField("err", err).Error("read device policy failed")
+		if devicePolicyCache.policy == nil {
+			return entity.DefaultDevicePolicy()
+		}
+		return devicePolicyCache.policy
+	}
+	policy := entity.DefaultDevicePolicy()
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), policy); err != nil {
+			logger.WithField("err", err).Error("unmarshal device policy failed")
+			policy = entity.DefaultDevicePolicy()
+		}
+	}
+	devicePolicyCache.policy = policy
+	devicePolicyCache.loadTime = time.Now()
+	return policy
+}
+
+// maxSessionsOfUser sessions user can have at the same time
+func maxSessionsOfUser(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userId string) int {
+	policy := getDevicePolicy(ctx, logger, nk)
+	var vipLevel int64
+	if policy.NeedVipLevel() {
+		profile, _, err := cgbdb.GetProfileUser(ctx, db, userId, nil)
+		if err != nil {
+			logger.WithField("err", err).WithField("user", userId).Error("get profile for device policy failed")
+		} else {
+			vipLevel = profile.GetVipLevel()
+		}
+	}
+	return policy.MaxSessionsOf(userId, vipLevel)
+}
+
+// sessionDevice device id and platform in session vars, set at login
+func sessionDevice(ctx context.Context) (string, string) {
+	vars, _ := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string)
+	return entity.NormalizeDevice(vars[entity.DeviceVarId], vars[entity.DeviceVarPlatform])
+}
+
+// checkNewDevice block login from device not in registry of flagged account,
+// account is flagged by device lock sanction or refer fraud review pending.
+// Db error does not block user.
+func checkNewDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, deviceId string) error {
+	if userId == "" || deviceId == "" {
+		return nil
+	}
+	known, err := cgbdb.IsKnownUserDevice(ctx, db, userId, deviceId)
+	if err != nil {
+		logger.WithField("err", err).WithField("user", userId).Error("check known device failed")
+		return nil
+	}
+	if known {
+		return nil
+	}
+	lock, err := cgbdb.GetActiveSanction(ctx, db, userId, entity.SanctionKindDeviceLock)
+	if err != nil {
+		logger.WithField("err", err).WithField("user", userId).Error("check device lock failed")
+	}
+	if lock != nil {
+		return runtime.NewError(lock.Message(), presenter.ErrNewDeviceBlocked.Code)
+	}
+	flagged, err := cgbdb.HasOpenReferReview(ctx, db, userId)
+	if err != nil {
+		logger.WithField("err", err).WithField("user", userId).Error("check refer review failed")
+	}
+	if flagged {
+		logger.Info("Block login of flagged user %s from new device %s", userId, deviceId)
+		return runtime.NewError(entity.ErrDeviceNewBlock.Error(), presenter.ErrNewDeviceBlocked.Code)
+	}
+	return nil
+}
+
+// checkRevokedDevice reject login from device revoked by user. Db error does not block user.
+func checkRevokedDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, deviceId string) error {
+	if userId == "" || deviceId == "" {
+		return nil
+	}
+	revoked, err := cgbdb.IsRevokedUserDevice(ctx, db, userId, deviceId)
+	if err != nil {
+		logger.WithField("err", err).WithField("user", userId).Error("check revoked device failed")
+		return nil
+	}
+	if revoked {
+		logger.Info("Block login of user %s from revoked device %s", userId, deviceId)
+		return runtime.NewError(entity.ErrDeviceRevoked.Error(), presenter.ErrDeviceRevoked.Code)
+	}
+	return nil
+}
+
+// registerDevice save device and tokens of login to registry
+func registerDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, vars map[string]string, out *nkapi.Session) {
+	deviceId, platform := entity.NormalizeDevice(vars[entity.DeviceVarId], vars[entity.DeviceVarPlatform])
+	if userId == "" || deviceId == "" {
+		return
+	}
+	_ = cgbdb.UpsertUserDevice(ctx, logger, db, userId, deviceId, platform, out.GetToken(), out.GetRefreshToken())
+}
+
+func AfterAuthFacebook(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *nkapi.Session, in *nkapi.AuthenticateFacebookRequest) error {
+	userID, err := getUserIDFromToken(out.Token)
+	if err != nil {
+		logger.Error("Failed to parse user ID from token: %v", err)
+		return err
+	}
+	// token is verified now, session of blocked login is logged out before client can use it
+	if err := checkFacebookLogin(ctx, logger, db, userID, in); err != nil {
+		if err := nk.SessionLogout(userID, out.Token, out.RefreshToken); err != nil {
+			logger.WithField("err", err).WithField("user", userID).Error("logout blocked facebook login failed")
+		}
+		return err
+	}
+	cacheFacebookToken(in.GetAccount().GetToken(), userID)
+	registerDevice(ctx, logger, db, userID, in.GetAccount().GetVars(), out)
+	deviceId, _ := entity.NormalizeDevice(in.GetAccount().GetVars()[entity.DeviceVarId], "")
+	saveLastLoginDevice(ctx, logger, db, userID, deviceId)
+	return nil
+}
+
+// afterSessionRefresh save new tokens of device, session refreshed by revoked device is logged out
+func afterSessionRefresh(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, out *nkapi.Session, in *nkapi.SessionRefreshRequest) error {
+	userID, deviceId, err := getUserDeviceFromToken(out.GetToken())
+	if err != nil {
+		logger.Error("Failed to parse user ID from token: %v", err)
+		return err
+	}
+	if deviceId == "" {
+		return nil
+	}
+	revoked, err := cgbdb.UpdateUserDeviceToken(ctx, logger, db, userID, deviceId, out.GetToken(), out.GetRefreshToken())
+	if err != nil || !revoked {
+		return err
+	}
+	logger.Info("Logout refreshed session of revoked device %s user %s", deviceId, userID)
+	if err := nk.SessionLogout(userID, out.GetToken(), out.GetRefreshToken()); err != nil {
+		logger.WithField("err", err).WithField("user", userID).Error("logout revoked device failed")
+	}
+	return runtime.NewError(entity.ErrDeviceRevoked.Error(), presenter.ErrDeviceRevoked.Code)
+}
+
+// enforceDevicePolicy at session start, disconnect revoked device and sessions over max sessions of user.
+// Single device user keep old behavior, other sessions get notification to logout.
+func enforceDevicePolicy(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userID, sessionID string) {
+	if deviceId, platform := sessionDevice(ctx); deviceId != "" {
+		revoked, err := cgbdb.TouchUserDevice(ctx, logger, db, userID, deviceId, platform, sessionID)
+		if err == nil && revoked {
+			logger.Info("Disconnect session %s of revoked device %s user %s", sessionID, deviceId, userID)
+			if err := nk.SessionDisconnect(ctx, sessionID, runtime.PresenceReasonDisconnect); err != nil {
+				logger.WithField("err", err).Error("nk.SessionDisconnect error.")
+			}
+			return
+		}
+	}
+	presences, err := nk.StreamUserList(streamModeNotification, userID, "", "", true, true)
+	if err != nil {
+		logger.WithField("err", err).Error("nk.StreamUserList error.")
+		return
+	}
+	maxSessions := maxSessionsOfUser(ctx, logger, db, nk, userID)
+	if maxSessions <= 1 {
+		notifySingleDevice(ctx, logger, db, nk, userID, sessionID, presences)
+		return
+	}
+	lastSeen := make(map[string]int64)
+	if devices, err := cgbdb.ListUserDevice(ctx, logger, db, userID); err == nil {
+		for _, d := range devices {
+			lastSeen[d.SessionId] = d.LastSeenUnix
+		}
+	}
+	sessions := make([]*entity.DeviceSession, 0, len(presences))
+	for _, presence := range presences {
+		sessions = append(sessions, &entity.DeviceSession{
+			SessionId:    presence.GetSessionId(),
+			LastSeenUnix: lastSeen[presence.GetSessionId()],
+		})
+	}
+	for _, id := range entity.ExcessSessions(sessions, sessionID, maxSessions) {
+		if err := nk.SessionDisconnect(ctx, id, runtime.PresenceReasonDisconnect); err != nil {
+			logger.WithField("err", err).Error("nk.SessionDisconnect error.")
+			continue
+		}
+		logger.WithField("session id", id).Debug("Disconnect session over max sessions")
+	}
+}
+
+// logoutSessionIds sessions closed when user logout, all sessions for single device user,
+// only session of logout device if user can have many sessions
+func logoutSessionIds(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userID string, presences []runtime.Presence) []string {
+	ids := make([]string, 0, len(presences))
+	deviceId, _ := sessionDevice(ctx)
+	if deviceId != "" && maxSessionsOfUser(ctx, logger, db, nk, userID) > 1 {
+		devices, err := cgbdb.ListUserDevice(ctx, logger, db, userID)
+		if err == nil {
+			for _, d := range devices {
+				if d.DeviceId == deviceId && d.SessionId != "" {
+					ids = append(ids, d.SessionId)
+				}
+			}
+			return ids
+		}
+	}
+	for _, presence := range presences {
+		ids = append(ids, presence.GetSessionId())
+	}
+	return ids
+}
+
+func RpcListDevices() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userID == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		devices, err := cgbdb.ListUserDevice(ctx, logger, db, userID)
+		if err != nil {
+			return "", err
+		}
+		current, _ := sessionDevice(ctx)
+		for _, d := range devices {
+			d.Current = d.DeviceId == current
+		}
+		out, _ := json.Marshal(&entity.ListUserDevice{Devices: devices})
+		return string(out), nil
+	}
+}
+
+// RpcRevokeDevice user sign out other device, device must login again
+func RpcRevokeDevice() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userID == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		req := &entity.DeviceRevokeRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.DeviceId == "" {
+			return "", runtime.NewError(entity.ErrDeviceId.Error(), presenter.ErrInvalidInput.Code)
+		}
+		if current, _ := sessionDevice(ctx); current == req.DeviceId {
+			return "", runtime.NewError(entity.ErrDeviceCurrent.Error(), presenter.ErrInvalidInput.Code)
+		}
+		device, err := cgbdb.RevokeUserDevice(ctx, logger, db, userID, req.DeviceId)
+		if err != nil {
+			return "", err
+		}
+		// empty tokens would logout every session of user
+		if device.Token != "" || device.RefreshToken != "" {
+			if err := nk.SessionLogout(userID, device.Token, device.RefreshToken); err != nil {
+				logger.WithField("err", err).WithField("user", userID).Error("logout revoked device failed")
+			}
+		}
+		if device.SessionId != "" {
+			// session may be closed already
+			_ = nk.SessionDisconnect(ctx, device.SessionId, runtime.PresenceReasonDisconnect)
+		}
+		// device auth by this device id create new account, unlink fail if it is the only login of user
+		if linked, err := cgbdb.GetUserIdByDevice(ctx, db, req.DeviceId); err == nil && linked == userID {
+			if err := nk.UnlinkDevice(ctx, userID, req.DeviceId); err != nil {
+				logger.WithField("err", err).WithField("user", userID).Warn("unlink revoked device failed")
+			}
+		}
+		logger.Info("User %s revoke device %s", userID, req.DeviceId)
+		return `{"result":"ok"}`, nil
+	}
+}
+
+func RpcGetDevicePolicy() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		out, _ := json.Marshal(getDevicePolicy(ctx, logger, nk))
+		return string(out), nil
+	}
+}
+
+func RpcSetDevicePolicy() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		policy := &entity.DevicePolicy{}
+		if err := json.Unmarshal([]byte(payload), policy); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := policy.Validate(); err != nil {
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		out, _ := json.Marshal(policy)
+		_, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+			Collection:      kDevicePolicyCollection,
+			Key:             kDevicePolicyKey,
+			Value:           string(out),
+			PermissionRead:  0,
+			PermissionWrite: 0,
+		}})
+		if err != nil {
+			logger.Error("StorageWrite error: %v", err)
+			return "", presenter.ErrInternalError
+		}
+		devicePolicyCache.Lock()
+		devicePolicyCache.policy = policy
+		devicePolicyCache.loadTime = time.Now()
+		devicePolicyCache.Unlock()
+		return string(out), nil
+	}
+}
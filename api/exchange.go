@@ -9,6 +9,7 @@ import (
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 )
 
@@ -160,6 +161,9 @@ func RpcRequestNewExchange() func(context.Context, runtime.Logger, *sql.DB, runt
 			logger.Error("Missing cash info")
 			return "", errors.New("missing cash info")
 		}
+		if err := checkSanction(ctx, logger, db, userID, entity.SanctionKindCashOutBlock); err != nil {
+			return "", err
+		}
 		// check valid id deal
 		deal, err := GetExchangeDealFromId(exChangedealReq.Id)
 		if err != nil {
@@ -12,6 +12,7 @@ import (
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"github.com/nk-nigeria/cgp-common/lib"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 )
@@ -111,6 +112,21 @@ func RpcExchangeUpdateStatus() func(context.Context, runtime.Logger, *sql.DB, ru
 		}
 		sarshaler := conf.MarshalerDefault
 		strJson, _ := sarshaler.Marshal(exchangeDB)
+		{
+			tplId := entity.NotiTplExchangeDone
+			if exchangeDB.GetStatus() == int64(pb.ExchangeStatus_EXCHANGE_STATUS_REJECT.Number()) {
+				tplId = entity.NotiTplExchangeReject
+			}
+			err := newNotiRenderer(logger, db).Send(ctx, nk, tplId, exchangeDB.GetUserIdRequest(), pb.TypeNotification_GIFT, entity.NotiCategoryTransfer,
+				map[string]interface{}{
+					"id":     exchangeDB.GetId(),
+					"chips":  exchangeDB.GetChips(),
+					"reason": exchangeDB.GetReason(),
+				})
+			if err != nil {
+				logger.Warn("Add exchange %s noti err %s", exchangeDB.GetId(), err.Error())
+			}
+		}
 		if exchangeDB.GetStatus() == int64(pb.ExchangeStatus_EXCHANGE_STATUS_DONE.Number()) {
 			props := make(map[string]string)
 			props["user_id"] = exchangeDB.GetUserIdRequest()
@@ -13,7 +13,6 @@ import (
 	"github.com/nk-nigeria/lobby-module/constant"
 	"github.com/nk-nigeria/lobby-module/entity"
 
-	"github.com/nk-nigeria/cgp-common/lib"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 
 	"github.com/heroiclabs/nakama-common/runtime"
@@ -102,15 +101,8 @@ func RpcMarkAcceptListFreeChip(marshaler *proto.MarshalOptions, unmarshaler *pro
 			if err != nil {
 				logger.WithField("err", err).WithField("user sid", userSid).Error("get account failed")
 			} else {
-				noti := pb.Notification{
-					RecipientId: account.User.Id,
-					Type:        pb.TypeNotification_GIFT,
-					Title:       "Freechip",
-					Content:     "Freechip",
-					SenderId:    "",
-					Read:        false,
-				}
-				err = cgbdb.AddNotification(ctx, logger, db, nk, &noti)
+				err = newNotiRenderer(logger, db).Send(ctx, nk, entity.NotiTplFreeChipReady, account.User.Id, pb.TypeNotification_GIFT, entity.NotiCategoryReward,
+					map[string]interface{}{"chips": freeChip.GetChips()})
 				if err != nil {
 					logger.Warn("Add freechip noti err %s, body %s",
 						err.Error(), freeChip.String())
@@ -139,69 +131,55 @@ func RpcClaimFreeChip(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmars
 			return "", presenter.ErrNoUserIdFound
 		}
 		req.RecipientId = strconv.FormatInt(account.Sid, 10)
-		freeChip, err := cgbdb.ClaimFreeChip(ctx, logger, db, req.Id, req.RecipientId)
+		freeChip, outbox, err := cgbdb.ClaimFreeChip(ctx, logger, db, req.Id, req.RecipientId, userID)
 		if err != nil {
-			if freeChip == nil {
-				freeChip = &pb.FreeChip{}
-			}
-			logger.WithField("user id", userID).WithField("freechip id", freeChip.Id).WithField("err", err).Error("claim free chip failed")
+			logger.WithField("user id", userID).WithField("freechip id", req.Id).WithField("err", err).Error("claim free chip failed")
 			return "", err
 		}
-		wallet := lib.Wallet{
-			Chips:  freeChip.Chips,
-			UserId: userID,
-		}
-		metadata := make(map[string]interface{})
-		metadata["action"] = entity.WalletActionFreeChip
-		if freeChip.GetAction() != "" {
-			metadata["action"] = freeChip.GetAction()
-		}
-		metadata["sender"] = freeChip.GetSenderId()
-		metadata["recv"] = userID
-
-		err = entity.AddChipWalletUser(ctx, nk, logger, userID, wallet, metadata)
-		if err != nil {
-			logger.Error("Add chip user %s, after claim freechip error %s", userID, err.Error())
-			return "", err
+		if outbox.Status == entity.ClaimOutboxStatusPending {
+			// worker retry if apply failed, chips is not lost
+			if err := ApplyClaimOutbox(ctx, logger, db, nk, outbox.Id); err != nil {
+				logger.WithField("claim id", outbox.Id).WithField("err", err).Warn("apply claim freechip failed, wait worker retry")
+			}
 		}
-		logger.Info("User %s claim %d from %s", userID, freeChip.Chips, freeChip.SenderId)
-		freeChip.Claimable = false
 		freeChipStr, _ := conf.MarshalerDefault.Marshal(freeChip)
-		// emit event to doris
-		{
-			metadata["chips"] = strconv.Itoa(int(freeChip.Chips))
-			metadata["user_id"] = userID
-			payload, _ := json.Marshal(metadata)
-			report := lib.NewReportGame(ctx)
-			data, _, err := report.ReportEvent(ctx, "send-chip", userID, string(payload))
-			logger.WithField("err", err).Info("Report event send-chip user %s , data %s, repsonse %s",
-				userID, string(payload), string(data))
-
-		}
 		return string(freeChipStr), nil
 	}
 }
 
+// listClaimableFreeChip freechips user can claim now, with expire time
+func listClaimableFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB) (*entity.ListClaimableFreeChip, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok {
+		return nil, errors.New("Missing user ID.")
+	}
+	account, err := cgbdb.GetAccount(ctx, db, userID, 0)
+	if err != nil {
+		logger.WithField("user id", userID).WithField("err", err).Error("get account failed")
+		return nil, presenter.ErrNoUserIdFound
+	}
+	return cgbdb.GetFreeChipClaimableByUser(ctx, logger, db, strconv.FormatInt(account.Sid, 10))
+}
+
 func RpcListClaimableFreeChip(marshaler *proto.MarshalOptions, unmarshaler *proto.UnmarshalOptions) func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
-		if !ok {
-			return "", errors.New("Missing user ID.")
-		}
-		freeChip := &pb.FreeChip{}
-		{
-			account, err := cgbdb.GetAccount(ctx, db, userID, 0)
-			if err != nil {
-				logger.WithField("user id", userID).WithField("err", err).Error("get account failed")
-				return "", presenter.ErrNoUserIdFound
-			}
-			freeChip.RecipientId = strconv.FormatInt(account.Sid, 10)
+		list, err := listClaimableFreeChip(ctx, logger, db)
+		if err != nil {
+			return "", err
 		}
-		list, err := cgbdb.GetFreeChipClaimableByUser(ctx, logger, db, freeChip.RecipientId)
+		listFreeChipStr, _ := conf.MarshalerDefault.Marshal(list.ToPb())
+		return string(listFreeChipStr), nil
+	}
+}
+
+// RpcListClaimableFreeChipExpire same list as list_claimable_freechip in json, include expire time and remain time
+func RpcListClaimableFreeChipExpire() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		list, err := listClaimableFreeChip(ctx, logger, db)
 		if err != nil {
 			return "", err
 		}
-		listFreeChipStr, _ := conf.MarshalerDefault.Marshal(list)
+		listFreeChipStr, _ := json.Marshal(list)
 		return string(listFreeChipStr), nil
 	}
 }
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/constant"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+func RpcAddFreeChipCampaign() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		campaign := &entity.FreeChipCampaign{}
+		if err := json.Unmarshal([]byte(payload), campaign); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if campaign.Chips <= 0 || campaign.Chips > constant.MaxChipAllowAdd || campaign.Budget <= 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		if campaign.UserGroupId <= 0 && len(campaign.RecipientIds) == 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		if campaign.ExpireTimeUnix > 0 && campaign.ExpireTimeUnix <= time.Now().Unix() {
+			return "", presenter.ErrInvalidInput
+		}
+		// sid -> user id
+		recipients, err := resolveFreeChipCampaignRecipients(ctx, logger, db, campaign)
+		if err != nil {
+			return "", err
+		}
+		sids := make([]int64, 0, len(recipients))
+		for sid := range recipients {
+			sids = append(sids, sid)
+		}
+		sort.Slice(sids, func(i, j int) bool { return sids[i] < sids[j] })
+		granted, err := cgbdb.AddFreeChipCampaign(ctx, logger, db, campaign, sids)
+		if err != nil {
+			logger.WithField("err", err).Error("add freechip campaign failed")
+			return "", err
+		}
+		var expire time.Time
+		if campaign.ExpireTimeUnix > 0 {
+			expire = time.Unix(campaign.ExpireTimeUnix, 0)
+		}
+		renderer := newNotiRenderer(logger, db)
+		if campaign.Template == "" {
+			userIds := make([]string, 0, len(granted))
+			for _, sid := range granted {
+				userIds = append(userIds, recipients[sid])
+			}
+			renderer.LoadLang(ctx, userIds...)
+		}
+		for _, sid := range granted {
+			var err error
+			// message of campaign override system template
+			if campaign.Template != "" {
+				err = cgbdb.AddCategoryNotification(ctx, logger, db, nk, &pb.Notification{
+					RecipientId: recipients[sid],
+					Type:        pb.TypeNotification_GIFT,
+					Title:       campaign.Title,
+					Content: entity.RenderFreeChipTemplate(campaign.Template, campaign.Chips,
+						expire, strconv.FormatInt(sid, 10)),
+					SenderId: "",
+					Read:     false,
+				}, entity.NotiCategoryReward)
+			} else {
+				err = renderer.Send(ctx, nk, entity.NotiTplFreeChipCampaign, recipients[sid], pb.TypeNotification_GIFT, entity.NotiCategoryReward,
+					map[string]interface{}{
+						"chips":  campaign.Chips,
+						"expire": expire,
+						"sid":    strconv.FormatInt(sid, 10),
+					})
+			}
+			if err != nil {
+				logger.Warn("Add freechip campaign %d noti user %s err %s",
+					campaign.Id, recipients[sid], err.Error())
+			}
+		}
+		logger.Info("Freechip campaign %d granted %d, skipped %d", campaign.Id, campaign.NumGranted, campaign.NumSkipped)
+		dataJson, _ := json.Marshal(campaign)
+		return string(dataJson), nil
+	}
+}
+
+func RpcGetFreeChipCampaign() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.FreeChipCampaign{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		campaign, err := cgbdb.GetFreeChipCampaign(ctx, logger, db, req.Id)
+		if err != nil {
+			return "", err
+		}
+		dataJson, _ := json.Marshal(campaign)
+		return string(dataJson), nil
+	}
+}
+
+// RpcRevokeFreeChip revoke one freechip by id, or all unclaimed freechip of a campaign
+func RpcRevokeFreeChip() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.FreeChipRevokeRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		var revoked int64 = 0
+		switch {
+		case req.CampaignId > 0:
+			var err error
+			revoked, err = cgbdb.RevokeFreeChipCampaign(ctx, logger, db, req.CampaignId)
+			if err != nil {
+				return "", err
+			}
+		case req.Id > 0:
+			if err := cgbdb.RevokeFreeChip(ctx, logger, db, req.Id); err != nil {
+				return "", err
+			}
+			revoked = 1
+		default:
+			return "", presenter.ErrInvalidInput
+		}
+		logger.Info("Revoke freechip id %d campaign %d, revoked %d", req.Id, req.CampaignId, revoked)
+		dataJson, _ := json.Marshal(map[string]int64{"revoked": revoked})
+		return string(dataJson), nil
+	}
+}
+
+func ExpireFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+	expired, err := cgbdb.ExpireFreeChip(ctx, logger, db)
+	if err != nil {
+		return
+	}
+	if expired > 0 {
+		logger.Info("Expired %d freechip", expired)
+	}
+}
+
+// resolveFreeChipCampaignRecipients return map sid -> user id of campaign recipients.
+// RecipientIds is sid or uuid.
+func resolveFreeChipCampaignRecipients(ctx context.Context, logger runtime.Logger, db *sql.DB, campaign *entity.FreeChipCampaign) (map[int64]string, error) {
+	recipients := make(map[int64]string)
+	userIds := make([]string, 0)
+	if campaign.UserGroupId > 0 {
+		ids, err := cgbdb.GetListUserIdsByUserGroup(ctx, logger, db, conf.Unmarshaler, campaign.UserGroupId)
+		if err != nil {
+			logger.Error("GetListUserIdsByUserGroup error %s", err.Error())
+			return nil, err
+		}
+		userIds = append(userIds, ids...)
+	}
+	for _, recipientId := range campaign.RecipientIds {
+		if userSid, _ := strconv.ParseInt(recipientId, 10, 64); userSid > 0 {
+			account, err := cgbdb.GetAccount(ctx, db, "", userSid)
+			if err != nil {
+				logger.WithField("recipient id", recipientId).WithField("err", err).Warn("get account failed")
+				continue
+			}
+			recipients[account.Sid] = account.User.Id
+			continue
+		}
+		userIds = append(userIds, recipientId)
+	}
+	// query sid by batch
+	batch := 1000
+	for i := 0; i < len(userIds); i += batch {
+		end := i + batch
+		if end > len(userIds) {
+			end = len(userIds)
+		}
+		sids, err := cgbdb.GetSidsByUserIds(ctx, db, userIds[i:end]...)
+		if err != nil {
+			logger.WithField("err", err).Error("get sid by user ids failed")
+			return nil, presenter.ErrInternalError
+		}
+		for userId, sid := range sids {
+			recipients[sid] = userId
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, presenter.ErrUserNotFound
+	}
+	return recipients, nil
+}
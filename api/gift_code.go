@@ -5,17 +5,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"strconv"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/conf"
-	"github.com/nk-nigeria/lobby-module/constant"
 	"github.com/nk-nigeria/lobby-module/entity"
-	"github.com/nk-nigeria/cgp-common/lib"
 	pb "github.com/nk-nigeria/cgp-common/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func RpcAddGiftCode() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
@@ -59,46 +58,121 @@ func RpcClaimGiftCode() func(context.Context, runtime.Logger, *sql.DB, runtime.N
 			logger.Error("Invalid payload")
 			return "", presenter.ErrUnmarshal
 		}
-		profile, _, err := cgbdb.GetProfileUser(ctx, db, userID, nil)
+		profile, metadata, err := cgbdb.GetProfileUser(ctx, db, userID, nil)
 		if err != nil {
 			logger.Error("Error when get user %s, err %s", userID, err.Error())
 			return "", presenter.ErrInternalError
 		}
+		claimer := &entity.GiftCodeClaimer{
+			UserId:   userID,
+			VipLevel: profile.GetVipLevel(),
+			DeviceId: entity.InterfaceToString(metadata["last_login_device_id"]),
+		}
+		attemptKeys := giftCodeAttemptKeys(ctx, claimer)
+		if err := checkGiftCodeAttemptLocked(ctx, logger, db, attemptKeys); err != nil {
+			return "", err
+		}
+		// code of campaign has check char, reject typo before query db.
+		// Code added by admin may have the same shape, only prefix of campaign is checked.
+		if code := entity.NormalizeGiftCode(giftCode.Code); entity.HasGiftCodeCampaignShape(code) && isGiftCodeCampaignPrefix(ctx, logger, db, code) {
+			if !entity.ValidGiftCodeChecksum(code) {
+				logger.Warn("User %s claim giftcode %s wrong checksum", userID, code)
+				addGiftCodeAttemptFail(ctx, logger, db, nk, attemptKeys, code)
+				return "", presenter.ErrGiftCodeInvalid
+			}
+			giftCode.Code = code
+		}
 		giftCode.UserId = userID
-		dbGiftCode, err := cgbdb.ClaimGiftCode(ctx, logger, db, giftCode, profile.GetVipLevel())
+		// retry of a claim return the stored result, rules may not pass any more after claim
+		claimed, err := cgbdb.GetClaimedGiftCode(ctx, logger, db, giftCode)
+		if err != nil && status.Code(err) != codes.NotFound {
+			logger.Error("GetClaimedGiftCode error %s", err.Error())
+			return "", err
+		}
+		if claimed != nil {
+			applyGiftCodeClaim(ctx, logger, db, nk, userID, claimed, attemptKeys)
+			out, _ := conf.MarshalerDefault.Marshal(claimed)
+			return string(out), nil
+		}
+		rules, err := cgbdb.GetGiftCodeRules(ctx, logger, db, giftCode.Code)
 		if err != nil {
-			logger.Error("ClaimGiftCode error %s", err.Error())
 			return "", err
 		}
-		if dbGiftCode.ErrCode == 0 {
-			wallet := lib.Wallet{
-				Chips: dbGiftCode.Value,
-			}
-			metadata := make(map[string]interface{})
-			metadata["action"] = entity.WalletActionGiftCode
-			metadata["sender"] = constant.UUID_USER_SYSTEM
-			metadata["recv"] = userID
-			// convert int64 to string because missing value when save to wallet metadata
-			// metadata save int64 as float64 cause missing value
-			metadata["g_id"] = strconv.FormatInt(dbGiftCode.Id, 10)
-			err = entity.AddChipWalletUser(ctx, nk, logger, userID, wallet, metadata)
-			if err != nil {
-				logger.Error("Update wallet chip by claim giftcode %s error %s", giftCode.GetCode(), err.Error())
-			}
-			// emit event doris
-			{
-				report := lib.NewReportGame(ctx)
-				metadata["chips"] = strconv.Itoa(int(wallet.Chips))
-				metadata["user_id"] = userID
-				payload, _ := json.Marshal(metadata)
-				report.ReportEvent(ctx, "send-chip", userID, string(payload))
+		if err := checkGiftCodeRules(ctx, logger, db, nk, rules, claimer); err != nil {
+			logger.Warn("User %s claim giftcode %s not eligible: %s", userID, giftCode.Code, err.Error())
+			return "", giftCodeRuleError(err)
+		}
+		dbGiftCode, err := cgbdb.ClaimGiftCode(ctx, logger, db, giftCode, claimer, rules)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				logger.Warn("User %s claim giftcode %s not found", userID, giftCode.Code)
+				addGiftCodeAttemptFail(ctx, logger, db, nk, attemptKeys, giftCode.Code)
+				return "", presenter.ErrGiftCodeInvalid
 			}
+			logger.Error("ClaimGiftCode error %s", err.Error())
+			return "", giftCodeRuleError(err)
 		}
+		applyGiftCodeClaim(ctx, logger, db, nk, userID, dbGiftCode, attemptKeys)
 		out, _ := conf.MarshalerDefault.Marshal(dbGiftCode)
 		return string(out), nil
 	}
 }
 
+// applyGiftCodeClaim send chips of claim succeeded to wallet, worker retry if apply failed
+func applyGiftCodeClaim(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userID string, dbGiftCode *pb.GiftCode, attemptKeys []giftCodeAttemptKey) {
+	if dbGiftCode.ErrCode != 0 {
+		return
+	}
+	resetGiftCodeAttempt(ctx, logger, db, attemptKeys)
+	outbox, err := cgbdb.GetClaimOutboxByKey(ctx, logger, db, userID, entity.GiftCodeClaimKey(dbGiftCode.Id))
+	if err != nil || outbox == nil {
+		return
+	}
+	recordInAppConversion(ctx, logger, db, userID, entity.InAppConversionGiftCode, outbox.IdemKey, outbox.Chips)
+	if outbox.Status == entity.ClaimOutboxStatusPending {
+		// worker retry if apply failed, chips is not lost
+		if err := ApplyClaimOutbox(ctx, logger, db, nk, outbox.Id); err != nil {
+			logger.Warn("Update wallet chip by claim giftcode %s error %s, wait worker retry", dbGiftCode.GetCode(), err.Error())
+		}
+	}
+}
+
+// RpcSetGiftCodeRules set eligibility rules of a code, or of all code in campaign
+func RpcSetGiftCodeRules() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.GiftCodeRulesRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if rules := req.Rules; rules != nil {
+			if rules.AccountAgeMinSec < 0 || rules.AccountAgeMaxSec < 0 || rules.MaxPerDevice < 0 ||
+				(rules.AccountAgeMaxSec > 0 && rules.AccountAgeMaxSec < rules.AccountAgeMinSec) {
+				logger.Error("Invalid giftcode rules")
+				return "", presenter.ErrInvalidInput
+			}
+		}
+		var err error
+		switch {
+		case req.CampaignId > 0:
+			err = cgbdb.SetGiftCodeCampaignRules(ctx, logger, db, req.CampaignId, req.Rules)
+		case req.Code != "":
+			err = cgbdb.SetGiftCodeRules(ctx, logger, db, req.Code, req.Rules)
+		default:
+			return "", presenter.ErrInvalidInput
+		}
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(req)
+		return string(out), nil
+	}
+}
+
 func RpcListGiftCode() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
@@ -139,3 +213,55 @@ func RpcDeleteGiftCode() func(context.Context, runtime.Logger, *sql.DB, runtime.
 		return string(out), nil
 	}
 }
+
+// checkGiftCodeRules load only info the rules need
+func checkGiftCodeRules(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, rules *entity.GiftCodeRules, claimer *entity.GiftCodeClaimer) error {
+	if rules.IsEmpty() {
+		return nil
+	}
+	if vars, ok := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string); ok {
+		claimer.AppPackage = vars["app_package"]
+	}
+	if rules.NeedGroupInfo() {
+		info, err := cgbdb.GetUserGroupUserInfo(ctx, logger, db, nk, claimer.UserId)
+		if err != nil {
+			logger.Error("GetUserGroupUserInfo user %s error %s", claimer.UserId, err.Error())
+			return err
+		}
+		claimer.GroupInfo = info
+	}
+	if rules.FirstIAPOnly {
+		firstIAPUnix, err := cgbdb.GetFirstIAPTopupUnix(ctx, db, claimer.UserId)
+		if err != nil {
+			logger.Error("GetFirstIAPTopupUnix user %s error %s", claimer.UserId, err.Error())
+			return err
+		}
+		claimer.FirstIAPUnix = firstIAPUnix
+	}
+	return rules.Check(claimer, time.Now().Unix())
+}
+
+func giftCodeRuleError(err error) error {
+	switch err {
+	case entity.ErrGiftCodeRuleUserGroup:
+		return presenter.ErrGiftCodeUserGroup
+	case entity.ErrGiftCodeRuleAccountAge:
+		return presenter.ErrGiftCodeAccountAge
+	case entity.ErrGiftCodeRuleFirstIAP:
+		return presenter.ErrGiftCodeFirstIAP
+	case entity.ErrGiftCodeRuleAppPackage:
+		return presenter.ErrGiftCodeAppPackage
+	case entity.ErrGiftCodeRuleDevice:
+		return presenter.ErrGiftCodeDevice
+	}
+	return err
+}
+
+func isGiftCodeCampaignPrefix(ctx context.Context, logger runtime.Logger, db *sql.DB, code string) bool {
+	ok, err := cgbdb.IsGiftCodeCampaignPrefix(ctx, db, entity.GiftCodePrefix(code))
+	if err != nil {
+		logger.WithField("err", err).Error("check giftcode campaign prefix failed")
+		return false
+	}
+	return ok
+}
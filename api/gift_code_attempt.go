@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+const (
+	notificationCodeGiftCodeBruteForce = 102
+
+	// runtime env, comma separated user id receive giftcode brute-force alert
+	envGiftCodeAlertUserIds = "giftcode_alert_user_ids"
+
+	giftCodeAttemptDefaultLimit = 100
+)
+
+type giftCodeAttemptKey struct {
+	keyType  string
+	keyValue string
+}
+
+func giftCodeAttemptKeys(ctx context.Context, claimer *entity.GiftCodeClaimer) []giftCodeAttemptKey {
+	keys := []giftCodeAttemptKey{{entity.GiftCodeAttemptKeyUser, claimer.UserId}}
+	if claimer.DeviceId != "" {
+		keys = append(keys, giftCodeAttemptKey{entity.GiftCodeAttemptKeyDevice, claimer.DeviceId})
+	}
+	if ip, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string); ip != "" {
+		keys = append(keys, giftCodeAttemptKey{entity.GiftCodeAttemptKeyIp, ip})
+	}
+	return keys
+}
+
+func checkGiftCodeAttemptLocked(ctx context.Context, logger runtime.Logger, db *sql.DB, keys []giftCodeAttemptKey) error {
+	now := time.Now().Unix()
+	for _, key := range keys {
+		attempt, err := cgbdb.GetGiftCodeAttempt(ctx, logger, db, key.keyType, key.keyValue)
+		if err != nil {
+			return err
+		}
+		if attempt.IsLocked(now) {
+			logger.Warn("Giftcode claim locked by %s %s, remain %d sec", key.keyType, key.keyValue, attempt.LockRemainSec(now))
+			return presenter.ErrGiftCodeTooManyAttempts
+		}
+	}
+	return nil
+}
+
+func addGiftCodeAttemptFail(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, keys []giftCodeAttemptKey, code string) {
+	for _, key := range keys {
+		attempt, alert, err := cgbdb.AddGiftCodeAttemptFail(ctx, logger, db, key.keyType, key.keyValue, code)
+		if err != nil {
+			continue
+		}
+		if alert {
+			alertGiftCodeBruteForce(ctx, logger, db, nk, attempt)
+		}
+	}
+}
+
+// resetGiftCodeAttempt success claim clear user and device, ip is shared so keep it
+func resetGiftCodeAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, keys []giftCodeAttemptKey) {
+	for _, key := range keys {
+		if key.keyType == entity.GiftCodeAttemptKeyIp {
+			continue
+		}
+		cgbdb.ResetGiftCodeAttempt(ctx, logger, db, key.keyType, key.keyValue)
+	}
+}
+
+func alertGiftCodeBruteForce(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, attempt *entity.GiftCodeAttempt) {
+	logger.Warn("Giftcode brute-force alert, %s %s failed %d attempts, last code %s",
+		attempt.KeyType, attempt.KeyValue, attempt.FailCount, attempt.LastCode)
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	adminIds := strings.Split(env[envGiftCodeAlertUserIds], ",")
+	content := map[string]interface{}{
+		"key_type":   attempt.KeyType,
+		"key_value":  attempt.KeyValue,
+		"fail_count": attempt.FailCount,
+		"last_code":  attempt.LastCode,
+	}
+	renderer := newNotiRenderer(logger, db)
+	notifications := make([]*runtime.NotificationSend, 0, len(adminIds))
+	for _, adminId := range adminIds {
+		adminId = strings.TrimSpace(adminId)
+		if adminId == "" {
+			continue
+		}
+		subject, message, _, err := renderer.Render(ctx, entity.NotiTplGiftCodeBruteForce, adminId, content)
+		if err != nil {
+			logger.WithField("err", err).Error("Render giftcode brute-force alert error")
+			continue
+		}
+		adminContent := map[string]interface{}{"message": message}
+		for k, v := range content {
+			adminContent[k] = v
+		}
+		notifications = append(notifications, &runtime.NotificationSend{
+			UserID:     adminId,
+			Subject:    subject,
+			Content:    adminContent,
+			Code:       notificationCodeGiftCodeBruteForce,
+			Persistent: true,
+		})
+	}
+	if len(notifications) == 0 {
+		return
+	}
+	if err := nk.NotificationsSend(ctx, notifications); err != nil {
+		logger.WithField("err", err).Error("Send giftcode brute-force alert error")
+	}
+}
+
+// RpcGiftCodeAttempts list failed redemption attempts, optional reset one key
+func RpcGiftCodeAttempts() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.GiftCodeAttemptRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Reset {
+			if req.KeyType == "" || req.KeyValue == "" {
+				return "", presenter.ErrInvalidInput
+			}
+			if err := cgbdb.ResetGiftCodeAttempt(ctx, logger, db, req.KeyType, req.KeyValue); err != nil {
+				return "", err
+			}
+		}
+		if req.Limit <= 0 || req.Limit > giftCodeAttemptDefaultLimit {
+			req.Limit = giftCodeAttemptDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListGiftCodeAttempt(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListGiftCodeAttempt{Attempts: ml})
+		return string(out), nil
+	}
+}
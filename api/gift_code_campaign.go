@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+	objectstorage "github.com/nk-nigeria/lobby-module/object-storage"
+)
+
+const giftCodeExportUrlExpiry = 24 * time.Hour
+
+func RpcAddGiftCodeCampaign(objStorage objectstorage.ObjStorage) func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		campaign := &entity.GiftCodeCampaign{}
+		if err := json.Unmarshal([]byte(payload), campaign); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		campaign.Prefix = entity.NormalizeGiftCode(campaign.Prefix)
+		if campaign.Name == "" || campaign.Value <= 0 || campaign.NumCode <= 0 ||
+			campaign.StartTimeUnix <= 0 || campaign.EndTimeUnix <= time.Now().Unix() {
+			logger.Error("Invalid payload")
+			return "", presenter.ErrInvalidInput
+		}
+		if err := entity.ValidGiftCodePrefix(campaign.Prefix); err != nil {
+			logger.Error("Invalid prefix %s", campaign.Prefix)
+			return "", presenter.ErrInvalidInput
+		}
+		campaign, err := cgbdb.AddGiftCodeCampaign(ctx, logger, db, campaign)
+		if err != nil {
+			logger.Error("AddGiftCodeCampaign error %s", err.Error())
+			return "", err
+		}
+		campaign.ExportUrl, campaign.ExportNextCursor, err = exportGiftCodeCampaign(ctx, logger, db, objStorage, campaign.Id, 0)
+		if err != nil {
+			logger.Warn("Export giftcode campaign %d error %s", campaign.Id, err.Error())
+		}
+		out, _ := json.Marshal(campaign)
+		return string(out), nil
+	}
+}
+
+// RpcExportGiftCodeCampaign upload csv of a page of codes in campaign, return link download and cursor of next page
+func RpcExportGiftCodeCampaign(objStorage objectstorage.ObjStorage) func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.GiftCodeCampaign{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		campaign, err := cgbdb.GetGiftCodeCampaign(ctx, logger, db, req.Id)
+		if err != nil {
+			return "", err
+		}
+		campaign.ExportCursor = req.ExportCursor
+		campaign.ExportUrl, campaign.ExportNextCursor, err = exportGiftCodeCampaign(ctx, logger, db, objStorage, campaign.Id, req.ExportCursor)
+		if err != nil {
+			logger.Error("Export giftcode campaign %d error %s", campaign.Id, err.Error())
+			return "", presenter.ErrInternalError
+		}
+		out, _ := json.Marshal(campaign)
+		return string(out), nil
+	}
+}
+
+func RpcGiftCodeCampaignStats() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.GiftCodeCampaign{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		stats, err := cgbdb.GetGiftCodeCampaignStats(ctx, logger, db, req.Id)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(stats)
+		return string(out), nil
+	}
+}
+
+func RpcDisableGiftCodeCampaign() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.GiftCodeCampaign{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := cgbdb.DisableGiftCodeCampaign(ctx, logger, db, req.Id); err != nil {
+			return "", err
+		}
+		campaign, err := cgbdb.GetGiftCodeCampaign(ctx, logger, db, req.Id)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(campaign)
+		return string(out), nil
+	}
+}
+
+// exportGiftCodeCampaign upload csv of codes after cursor, return link and next cursor (0 if no more code)
+func exportGiftCodeCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, objStorage objectstorage.ObjStorage, campaignId int64, cursor int64) (string, int64, error) {
+	ml, err := cgbdb.GetGiftCodeCampaignCodes(ctx, logger, db, campaignId, cursor, entity.GiftCodeExportPageSize)
+	if err != nil {
+		return "", 0, err
+	}
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	w.Write([]string{"code", "value", "n_max", "n_current"})
+	for _, code := range ml {
+		w.Write([]string{
+			code.Code,
+			strconv.FormatInt(code.Value, 10),
+			strconv.FormatInt(code.NMax, 10),
+			strconv.FormatInt(code.NCurrent, 10),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", 0, err
+	}
+	var nextCursor int64
+	if len(ml) == entity.GiftCodeExportPageSize {
+		nextCursor = ml[len(ml)-1].Id
+	}
+	objectName := fmt.Sprintf("campaign_%d_%d_%d.csv", campaignId, cursor, time.Now().Unix())
+	if err := objStorage.PutObject(entity.BucketGiftCode, objectName, buf, int64(buf.Len()), "text/csv"); err != nil {
+		return "", 0, err
+	}
+	url, err := objStorage.PresignGetObject(entity.BucketGiftCode, objectName, giftCodeExportUrlExpiry, nil)
+	return url, nextCursor, err
+}
@@ -12,6 +12,7 @@ import (
 
 	nkapi "github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/constant"
 	"github.com/nk-nigeria/lobby-module/entity"
 	lib "github.com/nk-nigeria/cgp-common/lib"
@@ -77,6 +78,9 @@ func validatePurchaseGoogle() func(ctx context.Context, logger runtime.Logger, d
 		logger.Info("validatePurchaseGoogle userId %s, purchase id %s", userID, strings.Join(productIDs, ","))
 
 		for _, validatePurchase := range listValidatePurchase {
+			if fp := entity.PaymentFingerprint(userID, validatePurchase.ProviderResponse); fp != nil {
+				_ = cgbdb.AddUserFingerprint(ctx, logger, db, fp)
+			}
 			if validatePurchase.SeenBefore {
 				logger.Warn("User %s , validate duplicate purchase %s", userID, validatePurchase.ProviderResponse)
 				continue
@@ -116,6 +120,9 @@ func topupChipIAP(ctx context.Context, logger runtime.Logger, db *sql.DB, nk run
 		Chips:  deal.AmountChips,
 	}
 	err := entity.AddChipWalletUser(ctx, nk, logger, userID, wallet, metadata)
+	if err == nil {
+		recordInAppConversion(ctx, logger, db, userID, entity.InAppConversionIap, transactionId, wallet.Chips)
+	}
 	// if err == nil {
 	// 	cgbdb.UpdateTopupSummary(db, userID, deal.Chips)
 	// }
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+func inAppEngagementError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrInAppNotFound):
+		return runtime.NewError(err.Error(), presenter.ErrNotFound.Code)
+	case errors.Is(err, entity.ErrInAppEvent), errors.Is(err, entity.ErrInAppCap):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// RpcInAppMessageEvent client report impression, click or dismiss of a message listed to user,
+// event over cap or click without impression is not counted
+func RpcInAppMessageEvent() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userId == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		req := &entity.InAppEventRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Validate(); err != nil {
+			return "", inAppEngagementError(err)
+		}
+		caps, engagements, err := cgbdb.GetInAppCapState(ctx, logger, db, userId, []int64{req.MessageId})
+		if err != nil {
+			return "", err
+		}
+		c, exist := caps[req.MessageId]
+		if !exist {
+			return "", inAppEngagementError(entity.ErrInAppNotFound)
+		}
+		m, err := cgbdb.GetInAppMessageById(ctx, logger, db, conf.Unmarshaler, req.MessageId)
+		if err != nil {
+			return "", err
+		}
+		// message not listed to user can not be seen or clicked
+		if active, err := cgbdb.InAppMessageActiveForUser(ctx, logger, db, nk, userId, m); err != nil {
+			return "", err
+		} else if !active {
+			return "", inAppEngagementError(entity.ErrInAppNotFound)
+		}
+		today := entity.InAppDay(time.Now())
+		if !c.AllowEvent(req.Event, engagements[req.MessageId], today) {
+			logger.Warn("User %s in-app message %d event %s ignored", userId, req.MessageId, req.Event)
+			engagement := engagements[req.MessageId]
+			if engagement == nil {
+				engagement = &entity.InAppEngagement{MessageId: req.MessageId, UserId: userId}
+			}
+			out, _ := json.Marshal(engagement)
+			return string(out), nil
+		}
+		variantIds, err := inAppVariantIds(ctx, logger, db, userId, []int64{req.MessageId})
+		if err != nil {
+			return "", err
+		}
+		engagement, err := cgbdb.AddInAppEvent(ctx, logger, db, userId, variantIds[req.MessageId], req, today)
+		if err != nil {
+			return "", inAppEngagementError(err)
+		}
+		out, _ := json.Marshal(engagement)
+		return string(out), nil
+	}
+}
+
+// RpcSetInAppMessageCap set daily impression cap and show once of a message
+func RpcSetInAppMessageCap() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		c := &entity.InAppMessageCap{}
+		if err := json.Unmarshal([]byte(payload), c); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := c.Validate(); err != nil {
+			return "", inAppEngagementError(err)
+		}
+		if err := cgbdb.UpdateInAppMessageCap(ctx, logger, db, c); err != nil {
+			return "", inAppEngagementError(err)
+		}
+		out, _ := json.Marshal(c)
+		return string(out), nil
+	}
+}
+
+// RpcInAppMessageStats impressions, clicks, dismisses and ctr of messages
+func RpcInAppMessageStats() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.InAppStatsRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Limit <= 0 || req.Limit > entity.InAppStatsDefaultLimit {
+			req.Limit = entity.InAppStatsDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListInAppMessageStat(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListInAppMessageStat{Stats: ml})
+		return string(out), nil
+	}
+}
@@ -60,6 +60,8 @@ func RpcListInAppMessage(marshaler *proto.MarshalOptions, unmarshaler *proto.Unm
 		if err != nil {
 			return "", err
 		}
+		userId, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		applyInAppVariants(ctx, logger, db, userId, list.InAppMessages)
 		listInAppMessageStr, _ := conf.MarshalerDefault.Marshal(list)
 		return string(listInAppMessageStr), nil
 	}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var inAppVariantUnmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// applyInAppVariants replace data of messages having variants by variant of user,
+// targeting params and show times stay those of message, variant id is added to params
+func applyInAppVariants(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, ml []*pb.InAppMessage) {
+	if userId == "" || len(ml) == 0 {
+		return
+	}
+	ids := make([]int64, 0, len(ml))
+	for _, m := range ml {
+		ids = append(ids, m.Id)
+	}
+	variants, err := cgbdb.ListInAppVariant(ctx, logger, db, ids)
+	if err != nil {
+		return
+	}
+	for _, m := range ml {
+		v := entity.PickInAppVariant(userId, m.Id, variants[m.Id])
+		if v == nil {
+			continue
+		}
+		data := &pb.InAppMessageData{}
+		if err := inAppVariantUnmarshaler.Unmarshal(v.Data, data); err != nil {
+			logger.Error("Unmarshal in-app message %d variant %s error %s", m.Id, v.Id, err.Error())
+			continue
+		}
+		if m.Data != nil {
+			data.ShowTimes = m.Data.ShowTimes
+		}
+		data.Params = make(map[string]string, len(m.GetData().GetParams())+1)
+		for k, v := range m.GetData().GetParams() {
+			data.Params[k] = v
+		}
+		data.Params[entity.InAppVariantParam] = v.Id
+		m.Data = data
+	}
+}
+
+// inAppVariantIds variant id of user for each message, message without variant is not in map
+func inAppVariantIds(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, messageIds []int64) (map[int64]string, error) {
+	variants, err := cgbdb.ListInAppVariant(ctx, logger, db, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]string, len(variants))
+	for messageId, vs := range variants {
+		if v := entity.PickInAppVariant(userId, messageId, vs); v != nil {
+			ids[messageId] = v.Id
+		}
+	}
+	return ids, nil
+}
+
+// recordInAppConversion attribute topup or giftcode claim to variants user saw recently, error is only logged
+func recordInAppConversion(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, kind, ref string, chips int64) {
+	added, err := cgbdb.AddInAppConversion(ctx, logger, db, userId, kind, ref, chips, entity.InAppConversionWindow)
+	if err == nil && added > 0 {
+		logger.Info("User %s %s %s attributed to %d in-app message variants", userId, kind, ref, added)
+	}
+}
+
+func inAppVariantError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrInAppVariant):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return inAppEngagementError(err)
+}
+
+// RpcSetInAppMessageVariants replace weighted variants of message, empty list stop the test
+func RpcSetInAppMessageVariants() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.InAppVariantRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Validate(); err != nil {
+			return "", inAppVariantError(err)
+		}
+		for _, v := range req.Variants {
+			if err := inAppVariantUnmarshaler.Unmarshal(v.Data, &pb.InAppMessageData{}); err != nil {
+				logger.Error("Invalid data of variant %s: %s", v.Id, err.Error())
+				return "", inAppVariantError(entity.ErrInAppVariant)
+			}
+		}
+		if err := cgbdb.ReplaceInAppVariant(ctx, logger, db, req); err != nil {
+			return "", inAppVariantError(err)
+		}
+		out, _ := json.Marshal(req)
+		return string(out), nil
+	}
+}
+
+// RpcInAppMessageVariantAssign variant id of user for messages, client attach it to its own tracking.
+// List in-app message already return data of the variant.
+func RpcInAppMessageVariantAssign() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userId == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		req := &entity.InAppVariantAssignRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if len(req.MessageIds) == 0 || len(req.MessageIds) > entity.InAppStatsDefaultLimit {
+			return "", presenter.ErrInvalidInput
+		}
+		ids, err := inAppVariantIds(ctx, logger, db, userId, req.MessageIds)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(map[string]interface{}{"variants": ids})
+		return string(out), nil
+	}
+}
+
+// RpcInAppMessageVariantReport compare ctr and conversion of variants of a message
+func RpcInAppMessageVariantReport() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.InAppVariantRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.MessageId <= 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		stats, err := cgbdb.GetInAppVariantReport(ctx, logger, db, req.MessageId)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.InAppVariantReport{
+			MessageId:   req.MessageId,
+			WindowHours: int64(entity.InAppConversionWindow.Hours()),
+			Variants:    stats,
+		})
+		return string(out), nil
+	}
+}
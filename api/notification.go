@@ -3,12 +3,15 @@ package api
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -19,8 +22,12 @@ func RpcReadAllNotification(marshaler *proto.MarshalOptions, unmarshaler *proto.
 		if !ok {
 			return "", presenter.ErrNoUserIdFound
 		}
+		category, err := parseNotiCategory(logger, payload)
+		if err != nil {
+			return "", err
+		}
 
-		err := cgbdb.ReadAllNotification(ctx, logger, db, userId)
+		err = cgbdb.ReadAllNotification(ctx, logger, db, userId, category)
 		if err != nil {
 			logger.Error("RpcReadAllNotification error", err)
 		}
@@ -42,8 +49,12 @@ func RpcDeleteAllNotification(marshaler *proto.MarshalOptions, unmarshaler *prot
 		if !ok {
 			return "", presenter.ErrNoUserIdFound
 		}
+		category, err := parseNotiCategory(logger, payload)
+		if err != nil {
+			return "", err
+		}
 
-		err := cgbdb.DeleteAllNotification(ctx, logger, db, userId)
+		err = cgbdb.DeleteAllNotification(ctx, logger, db, userId, category)
 		if err != nil {
 			logger.Error("RpcDeleteAllNotification error", err)
 		}
@@ -133,3 +144,68 @@ func RpcListNotification(marshaler *proto.MarshalOptions, unmarshaler *proto.Unm
 		return string(listNotificationStr), nil
 	}
 }
+
+// parseNotiCategory optional category filter of payload, empty is all categories
+func parseNotiCategory(logger runtime.Logger, payload string) (string, error) {
+	req := &entity.NotiCategoryRequest{}
+	if payload == "" {
+		return "", nil
+	}
+	if err := json.Unmarshal([]byte(payload), req); err != nil {
+		logger.Error("Error when unmarshal payload", err.Error())
+		return "", presenter.ErrUnmarshal
+	}
+	if req.Category != "" && !entity.IsNotiCategory(req.Category) {
+		return "", notiPreferenceError(entity.ErrNotiCategory)
+	}
+	return req.Category, nil
+}
+
+func notiPreferenceError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrNotiCategory), errors.Is(err, entity.ErrNotiMuteCategory):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// RpcGetNotificationPreference categories user muted and muted push
+func RpcGetNotificationPreference() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userId == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		pref, err := cgbdb.GetNotificationPreference(ctx, logger, db, userId)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(pref)
+		return string(out), nil
+	}
+}
+
+// RpcUpdateNotificationPreference replace muted and push muted categories of user,
+// system and transfer can not be muted but their push can
+func RpcUpdateNotificationPreference() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userId == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		pref := &entity.NotificationPreference{}
+		if err := json.Unmarshal([]byte(payload), pref); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		pref.UserId = userId
+		if err := pref.Validate(); err != nil {
+			return "", notiPreferenceError(err)
+		}
+		if err := cgbdb.UpsertNotificationPreference(ctx, logger, db, pref); err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(pref)
+		return string(out), nil
+	}
+}
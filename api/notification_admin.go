@@ -8,6 +8,7 @@ import (
 	pb "github.com/nk-nigeria/cgp-common/proto"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -20,14 +21,38 @@ func RpcAddNotification(marshaler *proto.MarshalOptions, unmarshaler *proto.Unma
 		}
 		request.SenderId = ""
 		recipientIds := request.RecipientIds
-		if request.UserGroupId > 0 {
-			var err error
-			recipientIds, err = cgbdb.GetListUserIdsByUserGroup(ctx, logger, db, unmarshaler, request.UserGroupId)
-			if err != nil {
-				logger.Error("GetListUserIdsByUserGroup error %s", err.Error())
+		// request is proto without category, admin pass it in query param, default is system
+		category := entity.NotiCategorySystem
+		if queryParams, ok := ctx.Value(runtime.RUNTIME_CTX_QUERY_PARAMS).(map[string][]string); ok {
+			if arr := queryParams["category"]; len(arr) > 0 && arr[0] != "" {
+				category = arr[0]
+			}
+		}
+		if !entity.IsNotiCategory(category) {
+			return "", runtime.NewError(entity.ErrNotiCategory.Error(), presenter.ErrInvalidInput.Code)
+		}
+		// user group and long list are sent by campaign worker in batches
+		if request.UserGroupId > 0 || len(recipientIds) > entity.NotiCampaignBatch {
+			campaign := &entity.NotificationCampaign{
+				Title:       request.Title,
+				Content:     request.Content,
+				Type:        int32(request.Type),
+				Audience:    entity.NotiAudienceIds,
+				UserIds:     recipientIds,
+				UserGroupId: request.UserGroupId,
+				Category:    category,
+			}
+			if request.UserGroupId > 0 {
+				campaign.Audience, campaign.UserIds = entity.NotiAudienceUserGroup, nil
+			}
+			if err := campaign.Validate(); err != nil {
+				return "", notiCampaignError(err)
+			}
+			if err := cgbdb.AddNotificationCampaign(ctx, logger, db, campaign); err != nil {
 				return "", err
 			}
-			logger.Info("GetListUserIdsByUserGroup %v", recipientIds)
+			logger.Info("Add notification campaign %d, audience %s", campaign.Id, campaign.Audience)
+			return "success", nil
 		}
 		for _, recipientId := range recipientIds {
 			notification := &pb.Notification{
@@ -38,7 +63,7 @@ func RpcAddNotification(marshaler *proto.MarshalOptions, unmarshaler *proto.Unma
 				SenderId:    "",
 				Read:        false,
 			}
-			err := cgbdb.AddNotification(ctx, logger, db, nk, notification)
+			err := cgbdb.AddCategoryNotification(ctx, logger, db, nk, notification, category)
 			if err != nil {
 				logger.Error("Add notification user %s, error: %s", request.SenderId, err.Error())
 				return "", err
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+// ProcessNotificationCampaigns worker send all campaigns reach send time
+func ProcessNotificationCampaigns(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	for {
+		campaign, err := cgbdb.ClaimDueNotificationCampaign(ctx, logger, db)
+		if err != nil || campaign == nil {
+			return
+		}
+		sendNotificationCampaign(ctx, logger, db, nk, campaign)
+	}
+}
+
+// sendNotificationCampaign send campaign from its cursor in batches, progress is saved after each batch.
+// If worker stop, campaign lock expire and other run resume from cursor.
+func sendNotificationCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, campaign *entity.NotificationCampaign) {
+	var audienceIds []string
+	switch campaign.Audience {
+	case entity.NotiAudienceUserGroup:
+		ids, err := cgbdb.GetListUserIdsByUserGroup(ctx, logger, db, conf.Unmarshaler, campaign.UserGroupId)
+		if err != nil {
+			logger.WithField("campaign id", campaign.Id).WithField("err", err).Error("get user ids of user group failed, retry later")
+			return
+		}
+		audienceIds = ids
+	case entity.NotiAudienceIds:
+		audienceIds = campaign.UserIds
+	}
+	if campaign.Total == 0 {
+		if campaign.Audience == entity.NotiAudienceAll {
+			total, err := cgbdb.CountRealUsers(ctx, db)
+			if err != nil {
+				logger.WithField("campaign id", campaign.Id).WithField("err", err).Error("count users failed")
+			}
+			campaign.Total = total
+		} else {
+			campaign.Total = int64(len(entity.NextRecipients(audienceIds, "", len(audienceIds))))
+		}
+	}
+	logger.Info("Send notification campaign %d from cursor %q, sent %d/%d", campaign.Id, campaign.Cursor, campaign.Sent, campaign.Total)
+	for {
+		var batch []string
+		if campaign.Audience == entity.NotiAudienceAll {
+			var err error
+			if batch, err = cgbdb.ListUserIdsAfter(ctx, db, campaign.Cursor, entity.NotiCampaignBatch); err != nil {
+				logger.WithField("campaign id", campaign.Id).WithField("err", err).Error("list users failed, retry later")
+				return
+			}
+		} else {
+			batch = entity.NextRecipients(audienceIds, campaign.Cursor, entity.NotiCampaignBatch)
+		}
+		moved := true
+		if len(batch) == 0 {
+			campaign.Status = entity.NotiCampaignStatusDone
+		} else if moved = sendNotificationBatch(ctx, logger, db, nk, campaign, batch); moved {
+			campaign.Cursor = batch[len(batch)-1]
+		}
+		running, err := cgbdb.UpdateNotificationCampaignProgress(ctx, logger, db, campaign)
+		if err != nil {
+			return
+		}
+		if !running {
+			logger.Info("Notification campaign %d is cancelled at cursor %q", campaign.Id, campaign.Cursor)
+			return
+		}
+		if !moved {
+			// lease expire and worker retry batch from same cursor
+			logger.Warn("Notification campaign %d batch after cursor %q failed %d times, retry later", campaign.Id, campaign.Cursor, campaign.BatchAttempts)
+			return
+		}
+		if campaign.Status == entity.NotiCampaignStatusDone {
+			logger.Info("Notification campaign %d done, sent %d, skipped %d, failed %d", campaign.Id, campaign.Sent, campaign.Skipped, campaign.Failed)
+			return
+		}
+	}
+}
+
+// sendNotificationBatch return false if batch is not saved and must be retried from same cursor,
+// batch failed NotiCampaignBatchAttempts times is counted failed.
+func sendNotificationBatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule,
+	campaign *entity.NotificationCampaign, recipientIds []string) bool {
+	inserted, err := cgbdb.AddNotificationBatch(ctx, logger, db, campaign.Title, campaign.Content, campaign.Type,
+		campaign.Category, recipientIds)
+	if err != nil {
+		campaign.LastError = err.Error()
+		campaign.BatchAttempts++
+		if campaign.BatchAttempts < entity.NotiCampaignBatchAttempts {
+			return false
+		}
+		campaign.Failed += int64(len(recipientIds))
+		campaign.BatchAttempts = 0
+		return true
+	}
+	campaign.BatchAttempts = 0
+	campaign.Sent += int64(len(inserted))
+	campaign.Skipped += int64(len(recipientIds) - len(inserted))
+	pushMuted, err := cgbdb.GetPushMutedUserIds(ctx, db, campaign.Category, inserted)
+	if err != nil {
+		logger.WithField("campaign id", campaign.Id).WithField("err", err).Warn("get push muted users failed")
+	}
+	notifications := make([]*runtime.NotificationSend, 0, len(inserted))
+	pushIds := make([]string, 0, len(inserted))
+	for _, recipientId := range inserted {
+		if pushMuted[recipientId] {
+			continue
+		}
+		pushIds = append(pushIds, recipientId)
+		notifications = append(notifications, &runtime.NotificationSend{
+			UserID:     recipientId,
+			Subject:    campaign.Title,
+			Content:    map[string]interface{}{"content": campaign.Content, "category": campaign.Category},
+			Code:       int(campaign.Type),
+			Persistent: false,
+		})
+	}
+	if len(notifications) == 0 {
+		return true
+	}
+	// campaign is not urgent, mobile push to every recipient instead of checking who is online
+	cgbdb.EnqueuePush(ctx, logger, db, pushIds, "", campaign.Title, campaign.Content,
+		map[string]string{"category": campaign.Category, "type": strconv.Itoa(int(campaign.Type))})
+	// notification is saved, user still see it in list if realtime send fail
+	if err := nk.NotificationsSend(ctx, notifications); err != nil {
+		logger.WithField("campaign id", campaign.Id).WithField("err", err).Warn("realtime send notification batch failed")
+		campaign.LastError = err.Error()
+	}
+	return true
+}
+
+func notiCampaignError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrNotiCampaignEmpty), errors.Is(err, entity.ErrNotiCampaignAudience),
+		errors.Is(err, entity.ErrNotiCampaignStatus), errors.Is(err, entity.ErrNotiCategory):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// RpcCreateNotificationCampaign schedule notification to user group, user ids or all users,
+// send time in past or 0 is sent by worker right away
+func RpcCreateNotificationCampaign() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		campaign := &entity.NotificationCampaign{}
+		if err := json.Unmarshal([]byte(payload), campaign); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := campaign.Validate(); err != nil {
+			return "", notiCampaignError(err)
+		}
+		if err := cgbdb.AddNotificationCampaign(ctx, logger, db, campaign); err != nil {
+			return "", err
+		}
+		campaign.UserIds = nil
+		out, _ := json.Marshal(campaign)
+		return string(out), nil
+	}
+}
+
+// RpcCancelNotificationCampaign stop scheduled or running campaign, recipients already sent keep notification
+func RpcCancelNotificationCampaign() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.NotiCampaignRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.Id <= 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		if err := cgbdb.CancelNotificationCampaign(ctx, logger, db, req.Id); err != nil {
+			return "", notiCampaignError(err)
+		}
+		campaign, err := cgbdb.GetNotificationCampaign(ctx, logger, db, req.Id)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(campaign)
+		return string(out), nil
+	}
+}
+
+// RpcNotificationCampaignStatus progress of a campaign by id, or list campaigns filter by status
+func RpcNotificationCampaignStatus() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.NotiCampaignRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Id > 0 {
+			campaign, err := cgbdb.GetNotificationCampaign(ctx, logger, db, req.Id)
+			if err != nil {
+				return "", err
+			}
+			out, _ := json.Marshal(campaign)
+			return string(out), nil
+		}
+		if req.Limit <= 0 || req.Limit > entity.NotiCampaignDefaultLimit {
+			req.Limit = entity.NotiCampaignDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListNotificationCampaign(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListNotificationCampaign{Campaigns: ml})
+		return string(out), nil
+	}
+}
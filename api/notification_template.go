@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+// notiRenderer render system notification in lang of recipient,
+// templates and lang tags are cached for lifetime of renderer so bulk send query them once
+type notiRenderer struct {
+	logger    runtime.Logger
+	db        *sql.DB
+	templates map[string][]*entity.NotificationTemplate
+	langs     map[string]string
+}
+
+func newNotiRenderer(logger runtime.Logger, db *sql.DB) *notiRenderer {
+	return &notiRenderer{
+		logger:    logger,
+		db:        db,
+		templates: make(map[string][]*entity.NotificationTemplate),
+		langs:     make(map[string]string),
+	}
+}
+
+// LoadLang prefetch lang tag of recipients
+func (r *notiRenderer) LoadLang(ctx context.Context, userIds ...string) {
+	missing := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		if _, exist := r.langs[userId]; !exist {
+			missing = append(missing, userId)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	langs, err := cgbdb.GetUserLangTag(ctx, r.db, missing...)
+	if err != nil {
+		r.logger.WithField("err", err).Error("get lang tag of users failed")
+	}
+	for _, userId := range missing {
+		// user without lang get default locale
+		r.langs[userId] = langs[userId]
+	}
+}
+
+// Render title, content and type override of template id for user, fallback to built-in template
+func (r *notiRenderer) Render(ctx context.Context, id, userId string, values map[string]interface{}) (string, string, int32, error) {
+	saved, exist := r.templates[id]
+	if !exist {
+		var err error
+		if saved, err = cgbdb.ListNotificationTemplate(ctx, r.logger, r.db, id); err != nil {
+			saved = nil
+		}
+		r.templates[id] = saved
+	}
+	r.LoadLang(ctx, userId)
+	if tpl := entity.PickNotiTemplate(saved, entity.NotiLocaleFallbacks(r.langs[userId])); tpl != nil {
+		title, content, err := tpl.Render(values)
+		if err == nil {
+			return title, content, tpl.Type, nil
+		}
+		r.logger.Warn("Render notification template %s locale %s error %s", tpl.Id, tpl.Locale, err.Error())
+	}
+	tpl, exist := entity.DefaultNotiTemplates[id]
+	if !exist {
+		return "", "", 0, entity.ErrNotiTplNotFound
+	}
+	title, content, err := tpl.Render(values)
+	return title, content, tpl.Type, err
+}
+
+// Send render template for recipient and add notification of category
+func (r *notiRenderer) Send(ctx context.Context, nk runtime.NakamaModule, id, recipientId string,
+	notiType pb.TypeNotification, category string, values map[string]interface{}) error {
+	title, content, tplType, err := r.Render(ctx, id, recipientId, values)
+	if err != nil {
+		r.logger.Error("Render notification %s for user %s error %s", id, recipientId, err.Error())
+		return err
+	}
+	if tplType > 0 {
+		notiType = pb.TypeNotification(tplType)
+	}
+	return cgbdb.AddCategoryNotification(ctx, r.logger, r.db, nk, &pb.Notification{
+		RecipientId: recipientId,
+		Type:        notiType,
+		Title:       title,
+		Content:     content,
+		SenderId:    "",
+		Read:        false,
+	}, category)
+}
+
+func notiTemplateError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrNotiTplNotFound):
+		return runtime.NewError(err.Error(), presenter.ErrNotFound.Code)
+	case errors.Is(err, entity.ErrNotiTplId), errors.Is(err, entity.ErrNotiTplEmpty),
+		errors.Is(err, entity.ErrNotiTplParamType), errors.Is(err, entity.ErrNotiTplPlaceholder):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// RpcUpsertNotificationTemplate add or update template of id in a locale
+func RpcUpsertNotificationTemplate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		tpl := &entity.NotificationTemplate{}
+		if err := json.Unmarshal([]byte(payload), tpl); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := tpl.Validate(); err != nil {
+			return "", notiTemplateError(err)
+		}
+		if err := cgbdb.UpsertNotificationTemplate(ctx, logger, db, tpl); err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(tpl)
+		return string(out), nil
+	}
+}
+
+// RpcDeleteNotificationTemplate delete template of id in a locale, built-in template is used again if no locale left
+func RpcDeleteNotificationTemplate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.NotiTplRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.Id == "" || req.Locale == "" {
+			return "", notiTemplateError(entity.ErrNotiTplId)
+		}
+		if err := cgbdb.DeleteNotificationTemplate(ctx, logger, db, req.Id, req.Locale); err != nil {
+			return "", notiTemplateError(err)
+		}
+		return `{"result":"ok"}`, nil
+	}
+}
+
+// RpcListNotificationTemplate saved templates, filter by id, and built-in templates
+func RpcListNotificationTemplate() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.NotiTplRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		ml, err := cgbdb.ListNotificationTemplate(ctx, logger, db, req.Id)
+		if err != nil {
+			return "", err
+		}
+		resp := &entity.ListNotificationTemplate{Templates: ml}
+		for id, tpl := range entity.DefaultNotiTemplates {
+			if req.Id == "" || req.Id == id {
+				resp.Defaults = append(resp.Defaults, tpl)
+			}
+		}
+		sort.Slice(resp.Defaults, func(i, j int) bool { return resp.Defaults[i].Id < resp.Defaults[j].Id })
+		out, _ := json.Marshal(resp)
+		return string(out), nil
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// runtime env, online time milestones of day, ex "600=500,1800=1000" (sec=chips).
+// Milestones are not read from online_sec/online_chip of daily reward template:
+// those fields gate each daily reward claim of the day and online_chip is paid in
+// the claim total, so milestones built from them would pay the same chips twice.
+const envPlaytimeMilestones = "playtime_milestones"
+
+// runtime env, time in match milestones of day, same format as playtime_milestones
+const envPlaytimeMatchMilestones = "playtime_match_milestones"
+
+var (
+	playtimeMilestones      = entity.DefaultPlaytimeMilestones
+	playtimeMatchMilestones = entity.DefaultPlaytimeMatchMilestones
+)
+
+func parsePlaytimeMilestonesEnv(logger runtime.Logger, env map[string]string, key string, def []*entity.PlaytimeMilestone) []*entity.PlaytimeMilestone {
+	s := env[key]
+	if s == "" {
+		return def
+	}
+	ml, err := entity.ParsePlaytimeMilestones(s)
+	if err != nil {
+		logger.Error("Invalid env %s=%s: %s, use default", key, s, err.Error())
+		return def
+	}
+	return ml
+}
+
+func playtimeNode(ctx context.Context) string {
+	node, _ := ctx.Value(runtime.RUNTIME_CTX_NODE).(string)
+	return node
+}
+
+// InitPlaytime load milestones, count presences left by last run of this node until its last heartbeat,
+// then keep heartbeat and clean presences of dead nodes.
+func InitPlaytime(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	playtimeMilestones = parsePlaytimeMilestonesEnv(logger, env, envPlaytimeMilestones, entity.DefaultPlaytimeMilestones)
+	playtimeMatchMilestones = parsePlaytimeMilestonesEnv(logger, env, envPlaytimeMatchMilestones, entity.DefaultPlaytimeMatchMilestones)
+	node := playtimeNode(ctx)
+	recoverPlaytimeNode(ctx, logger, db, node)
+	cgbdb.HeartbeatPlaytimeNode(ctx, logger, db, node)
+	go func() {
+		ticker := time.NewTicker(entity.PlaytimeNodeHeartbeat)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx := context.Background()
+			cgbdb.HeartbeatPlaytimeNode(ctx, logger, db, node)
+			nodes, err := cgbdb.ListStalePlaytimeNode(ctx, logger, db, time.Now().Add(-entity.PlaytimeNodeStale))
+			if err != nil {
+				continue
+			}
+			for _, staleNode := range nodes {
+				recoverPlaytimeNode(ctx, logger, db, staleNode)
+			}
+		}
+	}()
+}
+
+// ShutdownPlaytime count presences of this node until now and remove them
+func ShutdownPlaytime(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	node := playtimeNode(ctx)
+	cgbdb.HeartbeatPlaytimeNode(ctx, logger, db, node)
+	recoverPlaytimeNode(ctx, logger, db, node)
+}
+
+// recoverPlaytimeNode count presences of node until its last heartbeat and remove them
+func recoverPlaytimeNode(ctx context.Context, logger runtime.Logger, db *sql.DB, node string) {
+	until, err := cgbdb.TakePlaytimeNode(ctx, logger, db, node)
+	if err != nil {
+		return
+	}
+	presences, err := cgbdb.ListPlaytimePresenceOfNode(ctx, logger, db, node)
+	if err != nil {
+		return
+	}
+	for _, presence := range presences {
+		loc := dailyRewardLocation(ctx, logger, db, presence.UserId)
+		cgbdb.ClearPlaytimePresence(ctx, logger, db, node, presence.UserId, presence.Kind, until, loc)
+	}
+	logger.Info("Recover %d playtime presences of node %s until %v", len(presences), node, until)
+}
+
+// trackPlaytime user start (add=true) or end a session or match
+func trackPlaytime(ctx context.Context, logger runtime.Logger, db *sql.DB, userID, kind, presenceID string, add bool) {
+	if userID == "" || presenceID == "" {
+		return
+	}
+	loc := dailyRewardLocation(ctx, logger, db, userID)
+	if err := cgbdb.UpdatePlaytimePresence(ctx, logger, db, playtimeNode(ctx), userID, kind, presenceID, add, time.Now(), loc); err != nil {
+		logger.WithField("err", err).Error("track playtime user %s %s %s failed", userID, kind, presenceID)
+	}
+}
+
+func playtimeProgress(ctx context.Context, logger runtime.Logger, db *sql.DB, userID string) (*entity.PlaytimeProgress, error) {
+	now := time.Now()
+	loc := dailyRewardLocation(ctx, logger, db, userID)
+	active, err := cgbdb.FlushPlaytime(ctx, logger, db, userID, now, loc)
+	if err != nil {
+		return nil, err
+	}
+	playtime, err := cgbdb.GetPlaytimeDay(ctx, logger, db, userID, entity.DailyRewardDay(now, loc))
+	if err != nil {
+		return nil, err
+	}
+	return entity.BuildPlaytimeProgress(playtime, playtimeMilestones, playtimeMatchMilestones, active, now), nil
+}
+
+// RpcPlaytimeProgress online time of today and milestones, client count down next_milestone_sec when active
+func RpcPlaytimeProgress() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok {
+			return "", errors.New("Missing user ID.")
+		}
+		progress, err := playtimeProgress(ctx, logger, db, userID)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(progress)
+		return string(out), nil
+	}
+}
+
+// RpcPlaytimeClaim claim all reached milestones of today
+func RpcPlaytimeClaim() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok {
+			return "", errors.New("Missing user ID.")
+		}
+		progress, err := playtimeProgress(ctx, logger, db, userID)
+		if err != nil {
+			return "", err
+		}
+		if progress.ClaimableChips <= 0 {
+			return "", runtime.NewError(entity.ErrPlaytimeNoMilestone.Error(), presenter.ErrInvalidInput.Code)
+		}
+		_, outbox, err := cgbdb.ClaimPlaytime(ctx, logger, db, userID, progress.Day, playtimeMilestones, playtimeMatchMilestones)
+		if err != nil {
+			if status.Code(err) == codes.FailedPrecondition {
+				return "", runtime.NewError(status.Convert(err).Message(), presenter.ErrInvalidInput.Code)
+			}
+			return "", err
+		}
+		if err := ApplyClaimOutbox(ctx, logger, db, nk, outbox.Id); err != nil {
+			logger.WithField("claim id", outbox.Id).WithField("err", err).Error("apply claim outbox failed, worker will retry")
+		}
+		progress, err = playtimeProgress(ctx, logger, db, userID)
+		if err != nil {
+			return "", err
+		}
+		progress.ClaimChips = outbox.Chips
+		out, _ := json.Marshal(progress)
+		return string(out), nil
+	}
+}
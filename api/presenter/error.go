@@ -16,6 +16,19 @@ var (
 	ErrNotEnoughChip      = runtime.NewError("not enough chip", 103)
 	ErrFuncDisableByVipLv = runtime.NewError("function disable by vip lv", 104) // INTERNAL
 	ErrNotFound           = runtime.NewError("not found", 105)
+	ErrGiftCodeInvalid    = runtime.NewError("giftcode invalid", 106)
+
+	ErrGiftCodeUserGroup  = runtime.NewError("giftcode not available for your user group", 107)
+	ErrGiftCodeAccountAge = runtime.NewError("giftcode not available for your account age", 108)
+	ErrGiftCodeFirstIAP   = runtime.NewError("giftcode only shortly after first purchase", 109)
+	ErrGiftCodeAppPackage = runtime.NewError("giftcode not available for this app", 110)
+	ErrGiftCodeDevice     = runtime.NewError("giftcode reach max claim on this device", 111)
+
+	ErrGiftCodeTooManyAttempts = runtime.NewError("too many wrong giftcode, try again later", 112)
+
+	ErrUserSanctioned   = runtime.NewError("account restricted", 113)
+	ErrNewDeviceBlocked = runtime.NewError("login from new device is blocked", 114)
+	ErrDeviceRevoked    = runtime.NewError("device is revoked", 115)
 
 	ErrUserNameLenthTooShort       = runtime.NewError("Invalid username address, must be 8-255 bytes.", 1000)
 	ErrUserNameLenthTooLong        = runtime.NewError("Invalid username address, must be 8-255 bytes.", 1001)
@@ -95,6 +95,7 @@ func RpcUpdateProfile(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmars
 			metadata["status"] = profile.Status
 		}
 		addNewReferUser := false
+		invitorId := ""
 		if currentProfile.RemainTimeInputRefCode > 0 &&
 			entity.InterfaceToString(metadata["ref_code"]) == "" {
 			profile.RefCode = strings.TrimSpace(profile.RefCode)
@@ -106,15 +107,41 @@ func RpcUpdateProfile(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmars
 				}
 				// if using user sid
 				if refCodeInt, _ := strconv.Atoi(profile.RefCode); refCodeInt > 0 {
-					_, err = cgbdb.GetAccount(ctx, db, "", int64(refCodeInt))
+					var account *entity.Account
+					if !entity.ValidSid(int64(refCodeInt)) {
+						err = entity.ErrSidInvalid
+					} else if account, err = cgbdb.GetAccount(ctx, db, "", int64(refCodeInt)); err == nil {
+						invitorId = account.User.Id
+					}
 				} else {
 					//  using user id (uuid)
 					_, err = nk.AccountGetId(ctx, profile.RefCode)
+					invitorId = profile.RefCode
 				}
 				if err != nil {
 					logger.Error("Error when valid ref code %s err %s", profile.RefCode, err.Error())
 					return "", status.Error(codes.InvalidArgument, "Invalid ref code")
 				}
+				if invitorId == userID {
+					return "", status.Error(codes.InvalidArgument, "Can not ref yourself")
+				}
+				shared, err := cgbdb.GetSharedFingerprint(ctx, logger, db, invitorId, userID, entity.ReferBlockFingerprintKinds)
+				if err != nil {
+					return "", err
+				}
+				if len(shared) > 0 {
+					logger.Warn("User %s use ref code %s share %s %s", userID, profile.RefCode, shared[0].Kind, shared[0].Value)
+					return "", status.Error(codes.InvalidArgument, entity.ErrReferFingerprint.Error())
+				}
+				// refer is saved first, ref code is used only if refer is saved
+				userRefer := &pb.ReferUser{
+					UserInvitor: invitorId,
+					UserInvitee: userID,
+				}
+				if _, err := cgbdb.AddUserRefer(ctx, logger, db, userRefer); err != nil {
+					logger.Error("Add refer user %s invitor %s error %s", userID, invitorId, err.Error())
+					return "", err
+				}
 				metadata["ref_code"] = profile.RefCode
 				addNewReferUser = true
 			}
@@ -144,14 +171,10 @@ func RpcUpdateProfile(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmars
 			return "", err
 		}
 
-		newProfile, _, err := cgbdb.GetProfileUser(ctx, db, userID, objStorage)
 		if addNewReferUser {
-			userRefer := &pb.ReferUser{
-				UserInvitor: profile.RefCode,
-				UserInvitee: newProfile.UserId,
-			}
-			cgbdb.AddUserRefer(ctx, logger, db, userRefer)
+			flagReferCluster(ctx, logger, db, invitorId, userID)
 		}
+		newProfile, _, err := cgbdb.GetProfileUser(ctx, db, userID, objStorage)
 		// marshaler.EmitUnpopulated = true
 		respBase64, err := utilities.EncodeBase64Proto(newProfile)
 		if err != nil {
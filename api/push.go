@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"github.com/nk-nigeria/lobby-module/push"
+)
+
+// runtime env of push providers, platform without config is not pushed
+const (
+	// service account json of firebase project
+	envPushFcmCredentials = "push_fcm_credentials"
+	envPushApnsKeyId      = "push_apns_key_id"
+	envPushApnsTeamId     = "push_apns_team_id"
+	// content of .p8 key, new line can be escaped as \n
+	envPushApnsKey     = "push_apns_key"
+	envPushApnsSandbox = "push_apns_sandbox"
+	// "true" push to fake provider of both platforms, for local run
+	envPushFake = "push_fake"
+)
+
+// pushProviders provider by platform of token
+var pushProviders = map[string]push.Provider{}
+
+func InitPushProviders(ctx context.Context, logger runtime.Logger) {
+	env, _ := ctx.Value(runtime.RUNTIME_CTX_ENV).(map[string]string)
+	if env[envPushFake] == "true" {
+		fake := push.NewFakeProvider()
+		pushProviders[entity.PushPlatformAndroid] = fake
+		pushProviders[entity.PushPlatformIos] = fake
+		logger.Info("Push use fake provider")
+		return
+	}
+	if credentials := env[envPushFcmCredentials]; credentials != "" {
+		p, err := push.NewFcmProvider([]byte(credentials))
+		if err != nil {
+			logger.WithField("err", err).Error("init fcm push provider failed")
+		} else {
+			pushProviders[entity.PushPlatformAndroid] = p
+		}
+	}
+	if key := env[envPushApnsKey]; key != "" {
+		key = strings.ReplaceAll(key, `\n`, "\n")
+		p, err := push.NewApnsProvider(env[envPushApnsKeyId], env[envPushApnsTeamId], []byte(key), env[envPushApnsSandbox] == "true")
+		if err != nil {
+			logger.WithField("err", err).Error("init apns push provider failed")
+		} else {
+			pushProviders[entity.PushPlatformIos] = p
+		}
+	}
+	for platform, p := range pushProviders {
+		logger.Info("Push platform %s use provider %s", platform, p.Name())
+	}
+}
+
+// ProcessPushQueue worker send due push until queue empty
+func ProcessPushQueue(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+	for {
+		ml, err := cgbdb.ClaimDuePush(ctx, logger, db, entity.PushBatch)
+		if err != nil || len(ml) == 0 {
+			return
+		}
+		ids := make([]int64, 0, len(ml))
+		for _, msg := range ml {
+			ids = append(ids, msg.Id)
+		}
+		for idx, msg := range ml {
+			if err := deliverPush(ctx, logger, db, msg, ids[idx:]); err != nil {
+				return
+			}
+			if err := cgbdb.UpdatePushResult(ctx, logger, db, msg); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// deliverPush send push to tokens of user not delivered yet. Invalid token is deleted,
+// temporary error schedule retry with backoff, push is failed after max attempts.
+// Lease of leaseIds (this push and the rest of batch) is extended before each token is sent,
+// error is returned only if lease can not be extended, worker stop so other worker take the batch.
+func deliverPush(ctx context.Context, logger runtime.Logger, db *sql.DB, msg *entity.PushMessage, leaseIds []int64) error {
+	msg.Attempts++
+	tokens, err := cgbdb.ListPushToken(ctx, logger, db, msg.UserId, msg.AppPackage)
+	if err != nil {
+		schedulePushRetry(msg, err)
+		return nil
+	}
+	done := make(map[string]bool, len(msg.DoneTokens))
+	for _, t := range msg.DoneTokens {
+		done[t] = true
+	}
+	var retryErr error
+	for _, t := range tokens {
+		if done[t.Token] {
+			continue
+		}
+		provider, exist := pushProviders[t.Platform]
+		if !exist {
+			continue
+		}
+		if err := cgbdb.ExtendPushLease(ctx, logger, db, leaseIds); err != nil {
+			return err
+		}
+		err := provider.Send(ctx, &push.Message{
+			Token: t.Token,
+			Topic: t.AppPackage,
+			Title: msg.Title,
+			Body:  msg.Body,
+			Data:  msg.Data,
+		})
+		switch {
+		case err == nil:
+			msg.DoneTokens = append(msg.DoneTokens, t.Token)
+		case errors.Is(err, push.ErrTokenInvalid):
+			logger.Info("Delete invalid push token of user %s, app %s: %s", t.UserId, t.AppPackage, err.Error())
+			cgbdb.DeletePushToken(ctx, logger, db, "", t.AppPackage, t.Token)
+		case errors.Is(err, push.ErrRejected):
+			logger.Warn("Push %d to user %s rejected by %s: %s", msg.Id, msg.UserId, provider.Name(), err.Error())
+			msg.LastError = err.Error()
+		default:
+			retryErr = err
+		}
+	}
+	if retryErr != nil {
+		schedulePushRetry(msg, retryErr)
+		return nil
+	}
+	msg.Status = entity.PushStatusDone
+	msg.NextAttempt = time.Now()
+	return nil
+}
+
+func schedulePushRetry(msg *entity.PushMessage, err error) {
+	msg.LastError = err.Error()
+	msg.NextAttempt = time.Now().Add(entity.PushRetryDelay(msg.Attempts))
+	if msg.Attempts >= entity.PushMaxAttempts {
+		msg.Status = entity.PushStatusFailed
+	}
+}
+
+func pushTokenError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrPushToken), errors.Is(err, entity.ErrPushPlatform):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// parsePushToken token of payload, app package default to app of session
+func parsePushToken(ctx context.Context, logger runtime.Logger, payload string) (*entity.PushToken, error) {
+	token := &entity.PushToken{}
+	if err := json.Unmarshal([]byte(payload), token); err != nil {
+		logger.Error("Error when unmarshal payload", err.Error())
+		return nil, presenter.ErrUnmarshal
+	}
+	if vars, ok := ctx.Value(runtime.RUNTIME_CTX_VARS).(map[string]string); ok && token.AppPackage == "" {
+		token.AppPackage = vars["app_package"]
+	}
+	return token, nil
+}
+
+// RpcRegisterPushToken save device token of user, client call it on login and when token is refreshed
+func RpcRegisterPushToken() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userId == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		token, err := parsePushToken(ctx, logger, payload)
+		if err != nil {
+			return "", err
+		}
+		token.UserId = userId
+		if err := token.Validate(); err != nil {
+			return "", pushTokenError(err)
+		}
+		if err := cgbdb.UpsertPushToken(ctx, logger, db, token); err != nil {
+			return "", err
+		}
+		return `{"result":"ok"}`, nil
+	}
+}
+
+// RpcUnregisterPushToken delete device token of user, client call it on logout
+func RpcUnregisterPushToken() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userId, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userId == "" {
+			return "", presenter.ErrNoUserIdFound
+		}
+		token, err := parsePushToken(ctx, logger, payload)
+		if err != nil {
+			return "", err
+		}
+		if token.Token == "" || token.AppPackage == "" {
+			return "", pushTokenError(entity.ErrPushToken)
+		}
+		if err := cgbdb.DeletePushToken(ctx, logger, db, userId, token.AppPackage, token.Token); err != nil {
+			return "", err
+		}
+		return `{"result":"ok"}`, nil
+	}
+}
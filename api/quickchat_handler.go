@@ -6,14 +6,128 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	kQuickChatCollection = "quickchat"
+	kQuickChatKey        = "phrases"
+	// blocklist changed by admin is used after this time
+	chatBlocklistReload = time.Minute
+)
+
+var chatFilterCache struct {
+	sync.Mutex
+	filter   *entity.ChatFilter
+	loadTime time.Time
+}
+
+// getChatFilter blocklist filter, reload from db when cache is old. Keep old filter if reload fail.
+func getChatFilter(ctx context.Context, logger runtime.Logger, db *sql.DB) *entity.ChatFilter {
+	chatFilterCache.Lock()
+	defer chatFilterCache.Unlock()
+	if chatFilterCache.filter != nil && time.Since(chatFilterCache.loadTime) < chatBlocklistReload {
+		return chatFilterCache.filter
+	}
+	words, allowed, err := cgbdb.ListChatBlocklist(ctx, db)
+	if err != nil {
+		logger.WithField("err", err).Error("load chat blocklist failed")
+		if chatFilterCache.filter == nil {
+			return entity.NewChatFilter(nil, nil)
+		}
+		return chatFilterCache.filter
+	}
+	chatFilterCache.filter = entity.NewChatFilter(words, allowed)
+	chatFilterCache.loadTime = time.Now()
+	return chatFilterCache.filter
+}
+
+func quickChatError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrQuickChatCount), errors.Is(err, entity.ErrQuickChatLength),
+		errors.Is(err, entity.ErrQuickChatBlocked), errors.Is(err, entity.ErrQuickChatLocale),
+		errors.Is(err, entity.ErrQuickChatReport):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	}
+	return err
+}
+
+// readQuickChatPhrases custom phrases of user. Phrases of old version saved in metadata "qc"
+// are filtered and moved to storage at first read.
+func readQuickChatPhrases(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userID string) (*entity.QuickChatPhrases, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{{
+		Collection: kQuickChatCollection,
+		Key:        kQuickChatKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		logger.Error("StorageRead error: %v", err)
+		return nil, presenter.ErrInternalError
+	}
+	phrases := &entity.QuickChatPhrases{Texts: make([]string, 0)}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].GetValue()), phrases); err != nil {
+			logger.Error("Unmarshal quickchat of user %s error: %v", userID, err)
+		}
+		return phrases, nil
+	}
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(account.User.GetMetadata()), &metadata); err != nil {
+		return nil, errors.New("Corrupted user metadata.")
+	}
+	legacy, _ := metadata["qc"].([]interface{})
+	if len(legacy) == 0 {
+		return phrases, nil
+	}
+	filter := getChatFilter(ctx, logger, db)
+	for _, v := range legacy {
+		text, _ := v.(string)
+		// drop old phrase not allowed anymore, keep the rest
+		if cleaned, err := entity.CleanQuickChatTexts(append(phrases.Texts, text), filter); err == nil {
+			phrases.Texts = cleaned
+		}
+	}
+	if err := writeQuickChatPhrases(ctx, logger, nk, userID, phrases); err != nil {
+		return phrases, nil
+	}
+	query := "UPDATE users SET metadata = metadata - 'qc' WHERE id = $1"
+	if _, err := db.ExecContext(ctx, query, userID); err != nil {
+		logger.WithField("err", err).Error("remove legacy quickchat metadata failed")
+	}
+	logger.Info("Move %d/%d quickchat phrases of user %s to storage", len(phrases.Texts), len(legacy), userID)
+	return phrases, nil
+}
+
+// writeQuickChatPhrases save phrases, other players can read them to show at table
+func writeQuickChatPhrases(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userID string, phrases *entity.QuickChatPhrases) error {
+	out, _ := json.Marshal(phrases)
+	_, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{{
+		Collection:      kQuickChatCollection,
+		Key:             kQuickChatKey,
+		UserID:          userID,
+		Value:           string(out),
+		PermissionRead:  2,
+		PermissionWrite: 0, // No client write.
+	}})
+	if err != nil {
+		logger.Error("StorageWrite error: %v", err)
+		return presenter.ErrInternalError
+	}
+	return nil
+}
+
 func RpcUpdateQuickChat(marshaler *proto.MarshalOptions, unmarshaler *proto.UnmarshalOptions) func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
@@ -26,23 +140,17 @@ func RpcUpdateQuickChat(marshaler *proto.MarshalOptions, unmarshaler *proto.Unma
 			logger.Error("Error when unmarshal payload", err.Error())
 			return "", presenter.ErrUnmarshal
 		}
-
-		ctx2, _ := context.WithTimeout(ctx, 1*time.Second)
-		query := `UPDATE
-					users AS u
-				SET
-					metadata
-						= u.metadata
-						|| jsonb_build_object('qc', $1::text[])
-				WHERE	
-					id = $2;`
-
-		_, err := db.ExecContext(ctx2, query, updateReq.GetTexts(), userID)
-		if err != nil && err != context.DeadlineExceeded {
-			logger.WithField("err", err).Error("db.ExecContext last online update error.")
+		if err := checkSanction(ctx, logger, db, userID, entity.SanctionKindChatMute); err != nil {
+			return "", err
+		}
+		texts, err := entity.CleanQuickChatTexts(updateReq.GetTexts(), getChatFilter(ctx, logger, db))
+		if err != nil {
+			logger.Warn("User %s update quickchat rejected: %s", userID, err.Error())
+			return "", quickChatError(err)
+		}
+		if err := writeQuickChatPhrases(ctx, logger, nk, userID, &entity.QuickChatPhrases{Texts: texts}); err != nil {
 			return "", err
 		}
-
 		return "", nil
 	}
 }
@@ -54,31 +162,186 @@ func RpcGetQuickChat(marshaler *proto.MarshalOptions, unmarshaler *proto.Unmarsh
 			return "", errors.New("Missing user ID.")
 		}
 
-		account, err := nk.AccountGetId(ctx, userID)
+		phrases, err := readQuickChatPhrases(ctx, logger, db, nk, userID)
 		if err != nil {
 			return "", err
 		}
+		resData := &pb.QuickChatResponse{Texts: phrases.Texts}
 
-		var metadata map[string]interface{}
-		if err := json.Unmarshal([]byte(account.User.GetMetadata()), &metadata); err != nil {
-			return "", errors.New("Corrupted user metadata.")
+		// marshaler.EmitUnpopulated = true
+		res, err := marshaler.Marshal(resData)
+		if err != nil {
+			return "", fmt.Errorf("Marharl texts error: %s", err.Error())
 		}
 
-		qcMeta := metadata["qc"]
-		resData := &pb.QuickChatResponse{}
-		if qcMeta != nil {
-			metaText := qcMeta.([]interface{})
-			for _, text := range metaText {
-				resData.Texts = append(resData.Texts, text.(string))
+		return string(res), nil
+	}
+}
+
+// RpcGetQuickChatPreset default phrases in lang of user
+func RpcGetQuickChatPreset() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userID == "" {
+			return "", errors.New("Missing user ID.")
+		}
+		presets, err := cgbdb.ListQuickChatPreset(ctx, logger, db)
+		if err != nil {
+			return "", err
+		}
+		langs, err := cgbdb.GetUserLangTag(ctx, db, userID)
+		if err != nil {
+			logger.WithField("err", err).Error("get lang tag of user failed")
+		}
+		preset := entity.PickQuickChatPreset(presets, langs[userID])
+		if preset == nil {
+			preset = &entity.QuickChatPreset{Texts: make([]string, 0)}
+		}
+		out, _ := json.Marshal(preset)
+		return string(out), nil
+	}
+}
+
+// RpcReportQuickChat player report phrase of other player, phrase reported by enough players is removed
+func RpcReportQuickChat() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok || userID == "" {
+			return "", errors.New("Missing user ID.")
+		}
+		report := &entity.QuickChatReport{}
+		if err := json.Unmarshal([]byte(payload), report); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := report.Validate(); err != nil || report.UserId == userID {
+			return "", quickChatError(entity.ErrQuickChatReport)
+		}
+		report.ReporterId = userID
+		phrases, err := readQuickChatPhrases(ctx, logger, db, nk, report.UserId)
+		if err != nil {
+			return "", err
+		}
+		// only phrase user really has can be reported, preset phrases are not reported
+		owned := false
+		for _, text := range phrases.Texts {
+			owned = owned || text == report.Text
+		}
+		if !owned {
+			return "", presenter.ErrNotFound
+		}
+		count, err := cgbdb.AddQuickChatReport(ctx, logger, db, report)
+		if err != nil {
+			return "", err
+		}
+		if count >= entity.QuickChatReportThreshold {
+			texts := make([]string, 0, len(phrases.Texts))
+			for _, text := range phrases.Texts {
+				if text != report.Text {
+					texts = append(texts, text)
+				}
+			}
+			if err := writeQuickChatPhrases(ctx, logger, nk, report.UserId, &entity.QuickChatPhrases{Texts: texts}); err == nil {
+				logger.Info("Remove quickchat phrase %q of user %s reported by %d players", report.Text, report.UserId, count)
 			}
 		}
+		return `{"result":"ok"}`, nil
+	}
+}
 
-		// marshaler.EmitUnpopulated = true
-		res, err := marshaler.Marshal(resData)
+// RpcUpsertQuickChatPreset set default phrases of a locale, empty texts delete the locale
+func RpcUpsertQuickChatPreset() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		preset := &entity.QuickChatPreset{}
+		if err := json.Unmarshal([]byte(payload), preset); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := preset.Validate(); err != nil {
+			return "", quickChatError(err)
+		}
+		if err := cgbdb.UpsertQuickChatPreset(ctx, logger, db, preset); err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(preset)
+		return string(out), nil
+	}
+}
+
+func RpcListQuickChatPreset() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		presets, err := cgbdb.ListQuickChatPreset(ctx, logger, db)
 		if err != nil {
-			return "", fmt.Errorf("Marharl texts error: %s", err.Error())
+			return "", err
 		}
+		out, _ := json.Marshal(map[string]interface{}{"presets": presets})
+		return string(out), nil
+	}
+}
 
-		return string(res), nil
+// RpcUpdateChatBlocklist add and remove blocked and allowed words, return whole blocklist and allowlist
+func RpcUpdateChatBlocklist() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.QuickChatBlocklistRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if err := cgbdb.UpdateChatBlocklist(ctx, logger, db, req); err != nil {
+			return "", err
+		}
+		words, allowed, err := cgbdb.ListChatBlocklist(ctx, db)
+		if err != nil {
+			return "", err
+		}
+		// next check reload blocklist
+		chatFilterCache.Lock()
+		chatFilterCache.filter = nil
+		chatFilterCache.Unlock()
+		out, _ := json.Marshal(map[string]interface{}{"words": words, "allow_words": allowed})
+		return string(out), nil
+	}
+}
+
+// RpcListQuickChatReport newest reports, filter by reported user
+func RpcListQuickChatReport() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.QuickChatReportRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Limit <= 0 || req.Limit > 100 {
+			req.Limit = 100
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListQuickChatReport(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListQuickChatReport{Reports: ml})
+		return string(out), nil
 	}
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+// RpcReferDashboard invitees of user with fee this week, lifetime earning, active state and join date,
+// and weekly series of invitee fee and reward for chart
+func RpcReferDashboard() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if !ok {
+			return "", errors.New("Missing user ID.")
+		}
+		req := &entity.ReferDashboardRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if err := req.Normalize(); err != nil {
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		now := time.Now()
+		beginWeek, endWeek := entity.RangeWeek(now)
+
+		program := getReferProgram(ctx, logger, nk)
+		dashboard, err := cgbdb.GetReferDashboardSummary(ctx, logger, db, userID, program.MaxLevel(),
+			beginWeek.Unix(), endWeek.Unix(), program.MinInviteeFee)
+		if err != nil {
+			return "", presenter.ErrInternalError
+		}
+		dashboard.Invitees, err = cgbdb.ListReferDashboardInvitees(ctx, logger, db, userID, program.MaxLevel(),
+			beginWeek.Unix(), endWeek.Unix(), req)
+		if err != nil {
+			return "", presenter.ErrInternalError
+		}
+		for _, invitee := range dashboard.Invitees {
+			invitee.Active = program.IsActive(invitee.FeeThisWeek)
+		}
+
+		pageIds := make([]string, 0, len(dashboard.Invitees))
+		for _, invitee := range dashboard.Invitees {
+			pageIds = append(pageIds, invitee.UserId)
+		}
+		profiles, err := cgbdb.GetProfileUsers(ctx, db, pageIds...)
+		if err != nil {
+			logger.Error("Get profile of invitees user %s error %s", userID, err.Error())
+			return "", presenter.ErrInternalError
+		}
+		mapProfile := profiles.ToMap()
+		for _, invitee := range dashboard.Invitees {
+			profile, exist := mapProfile[invitee.UserId]
+			if !exist {
+				continue
+			}
+			name := profile.GetDisplayName()
+			if name == "" {
+				name = profile.GetUserName()
+			}
+			invitee.DisplayName = entity.MaskName(name)
+			invitee.UserSid = profile.GetUserSid()
+			invitee.AvatarId = profile.GetAvatarId()
+		}
+
+		// only reward in range of chart is loaded
+		dashboard.Series = entity.ReferWeekSeries(now, req.Weeks)
+		rewards, err := cgbdb.ListRewardReferByUserId(ctx, logger, db, userID, dashboard.Series[0].FromUnix, endWeek.Unix())
+		if err != nil {
+			return "", presenter.ErrInternalError
+		}
+		for _, r := range rewards {
+			for _, point := range dashboard.Series {
+				if r.GetFromUnix() < point.FromUnix || r.GetFromUnix() > point.ToUnix {
+					continue
+				}
+				point.Reward += r.GetEstReward()
+				for _, u := range r.GetUserRefers() {
+					point.Fee += u.GetWinAmt()
+					if program.IsActive(u.GetWinAmt()) {
+						point.ActiveInvitees++
+					}
+				}
+			}
+		}
+		out, _ := json.Marshal(dashboard)
+		return string(out), nil
+	}
+}
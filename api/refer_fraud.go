@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+const referReviewDefaultLimit = 100
+
+// flagReferCluster new invitee share fingerprint with many invitees of same invitor,
+// invitor is put in review queue and refer reward is held until admin clear
+func flagReferCluster(ctx context.Context, logger runtime.Logger, db *sql.DB, invitorId, inviteeId string) {
+	counts, err := cgbdb.CountInviteeSharedFingerprint(ctx, logger, db, invitorId, inviteeId, entity.ReferClusterFingerprintKinds)
+	if err != nil {
+		return
+	}
+	detail := make(map[string]interface{})
+	for kind, count := range counts {
+		// cluster include new invitee
+		if count+1 >= entity.ReferClusterThreshold {
+			detail[kind] = count + 1
+		}
+	}
+	if len(detail) == 0 {
+		return
+	}
+	detail["invitee_id"] = inviteeId
+	logger.Warn("Refer cluster invitor %s, invitee %s, detail %v", invitorId, inviteeId, detail)
+	cgbdb.AddReferReview(ctx, logger, db, &entity.ReferReview{
+		UserId: invitorId,
+		Reason: entity.ReferReviewReasonCluster,
+		Detail: detail,
+	})
+}
+
+// RpcListReferReview list flagged invitors, filter by status
+func RpcListReferReview() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.ReferReviewRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Limit <= 0 || req.Limit > referReviewDefaultLimit {
+			req.Limit = referReviewDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListReferReview(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListReferReview{Reviews: ml})
+		return string(out), nil
+	}
+}
+
+// RpcUpdateReferReview admin clear a pending review to release held refer reward, or reject it to void held reward
+func RpcUpdateReferReview() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.ReferReviewRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if req.Id <= 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		if req.Status == nil || (*req.Status != entity.ReferReviewStatusCleared && *req.Status != entity.ReferReviewStatusRejected) {
+			return "", runtime.NewError(entity.ErrReferReviewStatus.Error(), presenter.ErrInvalidInput.Code)
+		}
+		if err := cgbdb.UpdateReferReviewStatus(ctx, logger, db, req.Id, *req.Status, req.Note); err != nil {
+			return "", err
+		}
+		return `{"result":"ok"}`, nil
+	}
+}
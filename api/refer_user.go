@@ -6,15 +6,14 @@ import (
 	"encoding/json"
 	"errors"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/conf"
-	"github.com/nk-nigeria/lobby-module/constant"
 	"github.com/nk-nigeria/lobby-module/entity"
-	"github.com/nk-nigeria/cgp-common/lib"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 )
 
@@ -120,6 +119,110 @@ func InitReferUserReward(ctx context.Context, logger runtime.Logger, nk runtime.
 	}
 }
 
+const kReferProgramKey = "refer-program"
+
+// refer program changed by admin is used by all nodes after this time
+const referProgramReload = 30 * time.Second
+
+var referProgramCache struct {
+	sync.Mutex
+	program  *entity.ReferProgram
+	loadTime time.Time
+}
+
+// getReferProgram refer program in storage, default if not set. Keep old program if reload fail.
+func getReferProgram(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) *entity.ReferProgram {
+	referProgramCache.Lock()
+	defer referProgramCache.Unlock()
+	if referProgramCache.program != nil && time.Since(referProgramCache.loadTime) < referProgramReload {
+		return referProgramCache.program
+	}
+	program, err := readReferProgram(ctx, logger, nk)
+	if err != nil {
+		if referProgramCache.program == nil {
+			return entity.DefaultReferProgram
+		}
+		return referProgramCache.program
+	}
+	referProgramCache.program = program
+	referProgramCache.loadTime = time.Now()
+	return program
+}
+
+func readReferProgram(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) (*entity.ReferProgram, error) {
+	objects, err := nk.StorageRead(ctx, []*runtime.StorageRead{
+		{
+			Collection: kReferRewardCollection,
+			Key:        kReferProgramKey,
+		},
+	})
+	if err != nil {
+		logger.Error("Error when read refer program, error %s", err.Error())
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return entity.DefaultReferProgram, nil
+	}
+	program := &entity.ReferProgram{}
+	if err := json.Unmarshal([]byte(objects[0].GetValue()), program); err != nil {
+		logger.Error("Unmarshal refer program error %s", err.Error())
+		return entity.DefaultReferProgram, nil
+	}
+	if err := program.Validate(); err != nil {
+		logger.Error("Invalid refer program %s, use default", err.Error())
+		return entity.DefaultReferProgram, nil
+	}
+	return program, nil
+}
+
+func RpcGetReferProgram() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		out, _ := json.Marshal(getReferProgram(ctx, logger, nk))
+		return string(out), nil
+	}
+}
+
+// RpcSetReferProgram set refer levels, weekly cap and min invitee fee, apply from next est
+func RpcSetReferProgram() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		program := &entity.ReferProgram{}
+		if err := json.Unmarshal([]byte(payload), program); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := program.Validate(); err != nil {
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		out, _ := json.Marshal(program)
+		_, err := nk.StorageWrite(ctx, []*runtime.StorageWrite{
+			{
+				Collection:      kReferRewardCollection,
+				Key:             kReferProgramKey,
+				Value:           string(out),
+				PermissionRead:  2,
+				PermissionWrite: 0,
+			},
+		})
+		if err != nil {
+			logger.Error("Write refer program error %s", err.Error())
+			return "", presenter.ErrInternalError
+		}
+		referProgramCache.Lock()
+		referProgramCache.program = program
+		referProgramCache.loadTime = time.Now()
+		referProgramCache.Unlock()
+		return string(out), nil
+	}
+}
+
 func RpcEstRewardThisWeek() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
 	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
@@ -258,47 +361,60 @@ func EstRewardByUserId(ctx context.Context, logger runtime.Logger, db *sql.DB, n
 			break
 		}
 	}
-	rewardRefer.UserRefers, err = EstRewardFromReferredUser(ctx, logger, db, nk, req)
+	invitees, err := EstRewardFromReferredUser(ctx, logger, db, nk, req)
 	if err != nil {
 		logger.Error("EstRewardFromReferredUser %s err %s", userID, err.Error())
 		// return "",
 		return nil, errors.New("Est reward from referred user error")
 	}
-	for _, r := range rewardRefer.GetUserRefers() {
-		r.EstRewardLv = rewardRefer.EstRewardLv
-		r.EstReward = int64(float32(r.WinAmt) * rewardRefer.EstRateReward)
-		rewardRefer.EstReward += r.EstReward
+	program := getReferProgram(ctx, logger, nk)
+	result := program.Reward(rewardRefer.EstRateReward, invitees)
+	if result.Capped {
+		logger.Info("Refer reward user %s reach weekly cap %d", userID, program.WeeklyCap)
+	}
+	for _, invitee := range result.Invitees {
+		rewardRefer.UserRefers = append(rewardRefer.UserRefers, &pb.RewardRefer{
+			UserId:      invitee.UserId,
+			WinAmt:      invitee.Fee,
+			FromUnix:    req.From,
+			ToUnix:      req.To,
+			EstRewardLv: rewardRefer.EstRewardLv,
+			EstReward:   invitee.Reward,
+		})
 	}
+	rewardRefer.EstReward = result.Total
 
 	rewardRefer.FromUnix = req.From
 	rewardRefer.ToUnix = req.To
-	_, err = cgbdb.AddOrUpdateIfExistRewardRefer(ctx, logger, db, rewardRefer)
+	if _, err = cgbdb.AddOrUpdateIfExistRewardRefer(ctx, logger, db, rewardRefer); err != nil {
+		return rewardRefer, err
+	}
+	err = cgbdb.UpdateRewardReferLevel(ctx, logger, db, rewardRefer, result.LevelRewards)
 	return rewardRefer, err
 }
 
-func EstRewardFromReferredUser(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *entity.FeeGameListCursor) ([]*pb.RewardRefer, error) {
-	listReferUser, err := cgbdb.ListUserInvitedByUserId(ctx, logger, db, req.UserId)
+// EstRewardFromReferredUser fee of all users under inviter, up to max level of refer program
+func EstRewardFromReferredUser(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, req *entity.FeeGameListCursor) ([]*entity.ReferInvitee, error) {
+	listReferUser, err := cgbdb.ListReferTree(ctx, logger, db, req.UserId, getReferProgram(ctx, logger, nk).MaxLevel())
 	if err != nil {
 		logger.Error("Get list user prefer by user %s err %s", req.UserId, err.Error())
 		return nil, err
 	}
-	listUserPreferReward := make([]*pb.RewardRefer, 0, len(listReferUser))
+	listUserPreferReward := make([]*entity.ReferInvitee, 0, len(listReferUser))
 	for _, preferUser := range listReferUser {
 		sumFee, err := cgbdb.GetSumFeeByUserId(ctx, logger, db, &entity.FeeGameListCursor{
-			UserId: preferUser.UserInvitee,
+			UserId: preferUser.UserId,
 			From:   req.From,
 			To:     req.To,
 		})
 		if err != nil {
 			return nil, presenter.ErrInternalError
 		}
-		rewardRefer := &pb.RewardRefer{
-			UserId:   preferUser.UserInvitee,
-			WinAmt:   sumFee.Fee,
-			FromUnix: req.From,
-			ToUnix:   req.To,
-		}
-		listUserPreferReward = append(listUserPreferReward, rewardRefer)
+		listUserPreferReward = append(listUserPreferReward, &entity.ReferInvitee{
+			UserId: preferUser.UserId,
+			Level:  preferUser.Level,
+			Fee:    sumFee.Fee,
+		})
 	}
 	return listUserPreferReward, nil
 }
@@ -346,22 +462,20 @@ func SendReferRewardToWallet(ctx context.Context, logger runtime.Logger, db *sql
 		if len(listReward) == 0 {
 			return
 		}
-		metadata := make(map[string]interface{})
-		metadata["action"] = entity.WalletActionReferReward
-		metadata["sender"] = constant.UUID_USER_SYSTEM
-
-		wallet := lib.Wallet{}
 		for _, reward := range listReward {
-			wallet.UserId = reward.UserId
-			wallet.Chips = reward.EstReward
-			metadata["recv"] = reward.UserId
-			err = entity.AddChipWalletUser(ctx, nk, logger, reward.UserId, wallet, metadata)
+			// each level is a claim outbox, worker retry if apply fail
+			listOutbox, err := cgbdb.ClaimRewardRefer(ctx, logger, db, reward.Id)
 			if err != nil {
-				logger.Error("AddChipWalletUser for reward refer error %s", err.Error())
+				logger.Error("ClaimRewardRefer id %d error %s", reward.Id, err.Error())
 				return
 			}
-			logger.Info("Send %d chips for refer reward id %d", wallet.Chips, reward.Id)
-			cgbdb.UpdateRewardReferHasSendToWallet(ctx, logger, db, reward.Id)
+			for _, outbox := range listOutbox {
+				if err := ApplyClaimOutbox(ctx, logger, db, nk, outbox.Id); err != nil {
+					logger.WithField("claim id", outbox.Id).WithField("err", err).Error("apply claim outbox failed, worker will retry")
+					continue
+				}
+				logger.Info("Send %d chips for refer reward id %d level %s", outbox.Chips, reward.Id, outbox.Metadata["refer_level"])
+			}
 		}
 	}
 }
@@ -3,13 +3,17 @@ package api
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/nk-nigeria/lobby-module/api/presenter"
 	"github.com/nk-nigeria/lobby-module/cgbdb"
 	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
 	"github.com/nk-nigeria/cgp-common/define"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 )
@@ -59,11 +63,12 @@ func RpcRuleLuckyAdd() func(context.Context, runtime.Logger, *sql.DB, runtime.Na
 			logger.WithField("err", err).Error("Error when unmarshal payload")
 			return "", presenter.ErrUnmarshal
 		}
-		err = cgbdb.InsertRulesLucky(ctx, db, req)
+		versionId, err := cgbdb.InsertRulesLucky(ctx, db, req)
 		if err != nil {
 			logger.WithField("err", err).Error("Error when insert rules lucky")
-			return "", presenter.ErrInternalError
+			return "", ruleLuckyError(err)
 		}
+		logger.Info("Add rule lucky %d game %s, version %d", req.Id, req.GameCode, versionId)
 		dataJson, _ := conf.MarshalerDefault.Marshal(req)
 		// nk.Event(ctx, &api.Event{
 		// 	Name:       define.NakEventRuleLuckyChange,
@@ -90,11 +95,12 @@ func RpcRuleLuckyUpdate() func(context.Context, runtime.Logger, *sql.DB, runtime
 			logger.WithField("err", err).Error("Error when unmarshal payload")
 			return "", presenter.ErrUnmarshal
 		}
-		result, err := cgbdb.UpdateRulesLucky(ctx, db, req)
+		result, versionId, err := cgbdb.UpdateRulesLucky(ctx, db, req)
 		if err != nil {
-			logger.WithField("err", err).Error("Error when insert rules lucky")
-			return "", presenter.ErrInternalError
+			logger.WithField("err", err).Error("Error when update rules lucky")
+			return "", ruleLuckyError(err)
 		}
+		logger.Info("Update rule lucky %d game %s, version %d", result.Id, result.GameCode, versionId)
 		dataJson, _ := conf.MarshalerDefault.Marshal(result)
 
 		return string(dataJson), nil
@@ -121,11 +127,12 @@ func RpcRuleLuckyDelete() func(context.Context, runtime.Logger, *sql.DB, runtime
 		if req.Id <= 0 {
 			return "", nil
 		}
-		err = cgbdb.DeleteRulesLucky(ctx, db, req.Id)
+		versionId, err := cgbdb.DeleteRulesLucky(ctx, db, req.Id)
 		if err != nil {
-			logger.WithField("err", err).Error("Error when insert rules lucky")
+			logger.WithField("err", err).Error("Error when delete rules lucky")
 			return "", presenter.ErrInternalError
 		}
+		logger.Info("Delete rule lucky %d, version %d", req.Id, versionId)
 		return "", nil
 	}
 }
@@ -151,11 +158,123 @@ func RpcRuleLuckyEmitEvemt() func(context.Context, runtime.Logger, *sql.DB, runt
 			return "", nil
 		}
 		_ = cgbdb.UpdateEmitEventLucky(ctx, db, req)
+		// game reload rules of game_code, version_id is last change of rules in game
+		versionId, _ := cgbdb.LatestRulesLuckyVersionId(ctx, db, req.GameCode)
 		nk.Event(ctx, &api.Event{
-			Name:       define.NakEventRuleLuckyChange,
-			Properties: map[string]string{"game_code": req.GameCode},
+			Name: define.NakEventRuleLuckyChange,
+			Properties: map[string]string{
+				"game_code":  req.GameCode,
+				"version_id": strconv.FormatInt(versionId, 10),
+			},
 		})
 		return "", nil
 
 	}
 }
+
+// RpcRuleLuckyVersions list versions of a rule or a game, newest first
+func RpcRuleLuckyVersions() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unath.")
+		}
+		req := &entity.RuleLuckyVersionRequest{}
+		if len(payload) > 0 {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.WithField("err", err).Error("Error when unmarshal payload")
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Limit <= 0 || req.Limit > entity.RuleLuckyVersionDefaultLimit {
+			req.Limit = entity.RuleLuckyVersionDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListRulesLuckyVersion(ctx, db, req)
+		if err != nil {
+			logger.WithField("err", err).Error("Error when query rules lucky version")
+			return "", presenter.ErrInternalError
+		}
+		out, _ := json.Marshal(&entity.ListRuleLuckyVersion{Versions: ml})
+		return string(out), nil
+	}
+}
+
+// RpcRuleLuckyRollback restore rule to a version, event is emitted by rule_lucky_emit_event as other changes
+func RpcRuleLuckyRollback() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unath.")
+		}
+		req := &entity.RuleLuckyVersionRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.WithField("err", err).Error("Error when unmarshal payload")
+			return "", presenter.ErrUnmarshal
+		}
+		if req.VersionId <= 0 {
+			return "", presenter.ErrInvalidInput
+		}
+		result, versionId, err := cgbdb.RollbackRulesLucky(ctx, db, req.VersionId)
+		if err != nil {
+			logger.WithField("err", err).Error("Error when rollback rules lucky")
+			return "", ruleLuckyError(err)
+		}
+		logger.Info("Rollback rule lucky %d to version %d, new version %d", result.Id, req.VersionId, versionId)
+		dataJson, _ := conf.MarshalerDefault.Marshal(result)
+		return string(dataJson), nil
+	}
+}
+
+func ruleLuckyError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrRuleLuckyRange), errors.Is(err, entity.ErrRuleLuckyOverlap):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	case errors.Is(err, entity.ErrRuleLuckyNotFound), errors.Is(err, entity.ErrRuleLuckyVersionNotFound):
+		return runtime.NewError(err.Error(), presenter.ErrNotFound.Code)
+	}
+	return presenter.ErrInternalError
+}
+
+// RpcSimulateRuleLucky dry-run candidate rules of a game on sample user states,
+// report rule each user match under current and candidate rules
+func RpcSimulateRuleLucky() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unath.")
+		}
+		req := &entity.SimulateRuleLuckyRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.WithField("err", err).Error("Error when unmarshal payload")
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Normalize(); err != nil {
+			return "", runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+		}
+		oldRules, err := cgbdb.CurrentLuckyRuleMatchers(ctx, db, req.GameCode)
+		if err != nil {
+			logger.WithField("err", err).Error("Error when query rules lucky")
+			return "", presenter.ErrInternalError
+		}
+		entity.NumberNewLuckyRules(req.Rules)
+		newRules, overlaps, err := cgbdb.CandidateLuckyRuleMatchers(req.GameCode, req.Rules)
+		if err != nil {
+			return "", ruleLuckyError(err)
+		}
+		users := req.Users
+		if len(users) == 0 {
+			from := time.Now().AddDate(0, 0, -req.Days)
+			users, err = cgbdb.SampleLuckyUserStates(ctx, logger, db, req.GameCode, from, req.Limit)
+			if err != nil {
+				return "", presenter.ErrInternalError
+			}
+		}
+		result := entity.SimulateRuleLucky(req.GameCode, oldRules, newRules, users)
+		result.Overlaps = overlaps
+		out, _ := json.Marshal(result)
+		return string(out), nil
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	nkapi "github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/api/presenter"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
+)
+
+const (
+	// user of facebook token verified by nakama is kept this long
+	facebookTokenTTL = time.Hour
+	// cache is cleared of expired tokens when it grow to this size
+	facebookTokenCacheSize = 10000
+)
+
+// facebookTokenCache user of facebook token by hash of token, filled after nakama verify token
+var facebookTokenCache struct {
+	sync.Mutex
+	users map[string]facebookTokenUser
+}
+
+type facebookTokenUser struct {
+	userId string
+	expire time.Time
+}
+
+func facebookTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func cacheFacebookToken(token, userId string) {
+	facebookTokenCache.Lock()
+	defer facebookTokenCache.Unlock()
+	now := time.Now()
+	if facebookTokenCache.users == nil {
+		facebookTokenCache.users = make(map[string]facebookTokenUser)
+	}
+	if len(facebookTokenCache.users) >= facebookTokenCacheSize {
+		for k, u := range facebookTokenCache.users {
+			if now.After(u.expire) {
+				delete(facebookTokenCache.users, k)
+			}
+		}
+	}
+	if len(facebookTokenCache.users) < facebookTokenCacheSize {
+		facebookTokenCache.users[facebookTokenKey(token)] = facebookTokenUser{userId: userId, expire: now.Add(facebookTokenTTL)}
+	}
+}
+
+func cachedFacebookUser(token string) string {
+	facebookTokenCache.Lock()
+	defer facebookTokenCache.Unlock()
+	u, ok := facebookTokenCache.users[facebookTokenKey(token)]
+	if !ok || time.Now().After(u.expire) {
+		return ""
+	}
+	return u.userId
+}
+
+func sanctionError(err error) error {
+	switch {
+	case errors.Is(err, entity.ErrSanctionKind), errors.Is(err, entity.ErrSanctionUser),
+		errors.Is(err, entity.ErrSanctionReason), errors.Is(err, entity.ErrSanctionDuration):
+		return runtime.NewError(err.Error(), presenter.ErrInvalidInput.Code)
+	case errors.Is(err, entity.ErrSanctionNotFound):
+		return runtime.NewError(err.Error(), presenter.ErrNotFound.Code)
+	}
+	return err
+}
+
+// checkSanction error with reason and end time if user has active sanction of kind.
+// Db error does not block user.
+func checkSanction(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, kind string) error {
+	s, err := cgbdb.GetActiveSanction(ctx, db, userId, kind)
+	if err != nil {
+		logger.WithField("err", err).WithField("user", userId).Error("check sanction failed")
+		return nil
+	}
+	if s == nil {
+		return nil
+	}
+	return runtime.NewError(s.Message(), presenter.ErrUserSanctioned.Code)
+}
+
+// BeforeAuthDevice reject banned user login by device, and flagged user login from device not used before
+func BeforeAuthDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, in *nkapi.AuthenticateDeviceRequest) error {
+	deviceId := in.GetAccount().GetId()
+	if deviceId == "" {
+		return nil
+	}
+	// session keep device id for device policy, device auth is proof of device so client var is ignored
+	if in.Account.Vars == nil {
+		in.Account.Vars = make(map[string]string)
+	}
+	in.Account.Vars[entity.DeviceVarId] = deviceId
+	userId, err := cgbdb.GetUserIdByDevice(ctx, db, deviceId)
+	if err != nil {
+		logger.WithField("err", err).Error("get user by device failed")
+		return nil
+	}
+	if err := checkSanction(ctx, logger, db, userId, entity.SanctionKindBan); err != nil {
+		return err
+	}
+	deviceId, _ = entity.NormalizeDevice(deviceId, "")
+	if err := checkRevokedDevice(ctx, logger, db, userId, deviceId); err != nil {
+		return err
+	}
+	return checkNewDevice(ctx, logger, db, userId, deviceId)
+}
+
+// BeforeAuthFacebook reject banned user login by facebook, and flagged user login from new device.
+// Request has only access token, user is known only if token was verified by nakama before,
+// other logins are checked in AfterAuthFacebook.
+func BeforeAuthFacebook(ctx context.Context, logger runtime.Logger, db *sql.DB, in *nkapi.AuthenticateFacebookRequest) error {
+	token := in.GetAccount().GetToken()
+	if token == "" {
+		return nil
+	}
+	userId := cachedFacebookUser(token)
+	if userId == "" {
+		return nil
+	}
+	return checkFacebookLogin(ctx, logger, db, userId, in)
+}
+
+// checkFacebookLogin device id of facebook login is sent by client, revoked device is rejected.
+// New device is blocked only if device id is verified by device auth linked to the user,
+// device id client send alone is not checked.
+func checkFacebookLogin(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, in *nkapi.AuthenticateFacebookRequest) error {
+	if err := checkSanction(ctx, logger, db, userId, entity.SanctionKindBan); err != nil {
+		return err
+	}
+	deviceId, _ := entity.NormalizeDevice(in.GetAccount().GetVars()[entity.DeviceVarId], "")
+	if err := checkRevokedDevice(ctx, logger, db, userId, deviceId); err != nil {
+		return err
+	}
+	if deviceId == "" {
+		return nil
+	}
+	linked, err := cgbdb.GetUserIdByDevice(ctx, db, deviceId)
+	if err != nil {
+		logger.WithField("err", err).Error("get user by device failed")
+		return nil
+	}
+	if linked != userId {
+		return nil
+	}
+	return checkNewDevice(ctx, logger, db, userId, deviceId)
+}
+
+// kickBannedUser invalidate tokens and close sockets so banned user must login again
+func kickBannedUser(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, userId string) {
+	if err := nk.SessionLogout(userId, "", ""); err != nil {
+		logger.WithField("err", err).WithField("user", userId).Error("logout banned user failed")
+	}
+	presences, err := nk.StreamUserList(cgbdb.StreamModeNotifications, userId, "", "", true, true)
+	if err != nil {
+		return
+	}
+	for _, p := range presences {
+		if err := nk.SessionDisconnect(ctx, p.GetSessionId(), runtime.PresenceReasonDisconnect); err != nil {
+			logger.WithField("err", err).WithField("session", p.GetSessionId()).Warn("disconnect banned user failed")
+		}
+	}
+}
+
+func RpcApplySanction() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.SanctionRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Validate(); err != nil {
+			return "", sanctionError(err)
+		}
+		if _, err := nk.AccountGetId(ctx, req.UserId); err != nil {
+			return "", presenter.ErrUserNotFound
+		}
+		sanction := req.Sanction(time.Now())
+		if err := cgbdb.AddSanction(ctx, logger, db, sanction); err != nil {
+			return "", err
+		}
+		if sanction.Kind == entity.SanctionKindBan {
+			kickBannedUser(ctx, logger, nk, sanction.UserId)
+		}
+		logger.Info("Sanction %s user %s by %s, end %d, reason: %s",
+			sanction.Kind, sanction.UserId, sanction.Issuer, sanction.EndTimeUnix, sanction.Reason)
+		out, _ := json.Marshal(sanction)
+		return string(out), nil
+	}
+}
+
+func RpcLiftSanction() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.SanctionLiftRequest{}
+		if err := json.Unmarshal([]byte(payload), req); err != nil {
+			logger.Error("Error when unmarshal payload", err.Error())
+			return "", presenter.ErrUnmarshal
+		}
+		if err := req.Validate(); err != nil {
+			return "", sanctionError(err)
+		}
+		count, err := cgbdb.LiftSanction(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "", sanctionError(entity.ErrSanctionNotFound)
+		}
+		logger.Info("Lift %d sanction id %d user %s kind %s by %s", count, req.Id, req.UserId, req.Kind, req.LiftBy)
+		out, _ := json.Marshal(map[string]int64{"lifted": count})
+		return string(out), nil
+	}
+}
+
+func RpcListSanction() func(context.Context, runtime.Logger, *sql.DB, runtime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+		userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+		if userID != "" {
+			return "", errors.New("Unauth")
+		}
+		req := &entity.SanctionListRequest{}
+		if payload != "" {
+			if err := json.Unmarshal([]byte(payload), req); err != nil {
+				logger.Error("Error when unmarshal payload", err.Error())
+				return "", presenter.ErrUnmarshal
+			}
+		}
+		if req.Kind != "" && !entity.IsSanctionKind(req.Kind) {
+			return "", sanctionError(entity.ErrSanctionKind)
+		}
+		if req.Limit <= 0 || req.Limit > 100 {
+			req.Limit = entity.SanctionDefaultLimit
+		}
+		if req.Offset < 0 {
+			req.Offset = 0
+		}
+		ml, err := cgbdb.ListSanction(ctx, logger, db, req)
+		if err != nil {
+			return "", err
+		}
+		out, _ := json.Marshal(&entity.ListSanction{Sanctions: ml})
+		return string(out), nil
+	}
+}
@@ -21,6 +21,8 @@ import (
 
 	"github.com/heroiclabs/nakama-common/api"
 	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+	"github.com/nk-nigeria/lobby-module/entity"
 )
 
 const (
@@ -37,6 +39,10 @@ func RegisterSessionEvents(db *sql.DB, nk runtime.NakamaModule, initializer runt
 		return err
 	}
 
+	if err := initializer.RegisterAfterSessionRefresh(afterSessionRefresh); err != nil {
+		return err
+	}
+
 	initializer.RegisterBeforeSessionLogout(func(ctx context.Context,
 		logger runtime.Logger,
 		db *sql.DB, nk runtime.NakamaModule,
@@ -47,14 +53,13 @@ func RegisterSessionEvents(db *sql.DB, nk runtime.NakamaModule, initializer runt
 			logger.Error("context did not contain user ID.")
 			return in, nil
 		}
-		// Force disconnect the socket for the user's other game client.
+		// Force disconnect the socket for the user's other game client, or only this device if device policy allow many sessions.
 		presences, err := nk.StreamUserList(streamModeNotification, userID, "", "", true, true)
 		if err != nil || len(presences) == 0 {
 			logger.WithField("err", err).Error("nk.StreamUserList error.")
 			return in, nil
 		}
-		for _, presence := range presences {
-			sessionId := presence.GetSessionId()
+		for _, sessionId := range logoutSessionIds(ctx, logger, db, nk, userID, presences) {
 			if err := nk.SessionDisconnect(ctx, sessionId); err != nil {
 				logger.WithField("err", err).Error("nk.SessionDisconnect error.")
 				return in, nil
@@ -75,6 +80,8 @@ func eventSessionEndFunc(nk runtime.NakamaModule, db *sql.DB) func(context.Conte
 			return
 		}
 		// saveSecsOnlineNotClaimReward(ctx, logger, nk, db)
+		sessionID, _ := ctx.Value(runtime.RUNTIME_CTX_SESSION_ID).(string)
+		trackPlaytime(ctx, logger, db, userID, entity.PlaytimeKindOnline, sessionID, false)
 
 		// Restrict the time allowed with the DB operation so we can fail fast in a stampeding herd scenario.
 		ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -96,7 +103,7 @@ func eventSessionEndFunc(nk runtime.NakamaModule, db *sql.DB) func(context.Conte
 	}
 }
 
-// Limit the number of concurrent realtime sessions active for a user to just one.
+// Limit the number of concurrent realtime sessions active for a user by device policy.
 func eventSessionStartFunc(nk runtime.NakamaModule, db *sql.DB) func(context.Context, runtime.Logger, *api.Event) {
 	return func(ctx context.Context, logger runtime.Logger, evt *api.Event) {
 		userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
@@ -111,42 +118,13 @@ func eventSessionStartFunc(nk runtime.NakamaModule, db *sql.DB) func(context.Con
 			return
 		}
 
-		ResetUserDailyReward(ctx, logger, nk)
-
-		// Fetch all live presences for this user on their private notification stream.
-		{
-			presences, err := nk.StreamUserList(streamModeNotification, userID, "", "", true, true)
-			if err != nil {
-				logger.WithField("err", err).Error("nk.StreamUserList error.")
-				return
-			}
-
-			notifications := []*runtime.NotificationSend{
-				{
-					Code: notificationCodeSingleDevice,
-					Content: map[string]interface{}{
-						"kicked_by": sessionID,
-					},
-					Persistent: false,
-					Sender:     userID,
-					Subject:    "Another device is active!",
-					UserID:     userID,
-				},
-			}
-			for _, presence := range presences {
-				if presence.GetUserId() == userID && presence.GetSessionId() == sessionID {
-					// Ignore our current socket connection.
-					continue
-				}
-				ctx2, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-				defer cancel()
-				if err := nk.NotificationsSend(ctx2, notifications); err != nil {
-					logger.WithField("err", err).Error("nk.NotificationsSend error.")
-					continue
-				}
-
-			}
+		trackPlaytime(ctx, logger, db, userID, entity.PlaytimeKindOnline, sessionID, true)
+		if clientIP, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string); clientIP != "" {
+			_ = cgbdb.AddUserFingerprint(ctx, logger, db, entity.NetworkFingerprints(userID, clientIP)...)
 		}
+
+		// Limit live sessions of user by device policy, single device by default.
+		enforceDevicePolicy(ctx, logger, db, nk, userID, sessionID)
 		// save login info
 		{
 			ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
@@ -156,12 +134,12 @@ func eventSessionStartFunc(nk runtime.NakamaModule, db *sql.DB) func(context.Con
 					metadata
 						= u.metadata
 						|| jsonb_build_object('last_login_time_unix', extract('epoch' FROM now())::BIGINT,
-																	'last_login_device_id', 'todo',
-																	'last_login_ip', 'todo')
+																	'last_login_ip', $2::text)
 				WHERE	
 					id = $1;`
 
-			_, err := db.ExecContext(ctx2, query, userID)
+			clientIP, _ := ctx.Value(runtime.RUNTIME_CTX_CLIENT_IP).(string)
+			_, err := db.ExecContext(ctx2, query, userID, clientIP)
 			cancel()
 			if err != nil && err != context.DeadlineExceeded {
 				logger.WithField("err", err).Error("db.ExecContext last online update error.")
@@ -173,24 +151,35 @@ func eventSessionStartFunc(nk runtime.NakamaModule, db *sql.DB) func(context.Con
 
 }
 
-func ResetUserDailyReward(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule) {
-	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
-	if !ok {
-		logger.Error("context did not contain user ID.")
-		return
-	}
-	lastClaim, lastClaimObject, err := GetLastDailyRewardObject(ctx, logger, nk)
+// notifySingleDevice tell other sessions of user to logout, client compare kicked_by with its session.
+func notifySingleDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userID, sessionID string, presences []runtime.Presence) {
+	subject, _, _, err := newNotiRenderer(logger, db).Render(ctx, entity.NotiTplSingleDevice, userID, nil)
 	if err != nil {
-		logger.Error("GetLastDailyRewardObject error %s", err.Error())
-		return
+		logger.WithField("err", err).Error("Render single device notification error.")
 	}
-	lastClaim.NextClaimUnix = 0
-	lastClaim.LastClaimUnix = time.Now().Unix()
-	lastClaim.LastSpinNumber = 0
-	lastClaim.Streak = 0
-	version := ""
-	if lastClaimObject != nil {
-		version = lastClaimObject.GetVersion()
+	notifications := []*runtime.NotificationSend{
+		{
+			Code: notificationCodeSingleDevice,
+			Content: map[string]interface{}{
+				"kicked_by": sessionID,
+			},
+			Persistent: false,
+			Sender:     userID,
+			Subject:    subject,
+			UserID:     userID,
+		},
+	}
+	for _, presence := range presences {
+		if presence.GetUserId() == userID && presence.GetSessionId() == sessionID {
+			// Ignore our current socket connection.
+			continue
+		}
+		ctx2, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		err := nk.NotificationsSend(ctx2, notifications)
+		cancel()
+		if err != nil {
+			logger.WithField("err", err).Error("nk.NotificationsSend error.")
+			continue
+		}
 	}
-	SaveLastClaimReward(ctx, nk, logger, lastClaim, version, userID)
 }
@@ -0,0 +1,264 @@
+// Package botpolicy evaluate bot join, leave, create table and group rules of a game against a table state.
+package botpolicy
+
+import (
+	"sort"
+
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+)
+
+const (
+	ReasonNoRule      = "no_rule"
+	ReasonTableFull   = "table_full"
+	ReasonZeroPercent = "zero_percent"
+	ReasonBelowMin    = "below_min_active_tables"
+	ReasonBelowMax    = "below_max_active_tables"
+	ReasonReachMax    = "reach_max_active_tables"
+	ReasonWait        = "wait"
+)
+
+// TableState state of a table at a moment, Hour is hour of day 0-23,
+// WaitSec is time table wait for player or since last bot table is created
+type TableState struct {
+	AtSec        int   `json:"at_sec"`
+	Bet          int64 `json:"bet"`
+	Players      int   `json:"players"`
+	ActiveTables int   `json:"active_tables"`
+	LastResult   int   `json:"last_result"`
+	WaitSec      int   `json:"wait_sec"`
+	Hour         int   `json:"hour"`
+}
+
+type JoinDecision struct {
+	RuleId      int    `json:"rule_id"`
+	Join        bool   `json:"join"`
+	Percent     int    `json:"percent"`
+	DelayMinSec int    `json:"delay_min_sec"`
+	DelayMaxSec int    `json:"delay_max_sec"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type LeaveDecision struct {
+	RuleId  int    `json:"rule_id"`
+	Leave   bool   `json:"leave"`
+	Percent int    `json:"percent"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type CreateTableDecision struct {
+	RuleId      int    `json:"rule_id"`
+	Create      bool   `json:"create"`
+	DelayMinSec int    `json:"delay_min_sec"`
+	DelayMaxSec int    `json:"delay_max_sec"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type GroupDecision struct {
+	RuleId int    `json:"rule_id"`
+	VipMin int    `json:"vip_min"`
+	VipMax int    `json:"vip_max"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type Decision struct {
+	State       TableState           `json:"state"`
+	Join        *JoinDecision        `json:"join"`
+	Leave       *LeaveDecision       `json:"leave"`
+	CreateTable *CreateTableDecision `json:"create_table"`
+	Group       *GroupDecision       `json:"group"`
+}
+
+// Engine rules are sorted by min bet then id, first match rule win,
+// rule not saved yet (id 0) is after saved rules of same min bet.
+type Engine struct {
+	maxPlayers  int
+	joinRules   []cgbdb.BotJoinRule
+	leaveRules  []cgbdb.BotLeaveRule
+	createRules []cgbdb.BotCreateTableRule
+	groupRules  []cgbdb.BotGroupRule
+}
+
+// NewEngine maxPlayers is table size of game, 0 is unknown and not checked
+func NewEngine(config *cgbdb.BotConfig, maxPlayers int) *Engine {
+	e := &Engine{maxPlayers: maxPlayers}
+	for _, r := range config.BotJoinRules {
+		if r.IsActive {
+			e.joinRules = append(e.joinRules, r)
+		}
+	}
+	for _, r := range config.BotLeaveRules {
+		if r.IsActive {
+			e.leaveRules = append(e.leaveRules, r)
+		}
+	}
+	for _, r := range config.BotCreateTableRules {
+		if r.IsActive {
+			e.createRules = append(e.createRules, r)
+		}
+	}
+	for _, r := range config.BotGroupRules {
+		if r.IsActive {
+			e.groupRules = append(e.groupRules, r)
+		}
+	}
+	sort.SliceStable(e.joinRules, func(i, j int) bool {
+		return ruleLess(e.joinRules[i].MinBet, e.joinRules[i].ID, e.joinRules[j].MinBet, e.joinRules[j].ID)
+	})
+	sort.SliceStable(e.leaveRules, func(i, j int) bool {
+		return ruleLess(e.leaveRules[i].MinBet, e.leaveRules[i].ID, e.leaveRules[j].MinBet, e.leaveRules[j].ID)
+	})
+	sort.SliceStable(e.createRules, func(i, j int) bool {
+		return ruleLess(e.createRules[i].MinBet, e.createRules[i].ID, e.createRules[j].MinBet, e.createRules[j].ID)
+	})
+	sort.SliceStable(e.groupRules, func(i, j int) bool {
+		return ruleLess(e.groupRules[i].MCBMin, e.groupRules[i].ID, e.groupRules[j].MCBMin, e.groupRules[j].ID)
+	})
+	return e
+}
+
+func ruleLess(betA int64, idA int, betB int64, idB int) bool {
+	if betA != betB {
+		return betA < betB
+	}
+	if (idA == 0) != (idB == 0) {
+		return idB == 0
+	}
+	return idA < idB
+}
+
+// InHour hour in window [start, end), start > end wrap over midnight, start = end is all day
+func InHour(start, end, hour int) bool {
+	if start == end {
+		return true
+	}
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// ActiveAt config with join, leave and create table rules out of hour window removed,
+// match modules evaluate rules of get_bot_config in order so result is same as this engine.
+func ActiveAt(config *cgbdb.BotConfig, hour int) *cgbdb.BotConfig {
+	active := &cgbdb.BotConfig{
+		GameCode:            config.GameCode,
+		BotJoinRules:        []cgbdb.BotJoinRule{},
+		BotLeaveRules:       []cgbdb.BotLeaveRule{},
+		BotCreateTableRules: []cgbdb.BotCreateTableRule{},
+		BotGroupRules:       config.BotGroupRules,
+	}
+	for _, r := range config.BotJoinRules {
+		if InHour(r.HourStart, r.HourEnd, hour) {
+			active.BotJoinRules = append(active.BotJoinRules, r)
+		}
+	}
+	for _, r := range config.BotLeaveRules {
+		if InHour(r.HourStart, r.HourEnd, hour) {
+			active.BotLeaveRules = append(active.BotLeaveRules, r)
+		}
+	}
+	for _, r := range config.BotCreateTableRules {
+		if InHour(r.HourStart, r.HourEnd, hour) {
+			active.BotCreateTableRules = append(active.BotCreateTableRules, r)
+		}
+	}
+	return active
+}
+
+func inBet(min, max, bet int64) bool {
+	return bet >= min && bet <= max
+}
+
+func (e *Engine) Evaluate(s TableState) *Decision {
+	return &Decision{
+		State:       s,
+		Join:        e.join(s),
+		Leave:       e.leave(s),
+		CreateTable: e.createTable(s),
+		Group:       e.group(s),
+	}
+}
+
+// Simulate evaluate each state of timeline in order of time
+func (e *Engine) Simulate(timeline []TableState) []*Decision {
+	states := append([]TableState(nil), timeline...)
+	sort.SliceStable(states, func(i, j int) bool { return states[i].AtSec < states[j].AtSec })
+	decisions := make([]*Decision, 0, len(states))
+	for _, s := range states {
+		decisions = append(decisions, e.Evaluate(s))
+	}
+	return decisions
+}
+
+func (e *Engine) join(s TableState) *JoinDecision {
+	for _, r := range e.joinRules {
+		if !inBet(r.MinBet, r.MaxBet, s.Bet) || s.Players < r.MinUsers || s.Players > r.MaxUsers ||
+			!InHour(r.HourStart, r.HourEnd, s.Hour) {
+			continue
+		}
+		d := &JoinDecision{
+			RuleId:      r.ID,
+			Join:        true,
+			Percent:     r.JoinPercent,
+			DelayMinSec: r.RandomTimeMin,
+			DelayMaxSec: r.RandomTimeMax,
+		}
+		switch {
+		case e.maxPlayers > 0 && s.Players >= e.maxPlayers:
+			d.Join, d.Reason = false, ReasonTableFull
+		case r.JoinPercent <= 0:
+			d.Join, d.Reason = false, ReasonZeroPercent
+		}
+		return d
+	}
+	return &JoinDecision{Reason: ReasonNoRule}
+}
+
+func (e *Engine) leave(s TableState) *LeaveDecision {
+	for _, r := range e.leaveRules {
+		if !inBet(r.MinBet, r.MaxBet, s.Bet) || r.LastResult != s.LastResult || !InHour(r.HourStart, r.HourEnd, s.Hour) {
+			continue
+		}
+		d := &LeaveDecision{RuleId: r.ID, Leave: r.LeavePercent > 0, Percent: r.LeavePercent}
+		if !d.Leave {
+			d.Reason = ReasonZeroPercent
+		}
+		return d
+	}
+	return &LeaveDecision{Reason: ReasonNoRule}
+}
+
+// createTable below min active tables create after wait time, below max create after retry wait
+func (e *Engine) createTable(s TableState) *CreateTableDecision {
+	for _, r := range e.createRules {
+		if !inBet(r.MinBet, r.MaxBet, s.Bet) || !InHour(r.HourStart, r.HourEnd, s.Hour) {
+			continue
+		}
+		d := &CreateTableDecision{RuleId: r.ID}
+		switch {
+		case s.ActiveTables < r.MinActiveTables:
+			d.DelayMinSec, d.DelayMaxSec, d.Reason = r.WaitTimeMin, r.WaitTimeMax, ReasonBelowMin
+		case s.ActiveTables < r.MaxActiveTables:
+			d.DelayMinSec, d.DelayMaxSec, d.Reason = r.RetryWaitMin, r.RetryWaitMax, ReasonBelowMax
+		default:
+			d.Reason = ReasonReachMax
+			return d
+		}
+		d.Create = s.WaitSec >= d.DelayMinSec
+		if !d.Create {
+			d.Reason = ReasonWait
+		}
+		return d
+	}
+	return &CreateTableDecision{Reason: ReasonNoRule}
+}
+
+func (e *Engine) group(s TableState) *GroupDecision {
+	for _, r := range e.groupRules {
+		if !inBet(r.MCBMin, r.MCBMax, s.Bet) {
+			continue
+		}
+		return &GroupDecision{RuleId: r.ID, VipMin: r.VIPMin, VipMax: r.VIPMax}
+	}
+	return &GroupDecision{Reason: ReasonNoRule}
+}
@@ -0,0 +1,156 @@
+package botpolicy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+)
+
+func testBotConfig() *cgbdb.BotConfig {
+	return &cgbdb.BotConfig{
+		GameCode: "sicbo",
+		BotJoinRules: []cgbdb.BotJoinRule{
+			{ID: 2, MinBet: 1000, MaxBet: 5000, MinUsers: 1, MaxUsers: 5, RandomTimeMin: 5, RandomTimeMax: 10, JoinPercent: 50, IsActive: true},
+			{ID: 1, MinBet: 100, MaxBet: 900, MinUsers: 0, MaxUsers: 4, RandomTimeMin: 1, RandomTimeMax: 3, JoinPercent: 80,
+				HourStart: 22, HourEnd: 6, IsActive: true},
+		},
+		BotLeaveRules: []cgbdb.BotLeaveRule{
+			{ID: 1, MinBet: 100, MaxBet: 5000, LastResult: -1, LeavePercent: 30, IsActive: true},
+		},
+		BotCreateTableRules: []cgbdb.BotCreateTableRule{
+			{ID: 1, MinBet: 100, MaxBet: 5000, MinActiveTables: 2, MaxActiveTables: 5,
+				WaitTimeMin: 10, WaitTimeMax: 20, RetryWaitMin: 60, RetryWaitMax: 120, IsActive: true},
+		},
+		BotGroupRules: []cgbdb.BotGroupRule{
+			{ID: 1, VIPMin: 0, VIPMax: 2, MCBMin: 100, MCBMax: 900, IsActive: true},
+			{ID: 2, VIPMin: 3, VIPMax: 5, MCBMin: 1000, MCBMax: 5000, IsActive: true},
+		},
+	}
+}
+
+func TestInHour(t *testing.T) {
+	tests := []struct {
+		start, end, hour int
+		want             bool
+	}{
+		{0, 0, 13, true},
+		{8, 20, 8, true},
+		{8, 20, 20, false},
+		{22, 6, 23, true},
+		{22, 6, 3, true},
+		{22, 6, 12, false},
+	}
+	for _, tt := range tests {
+		if got := InHour(tt.start, tt.end, tt.hour); got != tt.want {
+			t.Errorf("InHour(%d, %d, %d) = %v, want %v", tt.start, tt.end, tt.hour, got, tt.want)
+		}
+	}
+}
+
+func TestActiveAt(t *testing.T) {
+	config := testBotConfig()
+	if got := ActiveAt(config, 12); len(got.BotJoinRules) != 1 || got.BotJoinRules[0].ID != 2 {
+		t.Errorf("ActiveAt(12) join rules = %v, want only id 2", got.BotJoinRules)
+	}
+	got := ActiveAt(config, 23)
+	if len(got.BotJoinRules) != 2 || len(got.BotLeaveRules) != 1 || len(got.BotCreateTableRules) != 1 || len(got.BotGroupRules) != 2 {
+		t.Errorf("ActiveAt(23) = %+v, want all rules", got)
+	}
+}
+
+func TestEngineSimulate(t *testing.T) {
+	e := NewEngine(testBotConfig(), 5)
+	decisions := e.Simulate([]TableState{
+		{AtSec: 30, Bet: 2000, Players: 5, ActiveTables: 3, WaitSec: 30, Hour: 12},
+		{AtSec: 0, Bet: 500, Players: 1, ActiveTables: 1, LastResult: -1, WaitSec: 15, Hour: 23},
+		{AtSec: 10, Bet: 500, Players: 1, ActiveTables: 1, WaitSec: 5, Hour: 12},
+	})
+	tests := []struct {
+		join, leave, create bool
+		joinReason          string
+		createReason        string
+		groupRule           int
+	}{
+		{true, true, true, "", ReasonBelowMin, 1},
+		{false, false, false, ReasonNoRule, ReasonWait, 1},
+		{false, false, false, ReasonTableFull, ReasonWait, 2},
+	}
+	for idx, tt := range tests {
+		d := decisions[idx]
+		if d.Join.Join != tt.join || d.Join.Reason != tt.joinReason {
+			t.Errorf("step %d join = %+v, want join %v reason %q", idx, d.Join, tt.join, tt.joinReason)
+		}
+		if d.Leave.Leave != tt.leave {
+			t.Errorf("step %d leave = %+v, want %v", idx, d.Leave, tt.leave)
+		}
+		if d.CreateTable.Create != tt.create || d.CreateTable.Reason != tt.createReason {
+			t.Errorf("step %d create = %+v, want %v reason %q", idx, d.CreateTable, tt.create, tt.createReason)
+		}
+		if d.Group.RuleId != tt.groupRule {
+			t.Errorf("step %d group rule = %d, want %d", idx, d.Group.RuleId, tt.groupRule)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *cgbdb.BotConfig)
+		wantErr error
+	}{
+		{"valid", func(c *cgbdb.BotConfig) {}, nil},
+		{"join need more players than seats", func(c *cgbdb.BotConfig) {
+			c.BotJoinRules[0].MinUsers, c.BotJoinRules[0].MaxUsers = 5, 6
+		}, ErrUnreachable},
+		{"join covered by earlier rule", func(c *cgbdb.BotConfig) {
+			c.BotJoinRules = append(c.BotJoinRules, cgbdb.BotJoinRule{MinBet: 2000, MaxBet: 3000, MinUsers: 1, MaxUsers: 2, IsActive: true})
+		}, ErrUnreachable},
+		{"narrow hour is not covered", func(c *cgbdb.BotConfig) {
+			c.BotJoinRules = append(c.BotJoinRules, cgbdb.BotJoinRule{MinBet: 200, MaxBet: 300, MinUsers: 1, MaxUsers: 2,
+				HourStart: 8, HourEnd: 20, IsActive: true})
+		}, nil},
+		{"inactive rule is ignored", func(c *cgbdb.BotConfig) {
+			c.BotGroupRules = append(c.BotGroupRules, cgbdb.BotGroupRule{MCBMin: 100, MCBMax: 200})
+		}, nil},
+		{"group covered", func(c *cgbdb.BotConfig) {
+			c.BotGroupRules = append(c.BotGroupRules, cgbdb.BotGroupRule{MCBMin: 100, MCBMax: 200, IsActive: true})
+		}, ErrUnreachable},
+		{"empty hour window", func(c *cgbdb.BotConfig) {
+			c.BotLeaveRules[0].HourStart, c.BotLeaveRules[0].HourEnd = 24, 0
+		}, ErrUnreachable},
+		{"hour out of range", func(c *cgbdb.BotConfig) {
+			c.BotCreateTableRules[0].HourEnd = 25
+		}, ErrHour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testBotConfig()
+			tt.modify(c)
+			if err := Validate(c, 5); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateChanged(t *testing.T) {
+	c := testBotConfig()
+	// legacy rule already saved is covered by join rule 2
+	legacy := cgbdb.BotJoinRule{ID: 3, MinBet: 2000, MaxBet: 3000, MinUsers: 1, MaxUsers: 2, IsActive: true}
+	c.BotJoinRules = append(c.BotJoinRules, legacy)
+	update := &cgbdb.BotConfig{GameCode: "sicbo", BotLeaveRules: []cgbdb.BotLeaveRule{
+		{ID: 1, MinBet: 100, MaxBet: 5000, LastResult: -1, LeavePercent: 40, IsActive: true},
+	}}
+	c.BotLeaveRules = update.BotLeaveRules
+	if err := ValidateChanged(c, update, 5); err != nil {
+		t.Errorf("ValidateChanged() legacy rule = %v, want nil", err)
+	}
+	if err := Validate(c, 5); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Validate() legacy rule = %v, want %v", err, ErrUnreachable)
+	}
+	update.BotJoinRules = []cgbdb.BotJoinRule{legacy}
+	if err := ValidateChanged(c, update, 5); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("ValidateChanged() changed rule = %v, want %v", err, ErrUnreachable)
+	}
+}
@@ -0,0 +1,112 @@
+package botpolicy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nk-nigeria/lobby-module/cgbdb"
+)
+
+var (
+	ErrHour        = errors.New("hour_start and hour_end must be in 0-24")
+	ErrUnreachable = errors.New("rule is unreachable")
+)
+
+// Validate reject active rule no table state can reach: empty hour window, join rule need more players
+// than table size, or rule is covered by a rule before it (first match win)
+func Validate(config *cgbdb.BotConfig, maxPlayers int) error {
+	return validate(config, maxPlayers, nil)
+}
+
+// ValidateChanged same as Validate but only rules of update are checked against config,
+// rule saved before is not checked again so a legacy unreachable rule does not block later updates
+func ValidateChanged(config, update *cgbdb.BotConfig, maxPlayers int) error {
+	return validate(config, maxPlayers, update)
+}
+
+func validate(config *cgbdb.BotConfig, maxPlayers int, update *cgbdb.BotConfig) error {
+	e := NewEngine(config, maxPlayers)
+	for i, r := range e.joinRules {
+		if update != nil && !slices.Contains(update.BotJoinRules, r) {
+			continue
+		}
+		if err := validateHour("bot_join_rules", r.ID, r.MinBet, r.HourStart, r.HourEnd); err != nil {
+			return err
+		}
+		if maxPlayers > 0 && r.MinUsers >= maxPlayers {
+			return fmt.Errorf("%w: bot_join_rules id %d min_bet %d, min_users %d but table has %d seats",
+				ErrUnreachable, r.ID, r.MinBet, r.MinUsers, maxPlayers)
+		}
+		for _, o := range e.joinRules[:i] {
+			if o.MinBet <= r.MinBet && o.MaxBet >= r.MaxBet && o.MinUsers <= r.MinUsers && o.MaxUsers >= r.MaxUsers &&
+				hourCover(o.HourStart, o.HourEnd, r.HourStart, r.HourEnd) {
+				return coveredError("bot_join_rules", r.ID, r.MinBet, o.ID)
+			}
+		}
+	}
+	for i, r := range e.leaveRules {
+		if update != nil && !slices.Contains(update.BotLeaveRules, r) {
+			continue
+		}
+		if err := validateHour("bot_leave_rules", r.ID, r.MinBet, r.HourStart, r.HourEnd); err != nil {
+			return err
+		}
+		for _, o := range e.leaveRules[:i] {
+			if o.MinBet <= r.MinBet && o.MaxBet >= r.MaxBet && o.LastResult == r.LastResult &&
+				hourCover(o.HourStart, o.HourEnd, r.HourStart, r.HourEnd) {
+				return coveredError("bot_leave_rules", r.ID, r.MinBet, o.ID)
+			}
+		}
+	}
+	for i, r := range e.createRules {
+		if update != nil && !slices.Contains(update.BotCreateTableRules, r) {
+			continue
+		}
+		if err := validateHour("bot_create_table_rules", r.ID, r.MinBet, r.HourStart, r.HourEnd); err != nil {
+			return err
+		}
+		for _, o := range e.createRules[:i] {
+			if o.MinBet <= r.MinBet && o.MaxBet >= r.MaxBet && hourCover(o.HourStart, o.HourEnd, r.HourStart, r.HourEnd) {
+				return coveredError("bot_create_table_rules", r.ID, r.MinBet, o.ID)
+			}
+		}
+	}
+	for i, r := range e.groupRules {
+		if update != nil && !slices.Contains(update.BotGroupRules, r) {
+			continue
+		}
+		for _, o := range e.groupRules[:i] {
+			if o.MCBMin <= r.MCBMin && o.MCBMax >= r.MCBMax {
+				return coveredError("bot_group_rules", r.ID, r.MCBMin, o.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func validateHour(table string, id int, minBet int64, start, end int) error {
+	if start < 0 || start > 24 || end < 0 || end > 24 {
+		return fmt.Errorf("%w in %s id %d min_bet %d", ErrHour, table, id, minBet)
+	}
+	for h := 0; h < 24; h++ {
+		if InHour(start, end, h) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s id %d min_bet %d, hour window %d-%d is empty", ErrUnreachable, table, id, minBet, start, end)
+}
+
+// hourCover every hour of window b is in window a
+func hourCover(startA, endA, startB, endB int) bool {
+	for h := 0; h < 24; h++ {
+		if InHour(startB, endB, h) && !InHour(startA, endA, h) {
+			return false
+		}
+	}
+	return true
+}
+
+func coveredError(table string, id int, minBet int64, byId int) error {
+	return fmt.Errorf("%w: %s id %d min_bet %d is covered by rule id %d before it", ErrUnreachable, table, id, minBet, byId)
+}
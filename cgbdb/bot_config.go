@@ -8,6 +8,7 @@ import (
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
+// hour_start, hour_end of bot rules, get_bot_config only return rule in window of current hour
 type BotJoinRule struct {
 	ID            int    `json:"id"`
 	GameCode      string `json:"game_code"`
@@ -18,6 +19,8 @@ type BotJoinRule struct {
 	RandomTimeMin int    `json:"random_time_min"`
 	RandomTimeMax int    `json:"random_time_max"`
 	JoinPercent   int    `json:"join_percent"`
+	HourStart     int    `json:"hour_start"`
+	HourEnd       int    `json:"hour_end"`
 	IsActive      bool   `json:"is_active"`
 }
 
@@ -28,6 +31,8 @@ type BotLeaveRule struct {
 	MaxBet       int64  `json:"max_bet"`
 	LastResult   int    `json:"last_result"`
 	LeavePercent int    `json:"leave_percent"`
+	HourStart    int    `json:"hour_start"`
+	HourEnd      int    `json:"hour_end"`
 	IsActive     bool   `json:"is_active"`
 }
 
@@ -42,6 +47,8 @@ type BotCreateTableRule struct {
 	WaitTimeMax     int    `json:"wait_time_max"`
 	RetryWaitMin    int    `json:"retry_wait_min"`
 	RetryWaitMax    int    `json:"retry_wait_max"`
+	HourStart       int    `json:"hour_start"`
+	HourEnd         int    `json:"hour_end"`
 	IsActive        bool   `json:"is_active"`
 }
 
@@ -67,7 +74,7 @@ type BotConfig struct {
 func GetBotJoinRules(ctx context.Context, logger runtime.Logger, db *sql.DB, gameCode string) ([]BotJoinRule, error) {
 	query := `
 		SELECT id, game_code, min_bet, max_bet, min_users, max_users, 
-		       random_time_min, random_time_max, join_percent, is_active
+		       random_time_min, random_time_max, join_percent, hour_start, hour_end, is_active
 		FROM bot_join_rules 
 		WHERE game_code = $1 AND is_active = true
 		ORDER BY min_bet ASC
@@ -86,7 +93,7 @@ func GetBotJoinRules(ctx context.Context, logger runtime.Logger, db *sql.DB, gam
 		err := rows.Scan(
 			&rule.ID, &rule.GameCode, &rule.MinBet, &rule.MaxBet,
 			&rule.MinUsers, &rule.MaxUsers, &rule.RandomTimeMin,
-			&rule.RandomTimeMax, &rule.JoinPercent, &rule.IsActive,
+			&rule.RandomTimeMax, &rule.JoinPercent, &rule.HourStart, &rule.HourEnd, &rule.IsActive,
 		)
 		if err != nil {
 			logger.Error("Failed to scan bot join rule: %v", err)
@@ -104,13 +111,13 @@ func SaveBotJoinRule(ctx context.Context, logger runtime.Logger, db *sql.DB, rul
 		// Insert new rule
 		query := `
 			INSERT INTO bot_join_rules (game_code, min_bet, max_bet, min_users, max_users, 
-			                           random_time_min, random_time_max, join_percent, is_active)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			                           random_time_min, random_time_max, join_percent, hour_start, hour_end, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 			RETURNING id
 		`
 		err := db.QueryRowContext(ctx, query,
 			rule.GameCode, rule.MinBet, rule.MaxBet, rule.MinUsers, rule.MaxUsers,
-			rule.RandomTimeMin, rule.RandomTimeMax, rule.JoinPercent, rule.IsActive,
+			rule.RandomTimeMin, rule.RandomTimeMax, rule.JoinPercent, rule.HourStart, rule.HourEnd, rule.IsActive,
 		).Scan(&rule.ID)
 		if err != nil {
 			logger.Error("Failed to insert bot join rule: %v", err)
@@ -121,12 +128,12 @@ func SaveBotJoinRule(ctx context.Context, logger runtime.Logger, db *sql.DB, rul
 		query := `
 			UPDATE bot_join_rules 
 			SET min_bet = $2, max_bet = $3, min_users = $4, max_users = $5,
-			    random_time_min = $6, random_time_max = $7, join_percent = $8, is_active = $9
+			    random_time_min = $6, random_time_max = $7, join_percent = $8, hour_start = $9, hour_end = $10, is_active = $11
 			WHERE id = $1
 		`
 		_, err := db.ExecContext(ctx, query,
 			rule.ID, rule.MinBet, rule.MaxBet, rule.MinUsers, rule.MaxUsers,
-			rule.RandomTimeMin, rule.RandomTimeMax, rule.JoinPercent, rule.IsActive,
+			rule.RandomTimeMin, rule.RandomTimeMax, rule.JoinPercent, rule.HourStart, rule.HourEnd, rule.IsActive,
 		)
 		if err != nil {
 			logger.Error("Failed to update bot join rule: %v", err)
@@ -139,7 +146,7 @@ func SaveBotJoinRule(ctx context.Context, logger runtime.Logger, db *sql.DB, rul
 // GetBotLeaveRules retrieves bot leave rules for a specific game
 func GetBotLeaveRules(ctx context.Context, logger runtime.Logger, db *sql.DB, gameCode string) ([]BotLeaveRule, error) {
 	query := `
-		SELECT id, game_code, min_bet, max_bet, last_result, leave_percent, is_active
+		SELECT id, game_code, min_bet, max_bet, last_result, leave_percent, hour_start, hour_end, is_active
 		FROM bot_leave_rules 
 		WHERE game_code = $1 AND is_active = true
 		ORDER BY min_bet ASC
@@ -157,7 +164,7 @@ func GetBotLeaveRules(ctx context.Context, logger runtime.Logger, db *sql.DB, ga
 		var rule BotLeaveRule
 		err := rows.Scan(
 			&rule.ID, &rule.GameCode, &rule.MinBet, &rule.MaxBet,
-			&rule.LastResult, &rule.LeavePercent, &rule.IsActive,
+			&rule.LastResult, &rule.LeavePercent, &rule.HourStart, &rule.HourEnd, &rule.IsActive,
 		)
 		if err != nil {
 			logger.Error("Failed to scan bot leave rule: %v", err)
@@ -174,12 +181,12 @@ func SaveBotLeaveRule(ctx context.Context, logger runtime.Logger, db *sql.DB, ru
 	if rule.ID == 0 {
 		// Insert new rule
 		query := `
-			INSERT INTO bot_leave_rules (game_code, min_bet, max_bet, last_result, leave_percent, is_active)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO bot_leave_rules (game_code, min_bet, max_bet, last_result, leave_percent, hour_start, hour_end, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 			RETURNING id
 		`
 		err := db.QueryRowContext(ctx, query,
-			rule.GameCode, rule.MinBet, rule.MaxBet, rule.LastResult, rule.LeavePercent, rule.IsActive,
+			rule.GameCode, rule.MinBet, rule.MaxBet, rule.LastResult, rule.LeavePercent, rule.HourStart, rule.HourEnd, rule.IsActive,
 		).Scan(&rule.ID)
 		if err != nil {
 			logger.Error("Failed to insert bot leave rule: %v", err)
@@ -189,11 +196,11 @@ func SaveBotLeaveRule(ctx context.Context, logger runtime.Logger, db *sql.DB, ru
 		// Update existing rule
 		query := `
 			UPDATE bot_leave_rules 
-			SET min_bet = $2, max_bet = $3, last_result = $4, leave_percent = $5, is_active = $6
+			SET min_bet = $2, max_bet = $3, last_result = $4, leave_percent = $5, hour_start = $6, hour_end = $7, is_active = $8
 			WHERE id = $1
 		`
 		_, err := db.ExecContext(ctx, query,
-			rule.ID, rule.MinBet, rule.MaxBet, rule.LastResult, rule.LeavePercent, rule.IsActive,
+			rule.ID, rule.MinBet, rule.MaxBet, rule.LastResult, rule.LeavePercent, rule.HourStart, rule.HourEnd, rule.IsActive,
 		)
 		if err != nil {
 			logger.Error("Failed to update bot leave rule: %v", err)
@@ -207,7 +214,7 @@ func SaveBotLeaveRule(ctx context.Context, logger runtime.Logger, db *sql.DB, ru
 func GetBotCreateTableRules(ctx context.Context, logger runtime.Logger, db *sql.DB, gameCode string) ([]BotCreateTableRule, error) {
 	query := `
 		SELECT id, game_code, min_bet, max_bet, min_active_tables, max_active_tables,
-		       wait_time_min, wait_time_max, retry_wait_min, retry_wait_max, is_active
+		       wait_time_min, wait_time_max, retry_wait_min, retry_wait_max, hour_start, hour_end, is_active
 		FROM bot_create_table_rules 
 		WHERE game_code = $1 AND is_active = true
 		ORDER BY min_bet ASC
@@ -226,7 +233,7 @@ func GetBotCreateTableRules(ctx context.Context, logger runtime.Logger, db *sql.
 		err := rows.Scan(
 			&rule.ID, &rule.GameCode, &rule.MinBet, &rule.MaxBet,
 			&rule.MinActiveTables, &rule.MaxActiveTables, &rule.WaitTimeMin,
-			&rule.WaitTimeMax, &rule.RetryWaitMin, &rule.RetryWaitMax, &rule.IsActive,
+			&rule.WaitTimeMax, &rule.RetryWaitMin, &rule.RetryWaitMax, &rule.HourStart, &rule.HourEnd, &rule.IsActive,
 		)
 		if err != nil {
 			logger.Error("Failed to scan bot create table rule: %v", err)
@@ -244,13 +251,13 @@ func SaveBotCreateTableRule(ctx context.Context, logger runtime.Logger, db *sql.
 		// Insert new rule
 		query := `
 			INSERT INTO bot_create_table_rules (game_code, min_bet, max_bet, min_active_tables, max_active_tables,
-			                                  wait_time_min, wait_time_max, retry_wait_min, retry_wait_max, is_active)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			                                  wait_time_min, wait_time_max, retry_wait_min, retry_wait_max, hour_start, hour_end, is_active)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 			RETURNING id
 		`
 		err := db.QueryRowContext(ctx, query,
 			rule.GameCode, rule.MinBet, rule.MaxBet, rule.MinActiveTables, rule.MaxActiveTables,
-			rule.WaitTimeMin, rule.WaitTimeMax, rule.RetryWaitMin, rule.RetryWaitMax, rule.IsActive,
+			rule.WaitTimeMin, rule.WaitTimeMax, rule.RetryWaitMin, rule.RetryWaitMax, rule.HourStart, rule.HourEnd, rule.IsActive,
 		).Scan(&rule.ID)
 		if err != nil {
 			logger.Error("Failed to insert bot create table rule: %v", err)
@@ -261,12 +268,13 @@ func SaveBotCreateTableRule(ctx context.Context, logger runtime.Logger, db *sql.
 		query := `
 			UPDATE bot_create_table_rules 
 			SET min_bet = $2, max_bet = $3, min_active_tables = $4, max_active_tables = $5,
-			    wait_time_min = $6, wait_time_max = $7, retry_wait_min = $8, retry_wait_max = $9, is_active = $10
+			    wait_time_min = $6, wait_time_max = $7, retry_wait_min = $8, retry_wait_max = $9,
+			    hour_start = $10, hour_end = $11, is_active = $12
 			WHERE id = $1
 		`
 		_, err := db.ExecContext(ctx, query,
 			rule.ID, rule.MinBet, rule.MaxBet, rule.MinActiveTables, rule.MaxActiveTables,
-			rule.WaitTimeMin, rule.WaitTimeMax, rule.RetryWaitMin, rule.RetryWaitMax, rule.IsActive,
+			rule.WaitTimeMin, rule.WaitTimeMax, rule.RetryWaitMin, rule.RetryWaitMax, rule.HourStart, rule.HourEnd, rule.IsActive,
 		)
 		if err != nil {
 			logger.Error("Failed to update bot create table rule: %v", err)
@@ -342,8 +350,23 @@ func SaveBotGroupRule(ctx context.Context, logger runtime.Logger, db *sql.DB, ru
 	return nil
 }
 
+// bot rule tables by kind, DeleteBotRule only accept these tables
+var BotRuleTables = map[string]string{
+	"join":         "bot_join_rules",
+	"leave":        "bot_leave_rules",
+	"create_table": "bot_create_table_rules",
+	"group":        "bot_group_rules",
+}
+
 // DeleteBotRule deactivates a bot rule by setting is_active = false
 func DeleteBotRule(ctx context.Context, logger runtime.Logger, db *sql.DB, tableName string, ruleID int) error {
+	valid := false
+	for _, t := range BotRuleTables {
+		valid = valid || t == tableName
+	}
+	if !valid {
+		return fmt.Errorf("invalid bot rule table %s", tableName)
+	}
 	query := fmt.Sprintf("UPDATE %s SET is_active = false WHERE id = $1", tableName)
 	_, err := db.ExecContext(ctx, query, ruleID)
 	if err != nil {
@@ -0,0 +1,274 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.users_bot (
+//
+//	id bigserial NOT NULL,
+//	user_id varchar(36) NOT NULL,
+//	game_code varchar(31) NOT NULL,
+//	status smallint NOT NULL DEFAULT 0,
+//	vip_level int8 NOT NULL DEFAULT 0,
+//	lease_id varchar(36) NOT NULL DEFAULT '',
+//	match_id varchar(128) NOT NULL DEFAULT '',
+//	lease_expire timestamptz,
+//	create_time timestamptz NOT NULL DEFAULT now(),
+//	update_time timestamptz NOT NULL DEFAULT now()
+//
+// );
+// CREATE UNIQUE INDEX idx_users_bot_user_id ON public.users_bot(user_id);
+// CREATE INDEX idx_users_bot_game_status ON public.users_bot(game_code, status);
+const UsersBotTableName = "users_bot"
+
+// bot is idle or its lease is expired, match module crashed without return it
+const botFreeCond = "(status=0 OR (status=1 AND lease_expire < now()))"
+
+var ErrBotNameExist = errors.New("bot user name exist")
+
+// AddPoolBot create user account of bot and add it to pool of game in one transaction,
+// ErrBotNameExist if generated user name is taken
+func AddPoolBot(ctx context.Context, logger runtime.Logger, db *sql.DB, bot *entity.PoolBot) error {
+	metadata, _ := json.Marshal(bot.Metadata())
+	bot.UserId = uuid.New().String()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx add pool bot error %s", err.Error())
+		return status.Error(codes.Internal, "Add pool bot error")
+	}
+	defer tx.Rollback()
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, "INSERT INTO public.users (id, username, display_name, avatar_url, lang_tag, metadata, wallet, email, password, edge_count, create_time, update_time, verify_time)"+
+		" VALUES ($1, $2, $3, '', 'en', $4, '{}', $5, $6, 0, $7, $7, $7) ON CONFLICT DO NOTHING",
+		bot.UserId, bot.UserName, bot.DisplayName, string(metadata), bot.UserName+"@gmail.com", uuid.New().String(), now)
+	if err != nil {
+		logger.Error("Insert user of bot %s error %s", bot.UserName, err.Error())
+		return status.Error(codes.Internal, "Add pool bot error")
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrBotNameExist
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO "+UsersBotTableName+" (user_id, game_code, status, vip_level, create_time, update_time) VALUES ($1, $2, $3, $4, $5, $5)",
+		bot.UserId, bot.GameCode, entity.BotStatusIdle, bot.VipLevel, now)
+	if err != nil {
+		logger.Error("Insert pool bot %s error %s", bot.UserId, err.Error())
+		return status.Error(codes.Internal, "Add pool bot error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit add pool bot %s error %s", bot.UserId, err.Error())
+		return status.Error(codes.Internal, "Add pool bot error")
+	}
+	bot.Status = entity.BotStatusIdle
+	bot.CreateTimeUnix, bot.UpdateTimeUnix = now.Unix(), now.Unix()
+	return nil
+}
+
+const poolBotStatus = "CASE WHEN b.status=1 AND b.lease_expire < now() THEN 0 ELSE b.status END"
+
+const poolBotColumns = "b.user_id, u.username, u.display_name, u.metadata, b.game_code, b.vip_level, " +
+	poolBotStatus + ", b.lease_id, b.match_id, b.lease_expire, b.create_time, b.update_time"
+
+func scanPoolBot(rows *sql.Rows) (*entity.PoolBot, error) {
+	bot := &entity.PoolBot{}
+	var metadata string
+	var leaseExpire sql.NullTime
+	var createTime, updateTime time.Time
+	err := rows.Scan(&bot.UserId, &bot.UserName, &bot.DisplayName, &metadata, &bot.GameCode, &bot.VipLevel,
+		&bot.Status, &bot.LeaseId, &bot.MatchId, &leaseExpire, &createTime, &updateTime)
+	if err != nil {
+		return nil, err
+	}
+	var meta map[string]interface{}
+	if json.Unmarshal([]byte(metadata), &meta) == nil {
+		bot.AvatarId = entity.InterfaceToString(meta["avatar_id"])
+		bot.Level = entity.ToInt64(meta["level"], 0)
+	}
+	if bot.Status == entity.BotStatusLeased && leaseExpire.Valid {
+		bot.LeaseExpireUnix = leaseExpire.Time.Unix()
+	} else {
+		bot.LeaseId, bot.MatchId = "", ""
+	}
+	bot.CreateTimeUnix, bot.UpdateTimeUnix = createTime.Unix(), updateTime.Unix()
+	return bot, nil
+}
+
+// ListPoolBot bots of pool, filter by game and status, bot with expired lease is idle
+func ListPoolBot(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.BotPoolListRequest) ([]*entity.PoolBot, error) {
+	query := "SELECT " + poolBotColumns + " FROM " + UsersBotTableName + " b JOIN users u ON u.id::text=b.user_id" +
+		" WHERE ($1='' OR b.game_code=$1) AND ($2 < 0 OR " + poolBotStatus + "=$2) ORDER BY b.id DESC LIMIT $3 OFFSET $4"
+	filterStatus := -1
+	if req.Status != nil {
+		filterStatus = *req.Status
+	}
+	ml, err := queryPoolBotList(ctx, db, query, req.GameCode, filterStatus, req.Limit, req.Offset)
+	if err != nil {
+		logger.Error("List pool bot error %s", err.Error())
+		return nil, status.Error(codes.Internal, "List pool bot error")
+	}
+	return ml, nil
+}
+
+func queryPoolBotList(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*entity.PoolBot, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ml := make([]*entity.PoolBot, 0)
+	for rows.Next() {
+		bot, err := scanPoolBot(rows)
+		if err != nil {
+			return nil, err
+		}
+		ml = append(ml, bot)
+	}
+	return ml, rows.Err()
+}
+
+// GetBotPoolStats number of bots per game by status
+func GetBotPoolStats(ctx context.Context, logger runtime.Logger, db *sql.DB) ([]*entity.BotPoolStat, error) {
+	query := "SELECT game_code," +
+		" count(*) FILTER (WHERE " + botFreeCond + ")," +
+		" count(*) FILTER (WHERE status=1 AND lease_expire >= now())," +
+		" count(*) FILTER (WHERE status=2)" +
+		" FROM " + UsersBotTableName + " GROUP BY game_code ORDER BY game_code"
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		logger.Error("Query bot pool stats error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query bot pool stats error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.BotPoolStat, 0)
+	for rows.Next() {
+		s := &entity.BotPoolStat{}
+		if err := rows.Scan(&s.GameCode, &s.Idle, &s.Leased, &s.Retired); err != nil {
+			logger.Error("Scan bot pool stats error %s", err.Error())
+			return nil, status.Error(codes.Internal, "Query bot pool stats error")
+		}
+		ml = append(ml, s)
+	}
+	return ml, rows.Err()
+}
+
+// RetirePoolBot retire idle bots by user ids, or count idle bots of game,
+// leased bots are not retired so they are not pulled out of a table
+func RetirePoolBot(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.BotPoolRetireRequest) ([]string, error) {
+	var rows *sql.Rows
+	var err error
+	if len(req.UserIds) > 0 {
+		rows, err = db.QueryContext(ctx, "UPDATE "+UsersBotTableName+" SET status=2, lease_id='', match_id='', update_time=now()"+
+			" WHERE user_id = ANY($1) AND "+botFreeCond+" RETURNING user_id", pq.Array(req.UserIds))
+	} else {
+		rows, err = db.QueryContext(ctx, "UPDATE "+UsersBotTableName+" SET status=2, lease_id='', match_id='', update_time=now()"+
+			" WHERE id IN (SELECT id FROM "+UsersBotTableName+" WHERE game_code=$1 AND "+botFreeCond+
+			" ORDER BY id DESC LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING user_id", req.GameCode, req.Count)
+	}
+	if err != nil {
+		logger.Error("Retire pool bot error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Retire pool bot error")
+	}
+	return scanUserIds(rows)
+}
+
+// MovePoolBot move count idle bots from a game to another
+func MovePoolBot(ctx context.Context, logger runtime.Logger, db *sql.DB, move *entity.BotMove) (int, error) {
+	res, err := db.ExecContext(ctx, "UPDATE "+UsersBotTableName+" SET game_code=$2, status=0, lease_id='', match_id='', update_time=now()"+
+		" WHERE id IN (SELECT id FROM "+UsersBotTableName+" WHERE game_code=$1 AND "+botFreeCond+
+		" ORDER BY id LIMIT $3 FOR UPDATE SKIP LOCKED)", move.From, move.To, move.Count)
+	if err != nil {
+		logger.Error("Move pool bot %s -> %s error %s", move.From, move.To, err.Error())
+		return 0, status.Error(codes.Internal, "Move pool bot error")
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// LeasePoolBot check out idle bots of game for a match, a bot is only in one lease at a time,
+// skip locked rows so concurrent lease never get same bot
+func LeasePoolBot(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.BotLeaseRequest) (*entity.BotLease, error) {
+	vipMin, vipMax := int64(-1), int64(-1)
+	if req.VipMin != nil {
+		vipMin = *req.VipMin
+	}
+	if req.VipMax != nil {
+		vipMax = *req.VipMax
+	}
+	lease := &entity.BotLease{
+		LeaseId:         uuid.New().String(),
+		MatchId:         req.MatchId,
+		LeaseExpireUnix: time.Now().Add(time.Duration(req.TtlSec) * time.Second).Unix(),
+	}
+	rows, err := db.QueryContext(ctx, "UPDATE "+UsersBotTableName+" SET status=1, lease_id=$1, match_id=$2, lease_expire=to_timestamp($3), update_time=now()"+
+		" WHERE id IN (SELECT id FROM "+UsersBotTableName+" WHERE game_code=$4 AND "+botFreeCond+
+		" AND ($5 < 0 OR vip_level >= $5) AND ($6 < 0 OR vip_level <= $6)"+
+		" ORDER BY random() LIMIT $7 FOR UPDATE SKIP LOCKED) RETURNING user_id",
+		lease.LeaseId, lease.MatchId, lease.LeaseExpireUnix, req.GameCode, vipMin, vipMax, req.Count)
+	if err != nil {
+		logger.Error("Lease pool bot game %s match %s error %s", req.GameCode, req.MatchId, err.Error())
+		return nil, status.Error(codes.Internal, "Lease pool bot error")
+	}
+	userIds, err := scanUserIds(rows)
+	if err != nil {
+		logger.Error("Scan lease pool bot error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Lease pool bot error")
+	}
+	if len(userIds) == 0 {
+		return nil, entity.ErrBotLeaseEmpty
+	}
+	lease.Bots, err = queryPoolBotList(ctx, db, "SELECT "+poolBotColumns+" FROM "+UsersBotTableName+" b JOIN users u ON u.id::text=b.user_id"+
+		" WHERE b.user_id = ANY($1)", pq.Array(userIds))
+	if err != nil {
+		logger.Error("Query leased bot error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Lease pool bot error")
+	}
+	return lease, nil
+}
+
+// RenewPoolBotLease extend expire of bots still in lease, number of bots renewed
+func RenewPoolBotLease(ctx context.Context, logger runtime.Logger, db *sql.DB, leaseId string, ttlSec int) (int, error) {
+	res, err := db.ExecContext(ctx, "UPDATE "+UsersBotTableName+" SET lease_expire=now() + make_interval(secs => $2), update_time=now()"+
+		" WHERE lease_id=$1 AND status=1 AND lease_expire >= now()", leaseId, ttlSec)
+	if err != nil {
+		logger.Error("Renew bot lease %s error %s", leaseId, err.Error())
+		return 0, status.Error(codes.Internal, "Renew bot lease error")
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// ReturnPoolBot return bots of lease to pool, empty user ids is all bots of lease
+func ReturnPoolBot(ctx context.Context, logger runtime.Logger, db *sql.DB, leaseId string, userIds []string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "UPDATE "+UsersBotTableName+" SET status=0, lease_id='', match_id='', lease_expire=NULL, update_time=now()"+
+		" WHERE lease_id=$1 AND status=1 AND (cardinality($2::text[])=0 OR user_id = ANY($2)) RETURNING user_id",
+		leaseId, pq.Array(userIds))
+	if err != nil {
+		logger.Error("Return bot lease %s error %s", leaseId, err.Error())
+		return nil, status.Error(codes.Internal, "Return bot lease error")
+	}
+	return scanUserIds(rows)
+}
+
+func scanUserIds(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	userIds := make([]string, 0)
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, rows.Err()
+}
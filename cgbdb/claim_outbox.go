@@ -0,0 +1,170 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.claim_outbox (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	user_id character varying(128) NOT NULL,
+//	idem_key character varying(128) NOT NULL,
+//	kind character varying(32) NOT NULL,
+//	ref_id bigint NOT NULL DEFAULT 0,
+//	chips bigint NOT NULL DEFAULT 0,
+//	metadata jsonb,
+//	result bytea,
+//	status smallint NOT NULL DEFAULT 0,
+//	attempts integer NOT NULL DEFAULT 0,
+//	last_error text NOT NULL DEFAULT '',
+//	lease_until timestamp with time zone,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	UNIQUE (user_id, idem_key)
+//
+// );
+const ClaimOutboxTableName = "claim_outbox"
+
+// dbExecutor is *sql.DB or *sql.Tx
+type dbExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const claimOutboxColumns = "id, user_id, idem_key, kind, ref_id, chips, metadata, result, status, attempts, create_time"
+
+func scanClaimOutbox(row interface{ Scan(dest ...any) error }) (*entity.ClaimOutbox, error) {
+	outbox := &entity.ClaimOutbox{}
+	var dbMetadata []byte
+	err := row.Scan(&outbox.Id, &outbox.UserId, &outbox.IdemKey, &outbox.Kind, &outbox.RefId, &outbox.Chips,
+		&dbMetadata, &outbox.Result, &outbox.Status, &outbox.Attempts, &outbox.CreateTime)
+	if err != nil {
+		return nil, err
+	}
+	outbox.Metadata = make(map[string]interface{})
+	if len(dbMetadata) > 0 {
+		_ = json.Unmarshal(dbMetadata, &outbox.Metadata)
+	}
+	return outbox, nil
+}
+
+// GetClaimOutboxByKey return nil if user not claim with this key yet
+func GetClaimOutboxByKey(ctx context.Context, logger runtime.Logger, db dbExecutor, userId, idemKey string) (*entity.ClaimOutbox, error) {
+	query := "SELECT " + claimOutboxColumns + " FROM " + ClaimOutboxTableName + " WHERE user_id=$1 AND idem_key=$2"
+	outbox, err := scanClaimOutbox(db.QueryRowContext(ctx, query, userId, idemKey))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error("Query claim outbox user %s, key %s error %s", userId, idemKey, err.Error())
+		return nil, status.Error(codes.Internal, "Query claim outbox error")
+	}
+	return outbox, nil
+}
+
+// addClaimOutbox insert pending claim, must run in the same tx with the claim status change
+func addClaimOutbox(ctx context.Context, logger runtime.Logger, tx *sql.Tx, outbox *entity.ClaimOutbox) error {
+	outbox.Id = conf.SnowlakeNode.Generate().Int64()
+	outbox.Status = entity.ClaimOutboxStatusPending
+	if outbox.Metadata == nil {
+		outbox.Metadata = make(map[string]interface{})
+	}
+	// convert int64 to string because missing value when save to wallet metadata
+	outbox.Metadata["claim_id"] = strconv.FormatInt(outbox.Id, 10)
+	metadata, _ := json.Marshal(outbox.Metadata)
+	query := "INSERT INTO " + ClaimOutboxTableName + " (id, user_id, idem_key, kind, ref_id, chips, metadata, result, status, attempts, last_error, create_time, update_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 0, '', now(), now())"
+	result, err := tx.ExecContext(ctx, query, outbox.Id, outbox.UserId, outbox.IdemKey, outbox.Kind,
+		outbox.RefId, outbox.Chips, metadata, outbox.Result, outbox.Status)
+	if err != nil {
+		if strings.Contains(err.Error(), DbErrorUniqueViolation) || strings.Contains(err.Error(), "duplicate key value") {
+			return status.Error(codes.AlreadyExists, "Claim already exists")
+		}
+		logger.Error("Add claim outbox user %s, key %s error %s", outbox.UserId, outbox.IdemKey, err.Error())
+		return status.Error(codes.Internal, "Add claim outbox error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		logger.Error("Did not insert claim outbox user %s, key %s", outbox.UserId, outbox.IdemKey)
+		return status.Error(codes.Internal, "Add claim outbox error")
+	}
+	return nil
+}
+
+// ClaimPendingClaimOutbox lease pending claims to this worker for leaseSec, claim leased by other worker is skipped.
+// id > 0 lease only this claim, else lease claims pending more than olderThanSec.
+// Lease is committed at return so wallet update run outside of any transaction.
+func ClaimPendingClaimOutbox(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, olderThanSec int64, limit int64, leaseSec int64) ([]*entity.ClaimOutbox, error) {
+	var rows *sql.Rows
+	var err error
+	leaseFree := " AND (lease_until IS NULL OR lease_until < now())"
+	if id > 0 {
+		query := "UPDATE " + ClaimOutboxTableName + " SET lease_until=now() + make_interval(secs => $1)" +
+			" WHERE id=$2 AND status=$3" + leaseFree + " RETURNING " + claimOutboxColumns
+		rows, err = db.QueryContext(ctx, query, leaseSec, id, entity.ClaimOutboxStatusPending)
+	} else {
+		query := "UPDATE " + ClaimOutboxTableName + " SET lease_until=now() + make_interval(secs => $1)" +
+			" WHERE id IN (SELECT id FROM " + ClaimOutboxTableName +
+			" WHERE status=$2 AND update_time < now() - make_interval(secs => $3)" + leaseFree +
+			" ORDER BY id ASC LIMIT $4 FOR UPDATE SKIP LOCKED) RETURNING " + claimOutboxColumns
+		rows, err = db.QueryContext(ctx, query, leaseSec, entity.ClaimOutboxStatusPending, olderThanSec, limit)
+	}
+	if err != nil {
+		logger.Error("Lease pending claim outbox error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query claim outbox error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.ClaimOutbox, 0)
+	for rows.Next() {
+		outbox, err := scanClaimOutbox(rows)
+		if err != nil {
+			logger.Error("Scan claim outbox error %s", err.Error())
+			continue
+		}
+		ml = append(ml, outbox)
+	}
+	return ml, rows.Err()
+}
+
+func MarkClaimOutboxDone(ctx context.Context, logger runtime.Logger, db dbExecutor, id int64) error {
+	query := "UPDATE " + ClaimOutboxTableName + " SET status=$1, attempts=attempts+1, last_error='', lease_until=NULL, update_time=now() WHERE id=$2 AND status=$3"
+	_, err := db.ExecContext(ctx, query, entity.ClaimOutboxStatusDone, id, entity.ClaimOutboxStatusPending)
+	if err != nil {
+		logger.Error("Mark claim outbox %d done error %s", id, err.Error())
+		return status.Error(codes.Internal, "Update claim outbox error")
+	}
+	return nil
+}
+
+// MarkClaimOutboxRetry increase attempts, mark failed when reach max attempts
+func MarkClaimOutboxRetry(ctx context.Context, logger runtime.Logger, db dbExecutor, id int64, lastErr string) error {
+	query := "UPDATE " + ClaimOutboxTableName + " SET attempts=attempts+1, last_error=$1, lease_until=NULL, update_time=now()," +
+		" status=CASE WHEN attempts+1 >= $2 THEN $3 ELSE status END WHERE id=$4 AND status=$5"
+	_, err := db.ExecContext(ctx, query, lastErr, entity.ClaimOutboxMaxAttempts,
+		entity.ClaimOutboxStatusFailed, id, entity.ClaimOutboxStatusPending)
+	if err != nil {
+		logger.Error("Mark claim outbox %d retry error %s", id, err.Error())
+		return status.Error(codes.Internal, "Update claim outbox error")
+	}
+	return nil
+}
+
+// IsClaimOutboxInWallet check wallet ledger already have the update of this claim,
+// in case wallet updated but claim not mark done.
+func IsClaimOutboxInWallet(ctx context.Context, db *sql.DB, userId string, id int64) (bool, error) {
+	query := "SELECT count(*) FROM wallet_ledger WHERE user_id = $1::UUID AND metadata->>'claim_id' = $2"
+	var count int64
+	if err := db.QueryRowContext(ctx, query, userId, strconv.FormatInt(id, 10)).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
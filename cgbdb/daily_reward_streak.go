@@ -0,0 +1,201 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.daily_reward_streak (
+//
+//	user_id character varying(128) NOT NULL PRIMARY KEY,
+//	streak integer NOT NULL DEFAULT 0,
+//	best_streak integer NOT NULL DEFAULT 0,
+//	last_day character varying(10) NOT NULL DEFAULT '',
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+const DailyRewardStreakTableName = "daily_reward_streak"
+
+// CREATE TABLE public.daily_reward_claim (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	user_id character varying(128) NOT NULL,
+//	day character varying(10) NOT NULL,
+//	kind character varying(16) NOT NULL,
+//	tier integer NOT NULL DEFAULT 0,
+//	chips bigint NOT NULL DEFAULT 0,
+//	create_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+// CREATE INDEX idx_daily_reward_claim_user_day ON public.daily_reward_claim(user_id, day);
+const DailyRewardClaimTableName = "daily_reward_claim"
+
+// GetDailyRewardStreak freeze is not loaded, it is in wallet of user
+func GetDailyRewardStreak(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string) (*entity.DailyRewardStreak, error) {
+	query := "SELECT streak, best_streak, last_day FROM " + DailyRewardStreakTableName + " WHERE user_id=$1"
+	streak := &entity.DailyRewardStreak{UserId: userId}
+	err := db.QueryRowContext(ctx, query, userId).Scan(&streak.Streak, &streak.BestStreak, &streak.LastDay)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Query daily reward streak user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Query daily reward streak error")
+	}
+	return streak, nil
+}
+
+func lockDailyRewardStreak(ctx context.Context, logger runtime.Logger, tx *sql.Tx, userId string) (*entity.DailyRewardStreak, error) {
+	_, err := tx.ExecContext(ctx, "INSERT INTO "+DailyRewardStreakTableName+" (user_id, streak, best_streak, last_day, update_time)"+
+		" VALUES ($1, 0, 0, '', now()) ON CONFLICT (user_id) DO NOTHING", userId)
+	if err != nil {
+		logger.Error("Insert daily reward streak user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Update daily reward streak error")
+	}
+	query := "SELECT streak, best_streak, last_day FROM " + DailyRewardStreakTableName + " WHERE user_id=$1 FOR UPDATE"
+	streak := &entity.DailyRewardStreak{UserId: userId}
+	if err := tx.QueryRowContext(ctx, query, userId).Scan(&streak.Streak, &streak.BestStreak, &streak.LastDay); err != nil {
+		logger.Error("Lock daily reward streak user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Update daily reward streak error")
+	}
+	return streak, nil
+}
+
+func saveDailyRewardStreak(ctx context.Context, logger runtime.Logger, tx *sql.Tx, streak *entity.DailyRewardStreak) error {
+	query := "UPDATE " + DailyRewardStreakTableName + " SET streak=$1, best_streak=$2, last_day=$3, update_time=now() WHERE user_id=$4"
+	if _, err := tx.ExecContext(ctx, query, streak.Streak, streak.BestStreak, streak.LastDay, streak.UserId); err != nil {
+		logger.Error("Update daily reward streak user %s error %s", streak.UserId, err.Error())
+		return status.Error(codes.Internal, "Update daily reward streak error")
+	}
+	return nil
+}
+
+func addDailyRewardClaimHistory(ctx context.Context, logger runtime.Logger, tx *sql.Tx, userId, day, kind string, tier, chips int64) error {
+	query := "INSERT INTO " + DailyRewardClaimTableName + " (id, user_id, day, kind, tier, chips, create_time) VALUES ($1, $2, $3, $4, $5, $6, now())"
+	if _, err := tx.ExecContext(ctx, query, conf.SnowlakeNode.Generate().Int64(), userId, day, kind, tier, chips); err != nil {
+		logger.Error("Add daily reward claim user %s day %s error %s", userId, day, err.Error())
+		return status.Error(codes.Internal, "Add daily reward claim error")
+	}
+	return nil
+}
+
+// AddDailyRewardClaim save nth claim of day with wallet update in claim outbox, streak is updated
+// by first claim of day. Claim fail if user already has n claims in day (retry or parallel claim).
+// freeze is number of streak freeze in wallet, updateFreeze is called before commit
+// with freeze used and earned, nothing saved if it fail. Update is nil if not first claim of day.
+func AddDailyRewardClaim(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, day string, secFromMidnight, numClaim, chips, freeze int64,
+	metadata map[string]interface{}, updateFreeze func(update *entity.DailyRewardStreakUpdate) error) (*entity.DailyRewardStreakUpdate, *entity.ClaimOutbox, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx daily reward claim error %s", err.Error())
+		return nil, nil, status.Error(codes.Internal, "Add daily reward claim error")
+	}
+	defer tx.Rollback()
+	streak, err := lockDailyRewardStreak(ctx, logger, tx, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	var claimed int64
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM "+DailyRewardClaimTableName+" WHERE user_id=$1 AND day=$2 AND kind=$3",
+		userId, day, entity.DailyRewardClaimKindClaim).Scan(&claimed)
+	if err != nil {
+		logger.Error("Count daily reward claim user %s day %s error %s", userId, day, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Add daily reward claim error")
+	}
+	if claimed != numClaim-1 {
+		return nil, nil, status.Error(codes.AlreadyExists, "Daily reward already claimed")
+	}
+	streak.Freeze = freeze
+	update := streak.Claim(day, secFromMidnight)
+	if update != nil {
+		for _, frozenDay := range update.FrozenDays {
+			if err := addDailyRewardClaimHistory(ctx, logger, tx, userId, frozenDay, entity.DailyRewardClaimKindFreeze, 0, 0); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := saveDailyRewardStreak(ctx, logger, tx, streak); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := addDailyRewardClaimHistory(ctx, logger, tx, userId, day, entity.DailyRewardClaimKindClaim, numClaim, chips); err != nil {
+		return nil, nil, err
+	}
+	outbox := &entity.ClaimOutbox{
+		UserId:   userId,
+		IdemKey:  entity.DailyRewardClaimKey(day, numClaim),
+		Kind:     entity.ClaimOutboxKindDailyReward,
+		Chips:    chips,
+		Metadata: metadata,
+	}
+	if err := addClaimOutbox(ctx, logger, tx, outbox); err != nil {
+		return nil, nil, err
+	}
+	if update != nil {
+		if err := updateFreeze(update); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit daily reward claim user %s error %s", userId, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Add daily reward claim error")
+	}
+	return update, outbox, nil
+}
+
+// CatchUpDailyReward restore yesterday, pay is called after check and before commit,
+// nothing saved if pay fail.
+func CatchUpDailyReward(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, today string, pay func() error) (*entity.DailyRewardStreak, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx daily reward catch up error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Catch up daily reward error")
+	}
+	defer tx.Rollback()
+	streak, err := lockDailyRewardStreak(ctx, logger, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	day, err := streak.CatchUp(today)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err := saveDailyRewardStreak(ctx, logger, tx, streak); err != nil {
+		return nil, err
+	}
+	if err := addDailyRewardClaimHistory(ctx, logger, tx, userId, day, entity.DailyRewardClaimKindCatchUp, 0, -entity.DailyRewardCatchUpPrice); err != nil {
+		return nil, err
+	}
+	if err := pay(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit daily reward catch up user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Catch up daily reward error")
+	}
+	return streak, nil
+}
+
+// GetDailyRewardClaimHistory claim of user from day fromDay, map by day
+func GetDailyRewardClaimHistory(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, fromDay string) (map[string]*entity.DailyRewardCalendarDay, error) {
+	query := "SELECT day, min(kind), count(*) FILTER (WHERE kind=$3), coalesce(sum(chips) FILTER (WHERE kind=$3), 0) FROM " + DailyRewardClaimTableName +
+		" WHERE user_id=$1 AND day >= $2 GROUP BY day"
+	rows, err := db.QueryContext(ctx, query, userId, fromDay, entity.DailyRewardClaimKindClaim)
+	if err != nil {
+		logger.Error("Query daily reward claim user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Query daily reward claim error")
+	}
+	defer rows.Close()
+	ml := make(map[string]*entity.DailyRewardCalendarDay)
+	for rows.Next() {
+		day := &entity.DailyRewardCalendarDay{}
+		if err := rows.Scan(&day.Day, &day.Kind, &day.NumClaim, &day.Chips); err != nil {
+			logger.Error("Scan daily reward claim error %s", err.Error())
+			continue
+		}
+		ml[day.Day] = day
+	}
+	return ml, rows.Err()
+}
@@ -0,0 +1,208 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.daily_reward_template (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	name character varying(128) NOT NULL,
+//	version integer NOT NULL DEFAULT 1,
+//	tiers jsonb NOT NULL,
+//	start_time timestamp with time zone,
+//	end_time timestamp with time zone,
+//	disabled boolean NOT NULL DEFAULT false,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	UNIQUE (name, version)
+//
+// );
+const DailyRewardTemplateTableName = "daily_reward_template"
+
+const dailyRewardTemplateColumns = "id, name, version, tiers, start_time, end_time, disabled, create_time"
+
+func scanDailyRewardTemplate(row interface{ Scan(dest ...any) error }) (*entity.DailyRewardTemplateVersion, error) {
+	template := &entity.DailyRewardTemplateVersion{}
+	var dbTiers []byte
+	var dbStartTime, dbEndTime sql.NullTime
+	var dbCreateTime time.Time
+	err := row.Scan(&template.Id, &template.Name, &template.Version, &dbTiers,
+		&dbStartTime, &dbEndTime, &template.Disabled, &dbCreateTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dbTiers, &template.Tiers); err != nil {
+		return nil, err
+	}
+	if dbStartTime.Valid {
+		template.StartTimeUnix = dbStartTime.Time.Unix()
+	}
+	if dbEndTime.Valid {
+		template.EndTimeUnix = dbEndTime.Time.Unix()
+	}
+	template.CreateTimeUnix = dbCreateTime.Unix()
+	return template, nil
+}
+
+func nullUnixTime(unix int64) interface{} {
+	if unix <= 0 {
+		return nil
+	}
+	return time.Unix(unix, 0)
+}
+
+// AddDailyRewardTemplate insert new version of template name, version start at 1
+func AddDailyRewardTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB, template *entity.DailyRewardTemplateVersion) (*entity.DailyRewardTemplateVersion, error) {
+	tiers, _ := json.Marshal(template.Tiers)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx add daily reward template error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Add daily reward template error")
+	}
+	defer tx.Rollback()
+	if template.IsScheduled() && !template.Disabled {
+		if err := checkDailyRewardScheduleOverlap(ctx, logger, tx, 0, template.StartTimeUnix, template.EndTimeUnix); err != nil {
+			return nil, err
+		}
+	}
+	template.Id = conf.SnowlakeNode.Generate().Int64()
+	query := "INSERT INTO " + DailyRewardTemplateTableName + " (id, name, version, tiers, start_time, end_time, disabled, create_time, update_time)" +
+		" VALUES ($1, $2, (SELECT coalesce(max(version), 0) + 1 FROM " + DailyRewardTemplateTableName + " WHERE name=$2), $3, $4, $5, $6, now(), now())" +
+		" RETURNING version"
+	err = tx.QueryRowContext(ctx, query, template.Id, template.Name, tiers,
+		nullUnixTime(template.StartTimeUnix), nullUnixTime(template.EndTimeUnix), template.Disabled).Scan(&template.Version)
+	if err != nil {
+		logger.Error("Add daily reward template %s error %s", template.Name, err.Error())
+		return nil, status.Error(codes.Internal, "Add daily reward template error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit daily reward template %s error %s", template.Name, err.Error())
+		return nil, status.Error(codes.Internal, "Add daily reward template error")
+	}
+	template.CreateTimeUnix = time.Now().Unix()
+	return template, nil
+}
+
+// ScheduleDailyRewardTemplate set active window of template version, zero start and end make it a default template
+func ScheduleDailyRewardTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB, id, startUnix, endUnix int64, disabled bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx schedule daily reward template error %s", err.Error())
+		return status.Error(codes.Internal, "Schedule daily reward template error")
+	}
+	defer tx.Rollback()
+	if (startUnix > 0 || endUnix > 0) && !disabled {
+		if err := checkDailyRewardScheduleOverlap(ctx, logger, tx, id, startUnix, endUnix); err != nil {
+			return err
+		}
+	}
+	query := "UPDATE " + DailyRewardTemplateTableName + " SET start_time=$1, end_time=$2, disabled=$3, update_time=now() WHERE id=$4"
+	result, err := tx.ExecContext(ctx, query, nullUnixTime(startUnix), nullUnixTime(endUnix), disabled, id)
+	if err != nil {
+		logger.Error("Schedule daily reward template %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Schedule daily reward template error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		return status.Error(codes.NotFound, "Daily reward template not found")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit schedule daily reward template %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Schedule daily reward template error")
+	}
+	return nil
+}
+
+// checkDailyRewardScheduleOverlap only one scheduled template is active at a time
+func checkDailyRewardScheduleOverlap(ctx context.Context, logger runtime.Logger, tx *sql.Tx, excludeId, startUnix, endUnix int64) error {
+	// lock table so two admin can not schedule overlap window at the same time
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE "+DailyRewardTemplateTableName+" IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		logger.Error("Lock daily reward template error %s", err.Error())
+		return status.Error(codes.Internal, "Schedule daily reward template error")
+	}
+	query := "SELECT count(*) FROM " + DailyRewardTemplateTableName +
+		" WHERE id<>$1 AND disabled=false AND start_time IS NOT NULL AND start_time < to_timestamp($3) AND end_time > to_timestamp($2)"
+	var count int64
+	if err := tx.QueryRowContext(ctx, query, excludeId, startUnix, endUnix).Scan(&count); err != nil {
+		logger.Error("Check overlap daily reward template error %s", err.Error())
+		return status.Error(codes.Internal, "Schedule daily reward template error")
+	}
+	if count > 0 {
+		return status.Error(codes.AlreadyExists, "Schedule overlap other template")
+	}
+	return nil
+}
+
+func GetListDailyRewardTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB, name string) ([]*entity.DailyRewardTemplateVersion, error) {
+	query := "SELECT " + dailyRewardTemplateColumns + " FROM " + DailyRewardTemplateTableName
+	params := make([]interface{}, 0)
+	if name != "" {
+		query += " WHERE name=$1"
+		params = append(params, name)
+	}
+	query += " ORDER BY name ASC, version DESC"
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		logger.Error("Query daily reward template error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query daily reward template error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.DailyRewardTemplateVersion, 0)
+	for rows.Next() {
+		template, err := scanDailyRewardTemplate(rows)
+		if err != nil {
+			logger.Error("Scan daily reward template error %s", err.Error())
+			continue
+		}
+		ml = append(ml, template)
+	}
+	return ml, rows.Err()
+}
+
+// GetActiveDailyRewardTemplate scheduled template active now, else latest default template.
+// Return nil if no template in db.
+func GetActiveDailyRewardTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB) (*entity.DailyRewardTemplateVersion, error) {
+	query := "SELECT " + dailyRewardTemplateColumns + " FROM " + DailyRewardTemplateTableName +
+		" WHERE disabled=false AND ((start_time <= now() AND end_time > now()) OR (start_time IS NULL AND end_time IS NULL))" +
+		" ORDER BY start_time IS NULL ASC, create_time DESC LIMIT 1"
+	template, err := scanDailyRewardTemplate(db.QueryRowContext(ctx, query))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error("Query active daily reward template error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query daily reward template error")
+	}
+	return template, nil
+}
+
+// GetDailyRewardTimezone timezone user set and timezone pinned for daily reward in users metadata
+func GetDailyRewardTimezone(ctx context.Context, db *sql.DB, userId string) (string, *entity.DailyRewardTimezone, error) {
+	var timezone sql.NullString
+	var dbPinned []byte
+	query := "SELECT timezone, metadata->'daily_reward_timezone' FROM users WHERE id=$1"
+	if err := db.QueryRowContext(ctx, query, userId).Scan(&timezone, &dbPinned); err != nil {
+		return "", nil, err
+	}
+	pinned := &entity.DailyRewardTimezone{}
+	if len(dbPinned) > 0 {
+		_ = json.Unmarshal(dbPinned, pinned)
+	}
+	return timezone.String, pinned, nil
+}
+
+func SaveDailyRewardTimezone(ctx context.Context, db *sql.DB, userId string, pinned *entity.DailyRewardTimezone) error {
+	data, _ := json.Marshal(pinned)
+	query := `UPDATE users AS u SET metadata = u.metadata || jsonb_build_object('daily_reward_timezone', $2::jsonb) WHERE id = $1`
+	_, err := db.ExecContext(ctx, query, userId, string(data))
+	return err
+}
@@ -0,0 +1,134 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.device_registry (
+//
+//	user_id character varying(128) NOT NULL,
+//	device_id character varying(128) NOT NULL,
+//	platform character varying(16) NOT NULL DEFAULT '',
+//	session_id character varying(64) NOT NULL DEFAULT '',
+//	first_seen timestamp with time zone NOT NULL DEFAULT now(),
+//	last_seen timestamp with time zone NOT NULL DEFAULT now(),
+//	revoke_time timestamp with time zone,
+//	CONSTRAINT device_registry_pkey PRIMARY KEY (user_id, device_id)
+//
+// );
+// CREATE INDEX idx_device_registry_session ON public.device_registry(user_id, session_id);
+// token of last login or refresh of device, logged out when device is revoked
+//
+//	ALTER TABLE public.device_registry ADD COLUMN token text NOT NULL DEFAULT '';
+//	ALTER TABLE public.device_registry ADD COLUMN refresh_token text NOT NULL DEFAULT '';
+const DeviceRegistryTableName = "device_registry"
+
+// UpsertUserDevice save device and tokens after login success, revoked device stay revoked
+func UpsertUserDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, deviceId, platform, token, refreshToken string) error {
+	query := "INSERT INTO " + DeviceRegistryTableName + " (user_id, device_id, platform, token, refresh_token, first_seen, last_seen) VALUES ($1, $2, $3, $4, $5, now(), now())" +
+		" ON CONFLICT (user_id, device_id) DO UPDATE SET last_seen=now(), token=EXCLUDED.token, refresh_token=EXCLUDED.refresh_token," +
+		" platform=CASE WHEN EXCLUDED.platform<>'' THEN EXCLUDED.platform ELSE " + DeviceRegistryTableName + ".platform END"
+	if _, err := db.ExecContext(ctx, query, userId, deviceId, platform, token, refreshToken); err != nil {
+		logger.Error("Upsert device %s user %s error %s", deviceId, userId, err.Error())
+		return status.Error(codes.Internal, "Upsert user device error")
+	}
+	return nil
+}
+
+// UpdateUserDeviceToken save tokens of device after session refresh. Return true if device is revoked.
+func UpdateUserDeviceToken(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, deviceId, token, refreshToken string) (bool, error) {
+	query := "UPDATE " + DeviceRegistryTableName + " SET token=$3, refresh_token=$4, last_seen=now() WHERE user_id=$1 AND device_id=$2" +
+		" RETURNING revoke_time IS NOT NULL"
+	var revoked bool
+	err := db.QueryRowContext(ctx, query, userId, deviceId, token, refreshToken).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.Error("Update token of device %s user %s error %s", deviceId, userId, err.Error())
+		return false, status.Error(codes.Internal, "Update user device token error")
+	}
+	return revoked, nil
+}
+
+// TouchUserDevice save session of device at session start. Return true if device is revoked.
+func TouchUserDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, deviceId, platform, sessionId string) (bool, error) {
+	query := "INSERT INTO " + DeviceRegistryTableName + " (user_id, device_id, platform, session_id, first_seen, last_seen) VALUES ($1, $2, $3, $4, now(), now())" +
+		" ON CONFLICT (user_id, device_id) DO UPDATE SET last_seen=now(), session_id=EXCLUDED.session_id" +
+		" RETURNING revoke_time IS NOT NULL"
+	var revoked bool
+	if err := db.QueryRowContext(ctx, query, userId, deviceId, platform, sessionId).Scan(&revoked); err != nil {
+		logger.Error("Touch device %s user %s error %s", deviceId, userId, err.Error())
+		return false, status.Error(codes.Internal, "Touch user device error")
+	}
+	return revoked, nil
+}
+
+// IsRevokedUserDevice device revoked in registry of user
+func IsRevokedUserDevice(ctx context.Context, db *sql.DB, userId, deviceId string) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM " + DeviceRegistryTableName + " WHERE user_id=$1 AND device_id=$2 AND revoke_time IS NOT NULL)"
+	var revoked bool
+	err := db.QueryRowContext(ctx, query, userId, deviceId).Scan(&revoked)
+	return revoked, err
+}
+
+// IsKnownUserDevice device not revoked in registry of user. User without any device in registry
+// (logged in before registry exist) know every device.
+func IsKnownUserDevice(ctx context.Context, db *sql.DB, userId, deviceId string) (bool, error) {
+	query := "SELECT NOT EXISTS (SELECT 1 FROM " + DeviceRegistryTableName + " WHERE user_id=$1)" +
+		" OR EXISTS (SELECT 1 FROM " + DeviceRegistryTableName + " WHERE user_id=$1 AND device_id=$2 AND revoke_time IS NULL)"
+	var known bool
+	err := db.QueryRowContext(ctx, query, userId, deviceId).Scan(&known)
+	return known, err
+}
+
+func ListUserDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string) ([]*entity.UserDevice, error) {
+	query := "SELECT device_id, platform, session_id, first_seen, last_seen, revoke_time FROM " + DeviceRegistryTableName +
+		" WHERE user_id=$1 ORDER BY last_seen DESC"
+	rows, err := db.QueryContext(ctx, query, userId)
+	if err != nil {
+		logger.Error("List device user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "List user device error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.UserDevice, 0)
+	for rows.Next() {
+		d := &entity.UserDevice{}
+		var firstSeen, lastSeen time.Time
+		var revokeTime sql.NullTime
+		if err := rows.Scan(&d.DeviceId, &d.Platform, &d.SessionId, &firstSeen, &lastSeen, &revokeTime); err != nil {
+			logger.Error("Scan user device error %s", err.Error())
+			continue
+		}
+		d.FirstSeenUnix = firstSeen.Unix()
+		d.LastSeenUnix = lastSeen.Unix()
+		if revokeTime.Valid {
+			d.RevokeTimeUnix = revokeTime.Time.Unix()
+		}
+		ml = append(ml, d)
+	}
+	return ml, rows.Err()
+}
+
+// RevokeUserDevice revoke active device, return last session and tokens of device to logout
+func RevokeUserDevice(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, deviceId string) (*entity.UserDevice, error) {
+	query := "UPDATE " + DeviceRegistryTableName + " SET revoke_time=now() WHERE user_id=$1 AND device_id=$2 AND revoke_time IS NULL" +
+		" RETURNING session_id, token, refresh_token"
+	d := &entity.UserDevice{DeviceId: deviceId}
+	err := db.QueryRowContext(ctx, query, userId, deviceId).Scan(&d.SessionId, &d.Token, &d.RefreshToken)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, entity.ErrDeviceNotFound.Error())
+	}
+	if err != nil {
+		logger.Error("Revoke device %s user %s error %s", deviceId, userId, err.Error())
+		return nil, status.Error(codes.Internal, "Revoke user device error")
+	}
+	return d, nil
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/jackc/pgtype"
+	"github.com/lib/pq"
 	"github.com/nk-nigeria/lobby-module/entity"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -147,3 +148,27 @@ func GetSumFeeByUserId(ctx context.Context, logger runtime.Logger, db *sql.DB, r
 	}
 	return l, nil
 }
+
+// GetSumFeeByUserIds sum fee of each user in [from, to], user has no fee is not in map
+func GetSumFeeByUserIds(ctx context.Context, logger runtime.Logger, db *sql.DB, userIds []string, from, to int64) (map[string]int64, error) {
+	ml := make(map[string]int64)
+	if len(userIds) == 0 {
+		return ml, nil
+	}
+	query := "SELECT user_id, sum(fee) FROM " + FeeGameTableName +
+		" WHERE user_id = ANY($1) AND create_time>=$2 AND create_time<=$3 GROUP BY user_id"
+	rows, err := db.QueryContext(ctx, query, pq.Array(userIds), time.Unix(from, 0), time.Unix(to, 0))
+	if err != nil {
+		logger.Error("Get sum fee game of %d users, error %s", len(userIds), err.Error())
+		return nil, status.Error(codes.Internal, "get sum free game error")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userId string
+		var fee int64
+		if rows.Scan(&userId, &fee) == nil {
+			ml[userId] = fee
+		}
+	}
+	return ml, rows.Err()
+}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/nk-nigeria/lobby-module/conf"
@@ -90,25 +91,82 @@ func MarkClaimableFreeChip(ctx context.Context, logger runtime.Logger, db *sql.D
 	return GetFreeChipByIdByUser(ctx, logger, db, freeChip.Id, "")
 }
 
-func ClaimFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, recipientId string) (*pb.FreeChip, error) {
+// ClaimFreeChip mark freechip claimed and write the pending wallet update to claim outbox
+// in the same transaction. Retry claim the same freechip return the original claim.
+func ClaimFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, recipientId string, userId string) (*pb.FreeChip, *entity.ClaimOutbox, error) {
+	idemKey := entity.FreeChipClaimKey(id)
+	if freeChip, outbox, err := getFreeChipClaimed(ctx, logger, db, userId, idemKey); err != nil || outbox != nil {
+		return freeChip, outbox, err
+	}
 	freeChip, err := GetFreeChipByIdByUser(ctx, logger, db, id, recipientId)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if !freeChip.Claimable {
-		return nil, status.Error(codes.Aborted, "Freechip alread claimed")
+		return nil, nil, status.Error(codes.Aborted, "Freechip alread claimed")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx claim free chip id %d error %s", id, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim freechip error")
 	}
-	query := "UPDATE " + FreeChipTableName + " SET claimable=$1,claim_status=$2 WHERE id=$3 AND recipient_id=$4 AND claimable=$5 and claim_status=$6"
-	result, err := db.ExecContext(ctx, query, 0, pb.FreeChip_CLAIM_STATUS_CLAIMED.Number(), id, recipientId, 1, pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number())
+	defer tx.Rollback()
+	query := "UPDATE " + FreeChipTableName + " SET claimable=$1,claim_status=$2,claim_time=now() WHERE id=$3 AND recipient_id=$4 AND claimable=$5 and claim_status=$6" +
+		" AND (expire_time IS NULL OR expire_time > now())"
+	result, err := tx.ExecContext(ctx, query, 0, pb.FreeChip_CLAIM_STATUS_CLAIMED.Number(), id, recipientId, 1, pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number())
 	if err != nil {
 		logger.Error("Claim free chip id %d, user %s, error %s", id, recipientId, err.Error())
-		return nil, status.Error(codes.Internal, "Claim freechip error")
+		return nil, nil, status.Error(codes.Internal, "Claim freechip error")
 	}
 	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		tx.Rollback()
+		// parallel request claimed it first
+		if freeChip, outbox, err := getFreeChipClaimed(ctx, logger, db, userId, idemKey); err == nil && outbox != nil {
+			return freeChip, outbox, nil
+		}
 		logger.Error("Did not claim freechip.")
-		return nil, status.Error(codes.Internal, "Error claim freechip")
+		return nil, nil, status.Error(codes.Internal, "Error claim freechip")
+	}
+	freeChip.Claimable = false
+	freeChip.ClaimStaus = pb.FreeChip_CLAIM_STATUS_CLAIMED
+	metadata := make(map[string]interface{})
+	metadata["action"] = entity.WalletActionFreeChip
+	if freeChip.GetAction() != "" {
+		metadata["action"] = freeChip.GetAction()
+	}
+	metadata["sender"] = freeChip.GetSenderId()
+	metadata["recv"] = userId
+	resultData, _ := conf.MarshalerDefault.Marshal(freeChip)
+	outbox := &entity.ClaimOutbox{
+		UserId:   userId,
+		IdemKey:  idemKey,
+		Kind:     entity.ClaimOutboxKindFreeChip,
+		RefId:    freeChip.Id,
+		Chips:    freeChip.Chips,
+		Metadata: metadata,
+		Result:   resultData,
+	}
+	if err := addClaimOutbox(ctx, logger, tx, outbox); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit claim free chip id %d error %s", id, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim freechip error")
 	}
-	return freeChip, nil
+	return freeChip, outbox, nil
+}
+
+func getFreeChipClaimed(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, idemKey string) (*pb.FreeChip, *entity.ClaimOutbox, error) {
+	outbox, err := GetClaimOutboxByKey(ctx, logger, db, userId, idemKey)
+	if err != nil || outbox == nil {
+		return nil, nil, err
+	}
+	freeChip := &pb.FreeChip{}
+	if err := conf.Unmarshaler.Unmarshal(outbox.Result, freeChip); err != nil {
+		logger.Error("Unmarshal claim outbox %d result error %s", outbox.Id, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim freechip error")
+	}
+	return freeChip, outbox, nil
 }
 
 func GetFreeChipByIdByUser(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, recipientId string) (*pb.FreeChip, error) {
@@ -148,24 +206,28 @@ func GetFreeChipByIdByUser(ctx context.Context, logger runtime.Logger, db *sql.D
 	return &freeChip, nil
 }
 
-func GetFreeChipClaimableByUser(ctx context.Context, logger runtime.Logger, db *sql.DB, recipientId string) (*pb.ListFreeChip, error) {
+func GetFreeChipClaimableByUser(ctx context.Context, logger runtime.Logger, db *sql.DB, recipientId string) (*entity.ListClaimableFreeChip, error) {
 	if recipientId == "" {
 		return nil, status.Error(codes.InvalidArgument, "Id or user id is empty")
 	}
-	query := "SELECT id, sender_id, recipient_id, title, content, chips, claimable, action FROM " + FreeChipTableName + " WHERE claimable=$1 AND recipient_id=$2 and claim_status=$3 "
+	query := "SELECT id, sender_id, recipient_id, title, content, chips, claimable, action, expire_time FROM " + FreeChipTableName +
+		" WHERE claimable=$1 AND recipient_id=$2 and claim_status=$3 AND (expire_time IS NULL OR expire_time > now())"
 
 	rows, err := db.QueryContext(ctx, query, 1, recipientId, pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number())
 	if err != nil {
 		logger.Error("Query free chip claimable user %s, error %s", recipientId, err.Error())
 		return nil, status.Error(codes.Internal, "Query freechip claimable error")
 	}
-	ml := make([]*pb.FreeChip, 0)
+	defer rows.Close()
+	now := time.Now()
+	ml := make([]*entity.ClaimableFreeChip, 0)
 	var dbID int64
 	var dbSenderId, dbRecvId, dbTitle, dbContent, dbAction string
 	var dbChips int64
 	var dbClaimable int
+	var dbExpireTime sql.NullTime
 	for rows.Next() {
-		rows.Scan(&dbID, &dbSenderId, &dbRecvId, &dbTitle, &dbContent, &dbChips, &dbClaimable, &dbAction)
+		rows.Scan(&dbID, &dbSenderId, &dbRecvId, &dbTitle, &dbContent, &dbChips, &dbClaimable, &dbAction, &dbExpireTime)
 		freeChip := pb.FreeChip{
 			Id:          dbID,
 			SenderId:    dbSenderId,
@@ -178,10 +240,15 @@ func GetFreeChipClaimableByUser(ctx context.Context, logger runtime.Logger, db *
 		if dbClaimable == 1 {
 			freeChip.Claimable = true
 		}
-		ml = append(ml, &freeChip)
+		item := &entity.ClaimableFreeChip{FreeChip: &freeChip}
+		if dbExpireTime.Valid {
+			item.ExpireTimeUnix = dbExpireTime.Time.Unix()
+			item.RemainSec = int64(dbExpireTime.Time.Sub(now).Seconds())
+		}
+		ml = append(ml, item)
 	}
 
-	return &pb.ListFreeChip{
+	return &entity.ListClaimableFreeChip{
 		Freechips: ml,
 	}, nil
 }
@@ -0,0 +1,205 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/constant"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.freechip_campaign (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	name character varying(128) NOT NULL,
+//	title character varying(128) NOT NULL,
+//	template text NOT NULL DEFAULT '',
+//	chips bigint NOT NULL DEFAULT 0,
+//	budget bigint NOT NULL DEFAULT 0,
+//	user_group_id bigint NOT NULL DEFAULT 0,
+//	recipient_ids jsonb,
+//	expire_time timestamp with time zone,
+//	status smallint NOT NULL DEFAULT 1,
+//	num_granted bigint NOT NULL DEFAULT 0,
+//	num_skipped bigint NOT NULL DEFAULT 0,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+const FreeChipCampaignTableName = "freechip_campaign"
+
+// AddFreeChipCampaign insert campaign and one claimable freechip per recipient sid
+// in one transaction. Recipients over budget are skipped.
+// Return list sid granted.
+func AddFreeChipCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, campaign *entity.FreeChipCampaign, sids []int64) ([]int64, error) {
+	if campaign == nil || campaign.Chips <= 0 || campaign.Budget <= 0 || len(sids) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Error add freechip campaign.")
+	}
+	campaign.Id = conf.SnowlakeNode.Generate().Int64()
+	campaign.Status = entity.FreeChipCampaignStatusActive
+	maxGrant := int(campaign.Budget / campaign.Chips)
+	granted := sids
+	if len(granted) > maxGrant {
+		granted = sids[:maxGrant]
+	}
+	campaign.NumGranted = int64(len(granted))
+	campaign.NumSkipped = int64(len(sids) - len(granted))
+	if len(granted) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Budget too small for one freechip.")
+	}
+	var expireTime *time.Time
+	var expire time.Time
+	if campaign.ExpireTimeUnix > 0 {
+		expire = time.Unix(campaign.ExpireTimeUnix, 0)
+		expireTime = &expire
+	}
+	recipientIds, _ := json.Marshal(campaign.RecipientIds)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx add freechip campaign error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Error add freechip campaign.")
+	}
+	defer tx.Rollback()
+
+	query := "INSERT INTO " + FreeChipCampaignTableName + " (id, name, title, template, chips, budget, user_group_id, recipient_ids, expire_time, status, num_granted, num_skipped, create_time, update_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, now(), now())"
+	_, err = tx.ExecContext(ctx, query, campaign.Id, campaign.Name, campaign.Title, campaign.Template,
+		campaign.Chips, campaign.Budget, campaign.UserGroupId, recipientIds, expireTime,
+		campaign.Status, campaign.NumGranted, campaign.NumSkipped)
+	if err != nil {
+		logger.Error("Add freechip campaign %s error %s", campaign.Name, err.Error())
+		return nil, status.Error(codes.Internal, "Error add freechip campaign.")
+	}
+
+	queryFreeChip := "INSERT INTO " + FreeChipTableName + " (id, sender_id, recipient_id, title, content, chips, claimable, action, create_time, update_time, claim_time, claim_status, campaign_id, expire_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now(), now(), $9, $10, $11, $12)"
+	for _, sid := range granted {
+		sidStr := strconv.FormatInt(sid, 10)
+		content := campaign.Title
+		if campaign.Template != "" {
+			content = entity.RenderFreeChipTemplate(campaign.Template, campaign.Chips, expire, sidStr)
+		}
+		_, err = tx.ExecContext(ctx, queryFreeChip, conf.SnowlakeNode.Generate().Int64(),
+			constant.UUID_USER_SYSTEM, sidStr, campaign.Title, content, campaign.Chips, 1,
+			entity.WalletActionFreeChip.String(), nil, pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number(),
+			campaign.Id, expireTime)
+		if err != nil {
+			logger.Error("Add freechip campaign %d, recv: %d error %s", campaign.Id, sid, err.Error())
+			return nil, status.Error(codes.Internal, "Error add freechip campaign.")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit freechip campaign %d error %s", campaign.Id, err.Error())
+		return nil, status.Error(codes.Internal, "Error add freechip campaign.")
+	}
+	campaign.CreateTimeUnix = time.Now().Unix()
+	return granted, nil
+}
+
+func GetFreeChipCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) (*entity.FreeChipCampaign, error) {
+	if id <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Campaign id is empty")
+	}
+	query := "SELECT id, name, title, template, chips, budget, user_group_id, recipient_ids, expire_time, status, num_granted, num_skipped, create_time FROM " +
+		FreeChipCampaignTableName + " WHERE id=$1"
+	campaign := &entity.FreeChipCampaign{}
+	var dbRecipientIds []byte
+	var dbExpireTime sql.NullTime
+	var dbCreateTime time.Time
+	err := db.QueryRowContext(ctx, query, id).Scan(&campaign.Id, &campaign.Name, &campaign.Title, &campaign.Template,
+		&campaign.Chips, &campaign.Budget, &campaign.UserGroupId, &dbRecipientIds, &dbExpireTime,
+		&campaign.Status, &campaign.NumGranted, &campaign.NumSkipped, &dbCreateTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "Freechip campaign not found")
+		}
+		logger.Error("Query freechip campaign %d error %s", id, err.Error())
+		return nil, status.Error(codes.Internal, "Query freechip campaign error")
+	}
+	if len(dbRecipientIds) > 0 {
+		_ = json.Unmarshal(dbRecipientIds, &campaign.RecipientIds)
+	}
+	if dbExpireTime.Valid {
+		campaign.ExpireTimeUnix = dbExpireTime.Time.Unix()
+	}
+	campaign.CreateTimeUnix = dbCreateTime.Unix()
+	return campaign, nil
+}
+
+// RevokeFreeChip revoke a freechip not claimed yet
+func RevokeFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) error {
+	if id <= 0 {
+		return status.Error(codes.InvalidArgument, "freechip id missing")
+	}
+	query := "UPDATE " + FreeChipTableName + " SET claimable=0, claim_status=$1, update_time=now() WHERE id=$2 AND claim_status IN ($3, $4)"
+	result, err := db.ExecContext(ctx, query, entity.FreeChipClaimStatusRevoked, id,
+		pb.FreeChip_CLAIM_STATUS_WAIT_ADMIN_ACCEPT.Number(), pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number())
+	if err != nil {
+		logger.Error("Revoke freechip id %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Revoke freechip error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		logger.Error("Did not revoke freechip id %d", id)
+		return status.Error(codes.FailedPrecondition, "Freechip already claimed or not found")
+	}
+	return nil
+}
+
+// RevokeFreeChipCampaign revoke all freechip not claimed yet of campaign.
+// Return number freechip revoked.
+func RevokeFreeChipCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, campaignId int64) (int64, error) {
+	if campaignId <= 0 {
+		return 0, status.Error(codes.InvalidArgument, "campaign id missing")
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx revoke freechip campaign error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Revoke freechip campaign error")
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE "+FreeChipCampaignTableName+" SET status=$1, update_time=now() WHERE id=$2",
+		entity.FreeChipCampaignStatusRevoked, campaignId)
+	if err != nil {
+		logger.Error("Revoke freechip campaign %d error %s", campaignId, err.Error())
+		return 0, status.Error(codes.Internal, "Revoke freechip campaign error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		return 0, status.Error(codes.NotFound, "Freechip campaign not found")
+	}
+	query := "UPDATE " + FreeChipTableName + " SET claimable=0, claim_status=$1, update_time=now() WHERE campaign_id=$2 AND claim_status IN ($3, $4)"
+	result, err = tx.ExecContext(ctx, query, entity.FreeChipClaimStatusRevoked, campaignId,
+		pb.FreeChip_CLAIM_STATUS_WAIT_ADMIN_ACCEPT.Number(), pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number())
+	if err != nil {
+		logger.Error("Revoke freechip of campaign %d error %s", campaignId, err.Error())
+		return 0, status.Error(codes.Internal, "Revoke freechip campaign error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit revoke freechip campaign %d error %s", campaignId, err.Error())
+		return 0, status.Error(codes.Internal, "Revoke freechip campaign error")
+	}
+	revoked, _ := result.RowsAffected()
+	return revoked, nil
+}
+
+// ExpireFreeChip mark all unclaimed freechip past expire_time as expired.
+func ExpireFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB) (int64, error) {
+	query := "UPDATE " + FreeChipTableName + " SET claimable=0, claim_status=$1, update_time=now()" +
+		" WHERE expire_time IS NOT NULL AND expire_time < now() AND claim_status IN ($2, $3)"
+	result, err := db.ExecContext(ctx, query, entity.FreeChipClaimStatusExpired,
+		pb.FreeChip_CLAIM_STATUS_WAIT_ADMIN_ACCEPT.Number(), pb.FreeChip_CLAIM_STATUS_WAIT_USER_CLAIM.Number())
+	if err != nil {
+		logger.Error("Expire freechip error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Expire freechip error")
+	}
+	expired, _ := result.RowsAffected()
+	return expired, nil
+}
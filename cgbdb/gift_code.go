@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/jackc/pgtype"
 	"github.com/nk-nigeria/lobby-module/conf"
 	"github.com/nk-nigeria/lobby-module/constant"
+	"github.com/nk-nigeria/lobby-module/entity"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -90,6 +92,9 @@ func GetGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftCod
 		&dbEndTime, &dbMessage, &dbVip,
 		&dbGiftCodeType, &dbCreateTime, &dbUpdateTime)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "Giftcode not found")
+		}
 		logger.Error("Query giftcode %s,  error %s",
 			giftCode.GetCode(), err.Error())
 		return nil, status.Error(codes.Internal, "Query giftcode error")
@@ -160,7 +165,31 @@ func GetListGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, gif
 	}, nil
 }
 
-func ClaimGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftCode *pb.GiftCode, lvVipUser int64) (*pb.GiftCode, error) {
+// ClaimGiftCode claimer rules except per-device limit must be checked before,
+// per-device limit is checked here after lock the code.
+// GetClaimedGiftCode result of claim giftcode by user stored in claim outbox, nil if user not claim it yet
+func GetClaimedGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftCode *pb.GiftCode) (*pb.GiftCode, error) {
+	dbGiftCode, err := GetGiftCode(ctx, logger, db, giftCode)
+	if err != nil {
+		return nil, err
+	}
+	dbGiftCode.UserId = giftCode.GetUserId()
+	return getClaimedGiftCode(ctx, logger, db, dbGiftCode)
+}
+
+func getClaimedGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, dbGiftCode *pb.GiftCode) (*pb.GiftCode, error) {
+	outbox, err := GetClaimOutboxByKey(ctx, logger, db, dbGiftCode.GetUserId(), entity.GiftCodeClaimKey(dbGiftCode.GetId()))
+	if err != nil || outbox == nil {
+		return nil, err
+	}
+	claimed := &pb.GiftCode{}
+	if err := conf.Unmarshaler.Unmarshal(outbox.Result, claimed); err != nil {
+		return nil, nil
+	}
+	return claimed, nil
+}
+
+func ClaimGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftCode *pb.GiftCode, claimer *entity.GiftCodeClaimer, rules *entity.GiftCodeRules) (*pb.GiftCode, error) {
 	if giftCode == nil || giftCode.GetCode() == "" || giftCode.UserId == "" {
 		return nil, status.Error(codes.InvalidArgument, "Error query giftcode.")
 	}
@@ -170,6 +199,10 @@ func ClaimGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftC
 	}
 
 	dbGiftCode.UserId = giftCode.GetUserId()
+	// retry claim return the original result, even if code is closed or used up after first claim
+	if claimed, err := getClaimedGiftCode(ctx, logger, db, dbGiftCode); err != nil || claimed != nil {
+		return claimed, err
+	}
 	nowUnix := time.Now().Unix()
 	dbGiftCode.OpenToClaim = true
 	if dbGiftCode.StartTimeUnix > nowUnix {
@@ -191,7 +224,7 @@ func ClaimGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftC
 		return dbGiftCode, nil
 	}
 
-	if dbGiftCode.Vip > lvVipUser {
+	if dbGiftCode.Vip > claimer.VipLevel {
 		dbGiftCode.ErrCode = int32(pb.GiftCodeError_GIFT_CODE_ERROR_LV_VIP_NOT_MEET_REQUIRE)
 		return dbGiftCode, nil
 	}
@@ -207,9 +240,15 @@ func ClaimGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftC
 		return dbGiftCode, nil
 	}
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx claim giftcode %s error %s", giftCode.GetCode(), err.Error())
+		return nil, status.Error(codes.Internal, "Error claim giftcode")
+	}
+	defer tx.Rollback()
 	queryCheckCodeClaimByUser := "Select code from " + GiftCodeClaimTableName + " where user_id=$2 AND id_code=$3 AND code=$4"
 	query := `UPDATE ` + GiftCodeTableName + " SET n_current=n_current+1, update_time=now() where code=$1 AND n_current<n_max AND code NOT IN ( " + queryCheckCodeClaimByUser + " )"
-	result, err := db.ExecContext(ctx, query, dbGiftCode.Code, dbGiftCode.GetUserId(), dbGiftCode.GetId(), dbGiftCode.GetCode())
+	result, err := tx.ExecContext(ctx, query, dbGiftCode.Code, dbGiftCode.GetUserId(), dbGiftCode.GetId(), dbGiftCode.GetCode())
 	if err != nil {
 		logger.Error("Cannot claim giftcode %s, err: %s",
 			giftCode.GetCode(), err.Error())
@@ -220,8 +259,52 @@ func ClaimGiftCode(ctx context.Context, logger runtime.Logger, db *sql.DB, giftC
 		logger.Error("Did not update gift code claim.")
 		return nil, status.Error(codes.Internal, " Error claim giftcode.")
 	}
+	// update above lock the code row, so count claim by device is safe
+	if rules != nil && rules.MaxPerDevice > 0 {
+		count, err := CountGiftCodeClaimByDevice(ctx, tx, dbGiftCode.GetId(), claimer.DeviceId)
+		if err != nil {
+			logger.Error("Count claim giftcode %s by device %s error %s", giftCode.GetCode(), claimer.DeviceId, err.Error())
+			return nil, status.Error(codes.Internal, "Error claim giftcode")
+		}
+		if count >= rules.MaxPerDevice {
+			return nil, entity.ErrGiftCodeRuleDevice
+		}
+	}
 	dbGiftCode.NCurrent++
-	AddNewGiftCodeClaim(ctx, logger, db, dbGiftCode)
+	if err := AddNewGiftCodeClaim(ctx, logger, tx, dbGiftCode, claimer.DeviceId); err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]interface{})
+	metadata["action"] = entity.WalletActionGiftCode
+	metadata["sender"] = constant.UUID_USER_SYSTEM
+	metadata["recv"] = dbGiftCode.GetUserId()
+	// convert int64 to string because missing value when save to wallet metadata
+	// metadata save int64 as float64 cause missing value
+	metadata["g_id"] = strconv.FormatInt(dbGiftCode.Id, 10)
+	resultData, _ := conf.MarshalerDefault.Marshal(dbGiftCode)
+	outbox := &entity.ClaimOutbox{
+		UserId:   dbGiftCode.GetUserId(),
+		IdemKey:  entity.GiftCodeClaimKey(dbGiftCode.GetId()),
+		Kind:     entity.ClaimOutboxKindGiftCode,
+		RefId:    dbGiftCode.GetId(),
+		Chips:    dbGiftCode.GetValue(),
+		Metadata: metadata,
+		Result:   resultData,
+	}
+	if err := addClaimOutbox(ctx, logger, tx, outbox); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			// parallel request claimed it first
+			tx.Rollback()
+			if claimed, _ := getClaimedGiftCode(ctx, logger, db, dbGiftCode); claimed != nil {
+				return claimed, nil
+			}
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit claim giftcode %s error %s", giftCode.GetCode(), err.Error())
+		return nil, status.Error(codes.Internal, "Error claim giftcode")
+	}
 	return dbGiftCode, nil
 }
 
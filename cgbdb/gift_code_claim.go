@@ -19,6 +19,7 @@ import (
 // 	id_code bigint NOT NULL,
 //     code character varying(128) NOT NULL DEFAULT '',
 //     user_id character varying(128) NOT NULL,
+//     device_id character varying(128) NOT NULL DEFAULT '',
 //     create_time timestamp
 //     with
 //       time zone NOT NULL DEFAULT now(),
@@ -36,17 +37,18 @@ import (
 //	CONSTRAINT giftcodeclaim_pkey PRIMARY KEY (id)
 const GiftCodeClaimTableName = "giftcodeclaim"
 
-func AddNewGiftCodeClaim(ctx context.Context, logger runtime.Logger, db *sql.DB, giftCode *pb.GiftCode) error {
+func AddNewGiftCodeClaim(ctx context.Context, logger runtime.Logger, db dbExecutor, giftCode *pb.GiftCode, deviceId string) error {
 	if giftCode == nil || giftCode.GetId() <= 0 || giftCode.GetCode() == "" || giftCode.GetValue() <= 0 {
 		return status.Error(codes.InvalidArgument, "Error add giftcode.")
 	}
-	query := "INSERT INTO " + GiftCodeClaimTableName + " (id, id_code, code, user_id, create_time, update_time) VALUES ($1, $2, $3, $4, now(), now())"
+	query := "INSERT INTO " + GiftCodeClaimTableName + " (id, id_code, code, user_id, device_id, create_time, update_time) VALUES ($1, $2, $3, $4, $5, now(), now())"
 	// startTime := pgtype.Timestamptz
 	result, err := db.ExecContext(ctx, query,
 		conf.SnowlakeNode.Generate().Int64(),
 		giftCode.GetId(),
 		giftCode.GetCode(),
-		giftCode.GetUserId())
+		giftCode.GetUserId(),
+		deviceId)
 	if err != nil {
 		logger.Error("Add new giftcodeclaim %s, error %s",
 			giftCode.GetCode(), err.Error())
@@ -88,3 +90,12 @@ func GetGiftCodeClaim(ctx context.Context, logger runtime.Logger, db *sql.DB, gi
 
 	return &respGiftCode, nil
 }
+
+func CountGiftCodeClaimByDevice(ctx context.Context, db dbExecutor, idCode int64, deviceId string) (int64, error) {
+	query := "SELECT count(*) FROM " + GiftCodeClaimTableName + " WHERE id_code=$1 AND device_id=$2"
+	var count int64
+	if err := db.QueryRowContext(ctx, query, idCode, deviceId).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,143 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.giftcode_attempt (
+//
+//	key_type character varying(16) NOT NULL,
+//	key_value character varying(128) NOT NULL,
+//	fail_count integer NOT NULL DEFAULT 0,
+//	last_fail_time timestamp with time zone,
+//	locked_until timestamp with time zone,
+//	last_code character varying(128) NOT NULL DEFAULT '',
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	PRIMARY KEY (key_type, key_value)
+//
+// );
+const GiftCodeAttemptTableName = "giftcode_attempt"
+
+const giftCodeAttemptColumns = "key_type, key_value, fail_count, last_fail_time, locked_until, last_code"
+
+func scanGiftCodeAttempt(row interface{ Scan(dest ...any) error }) (*entity.GiftCodeAttempt, error) {
+	attempt := &entity.GiftCodeAttempt{}
+	var dbLastFail, dbLockedUntil sql.NullTime
+	err := row.Scan(&attempt.KeyType, &attempt.KeyValue, &attempt.FailCount, &dbLastFail, &dbLockedUntil, &attempt.LastCode)
+	if err != nil {
+		return nil, err
+	}
+	if dbLastFail.Valid {
+		attempt.LastFailUnix = dbLastFail.Time.Unix()
+	}
+	if dbLockedUntil.Valid {
+		attempt.LockedUntilUnix = dbLockedUntil.Time.Unix()
+	}
+	return attempt, nil
+}
+
+// GetGiftCodeAttempt return empty attempt if key has no failed attempt
+func GetGiftCodeAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, keyType, keyValue string) (*entity.GiftCodeAttempt, error) {
+	query := "SELECT " + giftCodeAttemptColumns + " FROM " + GiftCodeAttemptTableName + " WHERE key_type=$1 AND key_value=$2"
+	attempt, err := scanGiftCodeAttempt(db.QueryRowContext(ctx, query, keyType, keyValue))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &entity.GiftCodeAttempt{KeyType: keyType, KeyValue: keyValue}, nil
+		}
+		logger.Error("Query giftcode attempt %s %s error %s", keyType, keyValue, err.Error())
+		return nil, status.Error(codes.Internal, "Query giftcode attempt error")
+	}
+	return attempt, nil
+}
+
+// AddGiftCodeAttemptFail record failed attempt, lock row so parallel guesses are all counted.
+// Return true if user reach alert threshold.
+func AddGiftCodeAttemptFail(ctx context.Context, logger runtime.Logger, db *sql.DB, keyType, keyValue, code string) (*entity.GiftCodeAttempt, bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx giftcode attempt error %s", err.Error())
+		return nil, false, status.Error(codes.Internal, "Update giftcode attempt error")
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, "INSERT INTO "+GiftCodeAttemptTableName+" (key_type, key_value, fail_count, last_code, update_time)"+
+		" VALUES ($1, $2, 0, '', now()) ON CONFLICT (key_type, key_value) DO NOTHING", keyType, keyValue)
+	if err != nil {
+		logger.Error("Insert giftcode attempt %s %s error %s", keyType, keyValue, err.Error())
+		return nil, false, status.Error(codes.Internal, "Update giftcode attempt error")
+	}
+	query := "SELECT " + giftCodeAttemptColumns + " FROM " + GiftCodeAttemptTableName + " WHERE key_type=$1 AND key_value=$2 FOR UPDATE"
+	attempt, err := scanGiftCodeAttempt(tx.QueryRowContext(ctx, query, keyType, keyValue))
+	if err != nil {
+		logger.Error("Lock giftcode attempt %s %s error %s", keyType, keyValue, err.Error())
+		return nil, false, status.Error(codes.Internal, "Update giftcode attempt error")
+	}
+	alert := attempt.Fail(code, time.Now().Unix())
+	var lockedUntil interface{}
+	if attempt.LockedUntilUnix > 0 {
+		lockedUntil = time.Unix(attempt.LockedUntilUnix, 0)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE "+GiftCodeAttemptTableName+" SET fail_count=$1, last_fail_time=to_timestamp($2), locked_until=$3,"+
+		" last_code=$4, update_time=now() WHERE key_type=$5 AND key_value=$6",
+		attempt.FailCount, attempt.LastFailUnix, lockedUntil, attempt.LastCode, keyType, keyValue)
+	if err != nil {
+		logger.Error("Update giftcode attempt %s %s error %s", keyType, keyValue, err.Error())
+		return nil, false, status.Error(codes.Internal, "Update giftcode attempt error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit giftcode attempt %s %s error %s", keyType, keyValue, err.Error())
+		return nil, false, status.Error(codes.Internal, "Update giftcode attempt error")
+	}
+	return attempt, alert, nil
+}
+
+func ResetGiftCodeAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, keyType, keyValue string) error {
+	query := "DELETE FROM " + GiftCodeAttemptTableName + " WHERE key_type=$1 AND key_value=$2"
+	if _, err := db.ExecContext(ctx, query, keyType, keyValue); err != nil {
+		logger.Error("Reset giftcode attempt %s %s error %s", keyType, keyValue, err.Error())
+		return status.Error(codes.Internal, "Reset giftcode attempt error")
+	}
+	return nil
+}
+
+// ListGiftCodeAttempt order by fail count, most suspicious first
+func ListGiftCodeAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.GiftCodeAttemptRequest) ([]*entity.GiftCodeAttempt, error) {
+	query := "SELECT " + giftCodeAttemptColumns + " FROM " + GiftCodeAttemptTableName + " WHERE true"
+	params := make([]interface{}, 0)
+	if req.KeyType != "" {
+		params = append(params, req.KeyType)
+		query += " AND key_type=$1"
+	}
+	if req.KeyValue != "" {
+		params = append(params, req.KeyValue)
+		query += fmt.Sprintf(" AND key_value=$%d", len(params))
+	}
+	if req.LockedOnly {
+		query += " AND locked_until > now()"
+	}
+	params = append(params, req.Limit, req.Offset)
+	query += fmt.Sprintf(" ORDER BY fail_count DESC, update_time DESC LIMIT $%d OFFSET $%d", len(params)-1, len(params))
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		logger.Error("Query list giftcode attempt error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query giftcode attempt error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.GiftCodeAttempt, 0)
+	for rows.Next() {
+		attempt, err := scanGiftCodeAttempt(rows)
+		if err != nil {
+			logger.Error("Scan giftcode attempt error %s", err.Error())
+			continue
+		}
+		ml = append(ml, attempt)
+	}
+	return ml, rows.Err()
+}
@@ -0,0 +1,236 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/constant"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.giftcode_campaign (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	name character varying(128) NOT NULL,
+//	prefix character varying(16) NOT NULL,
+//	n_code integer NOT NULL DEFAULT 0,
+//	value bigint NOT NULL DEFAULT 0,
+//	n_max integer NOT NULL DEFAULT 1,
+//	start_time_unix timestamp,
+//	end_time_unix timestamp,
+//	message character varying(256) NOT NULL DEFAULT '',
+//	vip integer NOT NULL DEFAULT 0,
+//	disabled boolean NOT NULL DEFAULT false,
+//	rules jsonb,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+// ALTER TABLE public.giftcode ADD COLUMN campaign_id bigint NOT NULL DEFAULT 0;
+const GiftCodeCampaignTableName = "giftcode_campaign"
+
+const (
+	MaxGiftCodePerCampaign = 100000
+	giftCodeInsertBatch    = 500
+	// stop generate when too many collision
+	giftCodeMaxGenerateRound = 10
+)
+
+// AddGiftCodeCampaign insert campaign and generate NumCode unique codes in one transaction
+func AddGiftCodeCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, campaign *entity.GiftCodeCampaign) (*entity.GiftCodeCampaign, error) {
+	if campaign == nil || campaign.NumCode <= 0 || campaign.NumCode > MaxGiftCodePerCampaign || campaign.Value <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Error add giftcode campaign.")
+	}
+	if campaign.Value > constant.MaxChipAllowAdd {
+		return nil, status.Error(codes.OutOfRange, "giftcode value too large")
+	}
+	if err := entity.ValidGiftCodePrefix(campaign.Prefix); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if campaign.NMax <= 0 {
+		campaign.NMax = 1
+	}
+	campaign.Id = conf.SnowlakeNode.Generate().Int64()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx add giftcode campaign error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Error add giftcode campaign.")
+	}
+	defer tx.Rollback()
+	query := "INSERT INTO " + GiftCodeCampaignTableName + " (id, name, prefix, n_code, value, n_max, start_time_unix, end_time_unix, message, vip, disabled, rules, create_time, update_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, to_timestamp($7), to_timestamp($8), $9, $10, false, $11, now(), now())"
+	_, err = tx.ExecContext(ctx, query, campaign.Id, campaign.Name, campaign.Prefix, campaign.NumCode,
+		campaign.Value, campaign.NMax, campaign.StartTimeUnix, campaign.EndTimeUnix, campaign.Message, campaign.Vip,
+		marshalGiftCodeRules(campaign.Rules))
+	if err != nil {
+		logger.Error("Add giftcode campaign %s error %s", campaign.Name, err.Error())
+		return nil, status.Error(codes.Internal, "Error add giftcode campaign.")
+	}
+
+	var inserted int64 = 0
+	for round := 0; inserted < campaign.NumCode; round++ {
+		if round >= giftCodeMaxGenerateRound*int(campaign.NumCode/giftCodeInsertBatch+1) {
+			logger.Error("Generate giftcode campaign %d, too many collision, prefix %s", campaign.Id, campaign.Prefix)
+			return nil, status.Error(codes.ResourceExhausted, "Prefix has too many codes, use other prefix")
+		}
+		n := campaign.NumCode - inserted
+		if n > giftCodeInsertBatch {
+			n = giftCodeInsertBatch
+		}
+		count, err := insertGiftCodeBatch(ctx, logger, tx, campaign, int(n))
+		if err != nil {
+			return nil, err
+		}
+		inserted += count
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit giftcode campaign %d error %s", campaign.Id, err.Error())
+		return nil, status.Error(codes.Internal, "Error add giftcode campaign.")
+	}
+	campaign.CreateTimeUnix = time.Now().Unix()
+	return campaign, nil
+}
+
+// insertGiftCodeBatch insert n random code, skip code already exists.
+// Return number code inserted.
+func insertGiftCodeBatch(ctx context.Context, logger runtime.Logger, tx *sql.Tx, campaign *entity.GiftCodeCampaign, n int) (int64, error) {
+	values := make([]string, 0, n)
+	params := make([]interface{}, 0, n*2+8)
+	params = append(params, campaign.NMax, campaign.Value, campaign.StartTimeUnix,
+		campaign.EndTimeUnix, campaign.Message, campaign.Vip, campaign.Id, marshalGiftCodeRules(campaign.Rules))
+	for i := 0; i < n; i++ {
+		code, err := entity.GenerateGiftCode(campaign.Prefix)
+		if err != nil {
+			logger.Error("Generate giftcode error %s", err.Error())
+			return 0, status.Error(codes.Internal, "Error generate giftcode")
+		}
+		params = append(params, conf.SnowlakeNode.Generate().Int64(), code)
+		idx := len(params)
+		values = append(values, fmt.Sprintf("($%d, $%d, 0, $1, $2, to_timestamp($3), to_timestamp($4), $5, $6, $7, $8, now(), now())", idx-1, idx))
+	}
+	query := "INSERT INTO " + GiftCodeTableName + " (id, code, n_current, n_max, value, start_time_unix, end_time_unix, message, vip, campaign_id, rules, create_time, update_time) VALUES " +
+		strings.Join(values, ",") + " ON CONFLICT (code) DO NOTHING"
+	result, err := tx.ExecContext(ctx, query, params...)
+	if err != nil {
+		logger.Error("Insert giftcode campaign %d error %s", campaign.Id, err.Error())
+		return 0, status.Error(codes.Internal, "Error generate giftcode")
+	}
+	count, _ := result.RowsAffected()
+	return count, nil
+}
+
+func GetGiftCodeCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) (*entity.GiftCodeCampaign, error) {
+	if id <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "Campaign id is empty")
+	}
+	query := "SELECT id, name, prefix, n_code, value, n_max, start_time_unix, end_time_unix, message, vip, disabled, rules, create_time FROM " +
+		GiftCodeCampaignTableName + " WHERE id=$1"
+	campaign := &entity.GiftCodeCampaign{}
+	var dbStartTime, dbEndTime sql.NullTime
+	var dbCreateTime time.Time
+	var dbRules []byte
+	err := db.QueryRowContext(ctx, query, id).Scan(&campaign.Id, &campaign.Name, &campaign.Prefix, &campaign.NumCode,
+		&campaign.Value, &campaign.NMax, &dbStartTime, &dbEndTime, &campaign.Message, &campaign.Vip,
+		&campaign.Disabled, &dbRules, &dbCreateTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, status.Error(codes.NotFound, "Giftcode campaign not found")
+		}
+		logger.Error("Query giftcode campaign %d error %s", id, err.Error())
+		return nil, status.Error(codes.Internal, "Query giftcode campaign error")
+	}
+	campaign.StartTimeUnix = dbStartTime.Time.Unix()
+	campaign.EndTimeUnix = dbEndTime.Time.Unix()
+	campaign.CreateTimeUnix = dbCreateTime.Unix()
+	campaign.Rules = unmarshalGiftCodeRules(logger, dbRules)
+	return campaign, nil
+}
+
+// GetGiftCodeCampaignCodes page of codes in campaign with id after cursor
+func GetGiftCodeCampaignCodes(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, cursor int64, limit int64) ([]*entity.GiftCodeCampaignCode, error) {
+	query := "SELECT id, code, n_current, n_max, value FROM " + GiftCodeTableName + " WHERE campaign_id=$1 AND id>$2 ORDER BY id ASC LIMIT $3"
+	rows, err := db.QueryContext(ctx, query, id, cursor, limit)
+	if err != nil {
+		logger.Error("Query code of giftcode campaign %d error %s", id, err.Error())
+		return nil, status.Error(codes.Internal, "Query giftcode campaign error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.GiftCodeCampaignCode, 0)
+	for rows.Next() {
+		code := &entity.GiftCodeCampaignCode{}
+		if err := rows.Scan(&code.Id, &code.Code, &code.NCurrent, &code.NMax, &code.Value); err != nil {
+			logger.Error("Scan code of giftcode campaign %d error %s", id, err.Error())
+			continue
+		}
+		ml = append(ml, code)
+	}
+	return ml, rows.Err()
+}
+
+// IsGiftCodeCampaignPrefix prefix is used by a campaign, so its codes has check char
+func IsGiftCodeCampaignPrefix(ctx context.Context, db *sql.DB, prefix string) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM " + GiftCodeCampaignTableName + " WHERE prefix=$1)"
+	err := db.QueryRowContext(ctx, query, prefix).Scan(&exists)
+	return exists, err
+}
+
+func GetGiftCodeCampaignStats(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) (*entity.GiftCodeCampaignStats, error) {
+	campaign, err := GetGiftCodeCampaign(ctx, logger, db, id)
+	if err != nil {
+		return nil, err
+	}
+	stats := &entity.GiftCodeCampaignStats{
+		CampaignId: id,
+		Disabled:   campaign.Disabled,
+	}
+	query := "SELECT count(*), count(*) FILTER (WHERE n_current > 0), coalesce(sum(n_current), 0), coalesce(sum(n_current * value), 0) FROM " +
+		GiftCodeTableName + " WHERE campaign_id=$1"
+	err = db.QueryRowContext(ctx, query, id).Scan(&stats.NumCode, &stats.NumCodeClaimed, &stats.NumClaim, &stats.ChipsClaimed)
+	if err != nil {
+		logger.Error("Query stats giftcode campaign %d error %s", id, err.Error())
+		return nil, status.Error(codes.Internal, "Query giftcode campaign stats error")
+	}
+	queryUser := "SELECT count(DISTINCT c.user_id) FROM " + GiftCodeClaimTableName + " c JOIN " + GiftCodeTableName +
+		" g ON g.id = c.id_code WHERE g.campaign_id=$1"
+	if err := db.QueryRowContext(ctx, queryUser, id).Scan(&stats.NumUser); err != nil {
+		logger.Error("Query user stats giftcode campaign %d error %s", id, err.Error())
+	}
+	return stats, nil
+}
+
+// DisableGiftCodeCampaign close all code of campaign now
+func DisableGiftCodeCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx disable giftcode campaign error %s", err.Error())
+		return status.Error(codes.Internal, "Disable giftcode campaign error")
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE "+GiftCodeCampaignTableName+" SET disabled=true, update_time=now() WHERE id=$1", id)
+	if err != nil {
+		logger.Error("Disable giftcode campaign %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Disable giftcode campaign error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		return status.Error(codes.NotFound, "Giftcode campaign not found")
+	}
+	// claim check end_time_unix, so closed code return HAS_CLOSED
+	query := "UPDATE " + GiftCodeTableName + " SET end_time_unix=to_timestamp($1), update_time=now() WHERE campaign_id=$2 AND end_time_unix > to_timestamp($1)"
+	if _, err := tx.ExecContext(ctx, query, time.Now().Unix()-1, id); err != nil {
+		logger.Error("Close code of giftcode campaign %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Disable giftcode campaign error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit disable giftcode campaign %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Disable giftcode campaign error")
+	}
+	return nil
+}
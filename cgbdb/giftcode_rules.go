@@ -0,0 +1,102 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ALTER TABLE public.giftcode ADD COLUMN rules jsonb;
+// ALTER TABLE public.giftcode_campaign ADD COLUMN rules jsonb;
+// ALTER TABLE public.giftcodeclaim ADD COLUMN device_id character varying(128) NOT NULL DEFAULT '';
+
+// GetGiftCodeRules return nil if code has no rules
+func GetGiftCodeRules(ctx context.Context, logger runtime.Logger, db *sql.DB, code string) (*entity.GiftCodeRules, error) {
+	query := "SELECT rules FROM " + GiftCodeTableName + " WHERE code=$1"
+	var dbRules []byte
+	if err := db.QueryRowContext(ctx, query, code).Scan(&dbRules); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error("Query rules giftcode %s error %s", code, err.Error())
+		return nil, status.Error(codes.Internal, "Query giftcode error")
+	}
+	return unmarshalGiftCodeRules(logger, dbRules), nil
+}
+
+func unmarshalGiftCodeRules(logger runtime.Logger, data []byte) *entity.GiftCodeRules {
+	if len(data) == 0 {
+		return nil
+	}
+	rules := &entity.GiftCodeRules{}
+	if err := json.Unmarshal(data, rules); err != nil {
+		logger.Error("Unmarshal giftcode rules error %s", err.Error())
+		return nil
+	}
+	return rules
+}
+
+func marshalGiftCodeRules(rules *entity.GiftCodeRules) []byte {
+	if rules.IsEmpty() {
+		return nil
+	}
+	data, _ := json.Marshal(rules)
+	return data
+}
+
+// SetGiftCodeRules replace rules of one code, nil rules remove all rules
+func SetGiftCodeRules(ctx context.Context, logger runtime.Logger, db *sql.DB, code string, rules *entity.GiftCodeRules) error {
+	query := "UPDATE " + GiftCodeTableName + " SET rules=$1, update_time=now() WHERE code=$2"
+	result, err := db.ExecContext(ctx, query, marshalGiftCodeRules(rules), code)
+	if err != nil {
+		logger.Error("Update rules giftcode %s error %s", code, err.Error())
+		return status.Error(codes.Internal, "Update giftcode rules error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		return status.Error(codes.NotFound, "Giftcode not found")
+	}
+	return nil
+}
+
+// SetGiftCodeCampaignRules replace rules of campaign and all its codes
+func SetGiftCodeCampaignRules(ctx context.Context, logger runtime.Logger, db *sql.DB, campaignId int64, rules *entity.GiftCodeRules) error {
+	data := marshalGiftCodeRules(rules)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx update rules giftcode campaign error %s", err.Error())
+		return status.Error(codes.Internal, "Update giftcode rules error")
+	}
+	defer tx.Rollback()
+	result, err := tx.ExecContext(ctx, "UPDATE "+GiftCodeCampaignTableName+" SET rules=$1, update_time=now() WHERE id=$2", data, campaignId)
+	if err != nil {
+		logger.Error("Update rules giftcode campaign %d error %s", campaignId, err.Error())
+		return status.Error(codes.Internal, "Update giftcode rules error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		return status.Error(codes.NotFound, "Giftcode campaign not found")
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE "+GiftCodeTableName+" SET rules=$1, update_time=now() WHERE campaign_id=$2", data, campaignId); err != nil {
+		logger.Error("Update rules code of giftcode campaign %d error %s", campaignId, err.Error())
+		return status.Error(codes.Internal, "Update giftcode rules error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit rules giftcode campaign %d error %s", campaignId, err.Error())
+		return status.Error(codes.Internal, "Update giftcode rules error")
+	}
+	return nil
+}
+
+// GetFirstIAPTopupUnix unix time of first iap topup of user from wallet ledger, 0 if user has no topup
+func GetFirstIAPTopupUnix(ctx context.Context, db *sql.DB, userId string) (int64, error) {
+	query := "SELECT COALESCE(EXTRACT(EPOCH FROM min(create_time))::BIGINT, 0) FROM wallet_ledger WHERE user_id = $1::UUID AND metadata->>'action' = $2"
+	var unix int64
+	if err := db.QueryRowContext(ctx, query, userId, WalletActionIAPTopUp.String()).Scan(&unix); err != nil {
+		return 0, err
+	}
+	return unix, nil
+}
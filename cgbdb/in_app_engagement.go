@@ -0,0 +1,147 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ALTER TABLE public.in_app_message ADD COLUMN daily_cap integer NOT NULL DEFAULT 0;
+// ALTER TABLE public.in_app_message ADD COLUMN show_once boolean NOT NULL DEFAULT false;
+
+// CREATE TABLE public.in_app_message_engagement (
+//
+//	message_id bigint NOT NULL,
+//	user_id character varying(128) NOT NULL,
+//	impressions bigint NOT NULL DEFAULT 0,
+//	clicks bigint NOT NULL DEFAULT 0,
+//	dismisses bigint NOT NULL DEFAULT 0,
+//	day character varying(10) NOT NULL DEFAULT '',
+//	day_impressions integer NOT NULL DEFAULT 0,
+//	variant_id character varying(32) NOT NULL DEFAULT '',
+//	first_impression_time timestamp with time zone,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT in_app_message_engagement_pkey PRIMARY KEY (message_id, user_id)
+//
+// );
+const InAppEngagementTableName = "in_app_message_engagement"
+
+// AddInAppEvent count event of user on message, impression of new day reset day impressions.
+// Click or dismiss of user has no impression is not saved and return not found.
+// Variant is kept from first event so a/b result is not mixed when variants change.
+func AddInAppEvent(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, variantId string, req *entity.InAppEventRequest, today string) (*entity.InAppEngagement, error) {
+	var impression, click, dismiss int64
+	switch req.Event {
+	case entity.InAppEventImpression:
+		impression = 1
+	case entity.InAppEventClick:
+		click = 1
+	case entity.InAppEventDismiss:
+		dismiss = 1
+	}
+	query := "INSERT INTO " + InAppEngagementTableName + " AS e" +
+		" (message_id, user_id, impressions, clicks, dismisses, day, day_impressions, variant_id, first_impression_time, create_time, update_time)" +
+		" SELECT m.id, $2, $3, $4, $5, $6, $3, $7, CASE WHEN $3>0 THEN now() END, now(), now() FROM " + InAppMessageTableName + " m WHERE m.id=$1 AND $3>0" +
+		" ON CONFLICT (message_id, user_id) DO UPDATE SET" +
+		" impressions=e.impressions+$3, clicks=e.clicks+$4, dismisses=e.dismisses+$5," +
+		" day_impressions=CASE WHEN e.day=$6 THEN e.day_impressions+$3 WHEN $3>0 THEN $3 ELSE e.day_impressions END," +
+		" day=CASE WHEN $3>0 THEN $6 ELSE e.day END," +
+		" variant_id=CASE WHEN e.variant_id='' THEN $7 ELSE e.variant_id END," +
+		" first_impression_time=COALESCE(e.first_impression_time, CASE WHEN $3>0 THEN now() END), update_time=now()" +
+		" WHERE $3>0 OR e.impressions>0" +
+		" RETURNING message_id, user_id, variant_id, impressions, clicks, dismisses, day, day_impressions"
+	e := &entity.InAppEngagement{}
+	err := db.QueryRowContext(ctx, query, req.MessageId, userId, impression, click, dismiss, today, variantId).
+		Scan(&e.MessageId, &e.UserId, &e.VariantId, &e.Impressions, &e.Clicks, &e.Dismisses, &e.Day, &e.DayImpressions)
+	if err == sql.ErrNoRows {
+		return nil, entity.ErrInAppNotFound
+	}
+	if err != nil {
+		logger.Error("Add in-app message %d event %s user %s error %s", req.MessageId, req.Event, userId, err.Error())
+		return nil, status.Error(codes.Internal, "Add in-app message event error")
+	}
+	return e, nil
+}
+
+// GetInAppCapState cap of messages and engagement of user on them, message user never see has no engagement
+func GetInAppCapState(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, messageIds []int64) (map[int64]*entity.InAppMessageCap, map[int64]*entity.InAppEngagement, error) {
+	query := "SELECT m.id, m.daily_cap, m.show_once, e.impressions, e.clicks, e.dismisses, e.day, e.day_impressions" +
+		" FROM " + InAppMessageTableName + " m LEFT JOIN " + InAppEngagementTableName + " e ON e.message_id=m.id AND e.user_id=$2" +
+		" WHERE m.id = ANY($1)"
+	rows, err := db.QueryContext(ctx, query, pq.Array(messageIds), userId)
+	if err != nil {
+		logger.Error("Query in-app message cap user %s error %s", userId, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Query in-app message cap error")
+	}
+	defer rows.Close()
+	caps := make(map[int64]*entity.InAppMessageCap)
+	engagements := make(map[int64]*entity.InAppEngagement)
+	for rows.Next() {
+		c := &entity.InAppMessageCap{}
+		var impressions, clicks, dismisses sql.NullInt64
+		var day sql.NullString
+		var dayImpressions sql.NullInt64
+		if err := rows.Scan(&c.MessageId, &c.DailyCap, &c.ShowOnce, &impressions, &clicks, &dismisses, &day, &dayImpressions); err != nil {
+			logger.Error("Scan in-app message cap error %s", err.Error())
+			continue
+		}
+		caps[c.MessageId] = c
+		if impressions.Valid {
+			engagements[c.MessageId] = &entity.InAppEngagement{
+				MessageId:      c.MessageId,
+				UserId:         userId,
+				Impressions:    impressions.Int64,
+				Clicks:         clicks.Int64,
+				Dismisses:      dismisses.Int64,
+				Day:            day.String,
+				DayImpressions: int(dayImpressions.Int64),
+			}
+		}
+	}
+	return caps, engagements, rows.Err()
+}
+
+func UpdateInAppMessageCap(ctx context.Context, logger runtime.Logger, db *sql.DB, c *entity.InAppMessageCap) error {
+	query := "UPDATE " + InAppMessageTableName + " SET daily_cap=$2, show_once=$3, update_time=now() WHERE id=$1"
+	result, err := db.ExecContext(ctx, query, c.MessageId, c.DailyCap, c.ShowOnce)
+	if err != nil {
+		logger.Error("Update in-app message %d cap error %s", c.MessageId, err.Error())
+		return status.Error(codes.Internal, "Update in-app message cap error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
+		return entity.ErrInAppNotFound
+	}
+	return nil
+}
+
+// ListInAppMessageStat engagement totals of messages, newest message first when no id given
+func ListInAppMessageStat(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.InAppStatsRequest) ([]*entity.InAppMessageStat, error) {
+	query := "SELECT m.id, COALESCE(sum(e.impressions), 0), count(e.user_id) FILTER (WHERE e.impressions > 0)," +
+		" COALESCE(sum(e.clicks), 0), count(e.user_id) FILTER (WHERE e.clicks > 0), COALESCE(sum(e.dismisses), 0)" +
+		" FROM " + InAppMessageTableName + " m LEFT JOIN " + InAppEngagementTableName + " e ON e.message_id=m.id" +
+		" WHERE (cardinality($1::bigint[]) = 0 OR m.id = ANY($1))" +
+		" GROUP BY m.id ORDER BY m.id DESC LIMIT $2 OFFSET $3"
+	rows, err := db.QueryContext(ctx, query, pq.Array(req.MessageIds), req.Limit, req.Offset)
+	if err != nil {
+		logger.Error("Query in-app message stats error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query in-app message stats error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.InAppMessageStat, 0)
+	for rows.Next() {
+		s := &entity.InAppMessageStat{}
+		if err := rows.Scan(&s.MessageId, &s.Impressions, &s.Users, &s.Clicks, &s.ClickUsers, &s.Dismisses); err != nil {
+			logger.Error("Scan in-app message stats error %s", err.Error())
+			continue
+		}
+		s.ComputeCtr()
+		ml = append(ml, s)
+	}
+	return ml, rows.Err()
+}
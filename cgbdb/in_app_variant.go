@@ -0,0 +1,152 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.in_app_message_variant (
+//
+//	message_id bigint NOT NULL,
+//	variant_id character varying(32) NOT NULL,
+//	weight integer NOT NULL,
+//	data jsonb NOT NULL,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT in_app_message_variant_pkey PRIMARY KEY (message_id, variant_id)
+//
+// );
+const InAppVariantTableName = "in_app_message_variant"
+
+// CREATE TABLE public.in_app_variant_conversion (
+//
+//	message_id bigint NOT NULL,
+//	variant_id character varying(32) NOT NULL,
+//	user_id character varying(128) NOT NULL,
+//	kind character varying(16) NOT NULL,
+//	ref character varying(128) NOT NULL,
+//	chips bigint NOT NULL DEFAULT 0,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT in_app_variant_conversion_pkey PRIMARY KEY (message_id, user_id, kind, ref)
+//
+// );
+const InAppConversionTableName = "in_app_variant_conversion"
+
+// ReplaceInAppVariant replace all variants of message, engagement of users keep variant assigned before
+func ReplaceInAppVariant(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.InAppVariantRequest) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx replace in-app variant error %s", err.Error())
+		return status.Error(codes.Internal, "Update in-app variant error")
+	}
+	defer tx.Rollback()
+	var exist bool
+	query := "SELECT EXISTS (SELECT 1 FROM " + InAppMessageTableName + " WHERE id=$1 FOR UPDATE)"
+	if err := tx.QueryRowContext(ctx, query, req.MessageId).Scan(&exist); err != nil {
+		logger.Error("Query in-app message %d error %s", req.MessageId, err.Error())
+		return status.Error(codes.Internal, "Update in-app variant error")
+	}
+	if !exist {
+		return entity.ErrInAppNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+InAppVariantTableName+" WHERE message_id=$1", req.MessageId); err != nil {
+		logger.Error("Delete in-app variant of message %d error %s", req.MessageId, err.Error())
+		return status.Error(codes.Internal, "Update in-app variant error")
+	}
+	query = "INSERT INTO " + InAppVariantTableName + " (message_id, variant_id, weight, data, create_time) VALUES ($1, $2, $3, $4, now())"
+	for _, v := range req.Variants {
+		if _, err := tx.ExecContext(ctx, query, req.MessageId, v.Id, v.Weight, []byte(v.Data)); err != nil {
+			logger.Error("Add in-app variant %s of message %d error %s", v.Id, req.MessageId, err.Error())
+			return status.Error(codes.Internal, "Update in-app variant error")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit replace in-app variant error %s", err.Error())
+		return status.Error(codes.Internal, "Update in-app variant error")
+	}
+	return nil
+}
+
+// ListInAppVariant variants by message id, message without variant is not in map
+func ListInAppVariant(ctx context.Context, logger runtime.Logger, db *sql.DB, messageIds []int64) (map[int64][]*entity.InAppVariant, error) {
+	query := "SELECT message_id, variant_id, weight, data FROM " + InAppVariantTableName +
+		" WHERE message_id = ANY($1) ORDER BY message_id, variant_id"
+	rows, err := db.QueryContext(ctx, query, pq.Array(messageIds))
+	if err != nil {
+		logger.Error("Query in-app variant error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query in-app variant error")
+	}
+	defer rows.Close()
+	variants := make(map[int64][]*entity.InAppVariant)
+	for rows.Next() {
+		var messageId int64
+		v := &entity.InAppVariant{}
+		var data []byte
+		if err := rows.Scan(&messageId, &v.Id, &v.Weight, &data); err != nil {
+			logger.Error("Scan in-app variant error %s", err.Error())
+			continue
+		}
+		v.Data = data
+		variants[messageId] = append(variants[messageId], v)
+	}
+	return variants, rows.Err()
+}
+
+// AddInAppConversion attribute topup or giftcode claim to every variant user first saw within window,
+// same ref is counted once per message
+func AddInAppConversion(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, kind, ref string, chips int64, window time.Duration) (int64, error) {
+	query := "INSERT INTO " + InAppConversionTableName + " (message_id, variant_id, user_id, kind, ref, chips, create_time)" +
+		" SELECT message_id, variant_id, user_id, $2, $3, $4, now() FROM " + InAppEngagementTableName +
+		" WHERE user_id=$1 AND variant_id<>'' AND first_impression_time >= now() - make_interval(secs => $5)" +
+		" ON CONFLICT DO NOTHING"
+	result, err := db.ExecContext(ctx, query, userId, kind, ref, chips, int64(window.Seconds()))
+	if err != nil {
+		logger.Error("Add in-app conversion user %s, %s %s error %s", userId, kind, ref, err.Error())
+		return 0, status.Error(codes.Internal, "Add in-app conversion error")
+	}
+	added, _ := result.RowsAffected()
+	return added, nil
+}
+
+// GetInAppVariantReport stats of each variant of message, variant removed but still has users is kept with weight 0
+func GetInAppVariantReport(ctx context.Context, logger runtime.Logger, db *sql.DB, messageId int64) ([]*entity.InAppVariantStat, error) {
+	query := "SELECT v.variant_id, COALESCE(max(w.weight), 0)," +
+		" COALESCE(max(e.users), 0), COALESCE(max(e.impressions), 0), COALESCE(max(e.clicks), 0)," +
+		" COALESCE(max(c.iap_users), 0), COALESCE(max(c.iap_count), 0), COALESCE(max(c.iap_chips), 0)," +
+		" COALESCE(max(c.giftcode_users), 0), COALESCE(max(c.converted_users), 0)" +
+		" FROM (SELECT variant_id FROM " + InAppVariantTableName + " WHERE message_id=$1" +
+		" UNION SELECT DISTINCT variant_id FROM " + InAppEngagementTableName + " WHERE message_id=$1 AND variant_id<>'') v" +
+		" LEFT JOIN " + InAppVariantTableName + " w ON w.message_id=$1 AND w.variant_id=v.variant_id" +
+		" LEFT JOIN (SELECT variant_id, count(*) FILTER (WHERE impressions > 0) AS users, sum(impressions) AS impressions," +
+		" sum(clicks) AS clicks FROM " + InAppEngagementTableName + " WHERE message_id=$1 GROUP BY variant_id) e ON e.variant_id=v.variant_id" +
+		" LEFT JOIN (SELECT variant_id," +
+		" count(DISTINCT user_id) FILTER (WHERE kind=$2) AS iap_users, count(*) FILTER (WHERE kind=$2) AS iap_count," +
+		" COALESCE(sum(chips) FILTER (WHERE kind=$2), 0) AS iap_chips," +
+		" count(DISTINCT user_id) FILTER (WHERE kind=$3) AS giftcode_users, count(DISTINCT user_id) AS converted_users" +
+		" FROM " + InAppConversionTableName + " WHERE message_id=$1 GROUP BY variant_id) c ON c.variant_id=v.variant_id" +
+		" GROUP BY v.variant_id ORDER BY v.variant_id"
+	rows, err := db.QueryContext(ctx, query, messageId, entity.InAppConversionIap, entity.InAppConversionGiftCode)
+	if err != nil {
+		logger.Error("Query in-app variant report of message %d error %s", messageId, err.Error())
+		return nil, status.Error(codes.Internal, "Query in-app variant report error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.InAppVariantStat, 0)
+	for rows.Next() {
+		s := &entity.InAppVariantStat{}
+		if err := rows.Scan(&s.VariantId, &s.Weight, &s.Users, &s.Impressions, &s.Clicks,
+			&s.IapUsers, &s.IapCount, &s.IapChips, &s.GiftCodeUsers, &s.ConvertedUsers); err != nil {
+			logger.Error("Scan in-app variant report error %s", err.Error())
+			continue
+		}
+		s.ComputeRate()
+		ml = append(ml, s)
+	}
+	return ml, rows.Err()
+}
@@ -137,6 +137,11 @@ func DeleteInAppMessage(ctx context.Context, logger runtime.Logger, db *sql.DB,
 		logger.Error("Did delete user group")
 		return status.Error(codes.Internal, "Error delete inAppMessage")
 	}
+	for _, table := range []string{InAppEngagementTableName, InAppVariantTableName, InAppConversionTableName} {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+table+" WHERE message_id=$1", id); err != nil {
+			logger.Error("Delete %s of inAppMessage id %d, error %s", table, id, err.Error())
+		}
+	}
 	return nil
 }
 
@@ -329,6 +334,7 @@ func GetListInAppMessage(ctx context.Context, logger runtime.Logger, db *sql.DB,
 			} else {
 				logger.Error("GetUserGroupUserInfo %w", err)
 			}
+			inAppMessages = filterInAppMessageByCap(ctx, logger, db, userID, inAppMessages)
 		} else {
 			for _, m := range ml {
 				inAppMessages = append(inAppMessages, m)
@@ -388,6 +394,59 @@ func GetListInAppMessage(ctx context.Context, logger runtime.Logger, db *sql.DB,
 	}, nil
 }
 
+// InAppMessageActiveForUser message is listed to user now: in date range and show time,
+// and user match condition of message
+func InAppMessageActiveForUser(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, userId string, m *pb.InAppMessage) (bool, error) {
+	now := time.Now()
+	if m.StartDate > now.Unix() || (m.EndDate != 0 && m.EndDate < now.Unix()) {
+		return false, nil
+	}
+	if len(m.GetData().GetShowTimes()) > 0 {
+		hours, _, _ := now.Clock()
+		isTimeValid := false
+		for _, showTime := range m.Data.ShowTimes {
+			if showTime.From <= int32(hours) && showTime.To >= int32(hours) {
+				isTimeValid = true
+				break
+			}
+		}
+		if !isTimeValid {
+			return false, nil
+		}
+	}
+	userData, err := GetUserGroupUserInfo(ctx, logger, db, nk, userId)
+	if err != nil {
+		logger.Error("GetUserGroupUserInfo user %s error %s", userId, err.Error())
+		return false, status.Error(codes.Internal, "Query user info error")
+	}
+	return InAppMessageCheckCondition(logger, userData, m), nil
+}
+
+// filterInAppMessageByCap hide message user already seen if show once, or reached daily cap.
+// Message is kept if cap can not be loaded.
+func filterInAppMessageByCap(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, ml []*pb.InAppMessage) []*pb.InAppMessage {
+	if len(ml) == 0 {
+		return ml
+	}
+	ids := make([]int64, 0, len(ml))
+	for _, m := range ml {
+		ids = append(ids, m.Id)
+	}
+	caps, engagements, err := GetInAppCapState(ctx, logger, db, userId, ids)
+	if err != nil {
+		return ml
+	}
+	today := entity.InAppDay(time.Now())
+	allowed := make([]*pb.InAppMessage, 0, len(ml))
+	for _, m := range ml {
+		if c, exist := caps[m.Id]; exist && !c.Allow(engagements[m.Id], today) {
+			continue
+		}
+		allowed = append(allowed, m)
+	}
+	return allowed
+}
+
 func InAppMessageCheckCondition(logger runtime.Logger, data *entity.UserGroupUserInfo, inAppMessage *pb.InAppMessage) bool {
 	type Range struct {
 		Min int64 `json:"min"`
@@ -7,7 +7,9 @@ import (
 	"github.com/heroiclabs/nakama-common/runtime"
 )
 
-func RunMigrations(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+// RunMigrations run ddls, ddl error is only logged. Error if sid can not be made unique,
+// module must not start while sid lookup can resolve to many users.
+func RunMigrations(ctx context.Context, logger runtime.Logger, db *sql.DB) error {
 
 	_, err := db.ExecContext(ctx, `
 		CREATE SEQUENCE IF NOT EXISTS users_ext_sid_seq;
@@ -518,6 +520,485 @@ CREATE INDEX IF NOT EXISTS idx_bot_join_rules_game_active ON public.bot_join_rul
 CREATE INDEX IF NOT EXISTS idx_bot_leave_rules_game_active ON public.bot_leave_rules(game_code, is_active);
 CREATE INDEX IF NOT EXISTS idx_bot_create_table_rules_game_active ON public.bot_create_table_rules(game_code, is_active);
 CREATE INDEX IF NOT EXISTS idx_bot_group_rules_game_active ON public.bot_group_rules(game_code, is_active);
+`)
+	// freechip campaign, expiry
+	ddls = append(ddls, `
+ALTER TABLE public.freechip ADD COLUMN IF NOT EXISTS claim_time timestamp with time zone NULL;
+ALTER TABLE public.freechip ADD COLUMN IF NOT EXISTS claim_status smallint NOT NULL DEFAULT 0;
+ALTER TABLE public.freechip ADD COLUMN IF NOT EXISTS campaign_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE public.freechip ADD COLUMN IF NOT EXISTS expire_time timestamp with time zone NULL;
+ALTER TABLE public.freechip ALTER COLUMN content TYPE text;
+CREATE INDEX IF NOT EXISTS idx_freechip_expire ON public.freechip(claim_status, expire_time);
+CREATE INDEX IF NOT EXISTS idx_freechip_campaign ON public.freechip(campaign_id);
+
+CREATE TABLE IF NOT EXISTS public.freechip_campaign (
+	id bigint NOT NULL PRIMARY KEY,
+	name character varying(128) NOT NULL,
+	title character varying(128) NOT NULL,
+	template text NOT NULL DEFAULT '',
+	chips bigint NOT NULL DEFAULT 0,
+	budget bigint NOT NULL DEFAULT 0,
+	user_group_id bigint NOT NULL DEFAULT 0,
+	recipient_ids jsonb,
+	expire_time timestamp with time zone NULL,
+	status smallint NOT NULL DEFAULT 1,
+	num_granted bigint NOT NULL DEFAULT 0,
+	num_skipped bigint NOT NULL DEFAULT 0,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+`)
+	// claim outbox, pending wallet update of freechip/giftcode claim
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.claim_outbox (
+	id bigint NOT NULL PRIMARY KEY,
+	user_id character varying(128) NOT NULL,
+	idem_key character varying(128) NOT NULL,
+	kind character varying(32) NOT NULL,
+	ref_id bigint NOT NULL DEFAULT 0,
+	chips bigint NOT NULL DEFAULT 0,
+	metadata jsonb,
+	result bytea,
+	status smallint NOT NULL DEFAULT 0,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text NOT NULL DEFAULT '',
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT claim_outbox_user_key UNIQUE (user_id, idem_key)
+);
+CREATE INDEX IF NOT EXISTS idx_claim_outbox_status ON public.claim_outbox(status, update_time);
+`)
+	// giftcode campaign
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.giftcode_campaign (
+	id bigint NOT NULL PRIMARY KEY,
+	name character varying(128) NOT NULL,
+	prefix character varying(16) NOT NULL,
+	n_code integer NOT NULL DEFAULT 0,
+	value bigint NOT NULL DEFAULT 0,
+	n_max integer NOT NULL DEFAULT 1,
+	start_time_unix timestamp,
+	end_time_unix timestamp,
+	message character varying(256) NOT NULL DEFAULT '',
+	vip integer NOT NULL DEFAULT 0,
+	disabled boolean NOT NULL DEFAULT false,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+ALTER TABLE public.giftcode ADD COLUMN IF NOT EXISTS campaign_id bigint NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_giftcode_campaign ON public.giftcode(campaign_id);
+`)
+	// giftcode eligibility rules
+	ddls = append(ddls, `
+ALTER TABLE public.giftcode ADD COLUMN IF NOT EXISTS rules jsonb;
+ALTER TABLE public.giftcode_campaign ADD COLUMN IF NOT EXISTS rules jsonb;
+ALTER TABLE public.giftcodeclaim ADD COLUMN IF NOT EXISTS device_id character varying(128) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_giftcodeclaim_device ON public.giftcodeclaim(id_code, device_id);
+`)
+	// giftcode failed redemption attempt
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.giftcode_attempt (
+	key_type character varying(16) NOT NULL,
+	key_value character varying(128) NOT NULL,
+	fail_count integer NOT NULL DEFAULT 0,
+	last_fail_time timestamp with time zone,
+	locked_until timestamp with time zone,
+	last_code character varying(128) NOT NULL DEFAULT '',
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT giftcode_attempt_pkey PRIMARY KEY (key_type, key_value)
+);
+`)
+	// daily reward template version and schedule
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.daily_reward_template (
+	id bigint NOT NULL PRIMARY KEY,
+	name character varying(128) NOT NULL,
+	version integer NOT NULL DEFAULT 1,
+	tiers jsonb NOT NULL,
+	start_time timestamp with time zone,
+	end_time timestamp with time zone,
+	disabled boolean NOT NULL DEFAULT false,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT daily_reward_template_name_version UNIQUE (name, version)
+);
+`)
+	// daily reward streak, freeze and claim history
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.daily_reward_streak (
+	user_id character varying(128) NOT NULL PRIMARY KEY,
+	streak integer NOT NULL DEFAULT 0,
+	best_streak integer NOT NULL DEFAULT 0,
+	last_day character varying(10) NOT NULL DEFAULT '',
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+`)
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.daily_reward_claim (
+	id bigint NOT NULL PRIMARY KEY,
+	user_id character varying(128) NOT NULL,
+	day character varying(10) NOT NULL,
+	kind character varying(16) NOT NULL,
+	tier integer NOT NULL DEFAULT 0,
+	chips bigint NOT NULL DEFAULT 0,
+	create_time timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_daily_reward_claim_user_day ON public.daily_reward_claim(user_id, day);
+`)
+	// playtime tracker
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.playtime_presence (
+	user_id character varying(128) NOT NULL,
+	kind character varying(16) NOT NULL,
+	presence_id character varying(128) NOT NULL,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT playtime_presence_pkey PRIMARY KEY (user_id, kind, presence_id)
+);
+`)
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.playtime_checkpoint (
+	user_id character varying(128) NOT NULL,
+	kind character varying(16) NOT NULL,
+	checkpoint_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT playtime_checkpoint_pkey PRIMARY KEY (user_id, kind)
+);
+`)
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.playtime_daily (
+	user_id character varying(128) NOT NULL,
+	day character varying(10) NOT NULL,
+	online_sec bigint NOT NULL DEFAULT 0,
+	match_sec bigint NOT NULL DEFAULT 0,
+	claimed integer NOT NULL DEFAULT 0,
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT playtime_daily_pkey PRIMARY KEY (user_id, day)
+);
+`)
+	// multi level refer, closure table of referuser
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.refer_tree (
+	user_id character varying(128) NOT NULL,
+	ancestor_id character varying(128) NOT NULL,
+	level integer NOT NULL,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT refer_tree_pkey PRIMARY KEY (user_id, ancestor_id)
+);
+CREATE INDEX IF NOT EXISTS idx_refer_tree_ancestor ON public.refer_tree(ancestor_id, level);
+ALTER TABLE public.reward_refer ADD COLUMN IF NOT EXISTS level_rewards jsonb;
+`)
+	// legacy refer code saved sid of invitor, map to user id so tree link by user id.
+	// Closure rows built from sid before are rebuilt.
+	ddls = append(ddls, `
+UPDATE public.referuser AS r SET user_invitor = e.id::text, update_time = now()
+FROM public.users_ext AS e
+WHERE r.user_invitor ~ '^[0-9]+$' AND e.sid = r.user_invitor::bigint;
+DELETE FROM public.refer_tree WHERE ancestor_id ~ '^[0-9]+$';
+`)
+	ddls = append(ddls, `
+WITH RECURSIVE tree AS (
+	SELECT user_invitee AS user_id, user_invitor AS ancestor_id, 1 AS level FROM public.referuser
+	UNION ALL
+	SELECT t.user_id, r.user_invitor, t.level + 1 FROM tree t
+		JOIN public.referuser r ON r.user_invitee = t.ancestor_id
+	WHERE t.level < 5
+)
+INSERT INTO public.refer_tree (user_id, ancestor_id, level, create_time)
+SELECT user_id, ancestor_id, min(level), now() FROM tree WHERE user_id <> ancestor_id GROUP BY user_id, ancestor_id
+ON CONFLICT (user_id, ancestor_id) DO NOTHING;
+`)
+	// refer anti-fraud, fingerprint of user and review queue
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.user_fingerprint (
+	user_id character varying(128) NOT NULL,
+	kind character varying(16) NOT NULL,
+	value character varying(256) NOT NULL,
+	first_seen timestamp with time zone NOT NULL DEFAULT now(),
+	last_seen timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT user_fingerprint_pkey PRIMARY KEY (user_id, kind, value)
+);
+CREATE INDEX IF NOT EXISTS idx_user_fingerprint_value ON public.user_fingerprint(kind, value);
+CREATE TABLE IF NOT EXISTS public.refer_review (
+	id bigint NOT NULL PRIMARY KEY,
+	user_id character varying(128) NOT NULL,
+	reason character varying(32) NOT NULL,
+	detail jsonb,
+	status smallint NOT NULL DEFAULT 0,
+	note text NOT NULL DEFAULT '',
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_refer_review_user ON public.refer_review(user_id, status);
+`)
+	// immutable snapshot of rules_lucky after each change
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.rules_lucky_version (
+	id bigserial NOT NULL PRIMARY KEY,
+	rule_id int8 NOT NULL,
+	game_code varchar(31) NOT NULL,
+	version int4 NOT NULL,
+	action varchar(16) NOT NULL,
+	data text NOT NULL,
+	create_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT rules_lucky_version_rule_key UNIQUE (rule_id, version)
+);
+CREATE INDEX IF NOT EXISTS idx_rules_lucky_version_game ON public.rules_lucky_version(game_code, id);
+`)
+	// active hour window of bot rules, hour_start = hour_end is all day
+	ddls = append(ddls, `
+ALTER TABLE public.bot_join_rules ADD COLUMN IF NOT EXISTS hour_start INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE public.bot_join_rules ADD COLUMN IF NOT EXISTS hour_end INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE public.bot_leave_rules ADD COLUMN IF NOT EXISTS hour_start INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE public.bot_leave_rules ADD COLUMN IF NOT EXISTS hour_end INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE public.bot_create_table_rules ADD COLUMN IF NOT EXISTS hour_start INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE public.bot_create_table_rules ADD COLUMN IF NOT EXISTS hour_end INTEGER NOT NULL DEFAULT 0;
+`)
+	// bot pool, status and lease of bot so a bot is only at one table
+	ddls = append(ddls, `
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS status smallint NOT NULL DEFAULT 0;
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS vip_level int8 NOT NULL DEFAULT 0;
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS lease_id varchar(36) NOT NULL DEFAULT '';
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS match_id varchar(128) NOT NULL DEFAULT '';
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS lease_expire timestamptz;
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS create_time timestamptz NOT NULL DEFAULT now();
+ALTER TABLE public.users_bot ADD COLUMN IF NOT EXISTS update_time timestamptz NOT NULL DEFAULT now();
+DELETE FROM public.users_bot a USING public.users_bot b WHERE a.user_id = b.user_id AND a.id > b.id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_bot_user_id ON public.users_bot(user_id);
+CREATE INDEX IF NOT EXISTS idx_users_bot_game_status ON public.users_bot(game_code, status);
+UPDATE public.users_bot b SET vip_level = COALESCE((u.metadata->>'vip_level')::numeric::bigint, 0)
+FROM public.users u WHERE u.id::text = b.user_id AND b.vip_level = 0 AND u.metadata ? 'vip_level';
+`)
+	// notification template by id and locale
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.notification_template (
+	id character varying(64) NOT NULL,
+	locale character varying(16) NOT NULL,
+	title character varying(256) NOT NULL,
+	content text NOT NULL,
+	params jsonb NOT NULL DEFAULT '[]',
+	type integer NOT NULL DEFAULT 0,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT notification_template_pkey PRIMARY KEY (id, locale)
+);
+`)
+	// notification campaign send by worker in batches
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.notification_campaign (
+	id bigint NOT NULL PRIMARY KEY,
+	title character varying(256) NOT NULL,
+	content text NOT NULL,
+	type integer NOT NULL,
+	audience character varying(16) NOT NULL,
+	user_group_id bigint NOT NULL DEFAULT 0,
+	user_ids text[],
+	send_time timestamp with time zone NOT NULL,
+	status smallint NOT NULL DEFAULT 0,
+	total bigint NOT NULL DEFAULT 0,
+	sent bigint NOT NULL DEFAULT 0,
+	failed bigint NOT NULL DEFAULT 0,
+	cursor character varying(128) NOT NULL DEFAULT '',
+	last_error text NOT NULL DEFAULT '',
+	lock_until timestamp with time zone,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	finish_time timestamp with time zone
+);
+CREATE INDEX IF NOT EXISTS idx_notification_campaign_due ON public.notification_campaign(status, send_time);
+`)
+	// notification category, expiry and per-user preference
+	ddls = append(ddls, `
+ALTER TABLE public.cgb_notification ADD COLUMN IF NOT EXISTS category character varying(16) NOT NULL DEFAULT 'system';
+ALTER TABLE public.cgb_notification ADD COLUMN IF NOT EXISTS expire_at timestamp with time zone;
+UPDATE public.cgb_notification SET expire_at = create_time + interval '30 days' WHERE expire_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_cgb_notification_expire_at ON public.cgb_notification(expire_at);
+CREATE INDEX IF NOT EXISTS idx_cgb_notification_recipient_category ON public.cgb_notification(recipient_id, category);
+CREATE TABLE IF NOT EXISTS public.notification_preference (
+	user_id character varying(128) NOT NULL PRIMARY KEY,
+	muted text[] NOT NULL DEFAULT '{}',
+	push_muted text[] NOT NULL DEFAULT '{}',
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+ALTER TABLE public.notification_campaign ADD COLUMN IF NOT EXISTS category character varying(16) NOT NULL DEFAULT 'promo';
+ALTER TABLE public.notification_campaign ADD COLUMN IF NOT EXISTS skipped bigint NOT NULL DEFAULT 0;
+`)
+	// mobile push token and delivery queue
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.push_token (
+	app_package character varying(128) NOT NULL,
+	token character varying(4096) NOT NULL,
+	user_id character varying(128) NOT NULL,
+	platform character varying(16) NOT NULL,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT push_token_pkey PRIMARY KEY (app_package, token)
+);
+CREATE INDEX IF NOT EXISTS idx_push_token_user_id ON public.push_token(user_id);
+CREATE TABLE IF NOT EXISTS public.push_queue (
+	id bigint NOT NULL PRIMARY KEY,
+	user_id character varying(128) NOT NULL,
+	app_package character varying(128) NOT NULL DEFAULT '',
+	title character varying(256) NOT NULL,
+	body text NOT NULL,
+	data jsonb,
+	status smallint NOT NULL DEFAULT 0,
+	attempts integer NOT NULL DEFAULT 0,
+	done_tokens text[] NOT NULL DEFAULT '{}',
+	last_error text NOT NULL DEFAULT '',
+	next_attempt timestamp with time zone NOT NULL DEFAULT now(),
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_push_queue_due ON public.push_queue(status, next_attempt);
+`)
+	// in-app message frequency cap and engagement per user
+	ddls = append(ddls, `
+ALTER TABLE public.in_app_message ADD COLUMN IF NOT EXISTS daily_cap integer NOT NULL DEFAULT 0;
+ALTER TABLE public.in_app_message ADD COLUMN IF NOT EXISTS show_once boolean NOT NULL DEFAULT false;
+CREATE TABLE IF NOT EXISTS public.in_app_message_engagement (
+	message_id bigint NOT NULL,
+	user_id character varying(128) NOT NULL,
+	impressions bigint NOT NULL DEFAULT 0,
+	clicks bigint NOT NULL DEFAULT 0,
+	dismisses bigint NOT NULL DEFAULT 0,
+	day character varying(10) NOT NULL DEFAULT '',
+	day_impressions integer NOT NULL DEFAULT 0,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT in_app_message_engagement_pkey PRIMARY KEY (message_id, user_id)
+);
+`)
+	// in-app message a/b variants and their conversions
+	ddls = append(ddls, `
+ALTER TABLE public.in_app_message_engagement ADD COLUMN IF NOT EXISTS variant_id character varying(32) NOT NULL DEFAULT '';
+ALTER TABLE public.in_app_message_engagement ADD COLUMN IF NOT EXISTS first_impression_time timestamp with time zone;
+CREATE INDEX IF NOT EXISTS idx_in_app_message_engagement_user ON public.in_app_message_engagement(user_id, first_impression_time);
+CREATE TABLE IF NOT EXISTS public.in_app_message_variant (
+	message_id bigint NOT NULL,
+	variant_id character varying(32) NOT NULL,
+	weight integer NOT NULL,
+	data jsonb NOT NULL,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT in_app_message_variant_pkey PRIMARY KEY (message_id, variant_id)
+);
+CREATE TABLE IF NOT EXISTS public.in_app_variant_conversion (
+	message_id bigint NOT NULL,
+	variant_id character varying(32) NOT NULL,
+	user_id character varying(128) NOT NULL,
+	kind character varying(16) NOT NULL,
+	ref character varying(128) NOT NULL,
+	chips bigint NOT NULL DEFAULT 0,
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT in_app_variant_conversion_pkey PRIMARY KEY (message_id, user_id, kind, ref)
+);
+`)
+	// quick chat presets, blocklist and phrase reports
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.quickchat_preset (
+	locale character varying(16) NOT NULL PRIMARY KEY,
+	texts text[] NOT NULL,
+	update_time timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS public.chat_blocklist (
+	word character varying(64) NOT NULL PRIMARY KEY,
+	create_time timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS public.quickchat_report (
+	id bigint NOT NULL PRIMARY KEY,
+	reporter_id character varying(128) NOT NULL,
+	user_id character varying(128) NOT NULL,
+	text character varying(256) NOT NULL,
+	reason character varying(256) NOT NULL DEFAULT '',
+	create_time timestamp with time zone NOT NULL DEFAULT now(),
+	UNIQUE (reporter_id, user_id, text)
+);
+CREATE INDEX IF NOT EXISTS idx_quickchat_report_user ON public.quickchat_report(user_id, create_time);
+`)
+	// account sanctions: ban, chat mute, transfer and cash out block
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.user_sanction (
+	id bigint NOT NULL PRIMARY KEY,
+	user_id character varying(128) NOT NULL,
+	kind character varying(16) NOT NULL,
+	reason character varying(256) NOT NULL,
+	issuer character varying(128) NOT NULL DEFAULT '',
+	start_time timestamp with time zone NOT NULL DEFAULT now(),
+	end_time timestamp with time zone,
+	lift_time timestamp with time zone,
+	lift_by character varying(128) NOT NULL DEFAULT '',
+	create_time timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_user_sanction_user ON public.user_sanction(user_id, kind) WHERE lift_time IS NULL;
+CREATE INDEX IF NOT EXISTS idx_user_sanction_create ON public.user_sanction(create_time);
+`)
+	// devices of user with first and last seen, revoked device must login again
+	ddls = append(ddls, `
+CREATE TABLE IF NOT EXISTS public.device_registry (
+	user_id character varying(128) NOT NULL,
+	device_id character varying(128) NOT NULL,
+	platform character varying(16) NOT NULL DEFAULT '',
+	session_id character varying(64) NOT NULL DEFAULT '',
+	first_seen timestamp with time zone NOT NULL DEFAULT now(),
+	last_seen timestamp with time zone NOT NULL DEFAULT now(),
+	revoke_time timestamp with time zone,
+	CONSTRAINT device_registry_pkey PRIMARY KEY (user_id, device_id)
+);
+CREATE INDEX IF NOT EXISTS idx_device_registry_session ON public.device_registry(user_id, session_id);
+`)
+	// counter of sid allocator, sid is permuted from it
+	ddls = append(ddls, `
+CREATE SEQUENCE IF NOT EXISTS users_ext_sid_counter_seq MINVALUE 0 START 0;
+`)
+	// claim outbox worker lease claims instead of holding row locks
+	ddls = append(ddls, `
+ALTER TABLE public.claim_outbox ADD COLUMN IF NOT EXISTS lease_until timestamp with time zone;
+`)
+	// streak freeze moved to wallet of user
+	ddls = append(ddls, `
+ALTER TABLE public.daily_reward_streak DROP COLUMN IF EXISTS freeze;
+`)
+	// playtime presence scoped by node, node heartbeat, milestones of time in match
+	ddls = append(ddls, `
+ALTER TABLE public.playtime_presence ADD COLUMN IF NOT EXISTS node character varying(128) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_playtime_presence_node ON public.playtime_presence(node);
+ALTER TABLE public.playtime_daily ADD COLUMN IF NOT EXISTS match_claimed integer NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS public.playtime_node (
+	node character varying(128) NOT NULL PRIMARY KEY,
+	heartbeat_time timestamp with time zone NOT NULL DEFAULT now()
+);
+`)
+	// lifetime earning of user from each invitee
+	ddls = append(ddls, `
+ALTER TABLE public.reward_refer ADD COLUMN IF NOT EXISTS earning_counted boolean NOT NULL DEFAULT false;
+CREATE TABLE IF NOT EXISTS public.refer_earning (
+	user_id character varying(128) NOT NULL,
+	invitee_id character varying(128) NOT NULL,
+	earning bigint NOT NULL DEFAULT 0,
+	update_time timestamp with time zone NOT NULL DEFAULT now(),
+	CONSTRAINT refer_earning_pkey PRIMARY KEY (user_id, invitee_id)
+);
+`)
+	// first version of lucky rules added before versioning, so every game has a version id
+	ddls = append(ddls, `
+INSERT INTO public.rules_lucky_version (rule_id, game_code, version, action, data, create_at)
+SELECT r.id, r.game_code, 1, 'backfill', row_to_json(r)::text, now() FROM public.rules_lucky r
+WHERE NOT EXISTS (SELECT 1 FROM public.rules_lucky_version v WHERE v.rule_id = r.id);
+`)
+	// allowlist of chat filter, word blocked as substring of it is not blocked
+	ddls = append(ddls, `
+ALTER TABLE public.chat_blocklist ADD COLUMN IF NOT EXISTS allow boolean NOT NULL DEFAULT false;
+`)
+	// tokens of device are logged out when device is revoked
+	ddls = append(ddls, `
+ALTER TABLE public.device_registry ADD COLUMN IF NOT EXISTS token text NOT NULL DEFAULT '';
+ALTER TABLE public.device_registry ADD COLUMN IF NOT EXISTS refresh_token text NOT NULL DEFAULT '';
+`)
+	// reward voided by rejected refer review
+	ddls = append(ddls, `
+ALTER TABLE public.reward_refer ADD COLUMN IF NOT EXISTS void_time timestamp with time zone NULL;
+`)
+	// failed attempts of current batch of notification campaign
+	ddls = append(ddls, `
+ALTER TABLE public.notification_campaign ADD COLUMN IF NOT EXISTS batch_attempts integer NOT NULL DEFAULT 0;
 `)
 	for _, ddl := range ddls {
 		_, err = db.ExecContext(ctx, ddl)
@@ -525,5 +1006,13 @@ CREATE INDEX IF NOT EXISTS idx_bot_group_rules_game_active ON public.bot_group_r
 			logger.WithField("err", err).Error("ddl failed")
 		}
 	}
+	if err := RepairUserSid(ctx, logger, db); err != nil {
+		logger.WithField("err", err).Error("repair sid failed")
+		return err
+	}
+	if err := BackfillReferEarning(ctx, logger, db); err != nil {
+		logger.WithField("err", err).Error("backfill refer earning failed")
+	}
 	logger.Info("Done run migration")
+	return nil
 }
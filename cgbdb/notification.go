@@ -7,7 +7,9 @@ import (
 	"encoding/base64"
 	"encoding/gob"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/jackc/pgtype"
@@ -35,15 +37,38 @@ import (
 // ALTER SEQUENCE cgb_notification_id_seq OWNED BY public.cgb_notification.id;
 // ALTER TABLE public.cgb_notification ADD COLUMN app_package text NULL;
 // ALTER TABLE public.cgb_notification ADD COLUMN game_id text NULL;
+// ALTER TABLE public.cgb_notification ADD COLUMN category character varying(16) NOT NULL DEFAULT 'system';
+// ALTER TABLE public.cgb_notification ADD COLUMN expire_at timestamp with time zone NULL;
 
 const NotificationTableName = "cgb_notification"
 
+// notification not expired, row without expire_at never expire
+const notificationNotExpired = " and (expire_at IS NULL OR expire_at > now())"
+
 func AddNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, notification *pb.Notification) error {
+	return AddCategoryNotification(ctx, logger, db, nk, notification, entity.NotiCategorySystem)
+}
+
+// AddCategoryNotification save and push notification of category, respect preference of recipient:
+// muted category is dropped, push muted category is saved only
+func AddCategoryNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, notification *pb.Notification, category string) error {
 	if notification == nil || notification.Title == "" || notification.Type <= 0 || notification.Content == "" || notification.RecipientId == "" {
 		return status.Error(codes.InvalidArgument, "Error add notification.")
 	}
-	query := "INSERT INTO " + NotificationTableName + " (title, content, sender_id, recipient_id, type, read, app_package, game_id, create_time, update_time) VALUES ($1, $2, $3, $4, $5, false, $6, $7, now(), now())"
-	result, err := db.ExecContext(ctx, query, notification.Title, notification.Content, notification.SenderId, notification.RecipientId, notification.Type, notification.AppPackage, notification.GameId)
+	if !entity.IsNotiCategory(category) {
+		return status.Error(codes.InvalidArgument, entity.ErrNotiCategory.Error())
+	}
+	pref, err := GetNotificationPreference(ctx, logger, db, notification.RecipientId)
+	if err != nil {
+		return err
+	}
+	if pref.IsMuted(category) {
+		logger.Debug("User %s muted notification category %s, skip %s", notification.RecipientId, category, notification.Title)
+		return nil
+	}
+	expireAt := entity.NotiExpireAt(category, time.Now())
+	query := "INSERT INTO " + NotificationTableName + " (title, content, sender_id, recipient_id, type, read, app_package, game_id, category, expire_at, create_time, update_time) VALUES ($1, $2, $3, $4, $5, false, $6, $7, $8, $9, now(), now())"
+	result, err := db.ExecContext(ctx, query, notification.Title, notification.Content, notification.SenderId, notification.RecipientId, notification.Type, notification.AppPackage, notification.GameId, category, expireAt)
 	if err != nil {
 		logger.Error("Add notification, type: %s, title: %s, content: %s, error %s",
 			notification.Type, notification.Title, notification.Content, err.Error())
@@ -54,17 +79,35 @@ func AddNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, nk
 			notification.Type, notification.Title, notification.Content)
 		return status.Error(codes.Internal, "Error add notification.")
 	}
+	if pref.IsPushMuted(category) {
+		return nil
+	}
 	content := map[string]interface{}{
-		"content": notification.Content,
+		"content":  notification.Content,
+		"category": category,
 	}
 	err = nk.NotificationSend(ctx, notification.RecipientId, notification.Title, content, (int)(notification.Type), notification.SenderId, false)
 	if err != nil {
 		logger.Error("Send notification type: %s, title: %s, content: %s, error %s",
 			notification.Type, notification.Title, notification.Content, err.Error())
 	}
+	// user not connected only get notification by mobile push
+	if !isUserOnline(nk, notification.RecipientId) {
+		EnqueuePush(ctx, logger, db, []string{notification.RecipientId}, notification.AppPackage, notification.Title,
+			notification.Content, map[string]string{"category": category, "type": strconv.Itoa(int(notification.Type))})
+	}
 	return err
 }
 
+// stream mode of nakama notification stream, subject is user id
+const StreamModeNotifications uint8 = 0
+
+// isUserOnline user has socket listen notification
+func isUserOnline(nk runtime.NakamaModule, userId string) bool {
+	presences, err := nk.StreamUserList(StreamModeNotifications, userId, "", "", true, true)
+	return err == nil && len(presences) > 0
+}
+
 func GetNotificationById(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, user_id string) (*pb.Notification, error) {
 	if id <= 0 {
 		return nil, status.Error(codes.InvalidArgument, "Id is empty")
@@ -128,37 +171,54 @@ func DeleteNotification(ctx context.Context, logger runtime.Logger, db *sql.DB,
 	return nil
 }
 
-func ReadAllNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, user_id string) error {
+// ReadAllNotification mark read all notification of user, of category if not empty
+func ReadAllNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, user_id string, category string) error {
 	if !IsExistNotificationNotRead(ctx, logger, db, user_id) {
 		return nil
 	}
-	query := "UPDATE " + NotificationTableName + " SET read=$1 WHERE recipient_id=$2"
-	result, err := db.ExecContext(ctx, query, true, user_id)
+	query := "UPDATE " + NotificationTableName + " SET read=$1 WHERE recipient_id=$2 and ($3='' or category=$3)"
+	result, err := db.ExecContext(ctx, query, true, user_id, category)
 	if err != nil {
 		logger.Error("Read all notification, user %s, error %s", user_id, err.Error())
 		return status.Error(codes.Internal, "Read all notification error")
 	}
-	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount == 0 {
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount == 0 && category == "" {
 		logger.Error("Did not update notification")
 		return status.Error(codes.Internal, "Read notification group")
 	}
 	return nil
 }
 
-func DeleteAllNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string) error {
-	query := "DELETE FROM " + NotificationTableName + " WHERE recipient_id=$1"
-	result, err := db.ExecContext(ctx, query, userId)
+// DeleteAllNotification delete all notification of user, of category if not empty
+func DeleteAllNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, category string) error {
+	query := "DELETE FROM " + NotificationTableName + " WHERE recipient_id=$1 and ($2='' or category=$2)"
+	_, err := db.ExecContext(ctx, query, userId, category)
 	if err != nil {
 		logger.Error("Delete all notification, error %s", err.Error())
 		return status.Error(codes.Internal, "Delete notification error")
 	}
-	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
-		logger.Error("Did delete notification")
-		return status.Error(codes.Internal, "Error delete notification")
-	}
 	return nil
 }
 
+// DeleteExpiredNotification delete expired notification in batches, number of rows deleted
+func DeleteExpiredNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, batch int) (int64, error) {
+	query := "DELETE FROM " + NotificationTableName + " WHERE id IN (SELECT id FROM " + NotificationTableName +
+		" WHERE expire_at < now() LIMIT $1)"
+	var total int64
+	for {
+		result, err := db.ExecContext(ctx, query, batch)
+		if err != nil {
+			logger.Error("Delete expired notification error %s", err.Error())
+			return total, status.Error(codes.Internal, "Delete expired notification error")
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n < int64(batch) {
+			return total, nil
+		}
+	}
+}
+
 func GetListNotification(ctx context.Context, logger runtime.Logger, db *sql.DB, limit int64, cursor string, userId string, typeNotification pb.TypeNotification) (*pb.ListNotification, error) {
 	var incomingCursor = &entity.NotificationListCursor{}
 	if cursor != "" {
@@ -194,15 +254,15 @@ func GetListNotification(ctx context.Context, logger runtime.Logger, db *sql.DB,
 
 	if incomingCursor.Id > 0 {
 		if incomingCursor.IsNext {
-			query += " WHERE recipient_id=$1 and type=$2 and id < $3 order by id desc "
+			query += " WHERE recipient_id=$1 and type=$2 and id < $3" + notificationNotExpired + " order by id desc "
 		} else {
-			query += " WHERE recipient_id=$1 and type=$2 and id > $3 AND deleted = false order by id asc"
+			query += " WHERE recipient_id=$1 and type=$2 and id > $3 AND deleted = false" + notificationNotExpired + " order by id asc"
 		}
 		params = append(params, incomingCursor.Id)
 		query += "  limit $4"
 		params = append(params, limit)
 	} else {
-		query += " WHERE recipient_id=$1 and type=$2 order by id desc limit $3"
+		query += " WHERE recipient_id=$1 and type=$2" + notificationNotExpired + " order by id desc limit $3"
 		params = append(params, limit)
 	}
 	queryRow := "SELECT id, title, content, sender_id, recipient_id, type, read, app_package, game_id, create_time FROM " +
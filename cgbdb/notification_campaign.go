@@ -0,0 +1,225 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.notification_campaign (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	title character varying(256) NOT NULL,
+//	content text NOT NULL,
+//	type integer NOT NULL,
+//	audience character varying(16) NOT NULL,
+//	category character varying(16) NOT NULL DEFAULT 'promo',
+//	user_group_id bigint NOT NULL DEFAULT 0,
+//	user_ids text[],
+//	send_time timestamp with time zone NOT NULL,
+//	status smallint NOT NULL DEFAULT 0,
+//	total bigint NOT NULL DEFAULT 0,
+//	sent bigint NOT NULL DEFAULT 0,
+//	failed bigint NOT NULL DEFAULT 0,
+//	skipped bigint NOT NULL DEFAULT 0,
+//	cursor character varying(128) NOT NULL DEFAULT '',
+//	batch_attempts integer NOT NULL DEFAULT 0,
+//	last_error text NOT NULL DEFAULT '',
+//	lock_until timestamp with time zone,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	finish_time timestamp with time zone
+//
+// );
+// CREATE INDEX idx_notification_campaign_due ON public.notification_campaign(status, send_time);
+const NotificationCampaignTableName = "notification_campaign"
+
+// nil uuid is system user, it is also start cursor of all users audience
+const notiCampaignUserCursorStart = "00000000-0000-0000-0000-000000000000"
+
+const notiCampaignColumns = "id, title, content, type, audience, category, user_group_id, send_time, status, total, sent, failed, skipped, cursor, batch_attempts, last_error, create_time, update_time, finish_time"
+
+func scanNotificationCampaign(row interface{ Scan(dest ...any) error }, withUserIds bool) (*entity.NotificationCampaign, error) {
+	c := &entity.NotificationCampaign{}
+	var sendTime, createTime, updateTime time.Time
+	var finishTime sql.NullTime
+	dest := []any{&c.Id, &c.Title, &c.Content, &c.Type, &c.Audience, &c.Category, &c.UserGroupId, &sendTime, &c.Status,
+		&c.Total, &c.Sent, &c.Failed, &c.Skipped, &c.Cursor, &c.BatchAttempts, &c.LastError, &createTime, &updateTime, &finishTime}
+	if withUserIds {
+		dest = append(dest, pq.Array(&c.UserIds))
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	c.SendTimeUnix, c.CreateTimeUnix, c.UpdateTimeUnix = sendTime.Unix(), createTime.Unix(), updateTime.Unix()
+	if finishTime.Valid {
+		c.FinishTimeUnix = finishTime.Time.Unix()
+	}
+	return c, nil
+}
+
+func AddNotificationCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, c *entity.NotificationCampaign) error {
+	c.Id = conf.SnowlakeNode.Generate().Int64()
+	sendTime := time.Now()
+	if c.SendTimeUnix > sendTime.Unix() {
+		sendTime = time.Unix(c.SendTimeUnix, 0)
+	}
+	c.SendTimeUnix = sendTime.Unix()
+	c.Status = entity.NotiCampaignStatusScheduled
+	var userIds interface{}
+	if c.Audience == entity.NotiAudienceIds {
+		userIds = pq.Array(c.UserIds)
+	}
+	query := "INSERT INTO " + NotificationCampaignTableName +
+		" (id, title, content, type, audience, category, user_group_id, user_ids, send_time, status, create_time, update_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now(), now())"
+	_, err := db.ExecContext(ctx, query, c.Id, c.Title, c.Content, c.Type, c.Audience, c.Category, c.UserGroupId, userIds, sendTime, c.Status)
+	if err != nil {
+		logger.Error("Add notification campaign error %s", err.Error())
+		return status.Error(codes.Internal, "Add notification campaign error")
+	}
+	return nil
+}
+
+func GetNotificationCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) (*entity.NotificationCampaign, error) {
+	query := "SELECT " + notiCampaignColumns + " FROM " + NotificationCampaignTableName + " WHERE id=$1"
+	c, err := scanNotificationCampaign(db.QueryRowContext(ctx, query, id), false)
+	if err == sql.ErrNoRows {
+		return nil, status.Error(codes.NotFound, "Notification campaign not found")
+	}
+	if err != nil {
+		logger.Error("Get notification campaign %d error %s", id, err.Error())
+		return nil, status.Error(codes.Internal, "Get notification campaign error")
+	}
+	return c, nil
+}
+
+func ListNotificationCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.NotiCampaignRequest) ([]*entity.NotificationCampaign, error) {
+	filterStatus := -1
+	if req.Status != nil {
+		filterStatus = *req.Status
+	}
+	query := "SELECT " + notiCampaignColumns + " FROM " + NotificationCampaignTableName +
+		" WHERE ($1 < 0 OR status=$1) ORDER BY id DESC LIMIT $2 OFFSET $3"
+	rows, err := db.QueryContext(ctx, query, filterStatus, req.Limit, req.Offset)
+	if err != nil {
+		logger.Error("List notification campaign error %s", err.Error())
+		return nil, status.Error(codes.Internal, "List notification campaign error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.NotificationCampaign, 0)
+	for rows.Next() {
+		c, err := scanNotificationCampaign(rows, false)
+		if err != nil {
+			logger.Error("Scan notification campaign error %s", err.Error())
+			return nil, status.Error(codes.Internal, "List notification campaign error")
+		}
+		ml = append(ml, c)
+	}
+	return ml, rows.Err()
+}
+
+// CancelNotificationCampaign stop scheduled or running campaign, worker stop at next batch
+func CancelNotificationCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64) error {
+	query := "UPDATE " + NotificationCampaignTableName + " SET status=$2, finish_time=now(), update_time=now()" +
+		" WHERE id=$1 AND status IN ($3, $4)"
+	result, err := db.ExecContext(ctx, query, id, entity.NotiCampaignStatusCancelled,
+		entity.NotiCampaignStatusScheduled, entity.NotiCampaignStatusRunning)
+	if err != nil {
+		logger.Error("Cancel notification campaign %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Cancel notification campaign error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount == 0 {
+		return entity.ErrNotiCampaignStatus
+	}
+	return nil
+}
+
+// ClaimDueNotificationCampaign take a campaign reach send time, or running campaign its worker is gone,
+// nil if no campaign to send
+func ClaimDueNotificationCampaign(ctx context.Context, logger runtime.Logger, db *sql.DB) (*entity.NotificationCampaign, error) {
+	query := "UPDATE " + NotificationCampaignTableName + " SET status=$1, lock_until=now() + make_interval(secs => $2), update_time=now()" +
+		" WHERE id = (SELECT id FROM " + NotificationCampaignTableName +
+		" WHERE (status=$3 AND send_time <= now()) OR (status=$1 AND lock_until < now())" +
+		" ORDER BY send_time LIMIT 1 FOR UPDATE SKIP LOCKED)" +
+		" RETURNING " + notiCampaignColumns + ", user_ids"
+	c, err := scanNotificationCampaign(db.QueryRowContext(ctx, query, entity.NotiCampaignStatusRunning,
+		entity.NotiCampaignLeaseSec, entity.NotiCampaignStatusScheduled), true)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("Claim due notification campaign error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Claim notification campaign error")
+	}
+	return c, nil
+}
+
+// UpdateNotificationCampaignProgress save progress and extend lock of running campaign,
+// false if campaign is cancelled meanwhile
+func UpdateNotificationCampaignProgress(ctx context.Context, logger runtime.Logger, db *sql.DB, c *entity.NotificationCampaign) (bool, error) {
+	query := "UPDATE " + NotificationCampaignTableName + " SET status=$2, total=$3, sent=$4, failed=$5, skipped=$6, cursor=$7, last_error=$8," +
+		" lock_until=now() + make_interval(secs => $9), update_time=now()," +
+		" finish_time=CASE WHEN $2=" + strconv.Itoa(entity.NotiCampaignStatusDone) + " THEN now() ELSE NULL END," +
+		" batch_attempts=$11 WHERE id=$1 AND status=$10"
+	result, err := db.ExecContext(ctx, query, c.Id, c.Status, c.Total, c.Sent, c.Failed, c.Skipped, c.Cursor, c.LastError,
+		entity.NotiCampaignLeaseSec, entity.NotiCampaignStatusRunning, c.BatchAttempts)
+	if err != nil {
+		logger.Error("Update notification campaign %d progress error %s", c.Id, err.Error())
+		return false, status.Error(codes.Internal, "Update notification campaign error")
+	}
+	rowsAffectedCount, _ := result.RowsAffected()
+	return rowsAffectedCount == 1, nil
+}
+
+// AddNotificationBatch insert same notification for many recipients in one statement,
+// recipients muted category are skipped, return recipients inserted
+func AddNotificationBatch(ctx context.Context, logger runtime.Logger, db *sql.DB, title, content string, notiType int32,
+	category string, recipientIds []string) ([]string, error) {
+	query := "INSERT INTO " + NotificationTableName + " (title, content, sender_id, recipient_id, type, read, category, expire_at, create_time, update_time)" +
+		" SELECT $1, $2, '', r, $3, false, $5, $6, now(), now() FROM unnest($4::text[]) r" +
+		" WHERE NOT $7 OR NOT EXISTS (SELECT 1 FROM " + NotificationPreferenceTableName + " p WHERE p.user_id = r AND $5 = ANY(p.muted))" +
+		" RETURNING recipient_id"
+	rows, err := db.QueryContext(ctx, query, title, content, notiType, pq.Array(recipientIds), category,
+		entity.NotiExpireAt(category, time.Now()), entity.NotiCategoryMutable[category])
+	if err != nil {
+		logger.Error("Add notification batch of %d error %s", len(recipientIds), err.Error())
+		return nil, status.Error(codes.Internal, "Error add notification.")
+	}
+	inserted, err := scanUserIds(rows)
+	if err != nil {
+		logger.Error("Scan notification batch of %d error %s", len(recipientIds), err.Error())
+		return nil, status.Error(codes.Internal, "Error add notification.")
+	}
+	return inserted, nil
+}
+
+// ListUserIdsAfter id of real users after cursor in id order, bots and system user are excluded
+func ListUserIdsAfter(ctx context.Context, db *sql.DB, cursor string, limit int) ([]string, error) {
+	if cursor == "" {
+		cursor = notiCampaignUserCursorStart
+	}
+	query := "SELECT u.id::text FROM users u WHERE u.id > $1::uuid" +
+		" AND NOT EXISTS (SELECT 1 FROM " + UsersBotTableName + " b WHERE b.user_id = u.id::text)" +
+		" ORDER BY u.id LIMIT $2"
+	rows, err := db.QueryContext(ctx, query, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanUserIds(rows)
+}
+
+func CountRealUsers(ctx context.Context, db *sql.DB) (int64, error) {
+	var total int64
+	err := db.QueryRowContext(ctx, "SELECT count(*) FROM users u WHERE u.id > $1::uuid"+
+		" AND NOT EXISTS (SELECT 1 FROM "+UsersBotTableName+" b WHERE b.user_id = u.id::text)", notiCampaignUserCursorStart).Scan(&total)
+	return total, err
+}
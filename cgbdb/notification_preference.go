@@ -0,0 +1,69 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.notification_preference (
+//
+//	user_id character varying(128) NOT NULL PRIMARY KEY,
+//	muted text[] NOT NULL DEFAULT '{}',
+//	push_muted text[] NOT NULL DEFAULT '{}',
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+const NotificationPreferenceTableName = "notification_preference"
+
+// GetNotificationPreference preference of user, user not set any get empty preference
+func GetNotificationPreference(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string) (*entity.NotificationPreference, error) {
+	pref := &entity.NotificationPreference{UserId: userId, Muted: make([]string, 0), PushMuted: make([]string, 0)}
+	var updateTime time.Time
+	query := "SELECT muted, push_muted, update_time FROM " + NotificationPreferenceTableName + " WHERE user_id=$1"
+	err := db.QueryRowContext(ctx, query, userId).Scan(pq.Array(&pref.Muted), pq.Array(&pref.PushMuted), &updateTime)
+	if err == sql.ErrNoRows {
+		return pref, nil
+	}
+	if err != nil {
+		logger.Error("Get notification preference user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Get notification preference error")
+	}
+	pref.UpdateTimeUnix = updateTime.Unix()
+	return pref, nil
+}
+
+func UpsertNotificationPreference(ctx context.Context, logger runtime.Logger, db *sql.DB, pref *entity.NotificationPreference) error {
+	query := "INSERT INTO " + NotificationPreferenceTableName + " (user_id, muted, push_muted, update_time) VALUES ($1, $2, $3, now())" +
+		" ON CONFLICT (user_id) DO UPDATE SET muted=excluded.muted, push_muted=excluded.push_muted, update_time=now()"
+	if _, err := db.ExecContext(ctx, query, pref.UserId, pq.Array(pref.Muted), pq.Array(pref.PushMuted)); err != nil {
+		logger.Error("Upsert notification preference user %s error %s", pref.UserId, err.Error())
+		return status.Error(codes.Internal, "Update notification preference error")
+	}
+	pref.UpdateTimeUnix = time.Now().Unix()
+	return nil
+}
+
+// GetPushMutedUserIds users in list muted push of category
+func GetPushMutedUserIds(ctx context.Context, db *sql.DB, category string, userIds []string) (map[string]bool, error) {
+	query := "SELECT user_id FROM " + NotificationPreferenceTableName + " WHERE user_id = ANY($1) AND $2 = ANY(push_muted)"
+	rows, err := db.QueryContext(ctx, query, pq.Array(userIds), category)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanUserIds(rows)
+	if err != nil {
+		return nil, err
+	}
+	muted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		muted[id] = true
+	}
+	return muted, nil
+}
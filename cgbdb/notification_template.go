@@ -0,0 +1,106 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.notification_template (
+//
+//	id character varying(64) NOT NULL,
+//	locale character varying(16) NOT NULL,
+//	title character varying(256) NOT NULL,
+//	content text NOT NULL,
+//	params jsonb NOT NULL DEFAULT '[]',
+//	type integer NOT NULL DEFAULT 0,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT notification_template_pkey PRIMARY KEY (id, locale)
+//
+// );
+const NotificationTemplateTableName = "notification_template"
+
+func UpsertNotificationTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB, tpl *entity.NotificationTemplate) error {
+	params, _ := json.Marshal(tpl.Params)
+	query := "INSERT INTO " + NotificationTemplateTableName + " (id, locale, title, content, params, type, create_time, update_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, now(), now()) ON CONFLICT (id, locale) DO UPDATE SET" +
+		" title=excluded.title, content=excluded.content, params=excluded.params, type=excluded.type, update_time=now()"
+	_, err := db.ExecContext(ctx, query, tpl.Id, tpl.Locale, tpl.Title, tpl.Content, string(params), tpl.Type)
+	if err != nil {
+		logger.Error("Upsert notification template %s locale %s error %s", tpl.Id, tpl.Locale, err.Error())
+		return status.Error(codes.Internal, "Upsert notification template error")
+	}
+	return nil
+}
+
+func DeleteNotificationTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB, id, locale string) error {
+	query := "DELETE FROM " + NotificationTemplateTableName + " WHERE id=$1 AND locale=$2"
+	result, err := db.ExecContext(ctx, query, id, locale)
+	if err != nil {
+		logger.Error("Delete notification template %s locale %s error %s", id, locale, err.Error())
+		return status.Error(codes.Internal, "Delete notification template error")
+	}
+	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount == 0 {
+		return entity.ErrNotiTplNotFound
+	}
+	return nil
+}
+
+// ListNotificationTemplate templates of id, or all templates when id is empty
+func ListNotificationTemplate(ctx context.Context, logger runtime.Logger, db *sql.DB, id string) ([]*entity.NotificationTemplate, error) {
+	query := "SELECT id, locale, title, content, params, type, create_time, update_time FROM " + NotificationTemplateTableName +
+		" WHERE ($1='' OR id=$1) ORDER BY id, locale"
+	ml, err := queryNotificationTemplate(ctx, db, query, id)
+	if err != nil {
+		logger.Error("List notification template %s error %s", id, err.Error())
+		return nil, status.Error(codes.Internal, "List notification template error")
+	}
+	return ml, nil
+}
+
+func queryNotificationTemplate(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]*entity.NotificationTemplate, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ml := make([]*entity.NotificationTemplate, 0)
+	for rows.Next() {
+		tpl := &entity.NotificationTemplate{}
+		var params string
+		var createTime, updateTime time.Time
+		if err := rows.Scan(&tpl.Id, &tpl.Locale, &tpl.Title, &tpl.Content, &params, &tpl.Type, &createTime, &updateTime); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(params), &tpl.Params)
+		tpl.CreateTimeUnix, tpl.UpdateTimeUnix = createTime.Unix(), updateTime.Unix()
+		ml = append(ml, tpl)
+	}
+	return ml, rows.Err()
+}
+
+// GetUserLangTag lang tag of users, user not found is not in map
+func GetUserLangTag(ctx context.Context, db *sql.DB, userIds ...string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT id, lang_tag FROM users WHERE id::text = ANY($1)", pq.Array(userIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	langs := make(map[string]string)
+	for rows.Next() {
+		var userId, lang string
+		if err := rows.Scan(&userId, &lang); err != nil {
+			return nil, err
+		}
+		langs[userId] = lang
+	}
+	return langs, rows.Err()
+}
@@ -0,0 +1,319 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/constant"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.playtime_presence (
+//
+//	user_id character varying(128) NOT NULL,
+//	kind character varying(16) NOT NULL,
+//	presence_id character varying(128) NOT NULL,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	node character varying(128) NOT NULL DEFAULT '',
+//	CONSTRAINT playtime_presence_pkey PRIMARY KEY (user_id, kind, presence_id)
+//
+// );
+// CREATE INDEX idx_playtime_presence_node ON public.playtime_presence(node);
+const PlaytimePresenceTableName = "playtime_presence"
+
+// CREATE TABLE public.playtime_node (
+//
+//	node character varying(128) NOT NULL PRIMARY KEY,
+//	heartbeat_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+const PlaytimeNodeTableName = "playtime_node"
+
+// CREATE TABLE public.playtime_checkpoint (
+//
+//	user_id character varying(128) NOT NULL,
+//	kind character varying(16) NOT NULL,
+//	checkpoint_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT playtime_checkpoint_pkey PRIMARY KEY (user_id, kind)
+//
+// );
+const PlaytimeCheckpointTableName = "playtime_checkpoint"
+
+// CREATE TABLE public.playtime_daily (
+//
+//	user_id character varying(128) NOT NULL,
+//	day character varying(10) NOT NULL,
+//	online_sec bigint NOT NULL DEFAULT 0,
+//	match_sec bigint NOT NULL DEFAULT 0,
+//	claimed integer NOT NULL DEFAULT 0,
+//	match_claimed integer NOT NULL DEFAULT 0,
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT playtime_daily_pkey PRIMARY KEY (user_id, day)
+//
+// );
+const PlaytimeDailyTableName = "playtime_daily"
+
+// flushPlaytime add time from last checkpoint to now if user has any presence of kind,
+// then move checkpoint to now. Many devices or matches at same time only count once.
+// Return number of presences.
+func flushPlaytime(ctx context.Context, logger runtime.Logger, tx *sql.Tx, userId, kind string, now time.Time, loc *time.Location) (int64, error) {
+	_, err := tx.ExecContext(ctx, "INSERT INTO "+PlaytimeCheckpointTableName+" (user_id, kind, checkpoint_time) VALUES ($1, $2, $3)"+
+		" ON CONFLICT (user_id, kind) DO NOTHING", userId, kind, now)
+	if err != nil {
+		logger.Error("Insert playtime checkpoint user %s error %s", userId, err.Error())
+		return 0, status.Error(codes.Internal, "Update playtime error")
+	}
+	var checkpoint time.Time
+	err = tx.QueryRowContext(ctx, "SELECT checkpoint_time FROM "+PlaytimeCheckpointTableName+
+		" WHERE user_id=$1 AND kind=$2 FOR UPDATE", userId, kind).Scan(&checkpoint)
+	if err != nil {
+		logger.Error("Lock playtime checkpoint user %s error %s", userId, err.Error())
+		return 0, status.Error(codes.Internal, "Update playtime error")
+	}
+	var numPresence int64
+	err = tx.QueryRowContext(ctx, "SELECT count(*) FROM "+PlaytimePresenceTableName+
+		" WHERE user_id=$1 AND kind=$2", userId, kind).Scan(&numPresence)
+	if err != nil {
+		logger.Error("Count playtime presence user %s error %s", userId, err.Error())
+		return 0, status.Error(codes.Internal, "Update playtime error")
+	}
+	if numPresence > 0 {
+		for day, sec := range entity.SplitPlaytimeByDay(checkpoint, now, loc) {
+			if err := addPlaytimeDaily(ctx, logger, tx, userId, kind, day, sec); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if now.After(checkpoint) {
+		_, err = tx.ExecContext(ctx, "UPDATE "+PlaytimeCheckpointTableName+" SET checkpoint_time=$1 WHERE user_id=$2 AND kind=$3",
+			now, userId, kind)
+		if err != nil {
+			logger.Error("Update playtime checkpoint user %s error %s", userId, err.Error())
+			return 0, status.Error(codes.Internal, "Update playtime error")
+		}
+	}
+	return numPresence, nil
+}
+
+func addPlaytimeDaily(ctx context.Context, logger runtime.Logger, tx *sql.Tx, userId, kind, day string, sec int64) error {
+	var onlineSec, matchSec int64
+	if kind == entity.PlaytimeKindMatch {
+		matchSec = sec
+	} else {
+		onlineSec = sec
+	}
+	query := "INSERT INTO " + PlaytimeDailyTableName + " (user_id, day, online_sec, match_sec, claimed, update_time)" +
+		" VALUES ($1, $2, $3, $4, 0, now()) ON CONFLICT (user_id, day) DO UPDATE SET" +
+		" online_sec=" + PlaytimeDailyTableName + ".online_sec+excluded.online_sec," +
+		" match_sec=" + PlaytimeDailyTableName + ".match_sec+excluded.match_sec, update_time=now()"
+	if _, err := tx.ExecContext(ctx, query, userId, day, onlineSec, matchSec); err != nil {
+		logger.Error("Add playtime user %s day %s error %s", userId, day, err.Error())
+		return status.Error(codes.Internal, "Update playtime error")
+	}
+	return nil
+}
+
+// UpdatePlaytimePresence user start (add) or end (remove) a session or match on node
+func UpdatePlaytimePresence(ctx context.Context, logger runtime.Logger, db *sql.DB, node, userId, kind, presenceId string, add bool, now time.Time, loc *time.Location) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx playtime error %s", err.Error())
+		return status.Error(codes.Internal, "Update playtime error")
+	}
+	defer tx.Rollback()
+	if _, err := flushPlaytime(ctx, logger, tx, userId, kind, now, loc); err != nil {
+		return err
+	}
+	if add {
+		_, err = tx.ExecContext(ctx, "INSERT INTO "+PlaytimePresenceTableName+" (user_id, kind, presence_id, create_time, node)"+
+			" VALUES ($1, $2, $3, now(), $4) ON CONFLICT (user_id, kind, presence_id) DO NOTHING", userId, kind, presenceId, node)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM "+PlaytimePresenceTableName+" WHERE user_id=$1 AND kind=$2 AND presence_id=$3",
+			userId, kind, presenceId)
+	}
+	if err != nil {
+		logger.Error("Update playtime presence user %s %s %s error %s", userId, kind, presenceId, err.Error())
+		return status.Error(codes.Internal, "Update playtime error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit playtime user %s error %s", userId, err.Error())
+		return status.Error(codes.Internal, "Update playtime error")
+	}
+	return nil
+}
+
+// FlushPlaytime count online time until now, return true if user is online
+func FlushPlaytime(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, now time.Time, loc *time.Location) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx playtime error %s", err.Error())
+		return false, status.Error(codes.Internal, "Update playtime error")
+	}
+	defer tx.Rollback()
+	numPresence, err := flushPlaytime(ctx, logger, tx, userId, entity.PlaytimeKindOnline, now, loc)
+	if err != nil {
+		return false, err
+	}
+	if _, err := flushPlaytime(ctx, logger, tx, userId, entity.PlaytimeKindMatch, now, loc); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit playtime user %s error %s", userId, err.Error())
+		return false, status.Error(codes.Internal, "Update playtime error")
+	}
+	return numPresence > 0, nil
+}
+
+// HeartbeatPlaytimeNode node is alive, its presences are counted until now
+func HeartbeatPlaytimeNode(ctx context.Context, logger runtime.Logger, db *sql.DB, node string) error {
+	query := "INSERT INTO " + PlaytimeNodeTableName + " (node, heartbeat_time) VALUES ($1, now())" +
+		" ON CONFLICT (node) DO UPDATE SET heartbeat_time=now()"
+	if _, err := db.ExecContext(ctx, query, node); err != nil {
+		logger.Error("Heartbeat playtime node %s error %s", node, err.Error())
+		return status.Error(codes.Internal, "Heartbeat playtime node error")
+	}
+	return nil
+}
+
+// ListStalePlaytimeNode nodes without heartbeat since staleBefore
+func ListStalePlaytimeNode(ctx context.Context, logger runtime.Logger, db *sql.DB, staleBefore time.Time) ([]string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT node FROM "+PlaytimeNodeTableName+" WHERE heartbeat_time < $1", staleBefore)
+	if err != nil {
+		logger.Error("Query stale playtime node error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query playtime node error")
+	}
+	defer rows.Close()
+	ml := make([]string, 0)
+	for rows.Next() {
+		var node string
+		if err := rows.Scan(&node); err != nil {
+			logger.Error("Scan playtime node error %s", err.Error())
+			continue
+		}
+		ml = append(ml, node)
+	}
+	return ml, rows.Err()
+}
+
+// TakePlaytimeNode remove node, return its last heartbeat. Only one caller get the heartbeat,
+// zero time if node has no heartbeat.
+func TakePlaytimeNode(ctx context.Context, logger runtime.Logger, db *sql.DB, node string) (time.Time, error) {
+	var heartbeat time.Time
+	err := db.QueryRowContext(ctx, "DELETE FROM "+PlaytimeNodeTableName+" WHERE node=$1 RETURNING heartbeat_time", node).Scan(&heartbeat)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Take playtime node %s error %s", node, err.Error())
+		return heartbeat, status.Error(codes.Internal, "Take playtime node error")
+	}
+	return heartbeat, nil
+}
+
+// ListPlaytimePresenceOfNode user and kind has presence on node
+func ListPlaytimePresenceOfNode(ctx context.Context, logger runtime.Logger, db *sql.DB, node string) ([]*entity.PlaytimePresence, error) {
+	rows, err := db.QueryContext(ctx, "SELECT DISTINCT user_id, kind FROM "+PlaytimePresenceTableName+" WHERE node=$1", node)
+	if err != nil {
+		logger.Error("Query playtime presence of node %s error %s", node, err.Error())
+		return nil, status.Error(codes.Internal, "Query playtime presence error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.PlaytimePresence, 0)
+	for rows.Next() {
+		presence := &entity.PlaytimePresence{}
+		if err := rows.Scan(&presence.UserId, &presence.Kind); err != nil {
+			logger.Error("Scan playtime presence error %s", err.Error())
+			continue
+		}
+		ml = append(ml, presence)
+	}
+	return ml, rows.Err()
+}
+
+// ClearPlaytimePresence count time of user until the node stop, then remove presences of kind on node.
+// Sessions of stopped node are gone, time after until is not counted.
+func ClearPlaytimePresence(ctx context.Context, logger runtime.Logger, db *sql.DB, node, userId, kind string, until time.Time, loc *time.Location) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx playtime error %s", err.Error())
+		return status.Error(codes.Internal, "Clear playtime presence error")
+	}
+	defer tx.Rollback()
+	if !until.IsZero() {
+		if _, err := flushPlaytime(ctx, logger, tx, userId, kind, until, loc); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM "+PlaytimePresenceTableName+" WHERE user_id=$1 AND kind=$2 AND node=$3", userId, kind, node)
+	if err != nil {
+		logger.Error("Clear playtime presence user %s node %s error %s", userId, node, err.Error())
+		return status.Error(codes.Internal, "Clear playtime presence error")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit playtime user %s error %s", userId, err.Error())
+		return status.Error(codes.Internal, "Clear playtime presence error")
+	}
+	return nil
+}
+
+func GetPlaytimeDay(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, day string) (*entity.PlaytimeDay, error) {
+	playtime := &entity.PlaytimeDay{UserId: userId, Day: day}
+	err := db.QueryRowContext(ctx, "SELECT online_sec, match_sec, claimed, match_claimed FROM "+PlaytimeDailyTableName+
+		" WHERE user_id=$1 AND day=$2", userId, day).Scan(&playtime.OnlineSec, &playtime.MatchSec, &playtime.Claimed, &playtime.MatchClaimed)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error("Query playtime user %s day %s error %s", userId, day, err.Error())
+		return nil, status.Error(codes.Internal, "Query playtime error")
+	}
+	return playtime, nil
+}
+
+// ClaimPlaytime claim all reached online and match milestones of day, wallet update is saved in claim outbox
+func ClaimPlaytime(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, day string, milestones, matchMilestones []*entity.PlaytimeMilestone) (*entity.PlaytimeDay, *entity.ClaimOutbox, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx claim playtime error %s", err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim playtime error")
+	}
+	defer tx.Rollback()
+	playtime := &entity.PlaytimeDay{UserId: userId, Day: day}
+	err = tx.QueryRowContext(ctx, "SELECT online_sec, match_sec, claimed, match_claimed FROM "+PlaytimeDailyTableName+
+		" WHERE user_id=$1 AND day=$2 FOR UPDATE", userId, day).Scan(&playtime.OnlineSec, &playtime.MatchSec, &playtime.Claimed, &playtime.MatchClaimed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, status.Error(codes.FailedPrecondition, entity.ErrPlaytimeNoMilestone.Error())
+		}
+		logger.Error("Lock playtime user %s day %s error %s", userId, day, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim playtime error")
+	}
+	chips, err := playtime.ClaimPlaytime(milestones, matchMilestones)
+	if err != nil {
+		return nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE "+PlaytimeDailyTableName+" SET claimed=$1, match_claimed=$2, update_time=now() WHERE user_id=$3 AND day=$4",
+		playtime.Claimed, playtime.MatchClaimed, userId, day)
+	if err != nil {
+		logger.Error("Update playtime claimed user %s day %s error %s", userId, day, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim playtime error")
+	}
+	metadata := make(map[string]interface{})
+	metadata["action"] = entity.WalletActionPlaytime
+	metadata["sender"] = constant.UUID_USER_SYSTEM
+	metadata["recv"] = userId
+	metadata["day"] = day
+	outbox := &entity.ClaimOutbox{
+		UserId:   userId,
+		IdemKey:  entity.PlaytimeClaimKey(day, playtime.Claimed, playtime.MatchClaimed),
+		Kind:     entity.ClaimOutboxKindPlaytime,
+		Chips:    chips,
+		Metadata: metadata,
+	}
+	if err := addClaimOutbox(ctx, logger, tx, outbox); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit claim playtime user %s error %s", userId, err.Error())
+		return nil, nil, status.Error(codes.Internal, "Claim playtime error")
+	}
+	return playtime, outbox, nil
+}
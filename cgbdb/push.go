@@ -0,0 +1,181 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.push_token (
+//
+//	app_package character varying(128) NOT NULL,
+//	token character varying(4096) NOT NULL,
+//	user_id character varying(128) NOT NULL,
+//	platform character varying(16) NOT NULL,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT push_token_pkey PRIMARY KEY (app_package, token)
+//
+// );
+const PushTokenTableName = "push_token"
+
+// CREATE TABLE public.push_queue (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	user_id character varying(128) NOT NULL,
+//	app_package character varying(128) NOT NULL DEFAULT '',
+//	title character varying(256) NOT NULL,
+//	body text NOT NULL,
+//	data jsonb,
+//	status smallint NOT NULL DEFAULT 0,
+//	attempts integer NOT NULL DEFAULT 0,
+//	done_tokens text[] NOT NULL DEFAULT '{}',
+//	last_error text NOT NULL DEFAULT '',
+//	next_attempt timestamp with time zone NOT NULL DEFAULT now(),
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+const PushQueueTableName = "push_queue"
+
+// UpsertPushToken register token for user, token registered by other user before is moved to this user
+func UpsertPushToken(ctx context.Context, logger runtime.Logger, db *sql.DB, token *entity.PushToken) error {
+	query := "INSERT INTO " + PushTokenTableName + " (app_package, token, user_id, platform, create_time, update_time)" +
+		" VALUES ($1, $2, $3, $4, now(), now())" +
+		" ON CONFLICT (app_package, token) DO UPDATE SET user_id=excluded.user_id, platform=excluded.platform, update_time=now()"
+	if _, err := db.ExecContext(ctx, query, token.AppPackage, token.Token, token.UserId, token.Platform); err != nil {
+		logger.Error("Upsert push token user %s, app %s error %s", token.UserId, token.AppPackage, err.Error())
+		return status.Error(codes.Internal, "Register push token error")
+	}
+	return nil
+}
+
+// DeletePushToken delete token of user, userId empty delete token of any user (token invalidated by provider)
+func DeletePushToken(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, appPackage, token string) error {
+	query := "DELETE FROM " + PushTokenTableName + " WHERE app_package=$1 AND token=$2 AND ($3='' OR user_id=$3)"
+	if _, err := db.ExecContext(ctx, query, appPackage, token, userId); err != nil {
+		logger.Error("Delete push token app %s error %s", appPackage, err.Error())
+		return status.Error(codes.Internal, "Delete push token error")
+	}
+	return nil
+}
+
+// ListPushToken tokens of user, appPackage empty is tokens of all apps
+func ListPushToken(ctx context.Context, logger runtime.Logger, db *sql.DB, userId, appPackage string) ([]*entity.PushToken, error) {
+	query := "SELECT app_package, token, user_id, platform, create_time, update_time FROM " + PushTokenTableName +
+		" WHERE user_id=$1 AND ($2='' OR app_package=$2) ORDER BY update_time DESC"
+	rows, err := db.QueryContext(ctx, query, userId, appPackage)
+	if err != nil {
+		logger.Error("List push token user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "List push token error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.PushToken, 0)
+	for rows.Next() {
+		t := &entity.PushToken{}
+		var createTime, updateTime time.Time
+		if err := rows.Scan(&t.AppPackage, &t.Token, &t.UserId, &t.Platform, &createTime, &updateTime); err != nil {
+			logger.Error("Scan push token error %s", err.Error())
+			continue
+		}
+		t.CreateTimeUnix, t.UpdateTimeUnix = createTime.Unix(), updateTime.Unix()
+		ml = append(ml, t)
+	}
+	return ml, rows.Err()
+}
+
+// EnqueuePush queue same push for users, worker send it to all their tokens
+func EnqueuePush(ctx context.Context, logger runtime.Logger, db *sql.DB, userIds []string, appPackage, title, body string, data map[string]string) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	dbData, _ := json.Marshal(data)
+	ids := make([]int64, 0, len(userIds))
+	for range userIds {
+		ids = append(ids, conf.SnowlakeNode.Generate().Int64())
+	}
+	query := "INSERT INTO " + PushQueueTableName + " (id, user_id, app_package, title, body, data, status, create_time, update_time, next_attempt)" +
+		" SELECT q.id, q.user_id, $3, $4, $5, $6, $7, now(), now(), now() FROM unnest($1::bigint[], $2::text[]) AS q(id, user_id)" +
+		" WHERE EXISTS (SELECT 1 FROM " + PushTokenTableName + " t WHERE t.user_id = q.user_id AND ($3='' OR t.app_package=$3))"
+	_, err := db.ExecContext(ctx, query, pq.Array(ids), pq.Array(userIds), appPackage, title, body, dbData, entity.PushStatusPending)
+	if err != nil {
+		logger.Error("Enqueue push of %d users error %s", len(userIds), err.Error())
+		return status.Error(codes.Internal, "Enqueue push error")
+	}
+	return nil
+}
+
+// ClaimDuePush take pending push reached next attempt, next attempt is moved by lease so other worker skip it
+func ClaimDuePush(ctx context.Context, logger runtime.Logger, db *sql.DB, limit int) ([]*entity.PushMessage, error) {
+	query := "UPDATE " + PushQueueTableName + " SET next_attempt=now() + make_interval(secs => $1), update_time=now()" +
+		" WHERE id IN (SELECT id FROM " + PushQueueTableName +
+		" WHERE status=$2 AND next_attempt <= now() ORDER BY next_attempt LIMIT $3 FOR UPDATE SKIP LOCKED)" +
+		" RETURNING id, user_id, app_package, title, body, data, status, attempts, done_tokens, last_error"
+	rows, err := db.QueryContext(ctx, query, entity.PushLeaseSec, entity.PushStatusPending, limit)
+	if err != nil {
+		logger.Error("Claim due push error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Claim push error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.PushMessage, 0)
+	for rows.Next() {
+		msg := &entity.PushMessage{}
+		var dbData []byte
+		if err := rows.Scan(&msg.Id, &msg.UserId, &msg.AppPackage, &msg.Title, &msg.Body, &dbData, &msg.Status,
+			&msg.Attempts, pq.Array(&msg.DoneTokens), &msg.LastError); err != nil {
+			logger.Error("Scan push queue error %s", err.Error())
+			continue
+		}
+		msg.Data = make(map[string]string)
+		if len(dbData) > 0 {
+			_ = json.Unmarshal(dbData, &msg.Data)
+		}
+		ml = append(ml, msg)
+	}
+	return ml, rows.Err()
+}
+
+// ExtendPushLease move next attempt of pending push by lease again, worker call it while sending
+// so a slow batch is not claimed by other worker
+func ExtendPushLease(ctx context.Context, logger runtime.Logger, db *sql.DB, ids []int64) error {
+	query := "UPDATE " + PushQueueTableName + " SET next_attempt=now() + make_interval(secs => $1), update_time=now()" +
+		" WHERE id = ANY($2) AND status=$3"
+	_, err := db.ExecContext(ctx, query, entity.PushLeaseSec, pq.Array(ids), entity.PushStatusPending)
+	if err != nil {
+		logger.Error("Extend lease of %d push error %s", len(ids), err.Error())
+		return status.Error(codes.Internal, "Extend push lease error")
+	}
+	return nil
+}
+
+// UpdatePushResult save status, attempts, tokens delivered and next attempt of push
+func UpdatePushResult(ctx context.Context, logger runtime.Logger, db *sql.DB, msg *entity.PushMessage) error {
+	query := "UPDATE " + PushQueueTableName + " SET status=$2, attempts=$3, done_tokens=$4, last_error=$5, next_attempt=$6, update_time=now()" +
+		" WHERE id=$1"
+	_, err := db.ExecContext(ctx, query, msg.Id, msg.Status, msg.Attempts, pq.Array(msg.DoneTokens), msg.LastError, msg.NextAttempt)
+	if err != nil {
+		logger.Error("Update push %d error %s", msg.Id, err.Error())
+		return status.Error(codes.Internal, "Update push error")
+	}
+	return nil
+}
+
+// DeleteFinishedPush delete done and failed push not updated in keepDays
+func DeleteFinishedPush(ctx context.Context, logger runtime.Logger, db *sql.DB, keepDays int) (int64, error) {
+	query := "DELETE FROM " + PushQueueTableName + " WHERE status<>$1 AND update_time < now() - make_interval(days => $2)"
+	result, err := db.ExecContext(ctx, query, entity.PushStatusPending, keepDays)
+	if err != nil {
+		logger.Error("Delete finished push error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Delete push error")
+	}
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
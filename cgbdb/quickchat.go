@@ -0,0 +1,188 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.quickchat_preset (
+//
+//	locale character varying(16) NOT NULL PRIMARY KEY,
+//	texts text[] NOT NULL,
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+const QuickChatPresetTableName = "quickchat_preset"
+
+// CREATE TABLE public.chat_blocklist (
+//
+//	word character varying(64) NOT NULL PRIMARY KEY,
+//	create_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+// word with allow is in allowlist, never blocked
+// ALTER TABLE public.chat_blocklist ADD COLUMN allow boolean NOT NULL DEFAULT false;
+const ChatBlocklistTableName = "chat_blocklist"
+
+// CREATE TABLE public.quickchat_report (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	reporter_id character varying(128) NOT NULL,
+//	user_id character varying(128) NOT NULL,
+//	text character varying(256) NOT NULL,
+//	reason character varying(256) NOT NULL DEFAULT '',
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	UNIQUE (reporter_id, user_id, text)
+//
+// );
+const QuickChatReportTableName = "quickchat_report"
+
+// UpsertQuickChatPreset save preset of locale, preset without text is deleted
+func UpsertQuickChatPreset(ctx context.Context, logger runtime.Logger, db *sql.DB, preset *entity.QuickChatPreset) error {
+	var err error
+	if len(preset.Texts) == 0 {
+		_, err = db.ExecContext(ctx, "DELETE FROM "+QuickChatPresetTableName+" WHERE locale=$1", preset.Locale)
+	} else {
+		query := "INSERT INTO " + QuickChatPresetTableName + " (locale, texts, update_time) VALUES ($1, $2, now())" +
+			" ON CONFLICT (locale) DO UPDATE SET texts=excluded.texts, update_time=now()"
+		_, err = db.ExecContext(ctx, query, preset.Locale, pq.Array(preset.Texts))
+	}
+	if err != nil {
+		logger.Error("Upsert quickchat preset %s error %s", preset.Locale, err.Error())
+		return status.Error(codes.Internal, "Update quickchat preset error")
+	}
+	preset.UpdateTimeUnix = time.Now().Unix()
+	return nil
+}
+
+func ListQuickChatPreset(ctx context.Context, logger runtime.Logger, db *sql.DB) ([]*entity.QuickChatPreset, error) {
+	rows, err := db.QueryContext(ctx, "SELECT locale, texts, update_time FROM "+QuickChatPresetTableName+" ORDER BY locale")
+	if err != nil {
+		logger.Error("Query quickchat preset error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query quickchat preset error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.QuickChatPreset, 0)
+	for rows.Next() {
+		p := &entity.QuickChatPreset{}
+		var updateTime time.Time
+		if err := rows.Scan(&p.Locale, pq.Array(&p.Texts), &updateTime); err != nil {
+			logger.Error("Scan quickchat preset error %s", err.Error())
+			continue
+		}
+		p.UpdateTimeUnix = updateTime.Unix()
+		ml = append(ml, p)
+	}
+	return ml, rows.Err()
+}
+
+// ListChatBlocklist blocked words and allowed words
+func ListChatBlocklist(ctx context.Context, db *sql.DB) ([]string, []string, error) {
+	rows, err := db.QueryContext(ctx, "SELECT word, allow FROM "+ChatBlocklistTableName+" ORDER BY word")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	blocked := make([]string, 0)
+	allowed := make([]string, 0)
+	for rows.Next() {
+		var word string
+		var allow bool
+		if err := rows.Scan(&word, &allow); err != nil {
+			return nil, nil, err
+		}
+		if allow {
+			allowed = append(allowed, word)
+		} else {
+			blocked = append(blocked, word)
+		}
+	}
+	return blocked, allowed, rows.Err()
+}
+
+// UpdateChatBlocklist add and remove words of blocklist and allowlist, word added to one list leave the other
+func UpdateChatBlocklist(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.QuickChatBlocklistRequest) error {
+	add := func(words []string, allow bool) error {
+		if len(words) == 0 {
+			return nil
+		}
+		query := "INSERT INTO " + ChatBlocklistTableName + " (word, allow, create_time) SELECT w, $2, now() FROM unnest($1::text[]) w" +
+			" WHERE w <> '' ON CONFLICT (word) DO UPDATE SET allow=EXCLUDED.allow"
+		if _, err := db.ExecContext(ctx, query, pq.Array(words), allow); err != nil {
+			logger.Error("Add chat blocklist error %s", err.Error())
+			return status.Error(codes.Internal, "Update chat blocklist error")
+		}
+		return nil
+	}
+	remove := func(words []string, allow bool) error {
+		if len(words) == 0 {
+			return nil
+		}
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+ChatBlocklistTableName+" WHERE word = ANY($1) AND allow=$2", pq.Array(words), allow); err != nil {
+			logger.Error("Remove chat blocklist error %s", err.Error())
+			return status.Error(codes.Internal, "Update chat blocklist error")
+		}
+		return nil
+	}
+	if err := add(req.Add, false); err != nil {
+		return err
+	}
+	if err := add(req.AllowAdd, true); err != nil {
+		return err
+	}
+	if err := remove(req.Remove, false); err != nil {
+		return err
+	}
+	return remove(req.AllowRemove, true)
+}
+
+// AddQuickChatReport save report, return number of distinct players reported the phrase.
+// Same player report same phrase again is not counted.
+func AddQuickChatReport(ctx context.Context, logger runtime.Logger, db *sql.DB, report *entity.QuickChatReport) (int64, error) {
+	report.Id = conf.SnowlakeNode.Generate().Int64()
+	query := "INSERT INTO " + QuickChatReportTableName + " (id, reporter_id, user_id, text, reason, create_time)" +
+		" VALUES ($1, $2, $3, $4, $5, now()) ON CONFLICT (reporter_id, user_id, text) DO NOTHING"
+	if _, err := db.ExecContext(ctx, query, report.Id, report.ReporterId, report.UserId, report.Text, report.Reason); err != nil {
+		logger.Error("Add quickchat report of user %s error %s", report.UserId, err.Error())
+		return 0, status.Error(codes.Internal, "Add quickchat report error")
+	}
+	var count int64
+	query = "SELECT count(*) FROM " + QuickChatReportTableName + " WHERE user_id=$1 AND text=$2"
+	if err := db.QueryRowContext(ctx, query, report.UserId, report.Text).Scan(&count); err != nil {
+		logger.Error("Count quickchat report of user %s error %s", report.UserId, err.Error())
+		return 0, status.Error(codes.Internal, "Add quickchat report error")
+	}
+	return count, nil
+}
+
+// ListQuickChatReport newest reports, filter by reported user
+func ListQuickChatReport(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.QuickChatReportRequest) ([]*entity.QuickChatReport, error) {
+	query := "SELECT id, reporter_id, user_id, text, reason, create_time FROM " + QuickChatReportTableName +
+		" WHERE ($1='' OR user_id=$1) ORDER BY id DESC LIMIT $2 OFFSET $3"
+	rows, err := db.QueryContext(ctx, query, req.UserId, req.Limit, req.Offset)
+	if err != nil {
+		logger.Error("Query quickchat report error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query quickchat report error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.QuickChatReport, 0)
+	for rows.Next() {
+		r := &entity.QuickChatReport{}
+		var createTime time.Time
+		if err := rows.Scan(&r.Id, &r.ReporterId, &r.UserId, &r.Text, &r.Reason, &createTime); err != nil {
+			logger.Error("Scan quickchat report error %s", err.Error())
+			continue
+		}
+		r.CreateTimeUnix = createTime.Unix()
+		ml = append(ml, r)
+	}
+	return ml, rows.Err()
+}
@@ -0,0 +1,82 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// referDashboardInviteeQuery invitees of $1 up to level $2 with fee in [$3, $4] and earning,
+// paging and sort is done in sql so dashboard never load whole tree
+func referDashboardInviteeQuery() string {
+	return "WITH tree AS (SELECT user_id, level, create_time FROM " + ReferTreeTableName + " WHERE ancestor_id=$1 AND level <= $2)," +
+		" fee AS (SELECT user_id, sum(fee) AS fee FROM " + FeeGameTableName +
+		" WHERE user_id IN (SELECT user_id FROM tree) AND create_time>=$3 AND create_time<=$4 GROUP BY user_id)" +
+		" SELECT t.user_id, t.level, COALESCE(r.create_time, t.create_time) AS join_time," +
+		" COALESCE(f.fee, 0) AS fee, COALESCE(e.earning, 0) AS earning FROM tree t" +
+		" LEFT JOIN " + ReferUserTableName + " r ON r.user_invitee=t.user_id" +
+		" LEFT JOIN fee f ON f.user_id=t.user_id" +
+		" LEFT JOIN " + ReferEarningTableName + " e ON e.user_id=$1 AND e.invitee_id=t.user_id"
+}
+
+func referDashboardOrder(sortBy string, asc bool) string {
+	column := "fee"
+	switch sortBy {
+	case entity.ReferDashboardSortEarning:
+		column = "earning"
+	case entity.ReferDashboardSortJoin:
+		column = "join_time"
+	}
+	dir := " DESC"
+	if asc {
+		dir = " ASC"
+	}
+	// tie is broken by join time then user id so paging is stable
+	return " ORDER BY " + column + dir + ", join_time, user_id"
+}
+
+// ListReferDashboardInvitees one page of invitees of user sorted by req.SortBy, fee is in [from, to]
+func ListReferDashboardInvitees(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, maxLevel int, from, to int64, req *entity.ReferDashboardRequest) ([]*entity.ReferDashboardInvitee, error) {
+	query := "SELECT * FROM (" + referDashboardInviteeQuery() + ") d" + referDashboardOrder(req.SortBy, req.Asc) +
+		" LIMIT " + strconv.Itoa(req.Limit) + " OFFSET " + strconv.Itoa(req.Offset)
+	rows, err := db.QueryContext(ctx, query, userId, maxLevel, time.Unix(from, 0), time.Unix(to, 0))
+	if err != nil {
+		logger.Error("Query refer dashboard invitees of user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Query refer dashboard error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.ReferDashboardInvitee, 0)
+	for rows.Next() {
+		invitee := &entity.ReferDashboardInvitee{}
+		var joinTime time.Time
+		if err := rows.Scan(&invitee.UserId, &invitee.Level, &joinTime, &invitee.FeeThisWeek, &invitee.LifetimeEarning); err != nil {
+			logger.Error("Scan refer dashboard invitee error %s", err.Error())
+			continue
+		}
+		invitee.JoinTimeUnix = joinTime.Unix()
+		ml = append(ml, invitee)
+	}
+	return ml, rows.Err()
+}
+
+// GetReferDashboardSummary number of invitees, active invitees with fee at least minFee,
+// fee in [from, to] of all invitees and lifetime earning of user
+func GetReferDashboardSummary(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, maxLevel int, from, to, minFee int64) (*entity.ReferDashboard, error) {
+	query := "SELECT count(*), count(*) FILTER (WHERE fee > 0 AND fee >= $5), COALESCE(sum(fee), 0)," +
+		" (SELECT COALESCE(sum(reward), 0) FROM " + RewardReferTableName + " WHERE user_id=$1 AND time_send_to_wallet IS NOT NULL)" +
+		" FROM (" + referDashboardInviteeQuery() + ") d"
+	dashboard := &entity.ReferDashboard{}
+	err := db.QueryRowContext(ctx, query, userId, maxLevel, time.Unix(from, 0), time.Unix(to, 0), minFee).
+		Scan(&dashboard.TotalInvitees, &dashboard.ActiveInvitees, &dashboard.FeeThisWeek, &dashboard.LifetimeEarning)
+	if err != nil {
+		logger.Error("Query refer dashboard summary of user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Query refer dashboard error")
+	}
+	return dashboard, nil
+}
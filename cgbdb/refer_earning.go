@@ -0,0 +1,106 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// lifetime reward user earned from each invitee, added when reward refer is sent to wallet
+// CREATE TABLE public.refer_earning (
+//
+//	user_id character varying(128) NOT NULL,
+//	invitee_id character varying(128) NOT NULL,
+//	earning bigint NOT NULL DEFAULT 0,
+//	update_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT refer_earning_pkey PRIMARY KEY (user_id, invitee_id)
+//
+// );
+// ALTER TABLE public.reward_refer ADD COLUMN earning_counted boolean NOT NULL DEFAULT false;
+const ReferEarningTableName = "refer_earning"
+
+// addReferEarning add reward of each invitee in data of reward refer to earning of user
+func addReferEarning(ctx context.Context, logger runtime.Logger, tx *sql.Tx, userId string, data string) error {
+	l := pb.ListRewardRefer{}
+	if err := conf.Unmarshaler.Unmarshal([]byte(data), &l); err != nil {
+		logger.Error("Unmarshal reward refer data of user %s error %s", userId, err.Error())
+		return nil
+	}
+	query := "INSERT INTO " + ReferEarningTableName + " (user_id, invitee_id, earning, update_time) VALUES ($1, $2, $3, now())" +
+		" ON CONFLICT (user_id, invitee_id) DO UPDATE SET earning=" + ReferEarningTableName + ".earning+EXCLUDED.earning, update_time=now()"
+	for _, u := range l.GetUserRefers() {
+		if u.GetEstReward() <= 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, query, userId, u.GetUserId(), u.GetEstReward()); err != nil {
+			logger.Error("Add refer earning user %s invitee %s error %s", userId, u.GetUserId(), err.Error())
+			return status.Error(codes.Internal, "Error add refer earning")
+		}
+	}
+	return nil
+}
+
+// BackfillReferEarning count earning of reward refer sent to wallet before refer_earning exist,
+// safe to run on many nodes, each reward is counted once.
+func BackfillReferEarning(ctx context.Context, logger runtime.Logger, db *sql.DB) error {
+	for {
+		num, err := backfillReferEarningBatch(ctx, logger, db, 100)
+		if err != nil {
+			return err
+		}
+		if num == 0 {
+			return nil
+		}
+	}
+}
+
+func backfillReferEarningBatch(ctx context.Context, logger runtime.Logger, db *sql.DB, limit int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx backfill refer earning error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Error backfill refer earning")
+	}
+	defer tx.Rollback()
+	query := "SELECT id, user_id, COALESCE(data, '') FROM " + RewardReferTableName +
+		" WHERE time_send_to_wallet IS NOT NULL AND NOT earning_counted LIMIT $1 FOR UPDATE SKIP LOCKED"
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		logger.Error("Query reward refer to backfill earning error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Error backfill refer earning")
+	}
+	type reward struct {
+		id     int64
+		userId string
+		data   string
+	}
+	ml := make([]reward, 0)
+	for rows.Next() {
+		r := reward{}
+		if err := rows.Scan(&r.id, &r.userId, &r.data); err != nil {
+			rows.Close()
+			logger.Error("Scan reward refer to backfill earning error %s", err.Error())
+			return 0, status.Error(codes.Internal, "Error backfill refer earning")
+		}
+		ml = append(ml, r)
+	}
+	rows.Close()
+	for _, r := range ml {
+		if err := addReferEarning(ctx, logger, tx, r.userId, r.data); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE "+RewardReferTableName+" SET earning_counted=true WHERE id=$1", r.id); err != nil {
+			logger.Error("Mark reward refer %d earning counted error %s", r.id, err.Error())
+			return 0, status.Error(codes.Internal, "Error backfill refer earning")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit backfill refer earning error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Error backfill refer earning")
+	}
+	return len(ml), nil
+}
@@ -0,0 +1,207 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.user_fingerprint (
+//
+//	user_id character varying(128) NOT NULL,
+//	kind character varying(16) NOT NULL,
+//	value character varying(256) NOT NULL,
+//	first_seen timestamp with time zone NOT NULL DEFAULT now(),
+//	last_seen timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT user_fingerprint_pkey PRIMARY KEY (user_id, kind, value)
+//
+// );
+// CREATE INDEX idx_user_fingerprint_value ON public.user_fingerprint(kind, value);
+const UserFingerprintTableName = "user_fingerprint"
+
+// CREATE TABLE public.refer_review (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	user_id character varying(128) NOT NULL,
+//	reason character varying(32) NOT NULL,
+//	detail jsonb,
+//	status smallint NOT NULL DEFAULT 0,
+//	note text NOT NULL DEFAULT '',
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	update_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+// CREATE INDEX idx_refer_review_user ON public.refer_review(user_id, status);
+const ReferReviewTableName = "refer_review"
+
+// AddUserFingerprint save device, ip, subnet or payment seen of user
+func AddUserFingerprint(ctx context.Context, logger runtime.Logger, db *sql.DB, fingerprints ...*entity.UserFingerprint) error {
+	query := "INSERT INTO " + UserFingerprintTableName + " (user_id, kind, value, first_seen, last_seen) VALUES ($1, $2, $3, now(), now())" +
+		" ON CONFLICT (user_id, kind, value) DO UPDATE SET last_seen=now()"
+	for _, fp := range fingerprints {
+		if fp == nil || fp.UserId == "" || fp.Value == "" {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, query, fp.UserId, fp.Kind, fp.Value); err != nil {
+			logger.Error("Add fingerprint user %s kind %s error %s", fp.UserId, fp.Kind, err.Error())
+			return status.Error(codes.Internal, "Add user fingerprint error")
+		}
+	}
+	return nil
+}
+
+// GetSharedFingerprint fingerprints of kinds both users have
+func GetSharedFingerprint(ctx context.Context, logger runtime.Logger, db *sql.DB, userA, userB string, kinds []string) ([]*entity.UserFingerprint, error) {
+	query := "SELECT a.kind, a.value FROM " + UserFingerprintTableName + " a JOIN " + UserFingerprintTableName + " b" +
+		" ON a.kind=b.kind AND a.value=b.value WHERE a.user_id=$1 AND b.user_id=$2 AND a.kind = ANY($3)"
+	rows, err := db.QueryContext(ctx, query, userA, userB, pq.Array(kinds))
+	if err != nil {
+		logger.Error("Query shared fingerprint %s %s error %s", userA, userB, err.Error())
+		return nil, status.Error(codes.Internal, "Query user fingerprint error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.UserFingerprint, 0)
+	for rows.Next() {
+		fp := &entity.UserFingerprint{UserId: userB}
+		if err := rows.Scan(&fp.Kind, &fp.Value); err != nil {
+			continue
+		}
+		ml = append(ml, fp)
+	}
+	return ml, rows.Err()
+}
+
+// CountInviteeSharedFingerprint number of other invitees of invitor share a fingerprint with invitee, by kind
+func CountInviteeSharedFingerprint(ctx context.Context, logger runtime.Logger, db *sql.DB, invitor, invitee string, kinds []string) (map[string]int64, error) {
+	query := "SELECT f.kind, count(DISTINCT r.user_invitee) FROM " + ReferUserTableName + " r" +
+		" JOIN " + UserFingerprintTableName + " f ON f.user_id=r.user_invitee" +
+		" JOIN " + UserFingerprintTableName + " g ON g.kind=f.kind AND g.value=f.value AND g.user_id=$2" +
+		" WHERE r.user_invitor=$1 AND r.user_invitee<>$2 AND f.kind = ANY($3) GROUP BY f.kind"
+	rows, err := db.QueryContext(ctx, query, invitor, invitee, pq.Array(kinds))
+	if err != nil {
+		logger.Error("Count invitee shared fingerprint %s %s error %s", invitor, invitee, err.Error())
+		return nil, status.Error(codes.Internal, "Query user fingerprint error")
+	}
+	defer rows.Close()
+	ml := make(map[string]int64)
+	for rows.Next() {
+		var kind string
+		var count int64
+		if err := rows.Scan(&kind, &count); err != nil {
+			continue
+		}
+		ml[kind] = count
+	}
+	return ml, rows.Err()
+}
+
+// AddReferReview flag invitor, skip if invitor has a review pending
+func AddReferReview(ctx context.Context, logger runtime.Logger, db *sql.DB, review *entity.ReferReview) error {
+	review.Id = conf.SnowlakeNode.Generate().Int64()
+	review.Status = entity.ReferReviewStatusPending
+	detail, _ := json.Marshal(review.Detail)
+	query := "INSERT INTO " + ReferReviewTableName + " (id, user_id, reason, detail, status, note, create_time, update_time)" +
+		" SELECT $1, $2, $3, $4, $5, '', now(), now()" +
+		" WHERE NOT EXISTS (SELECT 1 FROM " + ReferReviewTableName + " WHERE user_id=$2 AND status=$5)"
+	_, err := db.ExecContext(ctx, query, review.Id, review.UserId, review.Reason, detail, review.Status)
+	if err != nil {
+		logger.Error("Add refer review user %s error %s", review.UserId, err.Error())
+		return status.Error(codes.Internal, "Add refer review error")
+	}
+	return nil
+}
+
+func ListReferReview(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.ReferReviewRequest) ([]*entity.ReferReview, error) {
+	query := "SELECT id, user_id, reason, detail, status, note, create_time, update_time FROM " + ReferReviewTableName + " WHERE true"
+	params := make([]interface{}, 0)
+	if req.Status != nil {
+		params = append(params, *req.Status)
+		query += " AND status=$1"
+	}
+	params = append(params, req.Limit, req.Offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(params)-1, len(params))
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		logger.Error("Query refer review error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Query refer review error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.ReferReview, 0)
+	for rows.Next() {
+		review := &entity.ReferReview{}
+		var detail []byte
+		var createTime, updateTime time.Time
+		if err := rows.Scan(&review.Id, &review.UserId, &review.Reason, &detail, &review.Status, &review.Note, &createTime, &updateTime); err != nil {
+			logger.Error("Scan refer review error %s", err.Error())
+			continue
+		}
+		if len(detail) > 0 {
+			_ = json.Unmarshal(detail, &review.Detail)
+		}
+		review.CreateTimeUnix = createTime.Unix()
+		review.UpdateTimeUnix = updateTime.Unix()
+		ml = append(ml, review)
+	}
+	return ml, rows.Err()
+}
+
+// UpdateReferReviewStatus admin clear (release held reward) or reject (void held reward) a pending review.
+// Reward of period not ended yet when reject is not voided, it is held again if user is flagged again.
+func UpdateReferReviewStatus(ctx context.Context, logger runtime.Logger, db *sql.DB, id int64, reviewStatus int, note string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx update refer review %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Update refer review error")
+	}
+	defer tx.Rollback()
+	var userId string
+	var curStatus int
+	query := "SELECT user_id, status FROM " + ReferReviewTableName + " WHERE id=$1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, id).Scan(&userId, &curStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return status.Error(codes.NotFound, "Refer review not found")
+		}
+		logger.Error("Lock refer review %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Update refer review error")
+	}
+	if curStatus != entity.ReferReviewStatusPending {
+		return status.Error(codes.FailedPrecondition, "Refer review already resolved")
+	}
+	query = "UPDATE " + ReferReviewTableName + " SET status=$1, note=$2, update_time=now() WHERE id=$3"
+	if _, err := tx.ExecContext(ctx, query, reviewStatus, note, id); err != nil {
+		logger.Error("Update refer review %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Update refer review error")
+	}
+	if reviewStatus == entity.ReferReviewStatusRejected {
+		query = "UPDATE " + RewardReferTableName + " SET void_time=now(), update_time=now()" +
+			" WHERE user_id=$1 AND time_send_to_wallet IS NULL AND void_time IS NULL AND to_unix <= $2"
+		if _, err := tx.ExecContext(ctx, query, userId, time.Now().Unix()); err != nil {
+			logger.Error("Void reward refer user %s error %s", userId, err.Error())
+			return status.Error(codes.Internal, "Update refer review error")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit update refer review %d error %s", id, err.Error())
+		return status.Error(codes.Internal, "Update refer review error")
+	}
+	return nil
+}
+
+// HasOpenReferReview user flagged by refer fraud check and not reviewed by admin yet.
+// Rejected review does not flag user, admin add device lock sanction with end time to keep blocking.
+func HasOpenReferReview(ctx context.Context, db *sql.DB, userId string) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM " + ReferReviewTableName + " WHERE user_id=$1 AND status=$2)"
+	err := db.QueryRowContext(ctx, query, userId, entity.ReferReviewStatusPending).Scan(&exists)
+	return exists, err
+}
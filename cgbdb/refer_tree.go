@@ -0,0 +1,77 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// closure table of referuser, one row for each inviter above user up to entity.ReferTreeMaxLevel
+// CREATE TABLE public.refer_tree (
+//
+//	user_id character varying(128) NOT NULL,
+//	ancestor_id character varying(128) NOT NULL,
+//	level integer NOT NULL,
+//	create_time timestamp with time zone NOT NULL DEFAULT now(),
+//	CONSTRAINT refer_tree_pkey PRIMARY KEY (user_id, ancestor_id)
+//
+// );
+// CREATE INDEX idx_refer_tree_ancestor ON public.refer_tree(ancestor_id, level);
+const ReferTreeTableName = "refer_tree"
+
+// addReferTree add invitee under invitor and all ancestors of invitor
+func addReferTree(ctx context.Context, logger runtime.Logger, tx *sql.Tx, invitor, invitee string) error {
+	if invitor == invitee {
+		return status.Error(codes.InvalidArgument, entity.ErrReferCycle.Error())
+	}
+	var numCycle int64
+	err := tx.QueryRowContext(ctx, "SELECT count(*) FROM "+ReferTreeTableName+" WHERE user_id=$1 AND ancestor_id=$2",
+		invitor, invitee).Scan(&numCycle)
+	if err != nil {
+		logger.Error("Check refer tree cycle invitor %s invitee %s error %s", invitor, invitee, err.Error())
+		return status.Error(codes.Internal, "Error add refer tree")
+	}
+	if numCycle > 0 {
+		return status.Error(codes.InvalidArgument, entity.ErrReferCycle.Error())
+	}
+	query := "INSERT INTO " + ReferTreeTableName + " (user_id, ancestor_id, level, create_time)" +
+		" SELECT $1, $2, 1, now()" +
+		" UNION ALL SELECT $1, ancestor_id, level+1, now() FROM " + ReferTreeTableName + " WHERE user_id=$2 AND level < $3" +
+		" ON CONFLICT (user_id, ancestor_id) DO NOTHING"
+	if _, err := tx.ExecContext(ctx, query, invitee, invitor, entity.ReferTreeMaxLevel); err != nil {
+		logger.Error("Add refer tree invitor %s invitee %s error %s", invitor, invitee, err.Error())
+		return status.Error(codes.Internal, "Error add refer tree")
+	}
+	return nil
+}
+
+// ListReferTree users under ancestor up to maxLevel
+func ListReferTree(ctx context.Context, logger runtime.Logger, db *sql.DB, ancestorId string, maxLevel int) ([]*entity.ReferTreeNode, error) {
+	// join time is when invitee enter ref code, tree row of backfill does not have it
+	query := "SELECT t.user_id, t.ancestor_id, t.level, COALESCE(r.create_time, t.create_time) FROM " + ReferTreeTableName + " t" +
+		" LEFT JOIN " + ReferUserTableName + " r ON r.user_invitee=t.user_id" +
+		" WHERE t.ancestor_id=$1 AND t.level <= $2 ORDER BY t.level"
+	rows, err := db.QueryContext(ctx, query, ancestorId, maxLevel)
+	if err != nil {
+		logger.Error("Query refer tree of user %s error %s", ancestorId, err.Error())
+		return nil, status.Error(codes.Internal, "Query refer tree error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.ReferTreeNode, 0)
+	for rows.Next() {
+		node := &entity.ReferTreeNode{}
+		var joinTime time.Time
+		if err := rows.Scan(&node.UserId, &node.AncestorId, &node.Level, &joinTime); err != nil {
+			logger.Error("Scan refer tree error %s", err.Error())
+			continue
+		}
+		node.JoinTimeUnix = joinTime.Unix()
+		ml = append(ml, node)
+	}
+	return ml, rows.Err()
+}
@@ -35,11 +35,19 @@ const ReferUserTableName = "referuser"
 // ADD
 //   CONSTRAINT referuser_pkey PRIMARY KEY (id)
 
+// AddUserRefer save invitor of invitee and refer tree, error if invitee is invitor of invitor
 func AddUserRefer(ctx context.Context, logger runtime.Logger, db *sql.DB, userRefer *pb.ReferUser) (int64, error) {
 	userRefer.Id = conf.SnowlakeNode.Generate().Int64()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx add refer user error %s", err.Error())
+		return 0, status.Error(codes.Internal, "Error add use refer.")
+	}
+	defer tx.Rollback()
 	query := "INSERT INTO " + ReferUserTableName +
-		" (id, user_invitor, user_invitee, create_time, update_time) VALUES ($1, $2, $3, now(), now())"
-	result, err := db.ExecContext(ctx, query,
+		" (id, user_invitor, user_invitee, create_time, update_time) VALUES ($1, $2, $3, now(), now())" +
+		" ON CONFLICT (user_invitee) DO NOTHING"
+	result, err := tx.ExecContext(ctx, query,
 		userRefer.GetId(), userRefer.GetUserInvitor(), userRefer.GetUserInvitee())
 	if err != nil {
 		logger.Error("Error when add new refer user, user invitor: %s, user invitee: %s error %s",
@@ -47,8 +55,26 @@ func AddUserRefer(ctx context.Context, logger runtime.Logger, db *sql.DB, userRe
 		return 0, status.Error(codes.Internal, "Error add use refer.")
 	}
 	if rowsAffectedCount, _ := result.RowsAffected(); rowsAffectedCount != 1 {
-		logger.Error("Did not insert new user refer, user invitor: %s, user invitee: %s",
-			userRefer.GetUserInvitor(), userRefer.GetUserInvitee())
+		// retry of same ref code after refer saved is ok, other invitor is not
+		var id int64
+		var invitor string
+		err := tx.QueryRowContext(ctx, "SELECT id, user_invitor FROM "+ReferUserTableName+" WHERE user_invitee=$1",
+			userRefer.GetUserInvitee()).Scan(&id, &invitor)
+		if err != nil {
+			logger.Error("Query refer of user invitee: %s error %s", userRefer.GetUserInvitee(), err.Error())
+			return 0, status.Error(codes.Internal, "Error add use refer.")
+		}
+		if invitor != userRefer.GetUserInvitor() {
+			return 0, status.Error(codes.AlreadyExists, "User already has invitor")
+		}
+		userRefer.Id = id
+		return id, nil
+	}
+	if err := addReferTree(ctx, logger, tx, userRefer.GetUserInvitor(), userRefer.GetUserInvitee()); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit add refer user error %s", err.Error())
 		return 0, status.Error(codes.Internal, "Error add use refer.")
 	}
 	return userRefer.Id, nil
@@ -3,12 +3,16 @@ package cgbdb
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
 	"github.com/jackc/pgtype"
 	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/constant"
 	"github.com/nk-nigeria/lobby-module/entity"
 	pb "github.com/nk-nigeria/cgp-common/proto"
 	"google.golang.org/grpc/codes"
@@ -42,6 +46,12 @@ import (
 // ADD
 //   CONSTRAINT reward_refer_pkey PRIMARY KEY (id)
 
+// reward of each refer level, {"1": 1000, "2": 300}
+// ALTER TABLE public.reward_refer ADD COLUMN level_rewards jsonb;
+
+// reward forfeited when admin reject refer review of user, never send to wallet
+// ALTER TABLE public.reward_refer ADD COLUMN void_time timestamp with time zone NULL;
+
 const RewardReferTableName = "reward_refer"
 
 func AddOrUpdateIfExistRewardRefer(ctx context.Context, logger runtime.Logger, db *sql.DB, reward *pb.RewardRefer) (int64, error) {
@@ -80,7 +90,7 @@ func UpdateRewardRefer(ctx context.Context, logger runtime.Logger, db *sql.DB, r
 	dbId := conf.SnowlakeNode.Generate().Int64()
 	query := "UPDATE  " + RewardReferTableName +
 		" SET win_amt=$1, reward=$2, reward_lv=$3, reward_rate=$4, data=$5, update_time=now() " +
-		" WHERE user_id=$6 AND from_unix=$7 AND to_unix=$8 AND time_send_to_wallet is null"
+		" WHERE user_id=$6 AND from_unix=$7 AND to_unix=$8 AND time_send_to_wallet is null AND void_time IS NULL"
 	l := pb.ListRewardRefer{
 		UserRefers: reward.UserRefers,
 	}
@@ -195,10 +205,42 @@ func GetHistoryRewardRefer(ctx context.Context, logger runtime.Logger, db *sql.D
 	return ml, nil
 }
 
+// ListRewardReferByUserId reward of user in weeks begin in [from, to], sent to wallet or not
+func ListRewardReferByUserId(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string, from, to int64) ([]*pb.RewardRefer, error) {
+	query := "SELECT id, user_id, win_amt, reward, reward_lv, reward_rate, data, from_unix, to_unix FROM " +
+		RewardReferTableName + " WHERE user_id=$1 AND from_unix >= $2 AND from_unix <= $3 ORDER BY from_unix"
+	rows, err := db.QueryContext(ctx, query, userId, from, to)
+	if err != nil {
+		logger.Error("Query reward refer user %s error %s", userId, err.Error())
+		return nil, status.Error(codes.Internal, "Query reward refer error")
+	}
+	defer rows.Close()
+	ml := make([]*pb.RewardRefer, 0)
+	var dbData string
+	var dbRewardRate float64
+	for rows.Next() {
+		r := &pb.RewardRefer{}
+		if err := rows.Scan(&r.Id, &r.UserId, &r.WinAmt, &r.EstReward, &r.EstRewardLv, &dbRewardRate, &dbData, &r.FromUnix, &r.ToUnix); err != nil {
+			logger.Error("Scan reward refer error %s", err.Error())
+			continue
+		}
+		r.EstRateReward = float32(dbRewardRate)
+		l := pb.ListRewardRefer{}
+		if conf.Unmarshaler.Unmarshal([]byte(dbData), &l) == nil {
+			r.UserRefers = l.GetUserRefers()
+		}
+		ml = append(ml, r)
+	}
+	return ml, rows.Err()
+}
+
+// GetListRewardCompleteReferNotSendToWallet reward of invitor flagged in refer review is held until admin clear
+// or reject it, reward voided by reject is never sent
 func GetListRewardCompleteReferNotSendToWallet(ctx context.Context, logger runtime.Logger, db *sql.DB, limit int64, offset int64) ([]*pb.RewardRefer, error) {
 	query := "SELECT id, user_id, win_amt, reward,reward_lv, reward_rate, data, from_unix, to_unix FROM " +
-		RewardReferTableName + " WHERE time_send_to_wallet IS NULL AND to_unix <= $1 limit $2 offset $3"
-	rows, err := db.QueryContext(ctx, query, time.Now().Unix(), limit, offset)
+		RewardReferTableName + " WHERE time_send_to_wallet IS NULL AND void_time IS NULL AND to_unix <= $1" +
+		" AND user_id NOT IN (SELECT user_id FROM " + ReferReviewTableName + " WHERE status=$4) limit $2 offset $3"
+	rows, err := db.QueryContext(ctx, query, time.Now().Unix(), limit, offset, entity.ReferReviewStatusPending)
 	if err != nil {
 		logger.Error("Query list reward refer not send to wallet err %s", err.Error())
 		return nil, status.Error(codes.Internal, "Query list reward refer not send to wallet error")
@@ -234,7 +276,7 @@ func GetListRewardCompleteReferNotSendToWallet(ctx context.Context, logger runti
 func GetListRewardReferNotComplete(ctx context.Context, logger runtime.Logger, db *sql.DB, limit int64, offset int64) ([]*pb.RewardRefer, error) {
 	_, endLastWeek := entity.RangeLastWeek()
 	query := "SELECT id, user_id, win_amt, reward,reward_lv, reward_rate, data, from_unix, to_unix FROM " +
-		RewardReferTableName + " WHERE time_send_to_wallet IS NULL AND to_unix <= $1 AND update_time < $2 limit $3 offset $4"
+		RewardReferTableName + " WHERE time_send_to_wallet IS NULL AND void_time IS NULL AND to_unix <= $1 AND update_time < $2 limit $3 offset $4"
 	rows, err := db.QueryContext(ctx, query, endLastWeek.Unix(), endLastWeek, limit, offset)
 	if err != nil {
 		logger.Error("Query list reward refer not complete err %s", err.Error())
@@ -271,7 +313,7 @@ func GetListRewardReferNotComplete(ctx context.Context, logger runtime.Logger, d
 func UpdateRewardReferHasSendToWallet(ctx context.Context, logger runtime.Logger, db *sql.DB, rewardReferID int64) error {
 	query := "UPDATE  " + RewardReferTableName +
 		" SET time_send_to_wallet=now() " +
-		" WHERE id=$1 AND time_send_to_wallet is null"
+		" WHERE id=$1 AND time_send_to_wallet is null AND void_time IS NULL"
 	result, err := db.ExecContext(ctx, query,
 		rewardReferID)
 	if err != nil {
@@ -285,3 +327,93 @@ func UpdateRewardReferHasSendToWallet(ctx context.Context, logger runtime.Logger
 	}
 	return nil
 }
+
+// UpdateRewardReferLevel save reward by level of reward not send yet
+func UpdateRewardReferLevel(ctx context.Context, logger runtime.Logger, db *sql.DB, reward *pb.RewardRefer, levelRewards map[int]int64) error {
+	data, _ := json.Marshal(levelRewards)
+	query := "UPDATE " + RewardReferTableName + " SET level_rewards=$1, update_time=now()" +
+		" WHERE user_id=$2 AND from_unix=$3 AND to_unix=$4 AND time_send_to_wallet IS NULL AND void_time IS NULL"
+	_, err := db.ExecContext(ctx, query, data, reward.GetUserId(), reward.GetFromUnix(), reward.GetToUnix())
+	if err != nil {
+		logger.Error("Update level reward refer user %s error %s", reward.GetUserId(), err.Error())
+		return status.Error(codes.Internal, "Error update reward refer user.")
+	}
+	return nil
+}
+
+// ClaimRewardRefer mark reward sent and add one claim outbox for each level in same tx,
+// return nil if reward already sent.
+func ClaimRewardRefer(ctx context.Context, logger runtime.Logger, db *sql.DB, rewardReferID int64) ([]*entity.ClaimOutbox, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Begin tx claim reward refer error %s", err.Error())
+		return nil, status.Error(codes.Internal, "Error claim reward refer")
+	}
+	defer tx.Rollback()
+	var userId string
+	var reward, fromUnix, toUnix int64
+	var dbLevelRewards []byte
+	var dbData string
+	query := "SELECT user_id, reward, from_unix, to_unix, level_rewards, COALESCE(data, '') FROM " + RewardReferTableName +
+		" WHERE id=$1 AND time_send_to_wallet IS NULL AND void_time IS NULL FOR UPDATE"
+	err = tx.QueryRowContext(ctx, query, rewardReferID).Scan(&userId, &reward, &fromUnix, &toUnix, &dbLevelRewards, &dbData)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error("Lock reward refer %d error %s", rewardReferID, err.Error())
+		return nil, status.Error(codes.Internal, "Error claim reward refer")
+	}
+	levelRewards := make(map[int]int64)
+	if len(dbLevelRewards) > 0 {
+		_ = json.Unmarshal(dbLevelRewards, &levelRewards)
+	}
+	// reward est before refer level
+	if len(levelRewards) == 0 {
+		levelRewards[1] = reward
+	}
+	levels := make([]int, 0, len(levelRewards))
+	for level := range levelRewards {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	ml := make([]*entity.ClaimOutbox, 0, len(levels))
+	for _, level := range levels {
+		if levelRewards[level] <= 0 {
+			continue
+		}
+		metadata := make(map[string]interface{})
+		metadata["action"] = entity.WalletActionReferReward
+		metadata["sender"] = constant.UUID_USER_SYSTEM
+		metadata["recv"] = userId
+		metadata["refer_level"] = strconv.Itoa(level)
+		metadata["reward_refer_id"] = strconv.FormatInt(rewardReferID, 10)
+		metadata["from_unix"] = strconv.FormatInt(fromUnix, 10)
+		metadata["to_unix"] = strconv.FormatInt(toUnix, 10)
+		outbox := &entity.ClaimOutbox{
+			UserId:   userId,
+			IdemKey:  entity.ReferRewardClaimKey(rewardReferID, level),
+			Kind:     entity.ClaimOutboxKindRefer,
+			RefId:    rewardReferID,
+			Chips:    levelRewards[level],
+			Metadata: metadata,
+		}
+		if err := addClaimOutbox(ctx, logger, tx, outbox); err != nil {
+			return nil, err
+		}
+		ml = append(ml, outbox)
+	}
+	if err := addReferEarning(ctx, logger, tx, userId, dbData); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE "+RewardReferTableName+" SET time_send_to_wallet=now(), earning_counted=true WHERE id=$1", rewardReferID)
+	if err != nil {
+		logger.Error("Update reward refer %d send to wallet error %s", rewardReferID, err.Error())
+		return nil, status.Error(codes.Internal, "Error claim reward refer")
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Commit claim reward refer %d error %s", rewardReferID, err.Error())
+		return nil, status.Error(codes.Internal, "Error claim reward refer")
+	}
+	return ml, nil
+}
@@ -3,9 +3,17 @@ package cgbdb
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/heroiclabs/nakama-common/runtime"
 	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
 )
 
 type rulesLucky struct {
@@ -29,20 +37,75 @@ func (*rulesLucky) TableName() string {
 	return "rules_lucky"
 }
 
+// rulesLuckyVersion is never updated, Data is json of rulesLucky after change
+type rulesLuckyVersion struct {
+	Id       uint      `gorm:"primarykey" json:"id,omitempty"`
+	RuleId   uint      `json:"rule_id,omitempty"`
+	GameCode string    `json:"game_code,omitempty"`
+	Version  int       `json:"version,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	CreateAt time.Time `json:"create_at,omitempty"`
+}
+
+func (*rulesLuckyVersion) TableName() string {
+	return "rules_lucky_version"
+}
+
 func (r *rulesLucky) Copy(rule *pb.RuleLucky) {
 	r.Id = uint(rule.Id)
 	r.GameCode = rule.GameCode
 	r.EmitEventAtUnix = rule.EmitEventAtUnix
 	r.DeletedAt = rule.DeletedAt
-	r.RtpMax = rule.Rtp.Max
-	r.RtpMin = rule.Rtp.Min
-	r.MarkMin = rule.Mark.Min
-	r.RtpMax = rule.Mark.Max
-	r.VipMin = rule.Vip.Min
-	r.VipMax = rule.Vip.Max
-	r.WinMarkRatioMin = rule.WinMarkRatio.Min
-	r.WinMarkRatioMax = rule.WinMarkRatio.Max
-	r.ReDeal = rule.ReDeal
+	r.copyRange(rule)
+}
+
+// copyRange condition fields of rule, nil range is 0-0
+func (r *rulesLucky) copyRange(rule *pb.RuleLucky) {
+	r.RtpMin = rule.GetRtp().GetMin()
+	r.RtpMax = rule.GetRtp().GetMax()
+	r.MarkMin = rule.GetMark().GetMin()
+	r.MarkMax = rule.GetMark().GetMax()
+	r.VipMin = rule.GetVip().GetMin()
+	r.VipMax = rule.GetVip().GetMax()
+	r.WinMarkRatioMin = rule.GetWinMarkRatio().GetMin()
+	r.WinMarkRatioMax = rule.GetWinMarkRatio().GetMax()
+	r.ReDeal = rule.GetReDeal()
+}
+
+// Validate ranges are half-open [min, max), an empty range never match
+func (r *rulesLucky) Validate() error {
+	if r.RtpMin >= r.RtpMax || r.MarkMin >= r.MarkMax || r.VipMin >= r.VipMax ||
+		r.WinMarkRatioMin >= r.WinMarkRatioMax || r.ReDeal < 0 {
+		return entity.ErrRuleLuckyRange
+	}
+	return nil
+}
+
+// Match user state is in all ranges of rule, ranges are half-open [min, max)
+func (r *rulesLucky) Match(s *entity.LuckyUserState) bool {
+	in := func(v, min, max int64) bool {
+		return v >= min && v < max
+	}
+	return in(s.Rtp, r.RtpMin, r.RtpMax) && in(s.Mark, r.MarkMin, r.MarkMax) &&
+		in(s.Vip, r.VipMin, r.VipMax) && in(s.WinMarkRatio, r.WinMarkRatioMin, r.WinMarkRatioMax)
+}
+
+func (r *rulesLucky) RuleId() int64 {
+	return int64(r.Id)
+}
+
+// Overlap a user state can match both rules, same half-open ranges as Match
+// so rtp 0-50 and 50-100 do not overlap
+func (r *rulesLucky) Overlap(o *rulesLucky) bool {
+	inRange := func(aMin, aMax, bMin, bMax int64) bool {
+		return aMin < bMax && bMin < aMax
+	}
+	return r.GameCode == o.GameCode &&
+		inRange(r.RtpMin, r.RtpMax, o.RtpMin, o.RtpMax) &&
+		inRange(r.MarkMin, r.MarkMax, o.MarkMin, o.MarkMax) &&
+		inRange(r.VipMin, r.VipMax, o.VipMin, o.VipMax) &&
+		inRange(r.WinMarkRatioMin, r.WinMarkRatioMax, o.WinMarkRatioMin, o.WinMarkRatioMax)
 }
 
 func (r *rulesLucky) Trasnfer(rule *pb.RuleLucky) {
@@ -56,41 +119,73 @@ func (r *rulesLucky) Trasnfer(rule *pb.RuleLucky) {
 	rule.WinMarkRatio = &pb.Range{Min: r.WinMarkRatioMin, Max: r.WinMarkRatioMax}
 	rule.ReDeal = r.ReDeal
 }
-func InsertRulesLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) error {
+
+// InsertRulesLucky add rule and its first version, return version id
+func InsertRulesLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) (int64, error) {
 	r := &rulesLucky{}
 	r.Copy(rule)
 	gOrm, err := NewGorm(db)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	r.Id = 0
 	r.CreateAt = time.Now()
 	r.DeletedAt = 0
 	r.EmitEventAtUnix = 1
-	return gOrm.Create(r).Error
+	var version *rulesLuckyVersion
+	err = gOrm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkRulesLuckyOverlap(tx, r, nil); err != nil {
+			return err
+		}
+		if err := tx.Create(r).Error; err != nil {
+			return err
+		}
+		version, err = addRulesLuckyVersion(tx, r, entity.RuleLuckyActionAdd)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	rule.Id = int64(r.Id)
+	return int64(version.Id), nil
 }
 
-func UpdateRulesLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) (*pb.RuleLucky, error) {
+// UpdateRulesLucky update range and re_deal of rule not deleted, return version id
+func UpdateRulesLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) (*pb.RuleLucky, int64, error) {
 	gOrm, err := NewGorm(db)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if rule == nil {
-		return &pb.RuleLucky{}, nil
-	}
-	tx := gOrm.Model(new(rulesLucky)).Where("id = ? and deleted_at = 0", rule.Id).
-		Updates(map[string]interface{}{
-			"rtp_min":            rule.Rtp.Min,
-			"rtp_max":            rule.Rtp.Max,
-			"vip_min":            rule.Vip.Min,
-			"vip_max":            rule.Vip.Max,
-			"mark_min":           rule.Mark.Min,
-			"mark_max":           rule.Mark.Max,
-			"win_mark_ratio_min": rule.WinMarkRatio.Min,
-			"win_mark_ratio_max": rule.WinMarkRatio.Max,
-			"re_deal":            rule.ReDeal,
-			"emit_event_at_unix": 1,
-		})
-	return rule, tx.Error
+		return &pb.RuleLucky{}, 0, nil
+	}
+	var version *rulesLuckyVersion
+	r := &rulesLucky{}
+	err = gOrm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? and deleted_at = 0", rule.Id).Take(r).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return entity.ErrRuleLuckyNotFound
+			}
+			return err
+		}
+		prev := *r
+		r.copyRange(rule)
+		r.EmitEventAtUnix = 1
+		if err := checkRulesLuckyOverlap(tx, r, &prev); err != nil {
+			return err
+		}
+		if err := tx.Save(r).Error; err != nil {
+			return err
+		}
+		version, err = addRulesLuckyVersion(tx, r, entity.RuleLuckyActionUpdate)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	result := &pb.RuleLucky{}
+	r.Trasnfer(result)
+	return result, int64(version.Id), nil
 }
 
 func QueryRulesLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) ([]*pb.RuleLucky, error) {
@@ -134,16 +229,180 @@ func QueryRulesLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) ([]*pb
 	return list, nil
 }
 
-func DeleteRulesLucky(ctx context.Context, db *sql.DB, id int64) error {
+// DeleteRulesLucky soft delete rule, deleted state is kept as a version
+func DeleteRulesLucky(ctx context.Context, db *sql.DB, id int64) (int64, error) {
 	gOrm, err := NewGorm(db)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if id <= 0 {
-		return nil
+		return 0, nil
 	}
-	tx := gOrm.Model(new(rulesLucky)).Where("id=?", id).Updates(map[string]interface{}{"deleted_at": time.Now().Unix(), "emit_event_at_unix": 1})
-	return tx.Error
+	var version *rulesLuckyVersion
+	err = gOrm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		r := &rulesLucky{}
+		if err := tx.Where("id = ? and deleted_at = 0", id).Take(r).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		r.DeletedAt = time.Now().Unix()
+		r.EmitEventAtUnix = 1
+		if err := tx.Save(r).Error; err != nil {
+			return err
+		}
+		version, err = addRulesLuckyVersion(tx, r, entity.RuleLuckyActionDelete)
+		return err
+	})
+	if err != nil || version == nil {
+		return 0, err
+	}
+	return int64(version.Id), nil
+}
+
+// RollbackRulesLucky restore rule to snapshot of version, rollback is also a new version
+func RollbackRulesLucky(ctx context.Context, db *sql.DB, versionId int64) (*pb.RuleLucky, int64, error) {
+	gOrm, err := NewGorm(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	var version *rulesLuckyVersion
+	r := &rulesLucky{}
+	err = gOrm.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		target := &rulesLuckyVersion{}
+		if err := tx.Where("id = ?", versionId).Take(target).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return entity.ErrRuleLuckyVersionNotFound
+			}
+			return err
+		}
+		if err := tx.Where("id = ?", target.RuleId).Take(r).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return entity.ErrRuleLuckyNotFound
+			}
+			return err
+		}
+		snapshot := &rulesLucky{}
+		if err := json.Unmarshal([]byte(target.Data), snapshot); err != nil {
+			return err
+		}
+		var prev *rulesLucky
+		if r.DeletedAt == 0 {
+			current := *r
+			prev = &current
+		}
+		createAt := r.CreateAt
+		*r = *snapshot
+		r.Id = target.RuleId
+		r.GameCode = target.GameCode
+		r.CreateAt = createAt
+		r.EmitEventAtUnix = 1
+		if r.DeletedAt == 0 {
+			if err := checkRulesLuckyOverlap(tx, r, prev); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(r).Error; err != nil {
+			return err
+		}
+		version, err = addRulesLuckyVersion(tx, r, entity.RuleLuckyActionRollback)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	result := &pb.RuleLucky{}
+	r.Trasnfer(result)
+	return result, int64(version.Id), nil
+}
+
+// checkRulesLuckyOverlap validate edited rule and check it with other active rules of game,
+// overlap prev state of rule already had is legacy and does not block the edit.
+// lock game code so concurrent change can not add overlap rules
+func checkRulesLuckyOverlap(tx *gorm.DB, r *rulesLucky, prev *rulesLucky) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "rules_lucky:"+r.GameCode).Error; err != nil {
+		return err
+	}
+	others := make([]rulesLucky, 0)
+	if err := tx.Where("game_code = ? and deleted_at = 0 and id <> ?", r.GameCode, r.Id).Find(&others).Error; err != nil {
+		return err
+	}
+	for _, o := range others {
+		if !r.Overlap(&o) {
+			continue
+		}
+		if prev != nil && prev.Overlap(&o) {
+			continue
+		}
+		return fmt.Errorf("%w, rule id %d", entity.ErrRuleLuckyOverlap, o.Id)
+	}
+	return nil
+}
+
+func addRulesLuckyVersion(tx *gorm.DB, r *rulesLucky, action string) (*rulesLuckyVersion, error) {
+	var last int
+	err := tx.Model(new(rulesLuckyVersion)).Where("rule_id = ?", r.Id).
+		Select("COALESCE(MAX(version), 0)").Scan(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(r)
+	version := &rulesLuckyVersion{
+		RuleId:   r.Id,
+		GameCode: r.GameCode,
+		Version:  last + 1,
+		Action:   action,
+		Data:     string(data),
+		CreateAt: time.Now(),
+	}
+	return version, tx.Create(version).Error
+}
+
+func ListRulesLuckyVersion(ctx context.Context, db *sql.DB, req *entity.RuleLuckyVersionRequest) ([]*entity.RuleLuckyVersion, error) {
+	gOrm, err := NewGorm(db)
+	if err != nil {
+		return nil, err
+	}
+	tx := gOrm.WithContext(ctx).Model(new(rulesLuckyVersion))
+	if req.RuleId > 0 {
+		tx = tx.Where("rule_id = ?", req.RuleId)
+	}
+	if len(req.GameCode) > 0 {
+		tx = tx.Where("game_code = ?", req.GameCode)
+	}
+	ml := make([]rulesLuckyVersion, 0)
+	if err := tx.Order("id DESC").Limit(req.Limit).Offset(req.Offset).Find(&ml).Error; err != nil {
+		return nil, err
+	}
+	list := make([]*entity.RuleLuckyVersion, 0, len(ml))
+	for _, v := range ml {
+		list = append(list, &entity.RuleLuckyVersion{
+			Id:             int64(v.Id),
+			RuleId:         int64(v.RuleId),
+			GameCode:       v.GameCode,
+			Version:        v.Version,
+			Action:         v.Action,
+			Rule:           json.RawMessage(v.Data),
+			CreateTimeUnix: v.CreateAt.Unix(),
+		})
+	}
+	return list, nil
+}
+
+// LatestRulesLuckyVersionId last version of any rule of game, 0 if game has no version
+func LatestRulesLuckyVersionId(ctx context.Context, db *sql.DB, gameCode string) (int64, error) {
+	gOrm, err := NewGorm(db)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = gOrm.WithContext(ctx).Model(new(rulesLuckyVersion)).Where("game_code = ?", gameCode).
+		Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
 }
 
 func UpdateEmitEventLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) error {
@@ -159,3 +418,103 @@ func UpdateEmitEventLucky(ctx context.Context, db *sql.DB, rule *pb.RuleLucky) e
 	return tx.Error
 
 }
+
+// CurrentLuckyRuleMatchers active rules of game as matcher of simulate
+func CurrentLuckyRuleMatchers(ctx context.Context, db *sql.DB, gameCode string) ([]entity.LuckyRuleMatcher, error) {
+	gOrm, err := NewGorm(db)
+	if err != nil {
+		return nil, err
+	}
+	ml := make([]rulesLucky, 0)
+	if err := gOrm.WithContext(ctx).Where("game_code = ? and deleted_at = 0", gameCode).Order("id ASC").Find(&ml).Error; err != nil {
+		return nil, err
+	}
+	list := make([]entity.LuckyRuleMatcher, 0, len(ml))
+	for idx := range ml {
+		list = append(list, &ml[idx])
+	}
+	return list, nil
+}
+
+// CandidateLuckyRuleMatchers validate candidate rules of simulate as rule add or update does,
+// return matchers and pairs of candidate rule ids overlap each other
+func CandidateLuckyRuleMatchers(gameCode string, rules []*entity.LuckyRuleCondition) ([]entity.LuckyRuleMatcher, [][2]int64, error) {
+	ml := make([]*rulesLucky, 0, len(rules))
+	for _, rule := range rules {
+		r := &rulesLucky{
+			GameCode:        gameCode,
+			RtpMin:          rule.Rtp.Min,
+			RtpMax:          rule.Rtp.Max,
+			MarkMin:         rule.Mark.Min,
+			MarkMax:         rule.Mark.Max,
+			VipMin:          rule.Vip.Min,
+			VipMax:          rule.Vip.Max,
+			WinMarkRatioMin: rule.WinMarkRatio.Min,
+			WinMarkRatioMax: rule.WinMarkRatio.Max,
+			ReDeal:          rule.ReDeal,
+		}
+		if err := r.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("%w, rule id %d", err, rule.Id)
+		}
+		ml = append(ml, r)
+	}
+	list := make([]entity.LuckyRuleMatcher, 0, len(ml))
+	overlaps := make([][2]int64, 0)
+	for idx, r := range ml {
+		list = append(list, &candidateLuckyRule{rulesLucky: r, id: rules[idx].Id})
+		for j := idx + 1; j < len(ml); j++ {
+			if r.Overlap(ml[j]) {
+				overlaps = append(overlaps, [2]int64{rules[idx].Id, rules[j].Id})
+			}
+		}
+	}
+	return list, overlaps, nil
+}
+
+// candidateLuckyRule new rule in simulate has negative id, it does not fit id of rulesLucky
+type candidateLuckyRule struct {
+	*rulesLucky
+	id int64
+}
+
+func (c *candidateLuckyRule) RuleId() int64 {
+	return c.id
+}
+
+// SampleLuckyUserStates state of players of game since from, most active by feegame first.
+// bet, win, lost and mark are summed from players of op_match_details,
+// detail is {"players": [{"user_id", "chip", "chip_win", "chip_lost"}]}, mark is mcb of match.
+func SampleLuckyUserStates(ctx context.Context, logger runtime.Logger, db *sql.DB, gameCode string, from time.Time, limit int) ([]*entity.LuckyUserState, error) {
+	query := `WITH active AS (
+		SELECT user_id, count(*) AS num_fee FROM ` + FeeGameTableName + `
+		WHERE game = $1 AND create_time >= $2 GROUP BY user_id ORDER BY num_fee DESC LIMIT $3
+	), played AS (
+		SELECT p->>'user_id' AS user_id, SUM((p->>'chip')::bigint) AS bet, SUM((p->>'chip_win')::bigint) AS win,
+			SUM((p->>'chip_lost')::bigint) AS lost, MAX(d.mcb) AS mark
+		FROM public.op_match_details d,
+			jsonb_array_elements(CASE WHEN jsonb_typeof(d.detail->'players') = 'array' THEN d.detail->'players' ELSE '[]'::jsonb END) p
+		WHERE d.game_name = $1 AND d.date_unix >= $4 AND d.deleted_at IS NULL AND p->>'user_id' IN (SELECT user_id FROM active)
+		GROUP BY p->>'user_id'
+	)
+	SELECT a.user_id, COALESCE(p.bet, 0), COALESCE(p.win, 0), COALESCE(p.lost, 0), COALESCE(p.mark, 0),
+		COALESCE((u.metadata->>'vip_level')::numeric::bigint, 0)
+	FROM active a LEFT JOIN played p ON p.user_id = a.user_id LEFT JOIN public.users u ON u.id::text = a.user_id
+	ORDER BY a.num_fee DESC, a.user_id`
+	rows, err := db.QueryContext(ctx, query, gameCode, from, limit, from.Unix())
+	if err != nil {
+		logger.Error("Query lucky user states game %s error %s", gameCode, err.Error())
+		return nil, status.Error(codes.Internal, "Query user states error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.LuckyUserState, 0)
+	for rows.Next() {
+		var userId string
+		var bet, win, lost, mark, vip int64
+		if err := rows.Scan(&userId, &bet, &win, &lost, &mark, &vip); err != nil {
+			logger.Error("Scan lucky user state error %s", err.Error())
+			continue
+		}
+		ml = append(ml, entity.NewLuckyUserState(userId, bet, win, lost, mark, vip))
+	}
+	return ml, rows.Err()
+}
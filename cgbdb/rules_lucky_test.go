@@ -0,0 +1,146 @@
+package cgbdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRulesLuckyCopy(t *testing.T) {
+	rule := &pb.RuleLucky{
+		Id:              7,
+		GameCode:        "sicbo",
+		EmitEventAtUnix: 11,
+		DeletedAt:       12,
+		Rtp:             &pb.Range{Min: 1, Max: 2},
+		Mark:            &pb.Range{Min: 3, Max: 4},
+		Vip:             &pb.Range{Min: 5, Max: 6},
+		WinMarkRatio:    &pb.Range{Min: 7, Max: 8},
+		ReDeal:          9,
+	}
+	want := rulesLucky{
+		Id:              7,
+		GameCode:        "sicbo",
+		EmitEventAtUnix: 11,
+		DeletedAt:       12,
+		RtpMin:          1,
+		RtpMax:          2,
+		MarkMin:         3,
+		MarkMax:         4,
+		VipMin:          5,
+		VipMax:          6,
+		WinMarkRatioMin: 7,
+		WinMarkRatioMax: 8,
+		ReDeal:          9,
+	}
+	r := rulesLucky{}
+	r.Copy(rule)
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("Copy() = %+v, want %+v", r, want)
+	}
+	back := &pb.RuleLucky{}
+	r.Trasnfer(back)
+	if !proto.Equal(back, rule) {
+		t.Errorf("Trasnfer() = %v, want %v", back, rule)
+	}
+	// nil range is zero
+	r = rulesLucky{}
+	r.Copy(&pb.RuleLucky{GameCode: "sicbo", Rtp: &pb.Range{Min: 1, Max: 2}})
+	if r.RtpMax != 2 || r.MarkMin != 0 || r.MarkMax != 0 {
+		t.Errorf("Copy() nil range = %+v", r)
+	}
+}
+
+func TestRulesLuckyValidateOverlap(t *testing.T) {
+	base := rulesLucky{GameCode: "sicbo", RtpMin: 0, RtpMax: 50, MarkMin: 0, MarkMax: 100,
+		VipMin: 0, VipMax: 5, WinMarkRatioMin: 0, WinMarkRatioMax: 10}
+	tests := []struct {
+		name        string
+		modify      func(r *rulesLucky)
+		wantErr     error
+		wantOverlap bool
+	}{
+		{"same ranges", func(r *rulesLucky) {}, nil, true},
+		{"inside rtp", func(r *rulesLucky) { r.RtpMin, r.RtpMax = 49, 80 }, nil, true},
+		{"contiguous rtp", func(r *rulesLucky) { r.RtpMin, r.RtpMax = 50, 80 }, nil, false},
+		{"contiguous vip", func(r *rulesLucky) { r.VipMin, r.VipMax = 5, 10 }, nil, false},
+		{"contiguous win mark ratio", func(r *rulesLucky) { r.WinMarkRatioMin, r.WinMarkRatioMax = 10, 20 }, nil, false},
+		{"other game", func(r *rulesLucky) { r.GameCode = "baccarat" }, nil, false},
+		{"mark min greater max", func(r *rulesLucky) { r.MarkMin, r.MarkMax = 10, 5 }, entity.ErrRuleLuckyRange, false},
+		{"empty vip range", func(r *rulesLucky) { r.VipMin, r.VipMax = 0, 0 }, entity.ErrRuleLuckyRange, false},
+		{"negative re deal", func(r *rulesLucky) { r.ReDeal = -1 }, entity.ErrRuleLuckyRange, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := base
+			tt.modify(&r)
+			if err := r.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if got := r.Overlap(&base); got != tt.wantOverlap {
+					t.Errorf("Overlap() = %v, want %v", got, tt.wantOverlap)
+				}
+			}
+		})
+	}
+}
+
+func TestRulesLuckyMatch(t *testing.T) {
+	low := rulesLucky{GameCode: "sicbo", RtpMin: 0, RtpMax: 50, MarkMin: 0, MarkMax: 100,
+		VipMin: 0, VipMax: 5, WinMarkRatioMin: -10, WinMarkRatioMax: 10}
+	high := low
+	high.RtpMin, high.RtpMax = 50, 100
+	tests := []struct {
+		rtp      int64
+		wantLow  bool
+		wantHigh bool
+	}{
+		{0, true, false},
+		{49, true, false},
+		{50, false, true},
+		{99, false, true},
+		{100, false, false},
+	}
+	for _, tt := range tests {
+		s := &entity.LuckyUserState{Rtp: tt.rtp, Mark: 10, Vip: 1}
+		if got := low.Match(s); got != tt.wantLow {
+			t.Errorf("low.Match(rtp %d) = %v, want %v", tt.rtp, got, tt.wantLow)
+		}
+		if got := high.Match(s); got != tt.wantHigh {
+			t.Errorf("high.Match(rtp %d) = %v, want %v", tt.rtp, got, tt.wantHigh)
+		}
+	}
+	// contiguous rules never match the same state so they must not overlap
+	if low.Overlap(&high) {
+		t.Errorf("Overlap() contiguous = true, want false")
+	}
+}
+
+func TestCandidateLuckyRuleMatchers(t *testing.T) {
+	all := entity.LuckyRange{Min: 0, Max: 1000}
+	rules := []*entity.LuckyRuleCondition{
+		{Id: 1, Rtp: entity.LuckyRange{Min: 0, Max: 50}, Mark: all, Vip: all, WinMarkRatio: all},
+		{Id: -2, Rtp: entity.LuckyRange{Min: 50, Max: 100}, Mark: all, Vip: all, WinMarkRatio: all},
+		{Id: -3, Rtp: entity.LuckyRange{Min: 40, Max: 60}, Mark: all, Vip: all, WinMarkRatio: all},
+	}
+	matchers, overlaps, err := CandidateLuckyRuleMatchers("sicbo", rules)
+	if err != nil {
+		t.Fatalf("CandidateLuckyRuleMatchers() error = %v", err)
+	}
+	if len(matchers) != 3 || matchers[1].RuleId() != -2 || !matchers[1].Match(&entity.LuckyUserState{Rtp: 50}) {
+		t.Errorf("CandidateLuckyRuleMatchers() matchers = %v", matchers)
+	}
+	want := [][2]int64{{1, -3}, {-2, -3}}
+	if !reflect.DeepEqual(overlaps, want) {
+		t.Errorf("CandidateLuckyRuleMatchers() overlaps = %v, want %v", overlaps, want)
+	}
+	rules[2].Vip = entity.LuckyRange{Min: 5, Max: 5}
+	if _, _, err := CandidateLuckyRuleMatchers("sicbo", rules); !errors.Is(err, entity.ErrRuleLuckyRange) {
+		t.Errorf("CandidateLuckyRuleMatchers() invalid error = %v, want %v", err, entity.ErrRuleLuckyRange)
+	}
+}
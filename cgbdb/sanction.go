@@ -0,0 +1,154 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/nk-nigeria/lobby-module/conf"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE TABLE public.user_sanction (
+//
+//	id bigint NOT NULL PRIMARY KEY,
+//	user_id character varying(128) NOT NULL,
+//	kind character varying(16) NOT NULL,
+//	reason character varying(256) NOT NULL,
+//	issuer character varying(128) NOT NULL DEFAULT '',
+//	start_time timestamp with time zone NOT NULL DEFAULT now(),
+//	end_time timestamp with time zone,
+//	lift_time timestamp with time zone,
+//	lift_by character varying(128) NOT NULL DEFAULT '',
+//	create_time timestamp with time zone NOT NULL DEFAULT now()
+//
+// );
+// CREATE INDEX idx_user_sanction_user ON public.user_sanction(user_id, kind) WHERE lift_time IS NULL;
+const UserSanctionTableName = "user_sanction"
+
+const sanctionColumns = "id, user_id, kind, reason, issuer, start_time, end_time, lift_time, lift_by, create_time"
+
+// sanction is active if not lifted, started and not ended
+const sanctionActiveCond = "lift_time IS NULL AND start_time <= now() AND (end_time IS NULL OR end_time > now())"
+
+func scanSanction(rows interface{ Scan(dest ...any) error }) (*entity.Sanction, error) {
+	s := &entity.Sanction{}
+	var dbStartTime, dbCreateTime time.Time
+	var dbEndTime, dbLiftTime sql.NullTime
+	err := rows.Scan(&s.Id, &s.UserId, &s.Kind, &s.Reason, &s.Issuer,
+		&dbStartTime, &dbEndTime, &dbLiftTime, &s.LiftBy, &dbCreateTime)
+	if err != nil {
+		return nil, err
+	}
+	s.StartTimeUnix = dbStartTime.Unix()
+	if dbEndTime.Valid {
+		s.EndTimeUnix = dbEndTime.Time.Unix()
+	}
+	if dbLiftTime.Valid {
+		s.LiftTimeUnix = dbLiftTime.Time.Unix()
+	}
+	s.CreateTimeUnix = dbCreateTime.Unix()
+	return s, nil
+}
+
+func AddSanction(ctx context.Context, logger runtime.Logger, db *sql.DB, s *entity.Sanction) error {
+	s.Id = conf.SnowlakeNode.Generate().Int64()
+	var endTime interface{}
+	if s.EndTimeUnix > 0 {
+		endTime = time.Unix(s.EndTimeUnix, 0)
+	}
+	query := "INSERT INTO " + UserSanctionTableName +
+		" (id, user_id, kind, reason, issuer, start_time, end_time, create_time) VALUES ($1, $2, $3, $4, $5, $6, $7, now())"
+	_, err := db.ExecContext(ctx, query, s.Id, s.UserId, s.Kind, s.Reason, s.Issuer, time.Unix(s.StartTimeUnix, 0), endTime)
+	if err != nil {
+		logger.Error("Add sanction %s user %s error %s", s.Kind, s.UserId, err.Error())
+		return status.Error(codes.Internal, "Add sanction error")
+	}
+	s.CreateTimeUnix = time.Now().Unix()
+	return nil
+}
+
+// LiftSanction lift sanction by id, or all active sanctions of kind on user. Return number lifted.
+func LiftSanction(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.SanctionLiftRequest) (int64, error) {
+	var result sql.Result
+	var err error
+	if req.Id > 0 {
+		query := "UPDATE " + UserSanctionTableName + " SET lift_time=now(), lift_by=$1 WHERE id=$2 AND lift_time IS NULL"
+		result, err = db.ExecContext(ctx, query, req.LiftBy, req.Id)
+	} else {
+		query := "UPDATE " + UserSanctionTableName + " SET lift_time=now(), lift_by=$1 WHERE user_id=$2 AND kind=$3 AND " + sanctionActiveCond
+		result, err = db.ExecContext(ctx, query, req.LiftBy, req.UserId, req.Kind)
+	}
+	if err != nil {
+		logger.Error("Lift sanction id %d user %s kind %s error %s", req.Id, req.UserId, req.Kind, err.Error())
+		return 0, status.Error(codes.Internal, "Lift sanction error")
+	}
+	count, _ := result.RowsAffected()
+	return count, nil
+}
+
+// GetActiveSanction active sanction of kind on user which end last, nil if user is not sanctioned
+func GetActiveSanction(ctx context.Context, db *sql.DB, userId, kind string) (*entity.Sanction, error) {
+	if userId == "" {
+		return nil, nil
+	}
+	query := "SELECT " + sanctionColumns + " FROM " + UserSanctionTableName +
+		" WHERE user_id=$1 AND kind=$2 AND " + sanctionActiveCond +
+		" ORDER BY end_time DESC NULLS FIRST LIMIT 1"
+	s, err := scanSanction(db.QueryRowContext(ctx, query, userId, kind))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Query sanction error")
+	}
+	return s, nil
+}
+
+func ListSanction(ctx context.Context, logger runtime.Logger, db *sql.DB, req *entity.SanctionListRequest) ([]*entity.Sanction, error) {
+	query := "SELECT " + sanctionColumns + " FROM " + UserSanctionTableName + " WHERE 1=1"
+	args := make([]interface{}, 0)
+	if req.UserId != "" {
+		args = append(args, req.UserId)
+		query += " AND user_id=$" + strconv.Itoa(len(args))
+	}
+	if req.Kind != "" {
+		args = append(args, req.Kind)
+		query += " AND kind=$" + strconv.Itoa(len(args))
+	}
+	if req.ActiveOnly {
+		query += " AND " + sanctionActiveCond
+	}
+	args = append(args, req.Limit, req.Offset)
+	query += " ORDER BY create_time DESC LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Error("List sanction error %s", err.Error())
+		return nil, status.Error(codes.Internal, "List sanction error")
+	}
+	defer rows.Close()
+	ml := make([]*entity.Sanction, 0)
+	for rows.Next() {
+		s, err := scanSanction(rows)
+		if err != nil {
+			logger.Error("Scan sanction error %s", err.Error())
+			continue
+		}
+		ml = append(ml, s)
+	}
+	return ml, rows.Err()
+}
+
+// GetUserIdByDevice user linked to device id, empty if device not linked
+func GetUserIdByDevice(ctx context.Context, db *sql.DB, deviceId string) (string, error) {
+	var userId string
+	err := db.QueryRowContext(ctx, "SELECT user_id FROM user_device WHERE id=$1", deviceId).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userId, err
+}
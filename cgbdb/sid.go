@@ -0,0 +1,140 @@
+package cgbdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+	"github.com/lib/pq"
+	"github.com/nk-nigeria/lobby-module/entity"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CREATE SEQUENCE users_ext_sid_counter_seq MINVALUE 0 START 0;
+// CREATE UNIQUE INDEX users_ext_sid_key ON public.users_ext(sid);
+const SidCounterSeqName = "users_ext_sid_counter_seq"
+
+const sidAllocateAttempts = 3
+
+// AllocateSid next sid from counter sequence, unique unless sequence is reset
+func AllocateSid(ctx context.Context, db *sql.DB) (int64, error) {
+	var counter int64
+	if err := db.QueryRowContext(ctx, "SELECT nextval('"+SidCounterSeqName+"')").Scan(&counter); err != nil {
+		return 0, err
+	}
+	return entity.EncodeSid(counter)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// AddUserSid create users_ext of user with new sid, do nothing if user already has one.
+// Sid taken by a row not from allocator (unique violation) is retried with next sid.
+func AddUserSid(ctx context.Context, logger runtime.Logger, db *sql.DB, userId string) error {
+	for attempt := 0; attempt < sidAllocateAttempts; attempt++ {
+		sid, err := AllocateSid(ctx, db)
+		if err != nil {
+			logger.Error("Allocate sid user %s error %s", userId, err.Error())
+			return status.Error(codes.Internal, "Allocate sid error")
+		}
+		_, err = db.ExecContext(ctx, "INSERT INTO users_ext (id, sid) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING", userId, sid)
+		if err == nil {
+			return nil
+		}
+		if !isUniqueViolation(err) {
+			logger.Error("Insert users_ext user %s error %s", userId, err.Error())
+			return status.Error(codes.Internal, "Insert users_ext error")
+		}
+		logger.Warn("Sid %d already used, retry user %s", sid, userId)
+	}
+	return status.Error(codes.Internal, "Allocate sid error")
+}
+
+// RepairUserSid give new sid to users share sid with other, user created first keep the sid.
+// Rows of deleted users (users_ext created without foreign key) are removed first so their sid
+// does not block the index. Unique index is created after repair so sid lookup always resolve
+// to one user, error if index can not be created or is left invalid.
+func RepairUserSid(ctx context.Context, logger runtime.Logger, db *sql.DB) error {
+	res, err := db.ExecContext(ctx, "DELETE FROM users_ext ue WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = ue.id)")
+	if err != nil {
+		logger.Error("Delete users_ext of deleted users error %s", err.Error())
+		return err
+	}
+	if num, _ := res.RowsAffected(); num > 0 {
+		logger.Info("Delete %d users_ext of deleted users", num)
+	}
+	query := `SELECT ue.id, ue.sid FROM users_ext ue LEFT JOIN users u ON u.id = ue.id
+WHERE ue.sid IN (SELECT sid FROM users_ext WHERE sid IS NOT NULL GROUP BY sid HAVING count(*) > 1)
+ORDER BY ue.sid, u.create_time NULLS LAST, ue.id`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		logger.Error("Query duplicate sid error %s", err.Error())
+		return err
+	}
+	type userSid struct {
+		id  string
+		sid int64
+	}
+	moves := make([]userSid, 0)
+	lastSid := int64(-1)
+	for rows.Next() {
+		var u userSid
+		if err := rows.Scan(&u.id, &u.sid); err != nil {
+			continue
+		}
+		if u.sid != lastSid {
+			// first user of sid keep it
+			lastSid = u.sid
+			continue
+		}
+		moves = append(moves, u)
+	}
+	rows.Close()
+	for _, u := range moves {
+		var newSid int64
+		used := true
+		for attempt := 0; attempt < sidAllocateAttempts && used; attempt++ {
+			newSid, err = AllocateSid(ctx, db)
+			if err == nil {
+				err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users_ext WHERE sid = $1)", newSid).Scan(&used)
+			}
+			if err != nil {
+				logger.Error("Allocate sid to repair user %s error %s", u.id, err.Error())
+				return err
+			}
+		}
+		if used {
+			return status.Error(codes.Internal, "Allocate sid error")
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE users_ext SET sid = $1 WHERE id = $2 AND sid = $3", newSid, u.id, u.sid); err != nil {
+			logger.Error("Repair sid user %s error %s", u.id, err.Error())
+			return err
+		}
+		logger.Info("Repair duplicate sid user %s: %d -> %d", u.id, u.sid, newSid)
+	}
+	ctx2, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if _, err := db.ExecContext(ctx2, "CREATE UNIQUE INDEX IF NOT EXISTS users_ext_sid_key ON public.users_ext(sid)"); err != nil {
+		logger.Error("Create unique sid index error %s", err.Error())
+		return err
+	}
+	// index of same name left by failed build is skipped by IF NOT EXISTS
+	var valid bool
+	query = "SELECT indisunique AND indisvalid FROM pg_index WHERE indexrelid = 'public.users_ext_sid_key'::regclass"
+	if err := db.QueryRowContext(ctx, query).Scan(&valid); err != nil {
+		logger.Error("Check unique sid index error %s", err.Error())
+		return err
+	}
+	if !valid {
+		return errors.New("index users_ext_sid_key is not a valid unique index, drop it and restart")
+	}
+	if len(moves) > 0 {
+		logger.Info("Repair %d duplicate sid done", len(moves))
+	}
+	return nil
+}
@@ -211,6 +211,29 @@ WHERE u.id::text IN (` + "'" + strings.Join(userIds, "','") + "'" + `)`
 	return ml, nil
 }
 
+// GetSidsByUserIds return map user id -> sid
+func GetSidsByUserIds(ctx context.Context, db *sql.DB, userIds ...string) (map[string]int64, error) {
+	ml := make(map[string]int64, len(userIds))
+	if len(userIds) == 0 {
+		return ml, nil
+	}
+	query := `SELECT ue.id, ue.sid FROM users_ext ue WHERE ue.id::text IN (` + "'" + strings.Join(userIds, "','") + "'" + `)`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var sid int64
+		if err := rows.Scan(&id, &sid); err != nil {
+			continue
+		}
+		ml[id] = sid
+	}
+	return ml, rows.Err()
+}
+
 func GetProfileUser(ctx context.Context, db *sql.DB, userID string, objStorage objectstorage.ObjStorage) (*pb.Profile, map[string]interface{}, error) {
 	// account, err := nk.AccountGetId(ctx, userID)
 	account, err := GetAccount(ctx, db, userID, 0)
@@ -104,11 +104,7 @@ func GetUserGroupUserInfo(ctx context.Context, logger runtime.Logger, db *sql.DB
 	if err := json.Unmarshal([]byte(account.User.GetMetadata()), &metadata); err != nil {
 		return result, errors.New("Corrupted user metadata.")
 	}
-	var level int64 = 0
-	if levelStr, ok := metadata["level"]; ok {
-		level = levelStr.(int64)
-	}
-	result.Level = level
+	result.Level = entity.ToInt64(metadata["level"], 0)
 
 	result.VipLevel = entity.ToInt64(metadata["vip_level"], 0)
 
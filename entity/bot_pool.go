@@ -0,0 +1,292 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	BotStatusIdle    = 0
+	BotStatusLeased  = 1
+	BotStatusRetired = 2
+)
+
+const (
+	BotPoolMaxCreate      = 1000
+	BotPoolDefaultLimit   = 100
+	BotPoolMaxLimit       = 1000
+	BotPoolDefaultAvatars = 12
+	BotPoolDefaultVipMax  = 3
+	// lease is released if match module does not return or renew before it expire
+	BotLeaseDefaultTtlSec = 1800
+	BotLeaseMaxTtlSec     = 6 * 3600
+	BotLeaseMaxCount      = 10
+)
+
+var (
+	ErrBotPoolGameCode = errors.New("game_code is required")
+	ErrBotPoolCount    = errors.New("count must be in 1-1000")
+	ErrBotPoolVip      = errors.New("vip_min must not be greater than vip_max")
+	ErrBotLeaseMatchId = errors.New("match_id is required")
+	ErrBotLeaseCount   = errors.New("count must be in 1-10")
+	ErrBotLeaseEmpty   = errors.New("no idle bot in pool of game")
+)
+
+var botFirstNames = []string{
+	"Agus", "Budi", "Dewi", "Eko", "Fajar", "Gita", "Hendra", "Indah", "Joko", "Kartika",
+	"Lestari", "Made", "Nur", "Oka", "Putri", "Rizky", "Sari", "Teguh", "Wahyu", "Yanti",
+	"Adi", "Bayu", "Citra", "Dimas", "Endang", "Farhan", "Galih", "Hadi", "Intan", "Yoga",
+}
+
+var botLastNames = []string{
+	"Santoso", "Wijaya", "Saputra", "Pratama", "Hidayat", "Kusuma", "Nugroho", "Siregar",
+	"Lubis", "Setiawan", "Gunawan", "Halim", "Purnomo", "Susanto", "Utami", "Rahman",
+}
+
+// PoolBot bot account in pool of a game, lease_id and match_id are set while it is leased
+type PoolBot struct {
+	UserId          string `json:"user_id"`
+	UserName        string `json:"user_name"`
+	DisplayName     string `json:"display_name"`
+	AvatarId        string `json:"avatar_id"`
+	VipLevel        int64  `json:"vip_level"`
+	Level           int64  `json:"level"`
+	GameCode        string `json:"game_code"`
+	Status          int    `json:"status"`
+	LeaseId         string `json:"lease_id,omitempty"`
+	MatchId         string `json:"match_id,omitempty"`
+	LeaseExpireUnix int64  `json:"lease_expire_unix,omitempty"`
+	CreateTimeUnix  int64  `json:"create_time_unix"`
+	UpdateTimeUnix  int64  `json:"update_time_unix"`
+}
+
+func (b *PoolBot) Metadata() map[string]interface{} {
+	return map[string]interface{}{
+		"bot":       "true",
+		"avatar_id": b.AvatarId,
+		"vip_level": b.VipLevel,
+		"level":     b.Level,
+	}
+}
+
+type BotPoolCreateRequest struct {
+	GameCode string `json:"game_code"`
+	Count    int    `json:"count"`
+	VipMin   int64  `json:"vip_min"`
+	VipMax   int64  `json:"vip_max"`
+	// avatar id to pick, empty is 1 to BotPoolDefaultAvatars
+	AvatarIds []string `json:"avatar_ids"`
+}
+
+func (r *BotPoolCreateRequest) Normalize() error {
+	if r.GameCode == "" {
+		return ErrBotPoolGameCode
+	}
+	if r.Count <= 0 || r.Count > BotPoolMaxCreate {
+		return ErrBotPoolCount
+	}
+	if r.VipMin == 0 && r.VipMax == 0 {
+		r.VipMax = BotPoolDefaultVipMax
+	}
+	if r.VipMin < 0 || r.VipMin > r.VipMax {
+		return ErrBotPoolVip
+	}
+	if len(r.AvatarIds) == 0 {
+		for i := 1; i <= BotPoolDefaultAvatars; i++ {
+			r.AvatarIds = append(r.AvatarIds, strconv.Itoa(i))
+		}
+	}
+	return nil
+}
+
+// NewPoolBot generate name, avatar and vip/level of a bot,
+// low vip is more common like real players, level grow with vip
+func NewPoolBot(rng *rand.Rand, req *BotPoolCreateRequest) *PoolBot {
+	first := botFirstNames[rng.Intn(len(botFirstNames))]
+	last := botLastNames[rng.Intn(len(botLastNames))]
+	bot := &PoolBot{
+		GameCode: req.GameCode,
+		AvatarId: req.AvatarIds[rng.Intn(len(req.AvatarIds))],
+		UserName: fmt.Sprintf("%s%s%04d", strings.ToLower(first), strings.ToLower(last[:1]), rng.Intn(10000)),
+	}
+	switch rng.Intn(3) {
+	case 0:
+		bot.DisplayName = first + " " + last
+	case 1:
+		bot.DisplayName = first
+	default:
+		bot.DisplayName = fmt.Sprintf("%s%d", strings.ToLower(first), 1+rng.Intn(99))
+	}
+	total := int64(0)
+	for v := req.VipMin; v <= req.VipMax; v++ {
+		total += req.VipMax - v + 1
+	}
+	pick := rng.Int63n(total)
+	for v := req.VipMin; v <= req.VipMax; v++ {
+		pick -= req.VipMax - v + 1
+		if pick < 0 {
+			bot.VipLevel = v
+			break
+		}
+	}
+	bot.Level = 1 + bot.VipLevel*5 + rng.Int63n(10)
+	return bot
+}
+
+type BotPoolListRequest struct {
+	GameCode string `json:"game_code"`
+	Status   *int   `json:"status"`
+	Limit    int64  `json:"limit"`
+	Offset   int64  `json:"offset"`
+}
+
+// BotPoolStat number of bots of game by status
+type BotPoolStat struct {
+	GameCode string `json:"game_code"`
+	Idle     int    `json:"idle"`
+	Leased   int    `json:"leased"`
+	Retired  int    `json:"retired"`
+}
+
+func (s *BotPoolStat) Active() int {
+	return s.Idle + s.Leased
+}
+
+type ListPoolBot struct {
+	Bots  []*PoolBot     `json:"bots"`
+	Stats []*BotPoolStat `json:"stats"`
+}
+
+type BotPoolRetireRequest struct {
+	UserIds []string `json:"user_ids"`
+	// retire count idle bots of game when user_ids is empty
+	GameCode string `json:"game_code"`
+	Count    int    `json:"count"`
+}
+
+type BotPoolRebalanceRequest struct {
+	// wanted number of active bots per game, game not in targets is not touched
+	Targets map[string]int `json:"targets"`
+	DryRun  bool           `json:"dry_run"`
+}
+
+type BotMove struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+type BotPoolRebalanceResult struct {
+	Moves []*BotMove `json:"moves"`
+	// number of bots game still need after moves, create more bots for it
+	Shortfall map[string]int `json:"shortfall"`
+}
+
+// PlanBotRebalance move idle bots from game over target to game under target,
+// leased bots are not moved so a game can not give more than its idle bots
+func PlanBotRebalance(stats []*BotPoolStat, targets map[string]int) *BotPoolRebalanceResult {
+	result := &BotPoolRebalanceResult{Moves: make([]*BotMove, 0), Shortfall: make(map[string]int)}
+	mapStat := make(map[string]*BotPoolStat)
+	for _, s := range stats {
+		mapStat[s.GameCode] = s
+	}
+	games := make([]string, 0, len(targets))
+	for game := range targets {
+		games = append(games, game)
+	}
+	sort.Strings(games)
+	type slot struct {
+		game  string
+		count int
+	}
+	surplus, deficit := make([]*slot, 0), make([]*slot, 0)
+	for _, game := range games {
+		active, idle := 0, 0
+		if s, exist := mapStat[game]; exist {
+			active, idle = s.Active(), s.Idle
+		}
+		diff := active - targets[game]
+		switch {
+		case diff > 0:
+			if diff > idle {
+				diff = idle
+			}
+			if diff > 0 {
+				surplus = append(surplus, &slot{game, diff})
+			}
+		case diff < 0:
+			deficit = append(deficit, &slot{game, -diff})
+		}
+	}
+	for _, d := range deficit {
+		for _, s := range surplus {
+			if d.count == 0 {
+				break
+			}
+			n := s.count
+			if n > d.count {
+				n = d.count
+			}
+			if n == 0 {
+				continue
+			}
+			result.Moves = append(result.Moves, &BotMove{From: s.game, To: d.game, Count: n})
+			s.count -= n
+			d.count -= n
+		}
+		if d.count > 0 {
+			result.Shortfall[d.game] = d.count
+		}
+	}
+	return result
+}
+
+// BotLeaseRequest match module lease bots of game for a match, renew or return them by lease_id
+type BotLeaseRequest struct {
+	GameCode string `json:"game_code"`
+	MatchId  string `json:"match_id"`
+	Count    int    `json:"count"`
+	VipMin   *int64 `json:"vip_min"`
+	VipMax   *int64 `json:"vip_max"`
+	TtlSec   int    `json:"ttl_sec"`
+	LeaseId  string `json:"lease_id"`
+	// return only these bots of lease, empty is all
+	UserIds []string `json:"user_ids"`
+}
+
+func (r *BotLeaseRequest) NormalizeTtl() {
+	if r.TtlSec <= 0 {
+		r.TtlSec = BotLeaseDefaultTtlSec
+	}
+	if r.TtlSec > BotLeaseMaxTtlSec {
+		r.TtlSec = BotLeaseMaxTtlSec
+	}
+}
+
+func (r *BotLeaseRequest) Normalize() error {
+	if r.GameCode == "" {
+		return ErrBotPoolGameCode
+	}
+	if r.MatchId == "" {
+		return ErrBotLeaseMatchId
+	}
+	if r.Count == 0 {
+		r.Count = 1
+	}
+	if r.Count < 0 || r.Count > BotLeaseMaxCount {
+		return ErrBotLeaseCount
+	}
+	r.NormalizeTtl()
+	return nil
+}
+
+type BotLease struct {
+	LeaseId         string     `json:"lease_id"`
+	MatchId         string     `json:"match_id"`
+	LeaseExpireUnix int64      `json:"lease_expire_unix"`
+	Bots            []*PoolBot `json:"bots"`
+}
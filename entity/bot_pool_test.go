@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestPlanBotRebalance(t *testing.T) {
+	stats := []*BotPoolStat{
+		{GameCode: "sicbo", Idle: 30, Leased: 10},
+		{GameCode: "baccarat", Idle: 5, Leased: 20},
+		{GameCode: "whot", Idle: 2},
+	}
+	tests := []struct {
+		name      string
+		targets   map[string]int
+		moves     []*BotMove
+		shortfall map[string]int
+	}{
+		{"balanced", map[string]int{"sicbo": 40, "baccarat": 25}, []*BotMove{}, map[string]int{}},
+		{"move surplus", map[string]int{"sicbo": 20, "whot": 12},
+			[]*BotMove{{From: "sicbo", To: "whot", Count: 10}}, map[string]int{}},
+		{"leased bots are not moved", map[string]int{"baccarat": 0, "whot": 10},
+			[]*BotMove{{From: "baccarat", To: "whot", Count: 5}}, map[string]int{"whot": 3}},
+		{"new game", map[string]int{"sicbo": 35, "baccarat": 20, "domino": 15},
+			[]*BotMove{{From: "baccarat", To: "domino", Count: 5}, {From: "sicbo", To: "domino", Count: 5}},
+			map[string]int{"domino": 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PlanBotRebalance(stats, tt.targets)
+			if !reflect.DeepEqual(got.Moves, tt.moves) {
+				t.Errorf("moves = %v, want %v", got.Moves, tt.moves)
+			}
+			if !reflect.DeepEqual(got.Shortfall, tt.shortfall) {
+				t.Errorf("shortfall = %v, want %v", got.Shortfall, tt.shortfall)
+			}
+		})
+	}
+}
+
+func TestNewPoolBot(t *testing.T) {
+	req := &BotPoolCreateRequest{GameCode: "sicbo", Count: 10, VipMin: 1, VipMax: 4}
+	if err := req.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	vips := make(map[int64]int)
+	for i := 0; i < 1000; i++ {
+		bot := NewPoolBot(rng, req)
+		if bot.VipLevel < 1 || bot.VipLevel > 4 {
+			t.Fatalf("vip %d out of range", bot.VipLevel)
+		}
+		if bot.UserName == "" || bot.DisplayName == "" || bot.AvatarId == "" {
+			t.Fatalf("bot %+v missing name or avatar", bot)
+		}
+		vips[bot.VipLevel]++
+	}
+	if vips[1] <= vips[4] {
+		t.Errorf("low vip should be more common, got %v", vips)
+	}
+	if err := (&BotPoolCreateRequest{GameCode: "sicbo", Count: 1, VipMin: 3, VipMax: 1}).Normalize(); err != ErrBotPoolVip {
+		t.Errorf("Normalize() = %v, want %v", err, ErrBotPoolVip)
+	}
+}
@@ -0,0 +1,65 @@
+package entity
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	ClaimOutboxStatusPending = 0
+	ClaimOutboxStatusDone    = 1
+	ClaimOutboxStatusFailed  = 2
+)
+
+const (
+	ClaimOutboxKindFreeChip = "freechip"
+	ClaimOutboxKindGiftCode = "giftcode"
+	ClaimOutboxKindPlaytime = "playtime"
+	ClaimOutboxKindRefer    = "refer_reward"
+	// daily reward claim, key is day and number of claim in day
+	ClaimOutboxKindDailyReward = "daily_reward"
+)
+
+// after max attempts, claim is mark failed and need admin check
+const ClaimOutboxMaxAttempts = 10
+
+// ClaimOutbox is a pending wallet update, written in same transaction with the claim.
+type ClaimOutbox struct {
+	Id         int64
+	UserId     string
+	IdemKey    string
+	Kind       string
+	RefId      int64
+	Chips      int64
+	Metadata   map[string]interface{}
+	Result     []byte
+	Status     int
+	Attempts   int
+	CreateTime time.Time
+}
+
+// FreeChipClaimKey idempotency key of freechip claim, one freechip claim once
+func FreeChipClaimKey(freeChipId int64) string {
+	return ClaimOutboxKindFreeChip + ":" + strconv.FormatInt(freeChipId, 10)
+}
+
+// GiftCodeClaimKey idempotency key of giftcode claim, one user claim a giftcode once
+func GiftCodeClaimKey(giftCodeId int64) string {
+	return ClaimOutboxKindGiftCode + ":" + strconv.FormatInt(giftCodeId, 10)
+}
+
+// PlaytimeClaimKey idempotency key of playtime claim, claimed and matchClaimed are number of
+// online and match milestones claimed after this claim
+func PlaytimeClaimKey(day string, claimed, matchClaimed int) string {
+	return ClaimOutboxKindPlaytime + ":" + day + ":" + strconv.Itoa(claimed) + ":" + strconv.Itoa(matchClaimed)
+}
+
+// ReferRewardClaimKey idempotency key of refer reward of a week at a level
+func ReferRewardClaimKey(rewardReferId int64, level int) string {
+	return ClaimOutboxKindRefer + ":" + strconv.FormatInt(rewardReferId, 10) + ":" + strconv.Itoa(level)
+}
+
+// DailyRewardClaimKey idempotency key of nth claim of daily reward in day
+func DailyRewardClaimKey(day string, numClaim int64) string {
+	return ClaimOutboxKindDailyReward + ":" + day + ":" + strconv.FormatInt(numClaim, 10)
+}
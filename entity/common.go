@@ -21,9 +21,11 @@ func init() {
 	MapWalletAction := make(map[WalletAction]bool, 0)
 	MapWalletAction[WalletActionBankTopup] = true
 	MapWalletAction[WalletActionDailyReward] = true
+	MapWalletAction[WalletActionDailyRewardStreak] = true
 	MapWalletAction[WalletActionFreeChip] = true
 	MapWalletAction[WalletActionGiftCode] = true
 	MapWalletAction[WalletActionIAPTopUp] = true
+	MapWalletAction[WalletActionPlaytime] = true
 	MapWalletAction[WalletActionReferReward] = true
 }
 
@@ -121,13 +123,15 @@ func ToInt64(inf interface{}, def int64) int64 {
 type WalletAction string
 
 const (
-	WalletActionBankTopup   WalletAction = "bank_topup"
-	WalletActionDailyReward WalletAction = "daily_reward"
-	WalletActionFreeChip    WalletAction = "free_chip"
-	WalletActionGiftCode    WalletAction = "gift_code"
-	WalletActionIAPTopUp    WalletAction = "iap_topup"
-	WalletActionReferReward WalletAction = "refer_reward"
-	WalletActionUserGift    WalletAction = "user_gift"
+	WalletActionBankTopup         WalletAction = "bank_topup"
+	WalletActionDailyReward       WalletAction = "daily_reward"
+	WalletActionDailyRewardStreak WalletAction = "daily_reward_streak"
+	WalletActionFreeChip          WalletAction = "free_chip"
+	WalletActionGiftCode          WalletAction = "gift_code"
+	WalletActionIAPTopUp          WalletAction = "iap_topup"
+	WalletActionPlaytime          WalletAction = "playtime"
+	WalletActionReferReward       WalletAction = "refer_reward"
+	WalletActionUserGift          WalletAction = "user_gift"
 )
 
 func (w WalletAction) String() string {
@@ -0,0 +1,210 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	pb "github.com/nk-nigeria/cgp-common/proto"
+	"github.com/nk-nigeria/lobby-module/constant"
+)
+
+const (
+	DailyRewardMaxTier        = 30
+	DailyRewardMaxPercenBonus = 1000
+)
+
+var (
+	ErrDailyRewardNoTier          = errors.New("template must have 1-30 tiers")
+	ErrDailyRewardStreak          = errors.New("tier streak must start at 1 and increase by 1")
+	ErrDailyRewardBasicChips      = errors.New("basic chips must be positive and same number in all tiers")
+	ErrDailyRewardPercenBonus     = errors.New("percent bonus must be 0-1000 and not decrease")
+	ErrDailyRewardOnline          = errors.New("online sec must be positive, online chip must not decrease")
+	ErrDailyRewardChipTooLarge    = errors.New("tier total chip too large")
+	ErrDailyRewardScheduleInvalid = errors.New("end time must be after start time")
+)
+
+// default timezone of daily reward reset when user not set timezone,
+// key "" is default of all app package
+var DefaultTimezoneByAppPackage = map[string]string{}
+
+// ParseTimezoneByAppPackage parse "com.app.a=Africa/Lagos,=Asia/Jakarta",
+// skip invalid timezone.
+func ParseTimezoneByAppPackage(s string) map[string]string {
+	ml := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		pkg, name, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		if _, err := time.LoadLocation(name); err != nil || name == "" {
+			continue
+		}
+		ml[strings.TrimSpace(pkg)] = name
+	}
+	return ml
+}
+
+type DailyRewardTier struct {
+	Streak      int64   `json:"streak"`
+	BasicChips  []int64 `json:"basic_chips"`
+	PercenBonus float32 `json:"percen_bonus"`
+	OnlineSec   int64   `json:"online_sec"`
+	OnlineChip  int64   `json:"online_chip"`
+}
+
+// DailyRewardTemplateVersion template save in db, template without schedule is
+// default template, latest version is used. Scheduled template override default
+// between start and end time.
+type DailyRewardTemplateVersion struct {
+	Id             int64              `json:"id"`
+	Name           string             `json:"name"`
+	Version        int64              `json:"version"`
+	Tiers          []*DailyRewardTier `json:"tiers"`
+	StartTimeUnix  int64              `json:"start_time_unix"`
+	EndTimeUnix    int64              `json:"end_time_unix"`
+	Disabled       bool               `json:"disabled"`
+	CreateTimeUnix int64              `json:"create_time_unix"`
+}
+
+type ListDailyRewardTemplateVersion struct {
+	Templates []*DailyRewardTemplateVersion `json:"templates"`
+}
+
+func (t *DailyRewardTemplateVersion) IsScheduled() bool {
+	return t.StartTimeUnix > 0 || t.EndTimeUnix > 0
+}
+
+// ValidateDailyRewardTiers tiers are consistent: every tier has the same spin
+// slots, reward not decrease when streak increase.
+func ValidateDailyRewardTiers(tiers []*DailyRewardTier) error {
+	if len(tiers) == 0 || len(tiers) > DailyRewardMaxTier {
+		return ErrDailyRewardNoTier
+	}
+	numSlot := len(tiers[0].BasicChips)
+	for i, tier := range tiers {
+		if tier == nil || tier.Streak != int64(i+1) {
+			return ErrDailyRewardStreak
+		}
+		if len(tier.BasicChips) == 0 || len(tier.BasicChips) != numSlot {
+			return ErrDailyRewardBasicChips
+		}
+		var maxBasic int64
+		for _, chip := range tier.BasicChips {
+			if chip <= 0 {
+				return ErrDailyRewardBasicChips
+			}
+			maxBasic = MaxIn64(maxBasic, chip)
+		}
+		if tier.PercenBonus < 0 || tier.PercenBonus > DailyRewardMaxPercenBonus {
+			return ErrDailyRewardPercenBonus
+		}
+		if tier.OnlineSec <= 0 || tier.OnlineChip < 0 {
+			return ErrDailyRewardOnline
+		}
+		if i > 0 {
+			prev := tiers[i-1]
+			if tier.PercenBonus < prev.PercenBonus {
+				return ErrDailyRewardPercenBonus
+			}
+			if tier.OnlineChip < prev.OnlineChip {
+				return ErrDailyRewardOnline
+			}
+		}
+		total := maxBasic + int64(float32(maxBasic)*(tier.PercenBonus/100.0)) + tier.OnlineChip
+		if total > constant.MaxChipAllowAdd {
+			return ErrDailyRewardChipTooLarge
+		}
+	}
+	return nil
+}
+
+func ValidateDailyRewardSchedule(startUnix, endUnix int64) error {
+	if startUnix < 0 || endUnix < 0 {
+		return ErrDailyRewardScheduleInvalid
+	}
+	if (startUnix > 0 || endUnix > 0) && endUnix <= startUnix {
+		return ErrDailyRewardScheduleInvalid
+	}
+	return nil
+}
+
+func (t *DailyRewardTemplateVersion) ToPb() *pb.DailyRewardTemplate {
+	template := &pb.DailyRewardTemplate{
+		RewardTemplates: make([]*pb.RewardTemplate, 0, len(t.Tiers)),
+	}
+	for _, tier := range t.Tiers {
+		template.RewardTemplates = append(template.RewardTemplates, &pb.RewardTemplate{
+			BasicChips:  tier.BasicChips,
+			PercenBonus: tier.PercenBonus,
+			OnlineSec:   tier.OnlineSec,
+			OnlineChip:  tier.OnlineChip,
+			Streak:      tier.Streak,
+		})
+	}
+	return template
+}
+
+// DailyRewardLocation timezone of user, fallback default of app package, then server timezone
+func DailyRewardLocation(timezone, appPackage string) *time.Location {
+	for _, name := range []string{timezone, DefaultTimezoneByAppPackage[appPackage], DefaultTimezoneByAppPackage[""]} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// user can change timezone of daily reward once in this time
+const DailyRewardTimezoneChangeSec = int64(30 * 24 * 3600)
+
+// DailyRewardTimezone timezone pinned at first use, users.timezone is editable by user
+// so a change only take effect at next reset of the pinned timezone,
+// and only once per DailyRewardTimezoneChangeSec.
+type DailyRewardTimezone struct {
+	Name string `json:"name"`
+	// pending timezone, become Name at NextUnix
+	Next       string `json:"next,omitempty"`
+	NextUnix   int64  `json:"next_unix,omitempty"`
+	ChangeUnix int64  `json:"change_unix"`
+}
+
+// Resolve apply user timezone to pinned timezone, return true if pinned timezone changed and need save
+func (z *DailyRewardTimezone) Resolve(userTimezone string, now time.Time) bool {
+	nowUnix := now.Unix()
+	if z.Name == "" {
+		z.Name = userTimezone
+		z.ChangeUnix = nowUnix
+		return true
+	}
+	changed := false
+	if z.Next != "" && nowUnix >= z.NextUnix {
+		z.Name = z.Next
+		z.Next = ""
+		z.NextUnix = 0
+		changed = true
+	}
+	if userTimezone != z.Name && userTimezone != z.Next && nowUnix-z.ChangeUnix >= DailyRewardTimezoneChangeSec {
+		z.Next = userTimezone
+		z.NextUnix = Midnight(now, z.Location()).AddDate(0, 0, 1).Unix()
+		z.ChangeUnix = nowUnix
+		changed = true
+	}
+	return changed
+}
+
+func (z *DailyRewardTimezone) Location() *time.Location {
+	if loc, err := time.LoadLocation(z.Name); err == nil {
+		return loc
+	}
+	return time.Local
+}
+
+// Midnight start of day of t in loc
+func Midnight(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,180 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	DailyRewardClaimKindClaim   = "claim"
+	DailyRewardClaimKindCatchUp = "catch_up"
+	DailyRewardClaimKindFreeze  = "freeze"
+)
+
+const (
+	DailyRewardDayLayout = "2006-01-02"
+	// first claim in this time after midnight keep streak if only yesterday is missed
+	DailyRewardStreakGraceSec = 4 * 3600
+	// streak freeze cover one missed day, earn one every N days of streak
+	DailyRewardFreezeMax       = 2
+	DailyRewardFreezeEarnEvery = 7
+	DailyRewardFreezePrice     = 20000
+	DailyRewardCatchUpPrice    = 10000
+	DailyRewardCalendarDays    = 30
+	// wallet key of streak freeze user own
+	WalletKeyStreakFreeze = "streakFreeze"
+)
+
+var (
+	ErrDailyRewardCatchUpNotAllow = errors.New("catch up only when yesterday is the only missed day")
+	ErrDailyRewardFreezeFull      = errors.New("streak freeze reach max")
+)
+
+// DailyRewardStreak consecutive days user claim daily reward
+type DailyRewardStreak struct {
+	UserId     string `json:"user_id"`
+	Streak     int64  `json:"streak"`
+	BestStreak int64  `json:"best_streak"`
+	LastDay    string `json:"last_day"`
+	// number of streak freeze user own, kept in wallet not in streak table
+	Freeze int64 `json:"freeze"`
+}
+
+// DailyRewardStreakUpdate change of streak after claim of a new day
+type DailyRewardStreakUpdate struct {
+	Day        string
+	FrozenDays []string
+	EarnFreeze bool
+	Grace      bool
+	Reset      bool
+}
+
+type DailyRewardCalendarDay struct {
+	Day  string `json:"day"`
+	Kind string `json:"kind,omitempty"`
+	// number of claim in day
+	NumClaim int64 `json:"num_claim"`
+	Chips    int64 `json:"chips"`
+}
+
+type DailyRewardCalendar struct {
+	// reward is pb.Reward in json
+	Reward         json.RawMessage           `json:"reward,omitempty"`
+	Streak         *DailyRewardStreak        `json:"streak"`
+	CanCatchUp     bool                      `json:"can_catch_up"`
+	CatchUpPrice   int64                     `json:"catch_up_price"`
+	FreezePrice    int64                     `json:"freeze_price"`
+	Days           []*DailyRewardCalendarDay `json:"days"`
+	CalendarToday  string                    `json:"today"`
+	StreakGraceSec int64                     `json:"streak_grace_sec"`
+}
+
+type DailyRewardCalendarRequest struct {
+	Calendar bool `json:"calendar"`
+}
+
+func DailyRewardDay(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(DailyRewardDayLayout)
+}
+
+// dailyRewardDayDiff number of days from a to b, -1 if a or b invalid
+func dailyRewardDayDiff(a, b string) int64 {
+	ta, err := time.Parse(DailyRewardDayLayout, a)
+	if err != nil {
+		return -1
+	}
+	tb, err := time.Parse(DailyRewardDayLayout, b)
+	if err != nil {
+		return -1
+	}
+	return int64(tb.Sub(ta).Hours() / 24)
+}
+
+func addDailyRewardDay(day string, n int) string {
+	t, _ := time.Parse(DailyRewardDayLayout, day)
+	return t.AddDate(0, 0, n).Format(DailyRewardDayLayout)
+}
+
+// Claim update streak by first claim of day, return nil if day already claimed.
+// secFromMidnight is time of claim from start of day.
+func (s *DailyRewardStreak) Claim(day string, secFromMidnight int64) *DailyRewardStreakUpdate {
+	if s.LastDay == day {
+		return nil
+	}
+	update := &DailyRewardStreakUpdate{Day: day}
+	missed := dailyRewardDayDiff(s.LastDay, day) - 1
+	switch {
+	case s.LastDay == "" || missed < 0:
+		s.Streak = 1
+		update.Reset = true
+	case missed == 0:
+		s.Streak++
+	case missed == 1 && secFromMidnight < DailyRewardStreakGraceSec:
+		s.Streak++
+		update.Grace = true
+	case missed <= s.Freeze:
+		s.Freeze -= missed
+		for i := missed; i >= 1; i-- {
+			update.FrozenDays = append(update.FrozenDays, addDailyRewardDay(day, -int(i)))
+		}
+		s.Streak++
+	default:
+		s.Streak = 1
+		update.Reset = true
+	}
+	s.LastDay = day
+	if s.Streak > s.BestStreak {
+		s.BestStreak = s.Streak
+	}
+	if s.Streak%DailyRewardFreezeEarnEvery == 0 && s.Freeze < DailyRewardFreezeMax {
+		s.Freeze++
+		update.EarnFreeze = true
+	}
+	return update
+}
+
+// CanCatchUp yesterday is missed, the day before is claimed and today not claimed yet
+func (s *DailyRewardStreak) CanCatchUp(today string) bool {
+	return s.LastDay != "" && dailyRewardDayDiff(s.LastDay, today) == 2
+}
+
+// CatchUp restore yesterday, return the restored day
+func (s *DailyRewardStreak) CatchUp(today string) (string, error) {
+	if !s.CanCatchUp(today) {
+		return "", ErrDailyRewardCatchUpNotAllow
+	}
+	s.LastDay = addDailyRewardDay(today, -1)
+	s.Streak++
+	if s.Streak > s.BestStreak {
+		s.BestStreak = s.Streak
+	}
+	return s.LastDay, nil
+}
+
+func (s *DailyRewardStreak) AddFreeze() error {
+	if s.Freeze >= DailyRewardFreezeMax {
+		return ErrDailyRewardFreezeFull
+	}
+	s.Freeze++
+	return nil
+}
+
+// BuildDailyRewardCalendar last n days until today, missing day has empty kind
+func BuildDailyRewardCalendar(today string, n int, claimed map[string]*DailyRewardCalendarDay) []*DailyRewardCalendarDay {
+	days := make([]*DailyRewardCalendarDay, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		day := addDailyRewardDay(today, -i)
+		if d, ok := claimed[day]; ok {
+			days = append(days, d)
+			continue
+		}
+		days = append(days, &DailyRewardCalendarDay{Day: day})
+	}
+	return days
+}
+
+// DailyRewardCalendarFrom first day of calendar end at today
+func DailyRewardCalendarFrom(today string) string {
+	return addDailyRewardDay(today, -(DailyRewardCalendarDays - 1))
+}
@@ -0,0 +1,109 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDailyRewardStreakClaim(t *testing.T) {
+	tests := []struct {
+		name            string
+		streak          DailyRewardStreak
+		day             string
+		secFromMidnight int64
+		wantStreak      int64
+		wantFreeze      int64
+		want            *DailyRewardStreakUpdate
+	}{
+		{"first claim", DailyRewardStreak{}, "2024-01-10", 3600 * 10,
+			1, 0, &DailyRewardStreakUpdate{Day: "2024-01-10", Reset: true}},
+		{"same day", DailyRewardStreak{Streak: 3, BestStreak: 3, LastDay: "2024-01-10"}, "2024-01-10", 3600 * 10,
+			3, 0, nil},
+		{"next day", DailyRewardStreak{Streak: 3, LastDay: "2024-01-09"}, "2024-01-10", 3600 * 10,
+			4, 0, &DailyRewardStreakUpdate{Day: "2024-01-10"}},
+		{"grace", DailyRewardStreak{Streak: 3, LastDay: "2024-01-08"}, "2024-01-10", 3600,
+			4, 0, &DailyRewardStreakUpdate{Day: "2024-01-10", Grace: true}},
+		{"grace over use freeze", DailyRewardStreak{Streak: 3, LastDay: "2024-01-08", Freeze: 1}, "2024-01-10", 3600 * 5,
+			4, 0, &DailyRewardStreakUpdate{Day: "2024-01-10", FrozenDays: []string{"2024-01-09"}}},
+		{"two freeze", DailyRewardStreak{Streak: 3, LastDay: "2024-01-07", Freeze: 2}, "2024-01-10", 3600 * 5,
+			4, 0, &DailyRewardStreakUpdate{Day: "2024-01-10", FrozenDays: []string{"2024-01-08", "2024-01-09"}}},
+		{"not enough freeze", DailyRewardStreak{Streak: 3, LastDay: "2024-01-07", Freeze: 1}, "2024-01-10", 3600 * 5,
+			1, 1, &DailyRewardStreakUpdate{Day: "2024-01-10", Reset: true}},
+		{"earn freeze", DailyRewardStreak{Streak: 6, LastDay: "2024-01-09"}, "2024-01-10", 3600 * 10,
+			7, 1, &DailyRewardStreakUpdate{Day: "2024-01-10", EarnFreeze: true}},
+		{"freeze full", DailyRewardStreak{Streak: 13, LastDay: "2024-01-09", Freeze: DailyRewardFreezeMax}, "2024-01-10", 3600 * 10,
+			14, DailyRewardFreezeMax, &DailyRewardStreakUpdate{Day: "2024-01-10"}},
+		{"clock back", DailyRewardStreak{Streak: 3, LastDay: "2024-01-11"}, "2024-01-10", 3600 * 10,
+			1, 0, &DailyRewardStreakUpdate{Day: "2024-01-10", Reset: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.streak
+			got := s.Claim(tt.day, tt.secFromMidnight)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Claim() = %+v, want %+v", got, tt.want)
+			}
+			if s.Streak != tt.wantStreak || s.Freeze != tt.wantFreeze {
+				t.Errorf("Claim() streak %d freeze %d, want %d %d", s.Streak, s.Freeze, tt.wantStreak, tt.wantFreeze)
+			}
+			if s.BestStreak < s.Streak {
+				t.Errorf("Claim() best streak %d less than streak %d", s.BestStreak, s.Streak)
+			}
+		})
+	}
+}
+
+func TestDailyRewardStreakCatchUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		lastDay string
+		want    string
+		wantErr error
+	}{
+		{"missed yesterday", "2024-01-08", "2024-01-09", nil},
+		{"claimed yesterday", "2024-01-09", "", ErrDailyRewardCatchUpNotAllow},
+		{"missed two days", "2024-01-07", "", ErrDailyRewardCatchUpNotAllow},
+		{"never claim", "", "", ErrDailyRewardCatchUpNotAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &DailyRewardStreak{Streak: 3, BestStreak: 3, LastDay: tt.lastDay}
+			got, err := s.CatchUp("2024-01-10")
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("CatchUp() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+			if err == nil {
+				if s.Streak != 4 || s.BestStreak != 4 {
+					t.Errorf("CatchUp() streak %d best %d, want 4", s.Streak, s.BestStreak)
+				}
+				// claim today continue the streak
+				if update := s.Claim("2024-01-10", 3600*10); update == nil || update.Reset || s.Streak != 5 {
+					t.Errorf("Claim() after catch up = %+v streak %d, want streak 5", update, s.Streak)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildDailyRewardCalendar(t *testing.T) {
+	claimed := map[string]*DailyRewardCalendarDay{
+		"2024-02-28": {Day: "2024-02-28", Kind: DailyRewardClaimKindClaim, NumClaim: 2, Chips: 3000},
+		"2024-03-01": {Day: "2024-03-01", Kind: DailyRewardClaimKindFreeze},
+	}
+	days := BuildDailyRewardCalendar("2024-03-01", 3, claimed)
+	want := []string{"2024-02-28", "2024-02-29", "2024-03-01"}
+	if len(days) != len(want) {
+		t.Fatalf("BuildDailyRewardCalendar() len %d, want %d", len(days), len(want))
+	}
+	for i, d := range days {
+		if d.Day != want[i] {
+			t.Errorf("day %d = %s, want %s", i, d.Day, want[i])
+		}
+	}
+	if days[1].Kind != "" || days[0].NumClaim != 2 || days[2].Kind != DailyRewardClaimKindFreeze {
+		t.Errorf("BuildDailyRewardCalendar() = %+v %+v %+v", days[0], days[1], days[2])
+	}
+	if got := DailyRewardCalendarFrom("2024-03-01"); got != "2024-02-01" {
+		t.Errorf("DailyRewardCalendarFrom() = %s, want 2024-02-01", got)
+	}
+}
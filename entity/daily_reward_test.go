@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateDailyRewardTiers(t *testing.T) {
+	tier := func(streak int64, bonus float32, onlineChip int64, chips ...int64) *DailyRewardTier {
+		return &DailyRewardTier{Streak: streak, BasicChips: chips, PercenBonus: bonus, OnlineSec: 300, OnlineChip: onlineChip}
+	}
+	tests := []struct {
+		name  string
+		tiers []*DailyRewardTier
+		want  error
+	}{
+		{"valid", []*DailyRewardTier{tier(1, 10, 100, 1000, 2000), tier(2, 20, 200, 1001, 2001)}, nil},
+		{"empty", nil, ErrDailyRewardNoTier},
+		{"streak gap", []*DailyRewardTier{tier(1, 10, 100, 1000), tier(3, 20, 200, 1000)}, ErrDailyRewardStreak},
+		{"slot mismatch", []*DailyRewardTier{tier(1, 10, 100, 1000, 2000), tier(2, 20, 200, 1000)}, ErrDailyRewardBasicChips},
+		{"zero chip", []*DailyRewardTier{tier(1, 10, 100, 0)}, ErrDailyRewardBasicChips},
+		{"bonus decrease", []*DailyRewardTier{tier(1, 20, 100, 1000), tier(2, 10, 200, 1000)}, ErrDailyRewardPercenBonus},
+		{"online chip decrease", []*DailyRewardTier{tier(1, 10, 200, 1000), tier(2, 20, 100, 1000)}, ErrDailyRewardOnline},
+		{"too large", []*DailyRewardTier{tier(1, 1000, 0, 1000000000)}, ErrDailyRewardChipTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateDailyRewardTiers(tt.tiers); got != tt.want {
+				t.Errorf("ValidateDailyRewardTiers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDailyRewardMidnight(t *testing.T) {
+	DefaultTimezoneByAppPackage = ParseTimezoneByAppPackage("com.app.id=Asia/Jakarta, =Africa/Lagos,bad=Not/Zone")
+	defer func() { DefaultTimezoneByAppPackage = map[string]string{} }()
+	// 2024-01-01 20:00 UTC
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		timezone   string
+		appPackage string
+		want       time.Time
+	}{
+		{"user timezone", "America/New_York", "com.app.id", time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC)},
+		{"app package default", "", "com.app.id", time.Date(2024, 1, 1, 17, 0, 0, 0, time.UTC)},
+		{"global default", "", "com.other", time.Date(2024, 1, 0, 23, 0, 0, 0, time.UTC)},
+		{"invalid user timezone", "Bad/Zone", "bad", time.Date(2024, 1, 0, 23, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Midnight(now, DailyRewardLocation(tt.timezone, tt.appPackage))
+			if !got.Equal(tt.want) {
+				t.Errorf("Midnight() = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDailyRewardTimezoneResolve(t *testing.T) {
+	lagos, _ := time.LoadLocation("Africa/Lagos")
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, lagos)
+	z := &DailyRewardTimezone{}
+	if !z.Resolve("Africa/Lagos", now) || z.Name != "Africa/Lagos" {
+		t.Fatalf("want pinned at first use, got %+v", z)
+	}
+	// change right after pin is ignored
+	if z.Resolve("Asia/Jakarta", now.Add(time.Hour)) || z.Name != "Africa/Lagos" || z.Next != "" {
+		t.Fatalf("want change ignored in limit time, got %+v", z)
+	}
+	now = now.Add(time.Duration(DailyRewardTimezoneChangeSec) * time.Second)
+	if !z.Resolve("Asia/Jakarta", now) || z.Name != "Africa/Lagos" || z.Next != "Asia/Jakarta" {
+		t.Fatalf("want change pending, got %+v", z)
+	}
+	if want := Midnight(now, lagos).AddDate(0, 0, 1).Unix(); z.NextUnix != want {
+		t.Errorf("next unix = %d, want next midnight %d", z.NextUnix, want)
+	}
+	if z.Resolve("Asia/Jakarta", now.Add(time.Hour)) || z.Name != "Africa/Lagos" {
+		t.Fatalf("want old timezone until next reset, got %+v", z)
+	}
+	if !z.Resolve("Asia/Jakarta", time.Unix(z.NextUnix, 0)) || z.Name != "Asia/Jakarta" || z.Next != "" {
+		t.Fatalf("want new timezone after reset, got %+v", z)
+	}
+}
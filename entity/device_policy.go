@@ -0,0 +1,154 @@
+package entity
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	// session var client send at login, device auth fill it from device id
+	DeviceVarId       = "device_id"
+	DeviceVarPlatform = "platform"
+
+	DevicePlatformMaxLen = 16
+	DeviceIdMaxLen       = 128
+	DeviceSessionsLimit  = 10
+)
+
+var (
+	ErrDevicePolicy   = errors.New("max_sessions must be between 1 and 10")
+	ErrDeviceId       = errors.New("device_id is required")
+	ErrDeviceNotFound = errors.New("device not found or already revoked")
+	ErrDeviceCurrent  = errors.New("cannot revoke current device, logout instead")
+	ErrDeviceNewBlock = errors.New("Login from new device is blocked on your account, please login on a device used before or contact support")
+	ErrDeviceRevoked  = errors.New("This device is signed out of your account, please login with another method or contact support")
+)
+
+// DeviceVipRule users with vip level from min vip level can have max sessions at the same time
+type DeviceVipRule struct {
+	MinVipLevel int64 `json:"min_vip_level"`
+	MaxSessions int   `json:"max_sessions"`
+}
+
+// DevicePolicy number of concurrent sessions allowed by user class, default is single device
+type DevicePolicy struct {
+	MaxSessions      int              `json:"max_sessions"`
+	VipRules         []*DeviceVipRule `json:"vip_rules,omitempty"`
+	StaffUserIds     []string         `json:"staff_user_ids,omitempty"`
+	StaffMaxSessions int              `json:"staff_max_sessions,omitempty"`
+}
+
+func DefaultDevicePolicy() *DevicePolicy {
+	return &DevicePolicy{MaxSessions: 1}
+}
+
+func validDeviceSessions(n int) bool {
+	return n >= 1 && n <= DeviceSessionsLimit
+}
+
+func (p *DevicePolicy) Validate() error {
+	if !validDeviceSessions(p.MaxSessions) {
+		return ErrDevicePolicy
+	}
+	for _, rule := range p.VipRules {
+		if rule == nil || !validDeviceSessions(rule.MaxSessions) {
+			return ErrDevicePolicy
+		}
+	}
+	if p.StaffMaxSessions != 0 && !validDeviceSessions(p.StaffMaxSessions) {
+		return ErrDevicePolicy
+	}
+	return nil
+}
+
+// MaxSessionsOf sessions allowed for user, the most generous class user belong to is used
+func (p *DevicePolicy) MaxSessionsOf(userId string, vipLevel int64) int {
+	max := p.MaxSessions
+	if max < 1 {
+		max = 1
+	}
+	for _, rule := range p.VipRules {
+		if vipLevel >= rule.MinVipLevel && rule.MaxSessions > max {
+			max = rule.MaxSessions
+		}
+	}
+	if p.StaffMaxSessions > max {
+		for _, id := range p.StaffUserIds {
+			if id == userId {
+				max = p.StaffMaxSessions
+				break
+			}
+		}
+	}
+	return max
+}
+
+// NeedVipLevel vip level only matter if policy has vip rule
+func (p *DevicePolicy) NeedVipLevel() bool {
+	return len(p.VipRules) > 0
+}
+
+// DeviceSession live session of user, last seen 0 if not known in registry
+type DeviceSession struct {
+	SessionId    string
+	LastSeenUnix int64
+}
+
+// ExcessSessions sessions to disconnect so user keep max sessions, current session is always kept,
+// oldest sessions are disconnected first
+func ExcessSessions(sessions []*DeviceSession, current string, max int) []string {
+	others := make([]*DeviceSession, 0, len(sessions))
+	for _, s := range sessions {
+		if s.SessionId != current {
+			others = append(others, s)
+		}
+	}
+	keep := max - 1
+	if keep < 0 {
+		keep = 0
+	}
+	if len(others) <= keep {
+		return nil
+	}
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].LastSeenUnix < others[j].LastSeenUnix
+	})
+	ids := make([]string, 0, len(others)-keep)
+	for _, s := range others[:len(others)-keep] {
+		ids = append(ids, s.SessionId)
+	}
+	return ids
+}
+
+// UserDevice device user logged in, revoked device must login again
+type UserDevice struct {
+	DeviceId       string `json:"device_id"`
+	Platform       string `json:"platform"`
+	FirstSeenUnix  int64  `json:"first_seen_unix"`
+	LastSeenUnix   int64  `json:"last_seen_unix"`
+	RevokeTimeUnix int64  `json:"revoke_time_unix,omitempty"`
+	Current        bool   `json:"current"`
+	SessionId      string `json:"-"`
+	Token          string `json:"-"`
+	RefreshToken   string `json:"-"`
+}
+
+// NormalizeDevice cut device id and platform to column size, platform is lower case
+func NormalizeDevice(deviceId, platform string) (string, string) {
+	if len(deviceId) > DeviceIdMaxLen {
+		deviceId = deviceId[:DeviceIdMaxLen]
+	}
+	if len(platform) > DevicePlatformMaxLen {
+		platform = platform[:DevicePlatformMaxLen]
+	}
+	return deviceId, strings.ToLower(platform)
+}
+
+type DeviceRevokeRequest struct {
+	DeviceId string `json:"device_id"`
+}
+
+type ListUserDevice struct {
+	Devices []*UserDevice `json:"devices"`
+}
@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDevicePolicyMaxSessionsOf(t *testing.T) {
+	policy := &DevicePolicy{
+		MaxSessions:      1,
+		VipRules:         []*DeviceVipRule{{MinVipLevel: 5, MaxSessions: 2}, {MinVipLevel: 8, MaxSessions: 3}},
+		StaffUserIds:     []string{"staff"},
+		StaffMaxSessions: 5,
+	}
+	tests := []struct {
+		name   string
+		userId string
+		vip    int64
+		want   int
+	}{
+		{"default", "u1", 0, 1},
+		{"vip 5", "u1", 5, 2},
+		{"vip 9", "u1", 9, 3},
+		{"staff", "staff", 0, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.MaxSessionsOf(tt.userId, tt.vip); got != tt.want {
+				t.Errorf("MaxSessionsOf() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if err := policy.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := (&DevicePolicy{MaxSessions: 0}).Validate(); err != ErrDevicePolicy {
+		t.Errorf("Validate() = %v, want %v", err, ErrDevicePolicy)
+	}
+}
+
+func TestExcessSessions(t *testing.T) {
+	sessions := []*DeviceSession{
+		{SessionId: "new", LastSeenUnix: 300},
+		{SessionId: "old", LastSeenUnix: 100},
+		{SessionId: "mid", LastSeenUnix: 200},
+		{SessionId: "cur", LastSeenUnix: 0},
+	}
+	tests := []struct {
+		name string
+		max  int
+		want []string
+	}{
+		{"single", 1, []string{"old", "mid", "new"}},
+		{"two", 2, []string{"old", "mid"}},
+		{"enough", 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExcessSessions(sessions, "cur", tt.max); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExcessSessions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,22 @@
 package entity
 
 import (
+	"strconv"
+	"strings"
 	"time"
+
+	pb "github.com/nk-nigeria/cgp-common/proto"
+)
+
+// Claim status not in pb.FreeChip_ClaimStatus, stored in freechip.claim_status
+const (
+	FreeChipClaimStatusExpired = 100
+	FreeChipClaimStatusRevoked = 101
+)
+
+const (
+	FreeChipCampaignStatusActive  = 1
+	FreeChipCampaignStatusRevoked = 2
 )
 
 type FreeChipListCursor struct {
@@ -13,3 +28,58 @@ type FreeChipListCursor struct {
 	Total       int64
 	ClaimStatus int
 }
+
+type FreeChipCampaign struct {
+	Id             int64    `json:"id"`
+	Name           string   `json:"name"`
+	Title          string   `json:"title"`
+	Template       string   `json:"template"`
+	Chips          int64    `json:"chips"`
+	Budget         int64    `json:"budget"`
+	UserGroupId    int64    `json:"user_group_id"`
+	RecipientIds   []string `json:"recipient_ids"`
+	ExpireTimeUnix int64    `json:"expire_time_unix"`
+	Status         int      `json:"status"`
+	NumGranted     int64    `json:"num_granted"`
+	NumSkipped     int64    `json:"num_skipped"`
+	CreateTimeUnix int64    `json:"create_time_unix"`
+}
+
+type FreeChipRevokeRequest struct {
+	Id         int64 `json:"id"`
+	CampaignId int64 `json:"campaign_id"`
+}
+
+type ClaimableFreeChip struct {
+	*pb.FreeChip
+	ExpireTimeUnix int64 `json:"expire_time_unix"`
+	// 0 if freechip has no expiry
+	RemainSec int64 `json:"remain_sec"`
+}
+
+type ListClaimableFreeChip struct {
+	Freechips []*ClaimableFreeChip `json:"freechips"`
+}
+
+// ToPb list without expire info, for clients decode pb.ListFreeChip
+func (l *ListClaimableFreeChip) ToPb() *pb.ListFreeChip {
+	ml := make([]*pb.FreeChip, 0, len(l.Freechips))
+	for _, item := range l.Freechips {
+		ml = append(ml, item.FreeChip)
+	}
+	return &pb.ListFreeChip{Freechips: ml}
+}
+
+// RenderFreeChipTemplate replace {chips}, {expire} and {sid} in campaign message template
+func RenderFreeChipTemplate(tpl string, chips int64, expire time.Time, sid string) string {
+	expireStr := ""
+	if !expire.IsZero() {
+		expireStr = expire.Format("2006-01-02 15:04")
+	}
+	r := strings.NewReplacer(
+		"{chips}", strconv.FormatInt(chips, 10),
+		"{expire}", expireStr,
+		"{sid}", sid,
+	)
+	return r.Replace(tpl)
+}
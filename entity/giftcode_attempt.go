@@ -0,0 +1,100 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	GiftCodeAttemptKeyUser   = "user"
+	GiftCodeAttemptKeyDevice = "device"
+	GiftCodeAttemptKeyIp     = "ip"
+)
+
+const (
+	// failed attempts allowed before lockout of user and device
+	GiftCodeAttemptFree = 5
+	// lock double each failed attempt after free, from base to max
+	GiftCodeAttemptBaseLock = 30 * time.Second
+	GiftCodeAttemptMaxLock  = 24 * time.Hour
+	// fail count reset when no failed attempt in this time,
+	// must be longer than max lock so attacker waiting out the lock keep the count
+	GiftCodeAttemptResetAfter = 7 * 24 * time.Hour
+	// alert admin when user reach this number of failed attempts
+	GiftCodeAttemptAlertThreshold = 20
+	// ip is shared by many user (carrier NAT, cafe), it is never locked, only alert admin
+	GiftCodeAttemptAlertThresholdIp = 200
+)
+
+type GiftCodeAttempt struct {
+	KeyType         string `json:"key_type"`
+	KeyValue        string `json:"key_value"`
+	FailCount       int64  `json:"fail_count"`
+	LastFailUnix    int64  `json:"last_fail_unix"`
+	LockedUntilUnix int64  `json:"locked_until_unix"`
+	LastCode        string `json:"last_code"`
+}
+
+type GiftCodeAttemptRequest struct {
+	KeyType    string `json:"key_type,omitempty"`
+	KeyValue   string `json:"key_value,omitempty"`
+	LockedOnly bool   `json:"locked_only,omitempty"`
+	// clear fail count of key_type, key_value
+	Reset  bool  `json:"reset,omitempty"`
+	Limit  int64 `json:"limit,omitempty"`
+	Offset int64 `json:"offset,omitempty"`
+}
+
+type ListGiftCodeAttempt struct {
+	Attempts []*GiftCodeAttempt `json:"attempts"`
+}
+
+// GiftCodeLockDuration lock after failCount failed attempts of keyType, ip is never locked
+func GiftCodeLockDuration(keyType string, failCount int64) time.Duration {
+	if keyType == GiftCodeAttemptKeyIp {
+		return 0
+	}
+	over := failCount - GiftCodeAttemptFree
+	if over <= 0 {
+		return 0
+	}
+	lock := GiftCodeAttemptBaseLock
+	for i := int64(1); i < over; i++ {
+		lock *= 2
+		if lock >= GiftCodeAttemptMaxLock {
+			return GiftCodeAttemptMaxLock
+		}
+	}
+	return lock
+}
+
+func (a *GiftCodeAttempt) IsLocked(nowUnix int64) bool {
+	return a.LockedUntilUnix > nowUnix
+}
+
+// LockRemainSec zero if not locked
+func (a *GiftCodeAttempt) LockRemainSec(nowUnix int64) int64 {
+	if !a.IsLocked(nowUnix) {
+		return 0
+	}
+	return a.LockedUntilUnix - nowUnix
+}
+
+// Fail record a failed attempt, return true if this attempt reach alert threshold of user or ip
+func (a *GiftCodeAttempt) Fail(code string, nowUnix int64) bool {
+	if a.LastFailUnix > 0 && nowUnix-a.LastFailUnix > int64(GiftCodeAttemptResetAfter.Seconds()) {
+		a.FailCount = 0
+	}
+	a.FailCount++
+	a.LastFailUnix = nowUnix
+	a.LastCode = code
+	if lock := GiftCodeLockDuration(a.KeyType, a.FailCount); lock > 0 {
+		a.LockedUntilUnix = nowUnix + int64(lock.Seconds())
+	}
+	switch a.KeyType {
+	case GiftCodeAttemptKeyUser:
+		return a.FailCount == GiftCodeAttemptAlertThreshold
+	case GiftCodeAttemptKeyIp:
+		return a.FailCount == GiftCodeAttemptAlertThresholdIp
+	}
+	return false
+}
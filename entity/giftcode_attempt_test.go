@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGiftCodeLockDuration(t *testing.T) {
+	tests := []struct {
+		keyType   string
+		failCount int64
+		want      time.Duration
+	}{
+		{GiftCodeAttemptKeyUser, 0, 0},
+		{GiftCodeAttemptKeyUser, 5, 0},
+		{GiftCodeAttemptKeyUser, 6, 30 * time.Second},
+		{GiftCodeAttemptKeyUser, 7, time.Minute},
+		{GiftCodeAttemptKeyUser, 10, 8 * time.Minute},
+		{GiftCodeAttemptKeyUser, 100, GiftCodeAttemptMaxLock},
+		{GiftCodeAttemptKeyDevice, 6, 30 * time.Second},
+		{GiftCodeAttemptKeyIp, 1000, 0},
+	}
+	for _, tt := range tests {
+		if got := GiftCodeLockDuration(tt.keyType, tt.failCount); got != tt.want {
+			t.Errorf("GiftCodeLockDuration(%s, %d) = %v, want %v", tt.keyType, tt.failCount, got, tt.want)
+		}
+	}
+}
+
+// attacker guess as fast as lockout allow
+func simulateGiftCodeBruteForce(keyType string, duration time.Duration) (guesses int64, alerts int) {
+	attempt := &GiftCodeAttempt{KeyType: keyType, KeyValue: "attacker"}
+	start := int64(1700000000)
+	for now := start; now < start+int64(duration.Seconds()); now++ {
+		if attempt.IsLocked(now) {
+			now = attempt.LockedUntilUnix - 1
+			continue
+		}
+		guesses++
+		if attempt.Fail("XX-XXXXXXXXX", now) {
+			alerts++
+		}
+	}
+	return guesses, alerts
+}
+
+func TestGiftCodeBruteForce(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyType    string
+		duration   time.Duration
+		maxGuesses int64
+		wantAlerts int
+	}{
+		{"user one hour", GiftCodeAttemptKeyUser, time.Hour, 13, 0},
+		{"user one week", GiftCodeAttemptKeyUser, 7 * 24 * time.Hour, 30, 1},
+		{"ip one hour", GiftCodeAttemptKeyIp, time.Hour, 3600, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guesses, alerts := simulateGiftCodeBruteForce(tt.keyType, tt.duration)
+			if guesses > tt.maxGuesses {
+				t.Errorf("guesses = %d, want <= %d", guesses, tt.maxGuesses)
+			}
+			if alerts != tt.wantAlerts {
+				t.Errorf("alerts = %d, want %d", alerts, tt.wantAlerts)
+			}
+		})
+	}
+}
+
+func TestGiftCodeAttemptReset(t *testing.T) {
+	attempt := &GiftCodeAttempt{KeyType: GiftCodeAttemptKeyUser}
+	now := int64(1700000000)
+	for i := 0; i < GiftCodeAttemptFree+1; i++ {
+		attempt.Fail("A", now)
+	}
+	if !attempt.IsLocked(now) {
+		t.Fatalf("want locked after %d fails", attempt.FailCount)
+	}
+	now += int64(GiftCodeAttemptMaxLock.Seconds()) + 1
+	attempt.Fail("A", now)
+	if attempt.FailCount != GiftCodeAttemptFree+2 {
+		t.Fatalf("fail count = %d, want kept after waiting out max lock", attempt.FailCount)
+	}
+	now += int64(GiftCodeAttemptResetAfter.Seconds()) + 1
+	if attempt.IsLocked(now) {
+		t.Fatalf("want unlocked after reset window")
+	}
+	attempt.Fail("A", now)
+	if attempt.FailCount != 1 || attempt.IsLocked(now) {
+		t.Errorf("fail count = %d, locked %v, want 1 and unlocked", attempt.FailCount, attempt.IsLocked(now))
+	}
+}
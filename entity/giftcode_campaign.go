@@ -0,0 +1,159 @@
+package entity
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// no 0/O, 1/I/L, and no Z so it is not mistaken for 2, to avoid ambiguous when user type code.
+// 2 is kept because charset length must be even for Luhn mod N check char
+const GiftCodeCharset = "23456789ABCDEFGHJKMNPQRSTUVWXY"
+
+const (
+	// random part of campaign code, not include check char
+	GiftCodeBodyLen      = 8
+	GiftCodeMaxPrefixLen = 8
+	GiftCodeSeparator    = "-"
+	// codes in one exported csv file, export of big campaign is split in pages
+	GiftCodeExportPageSize = 10000
+)
+
+const BucketGiftCode = "giftcode"
+
+var (
+	ErrGiftCodeInvalidPrefix = errors.New("giftcode prefix must be 1-8 chars in charset")
+
+	// campaign code format: PREFIX-BODYC, C is check char
+	giftCodeCampaignRegex = regexp.MustCompile("^[" + GiftCodeCharset + "]{1,8}-[" + GiftCodeCharset + "]{9}$")
+)
+
+type GiftCodeCampaign struct {
+	Id            int64  `json:"id"`
+	Name          string `json:"name"`
+	Prefix        string `json:"prefix"`
+	NumCode       int64  `json:"num_code"`
+	Value         int64  `json:"value"`
+	NMax          int64  `json:"n_max"`
+	StartTimeUnix int64  `json:"start_time_unix"`
+	EndTimeUnix   int64  `json:"end_time_unix"`
+	Message       string `json:"message"`
+	Vip           int64  `json:"vip"`
+	Disabled      bool   `json:"disabled"`
+	ExportUrl     string `json:"export_url,omitempty"`
+	// export codes after this cursor, next cursor is 0 when all codes exported
+	ExportCursor     int64 `json:"export_cursor,omitempty"`
+	ExportNextCursor int64 `json:"export_next_cursor,omitempty"`
+	CreateTimeUnix   int64 `json:"create_time_unix"`
+	// copy to all code of campaign
+	Rules *GiftCodeRules `json:"rules,omitempty"`
+}
+
+type GiftCodeCampaignStats struct {
+	CampaignId     int64 `json:"campaign_id"`
+	NumCode        int64 `json:"num_code"`
+	NumCodeClaimed int64 `json:"num_code_claimed"`
+	NumClaim       int64 `json:"num_claim"`
+	NumUser        int64 `json:"num_user"`
+	ChipsClaimed   int64 `json:"chips_claimed"`
+	Disabled       bool  `json:"disabled"`
+}
+
+type GiftCodeCampaignCode struct {
+	Id       int64
+	Code     string
+	NCurrent int64
+	NMax     int64
+	Value    int64
+}
+
+// NormalizeGiftCode upper case, remove space
+func NormalizeGiftCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func ValidGiftCodePrefix(prefix string) error {
+	if len(prefix) == 0 || len(prefix) > GiftCodeMaxPrefixLen {
+		return ErrGiftCodeInvalidPrefix
+	}
+	for _, c := range prefix {
+		if !strings.ContainsRune(GiftCodeCharset, c) {
+			return ErrGiftCodeInvalidPrefix
+		}
+	}
+	return nil
+}
+
+// GenerateGiftCode random code PREFIX-BODYC
+func GenerateGiftCode(prefix string) (string, error) {
+	body := make([]byte, GiftCodeBodyLen)
+	max := big.NewInt(int64(len(GiftCodeCharset)))
+	for i := range body {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		body[i] = GiftCodeCharset[n.Int64()]
+	}
+	code := prefix + GiftCodeSeparator + string(body)
+	return code + string(giftCodeCheckChar(code)), nil
+}
+
+// HasGiftCodeCampaignShape code is PREFIX-XXXXXXXXX, may have typo.
+// Code added manually by admin should not have this shape.
+func HasGiftCodeCampaignShape(code string) bool {
+	idx := strings.LastIndex(code, GiftCodeSeparator)
+	if idx <= 0 || idx > GiftCodeMaxPrefixLen {
+		return false
+	}
+	return len(code)-idx-1 == GiftCodeBodyLen+1
+}
+
+// GiftCodePrefix prefix of campaign shaped code, empty if code has no prefix
+func GiftCodePrefix(code string) string {
+	idx := strings.LastIndex(code, GiftCodeSeparator)
+	if idx <= 0 {
+		return ""
+	}
+	return code[:idx]
+}
+
+// IsGiftCodeCampaignFormat code look like generated by campaign
+func IsGiftCodeCampaignFormat(code string) bool {
+	return giftCodeCampaignRegex.MatchString(code)
+}
+
+// ValidGiftCodeChecksum check last char of campaign code
+func ValidGiftCodeChecksum(code string) bool {
+	if !IsGiftCodeCampaignFormat(code) {
+		return false
+	}
+	return giftCodeCheckChar(code[:len(code)-1]) == code[len(code)-1]
+}
+
+// giftCodeCheckChar Luhn mod N check char, detect every single char typo and
+// most swap of adjacent chars. Separator is ignored.
+func giftCodeCheckChar(code string) byte {
+	n := len(GiftCodeCharset)
+	factor := 2
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		idx := strings.IndexByte(GiftCodeCharset, code[i])
+		if idx < 0 {
+			continue
+		}
+		addend := factor * idx
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		addend = addend/n + addend%n
+		sum += addend
+	}
+	check := (n - sum%n) % n
+	return GiftCodeCharset[check]
+}
@@ -0,0 +1,88 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateGiftCode(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		code, err := GenerateGiftCode("TET")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(code, "TET-") {
+			t.Errorf("GenerateGiftCode() = %s, missing prefix", code)
+		}
+		if !HasGiftCodeCampaignShape(code) {
+			t.Errorf("HasGiftCodeCampaignShape(%s) = false, want true", code)
+		}
+		if !ValidGiftCodeChecksum(code) {
+			t.Errorf("ValidGiftCodeChecksum(%s) = false, want true", code)
+		}
+	}
+}
+
+func TestGiftCodeCharset(t *testing.T) {
+	if len(GiftCodeCharset)%2 != 0 {
+		t.Errorf("len(GiftCodeCharset) = %d, want even", len(GiftCodeCharset))
+	}
+	if strings.ContainsAny(GiftCodeCharset, "0O1ILZ") {
+		t.Errorf("GiftCodeCharset %s contains ambiguous char", GiftCodeCharset)
+	}
+}
+
+func TestValidGiftCodeChecksum_Typo(t *testing.T) {
+	code, _ := GenerateGiftCode("VP")
+	// every single char typo must be rejected
+	for i := 0; i < len(code); i++ {
+		if code[i] == '-' {
+			continue
+		}
+		for _, c := range GiftCodeCharset {
+			if byte(c) == code[i] {
+				continue
+			}
+			typo := code[:i] + string(c) + code[i+1:]
+			if ValidGiftCodeChecksum(typo) {
+				t.Errorf("ValidGiftCodeChecksum(%s) = true, typo of %s", typo, code)
+			}
+		}
+	}
+}
+
+func TestValidGiftCodeChecksum(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{
+			name: "empty",
+			code: "",
+			want: false,
+		},
+		{
+			name: "no_prefix",
+			code: "ABCDEFGHJ",
+			want: false,
+		},
+		{
+			name: "ambiguous_char",
+			code: "TET-ABCDEFG0H",
+			want: false,
+		},
+		{
+			name: "too_short",
+			code: "TET-ABC",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidGiftCodeChecksum(tt.code); got != tt.want {
+				t.Errorf("ValidGiftCodeChecksum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package entity
+
+import (
+	"errors"
+)
+
+// GiftCodeFirstIAPWindowSec default time after first iap topup the user can claim a FirstIAPOnly code
+const GiftCodeFirstIAPWindowSec = int64(7 * 24 * 3600)
+
+var (
+	ErrGiftCodeRuleUserGroup  = errors.New("giftcode not for user group of user")
+	ErrGiftCodeRuleAccountAge = errors.New("giftcode not for account age of user")
+	ErrGiftCodeRuleFirstIAP   = errors.New("giftcode only shortly after first in-app purchase")
+	ErrGiftCodeRuleAppPackage = errors.New("giftcode not for this app package")
+	ErrGiftCodeRuleDevice     = errors.New("giftcode reach max claim on this device")
+)
+
+// GiftCodeRules eligibility to redeem a giftcode, zero value field is not checked
+type GiftCodeRules struct {
+	// user match at least one group, each group is map UserGroupType -> {"min","max"}
+	UserGroups []map[string]string `json:"user_groups,omitempty"`
+	// account age in second at claim time
+	AccountAgeMinSec int64 `json:"account_age_min_sec,omitempty"`
+	AccountAgeMaxSec int64 `json:"account_age_max_sec,omitempty"`
+	// user has at least one iap topup and claim within FirstIAPWindowSec after the first one,
+	// later topups do not matter
+	FirstIAPOnly bool `json:"first_iap_only,omitempty"`
+	// 0 is GiftCodeFirstIAPWindowSec
+	FirstIAPWindowSec int64    `json:"first_iap_window_sec,omitempty"`
+	AppPackages       []string `json:"app_packages,omitempty"`
+	// max claim of the code from one device
+	MaxPerDevice int64 `json:"max_per_device,omitempty"`
+}
+
+type GiftCodeRulesRequest struct {
+	Code       string         `json:"code,omitempty"`
+	CampaignId int64          `json:"campaign_id,omitempty"`
+	Rules      *GiftCodeRules `json:"rules"`
+}
+
+// GiftCodeClaimer info of user claim giftcode, used to check rules
+type GiftCodeClaimer struct {
+	UserId     string
+	VipLevel   int64
+	DeviceId   string
+	AppPackage string
+	// unix time of first iap topup, 0 if user has no topup or not loaded
+	FirstIAPUnix int64
+	// nil if not loaded
+	GroupInfo *UserGroupUserInfo
+}
+
+func (r *GiftCodeRules) IsEmpty() bool {
+	return r == nil || (len(r.UserGroups) == 0 && r.AccountAgeMinSec <= 0 && r.AccountAgeMaxSec <= 0 &&
+		!r.FirstIAPOnly && len(r.AppPackages) == 0 && r.MaxPerDevice <= 0)
+}
+
+// NeedGroupInfo account age and user group is checked by user group info
+func (r *GiftCodeRules) NeedGroupInfo() bool {
+	return r != nil && (len(r.UserGroups) > 0 || r.AccountAgeMinSec > 0 || r.AccountAgeMaxSec > 0)
+}
+
+// Check all rules except per-device limit, which is checked when claim
+// because it need lock the code.
+func (r *GiftCodeRules) Check(claimer *GiftCodeClaimer, nowUnix int64) error {
+	if r.IsEmpty() {
+		return nil
+	}
+	if len(r.AppPackages) > 0 {
+		found := false
+		for _, pkg := range r.AppPackages {
+			if pkg == claimer.AppPackage {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrGiftCodeRuleAppPackage
+		}
+	}
+	if r.AccountAgeMinSec > 0 || r.AccountAgeMaxSec > 0 {
+		if claimer.GroupInfo == nil || claimer.GroupInfo.CreateTime <= 0 {
+			return ErrGiftCodeRuleAccountAge
+		}
+		age := nowUnix - claimer.GroupInfo.CreateTime
+		if age < r.AccountAgeMinSec || (r.AccountAgeMaxSec > 0 && age > r.AccountAgeMaxSec) {
+			return ErrGiftCodeRuleAccountAge
+		}
+	}
+	if len(r.UserGroups) > 0 {
+		if claimer.GroupInfo == nil {
+			return ErrGiftCodeRuleUserGroup
+		}
+		match := false
+		for _, params := range r.UserGroups {
+			if UserGroupCheckCondition(claimer.GroupInfo, params) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return ErrGiftCodeRuleUserGroup
+		}
+	}
+	if r.FirstIAPOnly {
+		window := r.FirstIAPWindowSec
+		if window <= 0 {
+			window = GiftCodeFirstIAPWindowSec
+		}
+		if claimer.FirstIAPUnix <= 0 || nowUnix-claimer.FirstIAPUnix > window {
+			return ErrGiftCodeRuleFirstIAP
+		}
+	}
+	if r.MaxPerDevice > 0 && claimer.DeviceId == "" {
+		return ErrGiftCodeRuleDevice
+	}
+	return nil
+}
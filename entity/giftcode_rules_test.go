@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"testing"
+)
+
+func TestGiftCodeRulesCheck(t *testing.T) {
+	now := int64(1700000000)
+	day := int64(86400)
+	newUser := &GiftCodeClaimer{
+		DeviceId:     "d1",
+		AppPackage:   "com.game.a",
+		FirstIAPUnix: now - day,
+		GroupInfo:    &UserGroupUserInfo{VipLevel: 2, CreateTime: now - day},
+	}
+	tests := []struct {
+		name    string
+		rules   *GiftCodeRules
+		claimer *GiftCodeClaimer
+		want    error
+	}{
+		{"nil rules", nil, &GiftCodeClaimer{}, nil},
+		{"empty rules", &GiftCodeRules{}, &GiftCodeClaimer{}, nil},
+		{"app package match", &GiftCodeRules{AppPackages: []string{"com.game.b", "com.game.a"}}, newUser, nil},
+		{"app package not match", &GiftCodeRules{AppPackages: []string{"com.game.b"}}, newUser, ErrGiftCodeRuleAppPackage},
+		{"account new enough", &GiftCodeRules{AccountAgeMaxSec: 7 * day}, newUser, nil},
+		{"account too old", &GiftCodeRules{AccountAgeMaxSec: day / 2}, newUser, ErrGiftCodeRuleAccountAge},
+		{"account too young", &GiftCodeRules{AccountAgeMinSec: 2 * day}, newUser, ErrGiftCodeRuleAccountAge},
+		{"account age unknown", &GiftCodeRules{AccountAgeMinSec: 1}, &GiftCodeClaimer{}, ErrGiftCodeRuleAccountAge},
+		{"one group match", &GiftCodeRules{UserGroups: []map[string]string{
+			{"Vip": `{"min":5,"max":10}`},
+			{"Vip": `{"min":1,"max":3}`},
+		}}, newUser, nil},
+		{"no group match", &GiftCodeRules{UserGroups: []map[string]string{
+			{"Vip": `{"min":5,"max":10}`},
+		}}, newUser, ErrGiftCodeRuleUserGroup},
+		{"first iap", &GiftCodeRules{FirstIAPOnly: true}, newUser, nil},
+		{"no iap", &GiftCodeRules{FirstIAPOnly: true}, &GiftCodeClaimer{}, ErrGiftCodeRuleFirstIAP},
+		{"first iap too old", &GiftCodeRules{FirstIAPOnly: true}, &GiftCodeClaimer{FirstIAPUnix: now - 8*day}, ErrGiftCodeRuleFirstIAP},
+		{"first iap custom window", &GiftCodeRules{FirstIAPOnly: true, FirstIAPWindowSec: day / 2}, newUser, ErrGiftCodeRuleFirstIAP},
+		{"device known", &GiftCodeRules{MaxPerDevice: 1}, newUser, nil},
+		{"device unknown", &GiftCodeRules{MaxPerDevice: 1}, &GiftCodeClaimer{}, ErrGiftCodeRuleDevice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.Check(tt.claimer, now); got != tt.want {
+				t.Errorf("Check() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	InAppEventImpression = "impression"
+	InAppEventClick      = "click"
+	InAppEventDismiss    = "dismiss"
+)
+
+const (
+	InAppDailyCapMax       = 1000
+	InAppStatsDefaultLimit = 50
+)
+
+var (
+	ErrInAppEvent    = errors.New("message_id and event impression, click or dismiss are required")
+	ErrInAppCap      = errors.New("daily_cap must be between 0 and 1000")
+	ErrInAppNotFound = errors.New("in-app message not found")
+)
+
+type InAppEventRequest struct {
+	MessageId int64  `json:"message_id"`
+	Event     string `json:"event"`
+}
+
+func (r *InAppEventRequest) Validate() error {
+	if r.MessageId <= 0 {
+		return ErrInAppEvent
+	}
+	switch r.Event {
+	case InAppEventImpression, InAppEventClick, InAppEventDismiss:
+		return nil
+	}
+	return ErrInAppEvent
+}
+
+// InAppMessageCap limit how often a user see message, 0 daily cap is no limit
+type InAppMessageCap struct {
+	MessageId int64 `json:"message_id"`
+	DailyCap  int   `json:"daily_cap"`
+	// hide message after first impression
+	ShowOnce bool `json:"show_once"`
+}
+
+func (c *InAppMessageCap) Validate() error {
+	if c.MessageId <= 0 {
+		return ErrInAppEvent
+	}
+	if c.DailyCap < 0 || c.DailyCap > InAppDailyCapMax {
+		return ErrInAppCap
+	}
+	return nil
+}
+
+// Allow message can be listed to user with engagement, nil engagement is user never see it
+func (c *InAppMessageCap) Allow(e *InAppEngagement, today string) bool {
+	if e == nil {
+		return true
+	}
+	if c.ShowOnce && e.Impressions > 0 {
+		return false
+	}
+	if c.DailyCap > 0 && e.Day == today && e.DayImpressions >= c.DailyCap {
+		return false
+	}
+	return true
+}
+
+// AllowEvent event of user is counted, impression over cap or of show once message already seen
+// is ignored, click and dismiss of message user has no impression is ignored.
+func (c *InAppMessageCap) AllowEvent(event string, e *InAppEngagement, today string) bool {
+	if event == InAppEventImpression {
+		return c.Allow(e, today)
+	}
+	return e != nil && e.Impressions > 0
+}
+
+// InAppEngagement events of a user on a message, day impressions count impressions of day only
+type InAppEngagement struct {
+	MessageId      int64  `json:"message_id"`
+	UserId         string `json:"user_id"`
+	VariantId      string `json:"variant_id,omitempty"`
+	Impressions    int64  `json:"impressions"`
+	Clicks         int64  `json:"clicks"`
+	Dismisses      int64  `json:"dismisses"`
+	Day            string `json:"day"`
+	DayImpressions int    `json:"day_impressions"`
+}
+
+// InAppDay day of daily cap, in UTC
+func InAppDay(now time.Time) string {
+	return now.UTC().Format("2006-01-02")
+}
+
+// InAppMessageStat engagement of a message, ctr is clicks per impression, user ctr is users clicked per user seen
+type InAppMessageStat struct {
+	MessageId   int64   `json:"message_id"`
+	Impressions int64   `json:"impressions"`
+	Users       int64   `json:"users"`
+	Clicks      int64   `json:"clicks"`
+	ClickUsers  int64   `json:"click_users"`
+	Dismisses   int64   `json:"dismisses"`
+	Ctr         float64 `json:"ctr"`
+	UserCtr     float64 `json:"user_ctr"`
+}
+
+func (s *InAppMessageStat) ComputeCtr() {
+	s.Ctr, s.UserCtr = 0, 0
+	if s.Impressions > 0 {
+		s.Ctr = float64(s.Clicks) / float64(s.Impressions)
+	}
+	if s.Users > 0 {
+		s.UserCtr = float64(s.ClickUsers) / float64(s.Users)
+	}
+}
+
+type InAppStatsRequest struct {
+	MessageIds []int64 `json:"message_ids"`
+	Limit      int64   `json:"limit"`
+	Offset     int64   `json:"offset"`
+}
+
+type ListInAppMessageStat struct {
+	Stats []*InAppMessageStat `json:"stats"`
+}
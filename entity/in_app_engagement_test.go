@@ -0,0 +1,66 @@
+package entity
+
+import (
+	"testing"
+)
+
+func TestInAppMessageCapAllow(t *testing.T) {
+	today := "2024-05-02"
+	tests := []struct {
+		name       string
+		cap        InAppMessageCap
+		engagement *InAppEngagement
+		want       bool
+	}{
+		{"never seen", InAppMessageCap{DailyCap: 1, ShowOnce: true}, nil, true},
+		{"show once seen", InAppMessageCap{ShowOnce: true}, &InAppEngagement{Impressions: 1}, false},
+		{"show once only clicked", InAppMessageCap{ShowOnce: true}, &InAppEngagement{Clicks: 1}, true},
+		{"cap reached", InAppMessageCap{DailyCap: 3}, &InAppEngagement{Impressions: 5, Day: today, DayImpressions: 3}, false},
+		{"cap of other day", InAppMessageCap{DailyCap: 3}, &InAppEngagement{Impressions: 5, Day: "2024-05-01", DayImpressions: 3}, true},
+		{"no cap", InAppMessageCap{}, &InAppEngagement{Impressions: 50, Day: today, DayImpressions: 50}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cap.Allow(tt.engagement, today); got != tt.want {
+				t.Errorf("Allow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInAppMessageCapAllowEvent(t *testing.T) {
+	today := "2024-05-02"
+	tests := []struct {
+		name       string
+		event      string
+		cap        InAppMessageCap
+		engagement *InAppEngagement
+		want       bool
+	}{
+		{"first impression", InAppEventImpression, InAppMessageCap{ShowOnce: true}, nil, true},
+		{"impression show once seen", InAppEventImpression, InAppMessageCap{ShowOnce: true}, &InAppEngagement{Impressions: 1}, false},
+		{"click without impression", InAppEventClick, InAppMessageCap{}, nil, false},
+		{"dismiss without impression", InAppEventDismiss, InAppMessageCap{}, &InAppEngagement{Clicks: 1}, false},
+		{"click after impression", InAppEventClick, InAppMessageCap{ShowOnce: true}, &InAppEngagement{Impressions: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cap.AllowEvent(tt.event, tt.engagement, today); got != tt.want {
+				t.Errorf("AllowEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInAppMessageStatComputeCtr(t *testing.T) {
+	s := &InAppMessageStat{Impressions: 200, Users: 50, Clicks: 10, ClickUsers: 5}
+	s.ComputeCtr()
+	if s.Ctr != 0.05 || s.UserCtr != 0.1 {
+		t.Errorf("ComputeCtr() = %v, %v, want 0.05, 0.1", s.Ctr, s.UserCtr)
+	}
+	empty := &InAppMessageStat{Clicks: 1}
+	empty.ComputeCtr()
+	if empty.Ctr != 0 || empty.UserCtr != 0 {
+		t.Errorf("ComputeCtr() of no impression = %v, %v, want 0", empty.Ctr, empty.UserCtr)
+	}
+}
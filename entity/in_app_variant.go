@@ -0,0 +1,115 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	InAppVariantMax      = 10
+	InAppVariantIdMaxLen = 32
+	// topup or giftcode claim this long after first impression of a variant is counted as its conversion
+	InAppConversionWindow = 72 * time.Hour
+)
+
+// param of message data in list response holding variant id user is assigned
+const InAppVariantParam = "variant_id"
+
+const (
+	InAppConversionIap      = "iap"
+	InAppConversionGiftCode = "giftcode"
+)
+
+var ErrInAppVariant = errors.New("variants need unique id, positive weight and data, max 10 variants")
+
+// InAppVariant payload of message shown to share of users by weight, data is InAppMessageData json
+type InAppVariant struct {
+	Id     string          `json:"id"`
+	Weight int             `json:"weight"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type InAppVariantRequest struct {
+	MessageId int64           `json:"message_id"`
+	Variants  []*InAppVariant `json:"variants"`
+}
+
+// Validate empty variants remove a/b test of message
+func (r *InAppVariantRequest) Validate() error {
+	if r.MessageId <= 0 || len(r.Variants) > InAppVariantMax {
+		return ErrInAppVariant
+	}
+	seen := make(map[string]bool)
+	for _, v := range r.Variants {
+		if v.Id == "" || len(v.Id) > InAppVariantIdMaxLen || seen[v.Id] || v.Weight <= 0 || len(v.Data) == 0 {
+			return ErrInAppVariant
+		}
+		seen[v.Id] = true
+	}
+	return nil
+}
+
+// PickInAppVariant variant of user by hash of user id and message id, same user always get same variant
+// while variants of message are not changed. Nil if message has no variant.
+func PickInAppVariant(userId string, messageId int64, variants []*InAppVariant) *InAppVariant {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+	sorted := make([]*InAppVariant, len(variants))
+	copy(sorted, variants)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	h := fnv.New32a()
+	h.Write([]byte(userId + ":" + strconv.FormatInt(messageId, 10)))
+	bucket := int(h.Sum32() % uint32(total))
+	for _, v := range sorted {
+		if bucket < v.Weight {
+			return v
+		}
+		bucket -= v.Weight
+	}
+	return sorted[len(sorted)-1]
+}
+
+// InAppVariantStat exposure, engagement and conversion of users assigned to a variant
+type InAppVariantStat struct {
+	VariantId      string  `json:"variant_id"`
+	Weight         int     `json:"weight"`
+	Users          int64   `json:"users"`
+	Impressions    int64   `json:"impressions"`
+	Clicks         int64   `json:"clicks"`
+	Ctr            float64 `json:"ctr"`
+	IapUsers       int64   `json:"iap_users"`
+	IapCount       int64   `json:"iap_count"`
+	IapChips       int64   `json:"iap_chips"`
+	GiftCodeUsers  int64   `json:"giftcode_users"`
+	ConvertedUsers int64   `json:"converted_users"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+func (s *InAppVariantStat) ComputeRate() {
+	s.Ctr, s.ConversionRate = 0, 0
+	if s.Impressions > 0 {
+		s.Ctr = float64(s.Clicks) / float64(s.Impressions)
+	}
+	if s.Users > 0 {
+		s.ConversionRate = float64(s.ConvertedUsers) / float64(s.Users)
+	}
+}
+
+type InAppVariantReport struct {
+	MessageId   int64               `json:"message_id"`
+	WindowHours int64               `json:"window_hours"`
+	Variants    []*InAppVariantStat `json:"variants"`
+}
+
+type InAppVariantAssignRequest struct {
+	MessageIds []int64 `json:"message_ids"`
+}
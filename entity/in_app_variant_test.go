@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPickInAppVariant(t *testing.T) {
+	variants := []*InAppVariant{{Id: "b", Weight: 3}, {Id: "a", Weight: 1}}
+	if v := PickInAppVariant("u1", 1, nil); v != nil {
+		t.Fatalf("PickInAppVariant() of no variant = %v, want nil", v)
+	}
+	first := PickInAppVariant("u1", 1, variants)
+	// order of variants must not change assignment
+	reversed := []*InAppVariant{variants[1], variants[0]}
+	for i := 0; i < 5; i++ {
+		if got := PickInAppVariant("u1", 1, reversed); got.Id != first.Id {
+			t.Fatalf("PickInAppVariant() = %s, want stable %s", got.Id, first.Id)
+		}
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[PickInAppVariant("user-"+strconv.Itoa(i), 7, variants).Id]++
+	}
+	// weight 3:1, allow some skew of hash
+	if counts["b"] < 2700 || counts["b"] > 3300 {
+		t.Errorf("variant b assigned %d of 4000, want about 3000", counts["b"])
+	}
+}
+
+func TestInAppVariantRequestValidate(t *testing.T) {
+	data := []byte(`{}`)
+	tests := []struct {
+		name    string
+		req     InAppVariantRequest
+		wantErr error
+	}{
+		{"ok", InAppVariantRequest{MessageId: 1, Variants: []*InAppVariant{{Id: "a", Weight: 1, Data: data}, {Id: "b", Weight: 2, Data: data}}}, nil},
+		{"remove", InAppVariantRequest{MessageId: 1}, nil},
+		{"duplicate id", InAppVariantRequest{MessageId: 1, Variants: []*InAppVariant{{Id: "a", Weight: 1, Data: data}, {Id: "a", Weight: 2, Data: data}}}, ErrInAppVariant},
+		{"zero weight", InAppVariantRequest{MessageId: 1, Variants: []*InAppVariant{{Id: "a", Data: data}}}, ErrInAppVariant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"errors"
 	"time"
 )
 
@@ -12,3 +13,103 @@ type NotificationListCursor struct {
 	IsNext     bool
 	Total      int64
 }
+
+const (
+	NotiCategorySystem   = "system"
+	NotiCategoryTransfer = "transfer"
+	NotiCategoryReward   = "reward"
+	NotiCategoryPromo    = "promo"
+)
+
+var NotiCategories = []string{NotiCategorySystem, NotiCategoryTransfer, NotiCategoryReward, NotiCategoryPromo}
+
+// NotiCategoryTTL notification is deleted by cleanup job after this time
+var NotiCategoryTTL = map[string]time.Duration{
+	NotiCategorySystem:   30 * 24 * time.Hour,
+	NotiCategoryTransfer: 90 * 24 * time.Hour,
+	NotiCategoryReward:   30 * 24 * time.Hour,
+	NotiCategoryPromo:    7 * 24 * time.Hour,
+}
+
+// system and transfer notification can not be muted, user always get account and transfer receipt
+var NotiCategoryMutable = map[string]bool{
+	NotiCategoryReward: true,
+	NotiCategoryPromo:  true,
+}
+
+var (
+	ErrNotiCategory     = errors.New("category must be system, transfer, reward or promo")
+	ErrNotiMuteCategory = errors.New("only reward and promo notification can be muted")
+)
+
+func IsNotiCategory(category string) bool {
+	_, exist := NotiCategoryTTL[category]
+	return exist
+}
+
+// NotiExpireAt expire time of notification of category created at now
+func NotiExpireAt(category string, now time.Time) time.Time {
+	ttl, exist := NotiCategoryTTL[category]
+	if !exist {
+		ttl = NotiCategoryTTL[NotiCategorySystem]
+	}
+	return now.Add(ttl)
+}
+
+// NotificationPreference muted category is not saved nor pushed,
+// push muted category is saved in list but not pushed realtime
+type NotificationPreference struct {
+	UserId         string   `json:"user_id,omitempty"`
+	Muted          []string `json:"muted"`
+	PushMuted      []string `json:"push_muted"`
+	UpdateTimeUnix int64    `json:"update_time_unix,omitempty"`
+}
+
+func (p *NotificationPreference) Validate() error {
+	for _, c := range p.Muted {
+		if !IsNotiCategory(c) {
+			return ErrNotiCategory
+		}
+		if !NotiCategoryMutable[c] {
+			return ErrNotiMuteCategory
+		}
+	}
+	for _, c := range p.PushMuted {
+		if !IsNotiCategory(c) {
+			return ErrNotiCategory
+		}
+	}
+	p.Muted, p.PushMuted = uniqueStrings(p.Muted), uniqueStrings(p.PushMuted)
+	return nil
+}
+
+func (p *NotificationPreference) IsMuted(category string) bool {
+	return NotiCategoryMutable[category] && containsString(p.Muted, category)
+}
+
+func (p *NotificationPreference) IsPushMuted(category string) bool {
+	return containsString(p.PushMuted, category)
+}
+
+type NotiCategoryRequest struct {
+	Category string `json:"category"`
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueStrings(list []string) []string {
+	ml := make([]string, 0, len(list))
+	for _, v := range list {
+		if !containsString(ml, v) {
+			ml = append(ml, v)
+		}
+	}
+	return ml
+}
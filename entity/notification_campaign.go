@@ -0,0 +1,127 @@
+package entity
+
+import (
+	"errors"
+	"sort"
+)
+
+const (
+	NotiAudienceUserGroup = "user_group"
+	NotiAudienceIds       = "ids"
+	NotiAudienceAll       = "all"
+)
+
+const (
+	NotiCampaignStatusScheduled = 0
+	NotiCampaignStatusRunning   = 1
+	NotiCampaignStatusDone      = 2
+	NotiCampaignStatusCancelled = 3
+)
+
+const (
+	NotiCampaignBatch        = 500
+	NotiCampaignMaxIds       = 100000
+	NotiCampaignDefaultLimit = 50
+	// running campaign not update progress in this time is taken over by other worker
+	NotiCampaignLeaseSec = 120
+	// batch fail to save this number of times is counted failed and cursor move past it
+	NotiCampaignBatchAttempts = 3
+)
+
+var (
+	ErrNotiCampaignEmpty    = errors.New("title, content and type are required")
+	ErrNotiCampaignAudience = errors.New("audience must be user_group with user_group_id, ids with user_ids, or all")
+	ErrNotiCampaignStatus   = errors.New("campaign is already done or cancelled")
+)
+
+// NotificationCampaign notification send to an audience at send time by worker in batches,
+// cursor is last recipient id sent so worker resume after restart
+type NotificationCampaign struct {
+	Id       int64  `json:"id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Type     int32  `json:"type"`
+	Audience string `json:"audience"`
+	// category of notification, default system
+	Category     string   `json:"category"`
+	UserGroupId  int64    `json:"user_group_id,omitempty"`
+	UserIds      []string `json:"user_ids,omitempty"`
+	SendTimeUnix int64    `json:"send_time_unix"`
+	Status       int      `json:"status"`
+	Total        int64    `json:"total"`
+	Sent         int64    `json:"sent"`
+	Failed       int64    `json:"failed"`
+	// recipients muted category
+	Skipped        int64  `json:"skipped"`
+	Cursor         string `json:"cursor"`
+	LastError      string `json:"last_error,omitempty"`
+	CreateTimeUnix int64  `json:"create_time_unix"`
+	UpdateTimeUnix int64  `json:"update_time_unix"`
+	FinishTimeUnix int64  `json:"finish_time_unix,omitempty"`
+	// failed attempts of batch after cursor, reset when cursor move
+	BatchAttempts int `json:"batch_attempts,omitempty"`
+}
+
+func (c *NotificationCampaign) Validate() error {
+	if c.Title == "" || c.Content == "" || c.Type <= 0 {
+		return ErrNotiCampaignEmpty
+	}
+	if c.Category == "" {
+		c.Category = NotiCategorySystem
+	}
+	if !IsNotiCategory(c.Category) {
+		return ErrNotiCategory
+	}
+	switch c.Audience {
+	case NotiAudienceUserGroup:
+		if c.UserGroupId <= 0 {
+			return ErrNotiCampaignAudience
+		}
+	case NotiAudienceIds:
+		if len(c.UserIds) == 0 || len(c.UserIds) > NotiCampaignMaxIds {
+			return ErrNotiCampaignAudience
+		}
+	case NotiAudienceAll:
+	default:
+		return ErrNotiCampaignAudience
+	}
+	return nil
+}
+
+func (c *NotificationCampaign) IsFinished() bool {
+	return c.Status == NotiCampaignStatusDone || c.Status == NotiCampaignStatusCancelled
+}
+
+// NextRecipients next batch of sorted unique ids after cursor
+func NextRecipients(ids []string, cursor string, batch int) []string {
+	sorted := make([]string, 0, len(ids))
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+	idx := sort.SearchStrings(sorted, cursor)
+	if idx < len(sorted) && sorted[idx] == cursor {
+		idx++
+	}
+	end := idx + batch
+	if end > len(sorted) {
+		end = len(sorted)
+	}
+	return sorted[idx:end]
+}
+
+type NotiCampaignRequest struct {
+	Id     int64 `json:"id"`
+	Status *int  `json:"status"`
+	Limit  int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+}
+
+type ListNotificationCampaign struct {
+	Campaigns []*NotificationCampaign `json:"campaigns"`
+}
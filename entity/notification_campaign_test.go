@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNextRecipients(t *testing.T) {
+	ids := []string{"d", "b", "a", "c", "b", "", "e"}
+	tests := []struct {
+		cursor string
+		batch  int
+		want   []string
+	}{
+		{"", 2, []string{"a", "b"}},
+		{"b", 2, []string{"c", "d"}},
+		{"bb", 2, []string{"c", "d"}},
+		{"d", 5, []string{"e"}},
+		{"e", 5, []string{}},
+	}
+	for _, tt := range tests {
+		if got := NextRecipients(ids, tt.cursor, tt.batch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NextRecipients(%q, %d) = %v, want %v", tt.cursor, tt.batch, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationCampaignValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		campaign NotificationCampaign
+		wantErr  error
+	}{
+		{"all", NotificationCampaign{Title: "t", Content: "c", Type: 1, Audience: NotiAudienceAll}, nil},
+		{"ids", NotificationCampaign{Title: "t", Content: "c", Type: 1, Audience: NotiAudienceIds, UserIds: []string{"u"}}, nil},
+		{"ids empty", NotificationCampaign{Title: "t", Content: "c", Type: 1, Audience: NotiAudienceIds}, ErrNotiCampaignAudience},
+		{"group without id", NotificationCampaign{Title: "t", Content: "c", Type: 1, Audience: NotiAudienceUserGroup}, ErrNotiCampaignAudience},
+		{"unknown audience", NotificationCampaign{Title: "t", Content: "c", Type: 1, Audience: "vip"}, ErrNotiCampaignAudience},
+		{"no type", NotificationCampaign{Title: "t", Content: "c", Audience: NotiAudienceAll}, ErrNotiCampaignEmpty},
+		{"unknown category", NotificationCampaign{Title: "t", Content: "c", Type: 1, Audience: NotiAudienceAll, Category: "news"}, ErrNotiCategory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.campaign.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && tt.campaign.Category != NotiCategorySystem {
+				t.Errorf("Validate() category = %v, want %v", tt.campaign.Category, NotiCategorySystem)
+			}
+		})
+	}
+}
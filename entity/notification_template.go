@@ -0,0 +1,249 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// template id of system notifications
+const (
+	NotiTplGift               = "gift"
+	NotiTplFreeChipReady      = "freechip_ready"
+	NotiTplFreeChipCampaign   = "freechip_campaign"
+	NotiTplExchangeDone       = "exchange_done"
+	NotiTplExchangeReject     = "exchange_reject"
+	NotiTplSingleDevice       = "single_device"
+	NotiTplGiftCodeBruteForce = "giftcode_brute_force"
+)
+
+const (
+	NotiParamString = "string"
+	NotiParamInt    = "int"
+	// chips is int formatted with thousand separator
+	NotiParamChips = "chips"
+	NotiParamTime  = "time"
+)
+
+// DefaultNotiLocale is last locale in fallback chain, built-in templates are in this locale
+const DefaultNotiLocale = "en-US"
+
+var (
+	ErrNotiTplId          = errors.New("id and locale are required")
+	ErrNotiTplEmpty       = errors.New("title and content are required")
+	ErrNotiTplParamType   = errors.New("param type must be string, int, chips or time")
+	ErrNotiTplPlaceholder = errors.New("placeholder is not declared in params")
+	ErrNotiTplValue       = errors.New("value of param is missing or wrong type")
+	ErrNotiTplNotFound    = errors.New("notification template not found")
+)
+
+var notiPlaceholderRegexp = regexp.MustCompile(`\{([a-z0-9_]+)\}`)
+
+type NotiTplParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// NotificationTemplate title and content of a notification in a locale, {name} is replaced by value of param
+type NotificationTemplate struct {
+	Id      string          `json:"id"`
+	Locale  string          `json:"locale"`
+	Title   string          `json:"title"`
+	Content string          `json:"content"`
+	Params  []*NotiTplParam `json:"params"`
+	// override type of notification, 0 is type given by sender
+	Type           int32 `json:"type"`
+	CreateTimeUnix int64 `json:"create_time_unix"`
+	UpdateTimeUnix int64 `json:"update_time_unix"`
+}
+
+// Validate params of system template are fixed by code, only placeholders sender give can be used
+func (t *NotificationTemplate) Validate() error {
+	if t.Id == "" || t.Locale == "" {
+		return ErrNotiTplId
+	}
+	if def, exist := DefaultNotiTemplates[t.Id]; exist {
+		t.Params = def.Params
+	}
+	if t.Title == "" || t.Content == "" {
+		return ErrNotiTplEmpty
+	}
+	params := make(map[string]bool)
+	for _, p := range t.Params {
+		switch p.Type {
+		case NotiParamString, NotiParamInt, NotiParamChips, NotiParamTime:
+		default:
+			return fmt.Errorf("%w: %s", ErrNotiTplParamType, p.Name)
+		}
+		params[p.Name] = true
+	}
+	for _, s := range []string{t.Title, t.Content} {
+		for _, m := range notiPlaceholderRegexp.FindAllStringSubmatch(s, -1) {
+			if !params[m[1]] {
+				return fmt.Errorf("%w: {%s}", ErrNotiTplPlaceholder, m[1])
+			}
+		}
+	}
+	return nil
+}
+
+// Render replace placeholders with values, value is checked by type of param
+func (t *NotificationTemplate) Render(values map[string]interface{}) (string, string, error) {
+	pairs := make([]string, 0, len(t.Params)*2)
+	for _, p := range t.Params {
+		str, err := formatNotiValue(p.Type, values[p.Name])
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %s", err, p.Name)
+		}
+		pairs = append(pairs, "{"+p.Name+"}", str)
+	}
+	r := strings.NewReplacer(pairs...)
+	return r.Replace(t.Title), r.Replace(t.Content), nil
+}
+
+func formatNotiValue(paramType string, v interface{}) (string, error) {
+	switch paramType {
+	case NotiParamString:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case NotiParamInt, NotiParamChips:
+		var n int64
+		switch x := v.(type) {
+		case int:
+			n = int64(x)
+		case int32:
+			n = int64(x)
+		case int64:
+			n = x
+		default:
+			return "", ErrNotiTplValue
+		}
+		if paramType == NotiParamInt {
+			return strconv.FormatInt(n, 10), nil
+		}
+		return FormatChips(n), nil
+	case NotiParamTime:
+		switch x := v.(type) {
+		case time.Time:
+			if x.IsZero() {
+				return "", nil
+			}
+			return x.Format("2006-01-02 15:04"), nil
+		case int64:
+			if x <= 0 {
+				return "", nil
+			}
+			return time.Unix(x, 0).Format("2006-01-02 15:04"), nil
+		}
+	}
+	return "", ErrNotiTplValue
+}
+
+// FormatChips 1234567 -> 1,234,567
+func FormatChips(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// NotiLocaleFallbacks locales to try for lang tag of user: tl-PH -> tl-PH, tl, en-US, en
+func NotiLocaleFallbacks(langTag string) []string {
+	chain := make([]string, 0, 4)
+	add := func(locale string) {
+		if locale == "" {
+			return
+		}
+		for _, l := range chain {
+			if strings.EqualFold(l, locale) {
+				return
+			}
+		}
+		chain = append(chain, locale)
+	}
+	langTag = strings.ReplaceAll(strings.TrimSpace(langTag), "_", "-")
+	add(langTag)
+	add(strings.Split(langTag, "-")[0])
+	add(DefaultNotiLocale)
+	add(strings.Split(DefaultNotiLocale, "-")[0])
+	return chain
+}
+
+// PickNotiTemplate first template in fallback order of locales, nil if none
+func PickNotiTemplate(templates []*NotificationTemplate, locales []string) *NotificationTemplate {
+	for _, locale := range locales {
+		for _, t := range templates {
+			if strings.EqualFold(t.Locale, locale) {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// DefaultNotiTemplates built-in templates, used when no template of id is saved for any locale of fallback chain
+var DefaultNotiTemplates = map[string]*NotificationTemplate{
+	NotiTplGift: {
+		Id: NotiTplGift, Locale: DefaultNotiLocale,
+		Title:   "Gift",
+		Content: "{sender} sent you {chips} chips",
+		Params:  []*NotiTplParam{{Name: "sender", Type: NotiParamString}, {Name: "chips", Type: NotiParamChips}},
+	},
+	NotiTplFreeChipReady: {
+		Id: NotiTplFreeChipReady, Locale: DefaultNotiLocale,
+		Title:   "Freechip",
+		Content: "You have {chips} free chips, claim them now!",
+		Params:  []*NotiTplParam{{Name: "chips", Type: NotiParamChips}},
+	},
+	NotiTplFreeChipCampaign: {
+		Id: NotiTplFreeChipCampaign, Locale: DefaultNotiLocale,
+		Title:   "Freechip",
+		Content: "You have {chips} free chips, claim them now!",
+		Params: []*NotiTplParam{{Name: "chips", Type: NotiParamChips}, {Name: "expire", Type: NotiParamTime},
+			{Name: "sid", Type: NotiParamString}},
+	},
+	NotiTplExchangeDone: {
+		Id: NotiTplExchangeDone, Locale: DefaultNotiLocale,
+		Title:   "Exchange completed",
+		Content: "Your exchange {id} of {chips} chips is completed.",
+		Params:  []*NotiTplParam{{Name: "id", Type: NotiParamString}, {Name: "chips", Type: NotiParamChips}, {Name: "reason", Type: NotiParamString}},
+	},
+	NotiTplExchangeReject: {
+		Id: NotiTplExchangeReject, Locale: DefaultNotiLocale,
+		Title:   "Exchange rejected",
+		Content: "Your exchange {id} of {chips} chips is rejected. {reason}",
+		Params:  []*NotiTplParam{{Name: "id", Type: NotiParamString}, {Name: "chips", Type: NotiParamChips}, {Name: "reason", Type: NotiParamString}},
+	},
+	NotiTplSingleDevice: {
+		Id: NotiTplSingleDevice, Locale: DefaultNotiLocale,
+		Title:   "Another device is active!",
+		Content: "Another device is active!",
+	},
+	NotiTplGiftCodeBruteForce: {
+		Id: NotiTplGiftCodeBruteForce, Locale: DefaultNotiLocale,
+		Title:   "Giftcode brute-force by {key_type} {key_value}",
+		Content: "The {key_type} {key_value} failed {fail_count} giftcode attempts, last code {last_code}",
+		Params: []*NotiTplParam{{Name: "key_type", Type: NotiParamString}, {Name: "key_value", Type: NotiParamString},
+			{Name: "fail_count", Type: NotiParamInt}, {Name: "last_code", Type: NotiParamString}},
+	},
+}
+
+type NotiTplRequest struct {
+	Id     string `json:"id"`
+	Locale string `json:"locale"`
+}
+
+type ListNotificationTemplate struct {
+	Templates []*NotificationTemplate `json:"templates"`
+	// built-in templates of system notifications with their params
+	Defaults []*NotificationTemplate `json:"defaults,omitempty"`
+}
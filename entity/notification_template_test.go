@@ -0,0 +1,102 @@
+package entity
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotiLocaleFallbacks(t *testing.T) {
+	tests := []struct {
+		langTag string
+		want    []string
+	}{
+		{"tl-PH", []string{"tl-PH", "tl", "en-US", "en"}},
+		{"tl_PH", []string{"tl-PH", "tl", "en-US", "en"}},
+		{"en", []string{"en", "en-US"}},
+		{"", []string{"en-US", "en"}},
+	}
+	for _, tt := range tests {
+		if got := NotiLocaleFallbacks(tt.langTag); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NotiLocaleFallbacks(%q) = %v, want %v", tt.langTag, got, tt.want)
+		}
+	}
+	templates := []*NotificationTemplate{{Locale: "en-US"}, {Locale: "tl"}}
+	if got := PickNotiTemplate(templates, NotiLocaleFallbacks("tl-PH")); got != templates[1] {
+		t.Errorf("PickNotiTemplate tl-PH = %+v, want tl", got)
+	}
+	if got := PickNotiTemplate(templates, NotiLocaleFallbacks("vi")); got != templates[0] {
+		t.Errorf("PickNotiTemplate vi = %+v, want en-US", got)
+	}
+}
+
+func TestNotificationTemplateRender(t *testing.T) {
+	expire := time.Date(2026, 1, 2, 15, 4, 0, 0, time.Local)
+	tests := []struct {
+		name        string
+		tpl         *NotificationTemplate
+		values      map[string]interface{}
+		wantTitle   string
+		wantContent string
+		wantErr     error
+	}{
+		{
+			name:        "typed values",
+			tpl:         DefaultNotiTemplates[NotiTplFreeChipCampaign],
+			values:      map[string]interface{}{"chips": int64(1500000), "expire": expire, "sid": "123"},
+			wantTitle:   "Freechip",
+			wantContent: "You have 1,500,000 free chips, claim them now!",
+		},
+		{
+			name:        "gift",
+			tpl:         DefaultNotiTemplates[NotiTplGift],
+			values:      map[string]interface{}{"sender": "alice", "chips": int64(25000)},
+			wantTitle:   "Gift",
+			wantContent: "alice sent you 25,000 chips",
+		},
+		{
+			name: "localized",
+			tpl: &NotificationTemplate{Id: NotiTplExchangeReject, Locale: "tl", Title: "Tinanggihan",
+				Content: "Ang {chips} chips ay tinanggihan: {reason}", Params: DefaultNotiTemplates[NotiTplExchangeReject].Params},
+			values:      map[string]interface{}{"id": "x", "chips": int64(-1000), "reason": "KYC"},
+			wantTitle:   "Tinanggihan",
+			wantContent: "Ang -1,000 chips ay tinanggihan: KYC",
+		},
+		{
+			name:    "wrong type",
+			tpl:     DefaultNotiTemplates[NotiTplFreeChipReady],
+			values:  map[string]interface{}{"chips": "100"},
+			wantErr: ErrNotiTplValue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, content, err := tt.tpl.Render(tt.values)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Render() error = %v, want %v", err, tt.wantErr)
+			}
+			if title != tt.wantTitle || content != tt.wantContent {
+				t.Errorf("Render() = %q, %q, want %q, %q", title, content, tt.wantTitle, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestNotificationTemplateValidate(t *testing.T) {
+	for id, tpl := range DefaultNotiTemplates {
+		if err := tpl.Validate(); err != nil {
+			t.Errorf("default template %s invalid: %v", id, err)
+		}
+	}
+	tpl := &NotificationTemplate{Id: NotiTplFreeChipReady, Locale: "tl-PH", Title: "Libreng chips",
+		Content: "{chips} {expire}", Params: []*NotiTplParam{{Name: "expire", Type: NotiParamTime}}}
+	if err := tpl.Validate(); !errors.Is(err, ErrNotiTplPlaceholder) {
+		t.Errorf("Validate() = %v, want %v", err, ErrNotiTplPlaceholder)
+	}
+	custom := &NotificationTemplate{Id: "promo", Locale: "en", Title: "Promo", Content: "{code}",
+		Params: []*NotiTplParam{{Name: "code", Type: "bool"}}}
+	if err := custom.Validate(); !errors.Is(err, ErrNotiTplParamType) {
+		t.Errorf("Validate() = %v, want %v", err, ErrNotiTplParamType)
+	}
+}
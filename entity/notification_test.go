@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotiExpireAt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		category string
+		want     time.Time
+	}{
+		{NotiCategoryPromo, now.AddDate(0, 0, 7)},
+		{NotiCategoryTransfer, now.AddDate(0, 0, 90)},
+		{NotiCategoryReward, now.AddDate(0, 0, 30)},
+		{"unknown", now.AddDate(0, 0, 30)},
+	}
+	for _, tt := range tests {
+		if got := NotiExpireAt(tt.category, now); !got.Equal(tt.want) {
+			t.Errorf("NotiExpireAt(%q) = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationPreferenceValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		pref    NotificationPreference
+		wantErr error
+		want    []string
+	}{
+		{"dedupe", NotificationPreference{Muted: []string{NotiCategoryPromo, NotiCategoryPromo, NotiCategoryReward}},
+			nil, []string{NotiCategoryPromo, NotiCategoryReward}},
+		{"mute transfer", NotificationPreference{Muted: []string{NotiCategoryTransfer}}, ErrNotiMuteCategory, nil},
+		{"unknown", NotificationPreference{PushMuted: []string{"news"}}, ErrNotiCategory, nil},
+		{"push mute system", NotificationPreference{PushMuted: []string{NotiCategorySystem}}, nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.pref.Validate()
+			if err != tt.wantErr {
+				t.Fatalf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(tt.pref.Muted, tt.want) {
+				t.Errorf("Muted = %v, want %v", tt.pref.Muted, tt.want)
+			}
+		})
+	}
+	pref := &NotificationPreference{Muted: []string{NotiCategoryPromo}, PushMuted: []string{NotiCategorySystem}}
+	if !pref.IsMuted(NotiCategoryPromo) || pref.IsMuted(NotiCategoryReward) {
+		t.Errorf("IsMuted wrong for %v", pref.Muted)
+	}
+	if !pref.IsPushMuted(NotiCategorySystem) || pref.IsPushMuted(NotiCategoryPromo) {
+		t.Errorf("IsPushMuted wrong for %v", pref.PushMuted)
+	}
+}
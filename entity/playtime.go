@@ -0,0 +1,213 @@
+package entity
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PlaytimeKindOnline = "online"
+	PlaytimeKindMatch  = "match"
+)
+
+var (
+	ErrPlaytimeNoMilestone   = errors.New("no milestone reached")
+	ErrPlaytimeMilestoneSec  = errors.New("milestone sec must increase")
+	ErrPlaytimeMilestoneChip = errors.New("milestone chips must be positive")
+)
+
+const (
+	// node update heartbeat in this interval, presences of node count until last heartbeat
+	PlaytimeNodeHeartbeat = time.Minute
+	// node without heartbeat in this time is dead, its presences are counted and removed by other node
+	PlaytimeNodeStale = 5 * time.Minute
+)
+
+// PlaytimeMilestone reward when online (or match) sec of day reach Sec
+type PlaytimeMilestone struct {
+	Sec   int64 `json:"sec"`
+	Chips int64 `json:"chips"`
+}
+
+// DefaultPlaytimeMilestones can be override by env playtime_milestones,
+// separate from online_chip of daily reward template which is paid by daily reward claim
+var DefaultPlaytimeMilestones = []*PlaytimeMilestone{
+	{Sec: 10 * 60, Chips: 500},
+	{Sec: 30 * 60, Chips: 1000},
+	{Sec: 60 * 60, Chips: 2000},
+	{Sec: 120 * 60, Chips: 5000},
+}
+
+// DefaultPlaytimeMatchMilestones time in match, can be override by env playtime_match_milestones
+var DefaultPlaytimeMatchMilestones = []*PlaytimeMilestone{
+	{Sec: 15 * 60, Chips: 1000},
+	{Sec: 60 * 60, Chips: 3000},
+}
+
+// PlaytimePresence user has presence of kind on a node
+type PlaytimePresence struct {
+	UserId string
+	Kind   string
+}
+
+// PlaytimeDay active seconds of user in a day of user timezone
+type PlaytimeDay struct {
+	UserId    string `json:"user_id"`
+	Day       string `json:"day"`
+	OnlineSec int64  `json:"online_sec"`
+	MatchSec  int64  `json:"match_sec"`
+	// number of milestones claimed, milestones claim in order
+	Claimed      int `json:"claimed"`
+	MatchClaimed int `json:"match_claimed"`
+}
+
+type PlaytimeMilestoneState struct {
+	PlaytimeMilestone
+	Reached bool `json:"reached"`
+	Claimed bool `json:"claimed"`
+}
+
+// PlaytimeProgress status of online time reward in today
+type PlaytimeProgress struct {
+	Day        string                    `json:"day"`
+	OnlineSec  int64                     `json:"online_sec"`
+	MatchSec   int64                     `json:"match_sec"`
+	Milestones []*PlaytimeMilestoneState `json:"milestones"`
+	// milestones of time in match
+	MatchMilestones []*PlaytimeMilestoneState `json:"match_milestones"`
+	// total chips of reached milestones not claimed yet
+	ClaimableChips int64 `json:"claimable_chips"`
+	// seconds to next milestone, 0 if all reached
+	NextMilestoneSec      int64 `json:"next_milestone_sec"`
+	NextMatchMilestoneSec int64 `json:"next_match_milestone_sec"`
+	// user is online now, client count down next_milestone_sec
+	Active         bool  `json:"active"`
+	ServerTimeUnix int64 `json:"server_time_unix"`
+	// chips added by this claim
+	ClaimChips int64 `json:"claim_chips,omitempty"`
+}
+
+// ParsePlaytimeMilestones parse "600=500,1800=1000", sec=chips
+func ParsePlaytimeMilestones(s string) ([]*PlaytimeMilestone, error) {
+	ml := make([]*PlaytimeMilestone, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		arr := strings.SplitN(item, "=", 2)
+		if len(arr) != 2 {
+			return nil, ErrPlaytimeMilestoneSec
+		}
+		sec, err := strconv.ParseInt(strings.TrimSpace(arr[0]), 10, 64)
+		if err != nil {
+			return nil, ErrPlaytimeMilestoneSec
+		}
+		chips, err := strconv.ParseInt(strings.TrimSpace(arr[1]), 10, 64)
+		if err != nil {
+			return nil, ErrPlaytimeMilestoneChip
+		}
+		ml = append(ml, &PlaytimeMilestone{Sec: sec, Chips: chips})
+	}
+	sort.Slice(ml, func(i, j int) bool { return ml[i].Sec < ml[j].Sec })
+	return ml, ValidatePlaytimeMilestones(ml)
+}
+
+func ValidatePlaytimeMilestones(ml []*PlaytimeMilestone) error {
+	if len(ml) == 0 {
+		return ErrPlaytimeMilestoneSec
+	}
+	var lastSec int64
+	for _, m := range ml {
+		if m.Sec <= lastSec {
+			return ErrPlaytimeMilestoneSec
+		}
+		if m.Chips <= 0 {
+			return ErrPlaytimeMilestoneChip
+		}
+		lastSec = m.Sec
+	}
+	return nil
+}
+
+// SplitPlaytimeByDay split active time [from, to) by day of loc, return seconds per day
+func SplitPlaytimeByDay(from, to time.Time, loc *time.Location) map[string]int64 {
+	ml := make(map[string]int64)
+	for from.Before(to) {
+		nextMidnight := Midnight(from, loc).AddDate(0, 0, 1)
+		end := to
+		if nextMidnight.Before(to) {
+			end = nextMidnight
+		}
+		if sec := int64(end.Sub(from).Seconds()); sec > 0 {
+			ml[DailyRewardDay(from, loc)] += sec
+		}
+		from = end
+	}
+	return ml
+}
+
+// buildMilestoneStates state of milestones at sec, return claimable chips and seconds to next milestone
+func buildMilestoneStates(sec int64, claimed int, milestones []*PlaytimeMilestone) ([]*PlaytimeMilestoneState, int64, int64) {
+	states := make([]*PlaytimeMilestoneState, 0, len(milestones))
+	var claimable, next int64
+	for idx, m := range milestones {
+		state := &PlaytimeMilestoneState{
+			PlaytimeMilestone: *m,
+			Reached:           sec >= m.Sec,
+			Claimed:           idx < claimed,
+		}
+		if state.Reached && !state.Claimed {
+			claimable += m.Chips
+		}
+		if !state.Reached && next == 0 {
+			next = m.Sec - sec
+		}
+		states = append(states, state)
+	}
+	return states, claimable, next
+}
+
+// BuildPlaytimeProgress progress of online and match milestones in day
+func BuildPlaytimeProgress(day *PlaytimeDay, milestones, matchMilestones []*PlaytimeMilestone, active bool, now time.Time) *PlaytimeProgress {
+	progress := &PlaytimeProgress{
+		Day:            day.Day,
+		OnlineSec:      day.OnlineSec,
+		MatchSec:       day.MatchSec,
+		Active:         active,
+		ServerTimeUnix: now.Unix(),
+	}
+	var onlineChips, matchChips int64
+	progress.Milestones, onlineChips, progress.NextMilestoneSec = buildMilestoneStates(day.OnlineSec, day.Claimed, milestones)
+	progress.MatchMilestones, matchChips, progress.NextMatchMilestoneSec = buildMilestoneStates(day.MatchSec, day.MatchClaimed, matchMilestones)
+	progress.ClaimableChips = onlineChips + matchChips
+	return progress
+}
+
+// claimMilestones chips of reached milestones after claimed, return new number of claimed
+func claimMilestones(sec int64, claimed int, milestones []*PlaytimeMilestone) (int64, int) {
+	var chips int64
+	for idx := claimed; idx < len(milestones); idx++ {
+		if sec < milestones[idx].Sec {
+			break
+		}
+		chips += milestones[idx].Chips
+		claimed = idx + 1
+	}
+	return chips, claimed
+}
+
+// ClaimPlaytime mark all reached online and match milestones claimed, return chips
+func (d *PlaytimeDay) ClaimPlaytime(milestones, matchMilestones []*PlaytimeMilestone) (int64, error) {
+	onlineChips, claimed := claimMilestones(d.OnlineSec, d.Claimed, milestones)
+	matchChips, matchClaimed := claimMilestones(d.MatchSec, d.MatchClaimed, matchMilestones)
+	if claimed == d.Claimed && matchClaimed == d.MatchClaimed {
+		return 0, ErrPlaytimeNoMilestone
+	}
+	d.Claimed = claimed
+	d.MatchClaimed = matchClaimed
+	return onlineChips + matchChips, nil
+}
@@ -0,0 +1,96 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitPlaytimeByDay(t *testing.T) {
+	loc := time.FixedZone("WAT", 3600)
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want map[string]int64
+	}{
+		{"same day", time.Date(2024, 1, 1, 10, 0, 0, 0, loc), time.Date(2024, 1, 1, 10, 30, 0, 0, loc),
+			map[string]int64{"2024-01-01": 1800}},
+		{"over midnight", time.Date(2024, 1, 1, 23, 50, 0, 0, loc), time.Date(2024, 1, 2, 0, 5, 0, 0, loc),
+			map[string]int64{"2024-01-01": 600, "2024-01-02": 300}},
+		{"midnight in user timezone", time.Date(2024, 1, 1, 22, 50, 0, 0, time.UTC), time.Date(2024, 1, 1, 23, 5, 0, 0, time.UTC),
+			map[string]int64{"2024-01-01": 600, "2024-01-02": 300}},
+		{"many days", time.Date(2024, 1, 1, 12, 0, 0, 0, loc), time.Date(2024, 1, 3, 12, 0, 0, 0, loc),
+			map[string]int64{"2024-01-01": 12 * 3600, "2024-01-02": 24 * 3600, "2024-01-03": 12 * 3600}},
+		{"to before from", time.Date(2024, 1, 1, 12, 0, 0, 0, loc), time.Date(2024, 1, 1, 11, 0, 0, 0, loc),
+			map[string]int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitPlaytimeByDay(tt.from, tt.to, loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitPlaytimeByDay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaytimeClaim(t *testing.T) {
+	milestones := []*PlaytimeMilestone{{Sec: 600, Chips: 500}, {Sec: 1800, Chips: 1000}, {Sec: 3600, Chips: 2000}}
+	matchMilestones := []*PlaytimeMilestone{{Sec: 900, Chips: 3000}}
+	tests := []struct {
+		name             string
+		day              PlaytimeDay
+		wantChips        int64
+		wantClaimed      int
+		wantMatchClaimed int
+		wantErr          error
+	}{
+		{"not reach", PlaytimeDay{OnlineSec: 599}, 0, 0, 0, ErrPlaytimeNoMilestone},
+		{"first", PlaytimeDay{OnlineSec: 600}, 500, 1, 0, nil},
+		{"two at once", PlaytimeDay{OnlineSec: 2000}, 1500, 2, 0, nil},
+		{"skip claimed", PlaytimeDay{OnlineSec: 4000, Claimed: 2}, 2000, 3, 0, nil},
+		{"all claimed", PlaytimeDay{OnlineSec: 9000, Claimed: 3}, 0, 3, 0, ErrPlaytimeNoMilestone},
+		{"match", PlaytimeDay{OnlineSec: 1000, MatchSec: 900, Claimed: 1}, 3000, 1, 1, nil},
+		{"online and match", PlaytimeDay{OnlineSec: 1000, MatchSec: 900}, 3500, 1, 1, nil},
+		{"match claimed", PlaytimeDay{OnlineSec: 1000, MatchSec: 2000, Claimed: 1, MatchClaimed: 1}, 0, 1, 1, ErrPlaytimeNoMilestone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.day
+			progress := BuildPlaytimeProgress(&d, milestones, matchMilestones, true, time.Now())
+			chips, err := d.ClaimPlaytime(milestones, matchMilestones)
+			if chips != tt.wantChips || err != tt.wantErr || d.Claimed != tt.wantClaimed || d.MatchClaimed != tt.wantMatchClaimed {
+				t.Errorf("ClaimPlaytime() = %d, %v claimed %d %d, want %d, %v claimed %d %d",
+					chips, err, d.Claimed, d.MatchClaimed, tt.wantChips, tt.wantErr, tt.wantClaimed, tt.wantMatchClaimed)
+			}
+			if progress.ClaimableChips != tt.wantChips {
+				t.Errorf("BuildPlaytimeProgress() claimable %d, want %d", progress.ClaimableChips, tt.wantChips)
+			}
+		})
+	}
+}
+
+func TestParsePlaytimeMilestones(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []*PlaytimeMilestone
+		wantErr error
+	}{
+		{"1800=1000, 600=500", []*PlaytimeMilestone{{Sec: 600, Chips: 500}, {Sec: 1800, Chips: 1000}}, nil},
+		{"600=500,600=700", nil, ErrPlaytimeMilestoneSec},
+		{"600=0", nil, ErrPlaytimeMilestoneChip},
+		{"abc", nil, ErrPlaytimeMilestoneSec},
+		{"", nil, ErrPlaytimeMilestoneSec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParsePlaytimeMilestones(tt.s)
+			if err != tt.wantErr {
+				t.Fatalf("ParsePlaytimeMilestones() error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePlaytimeMilestones() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
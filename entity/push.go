@@ -0,0 +1,84 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	PushPlatformAndroid = "android"
+	PushPlatformIos     = "ios"
+)
+
+const (
+	PushStatusPending = 0
+	PushStatusDone    = 1
+	PushStatusFailed  = 2
+)
+
+const (
+	PushTokenMaxLen = 4096
+	// after max attempts, push is mark failed
+	PushMaxAttempts = 6
+	// batch is small, lease of push not sent yet in batch is extended before each token is sent
+	PushBatch = 10
+	// push claimed by worker is not picked by other worker in this time
+	PushLeaseSec = 60
+	// done and failed push older than this are deleted by cleanup
+	PushKeepDays = 7
+)
+
+var (
+	ErrPushToken    = errors.New("token and app_package are required")
+	ErrPushPlatform = errors.New("platform must be android or ios")
+)
+
+// PushToken device token of user in an app, a token belong to the last user registered it
+type PushToken struct {
+	UserId         string `json:"user_id,omitempty"`
+	AppPackage     string `json:"app_package"`
+	Token          string `json:"token"`
+	Platform       string `json:"platform"`
+	CreateTimeUnix int64  `json:"create_time_unix,omitempty"`
+	UpdateTimeUnix int64  `json:"update_time_unix,omitempty"`
+}
+
+func (t *PushToken) Validate() error {
+	if t.Token == "" || len(t.Token) > PushTokenMaxLen || t.AppPackage == "" {
+		return ErrPushToken
+	}
+	switch t.Platform {
+	case PushPlatformAndroid, PushPlatformIos:
+	default:
+		return ErrPushPlatform
+	}
+	return nil
+}
+
+// PushMessage queued push of user, app package empty is sent to tokens of all apps.
+// Tokens delivered are kept so retry only send to the rest.
+type PushMessage struct {
+	Id          int64
+	UserId      string
+	AppPackage  string
+	Title       string
+	Body        string
+	Data        map[string]string
+	Status      int
+	Attempts    int
+	DoneTokens  []string
+	LastError   string
+	NextAttempt time.Time
+}
+
+// PushRetryDelay backoff after attempts failed: 30s, 1m, 2m ... max 1h
+func PushRetryDelay(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
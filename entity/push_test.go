@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPushRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := PushRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("PushRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestPushTokenValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   PushToken
+		wantErr error
+	}{
+		{"android", PushToken{Token: "t", AppPackage: "com.app.a", Platform: PushPlatformAndroid}, nil},
+		{"no app", PushToken{Token: "t", Platform: PushPlatformIos}, ErrPushToken},
+		{"web", PushToken{Token: "t", AppPackage: "com.app.a", Platform: "web"}, ErrPushPlatform},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.token.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
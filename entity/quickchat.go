@@ -0,0 +1,250 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	QuickChatMaxPhrases = 10
+	QuickChatMaxLen     = 60
+	QuickChatPresetMax  = 30
+	// distinct players report same phrase, phrase is removed from owner
+	QuickChatReportThreshold = 5
+	QuickChatReasonMaxLen    = 256
+)
+
+var (
+	ErrQuickChatCount   = errors.New("too many quick chat phrases")
+	ErrQuickChatLength  = errors.New("quick chat phrase is empty or too long")
+	ErrQuickChatBlocked = errors.New("quick chat phrase contains blocked word")
+	ErrQuickChatLocale  = errors.New("locale is required")
+	ErrQuickChatReport  = errors.New("user_id and text are required")
+)
+
+// leetspeak letters normalized before matching blocklist
+var quickChatLeet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+var quickChatStripMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// NormalizeChatWords lower case, remove diacritics and map leetspeak,
+// return words split by anything not a letter
+func NormalizeChatWords(text string) []string {
+	stripped, _, err := transform.String(quickChatStripMarks, strings.ToLower(text))
+	if err != nil {
+		stripped = strings.ToLower(text)
+	}
+	words := make([]string, 0)
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			words = append(words, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range stripped {
+		if leet, exist := quickChatLeet[r]; exist {
+			r = leet
+		}
+		if !unicode.IsLetter(r) {
+			flush()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	flush()
+	return words
+}
+
+// collapseRepeats "booodoooh" -> "bodoh"
+func collapseRepeats(w string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range w {
+		if r == last {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+// ChatFilter match normalized text with blocklist, word in allowlist is never blocked
+type ChatFilter struct {
+	blocked []string
+	allowed map[string]bool
+}
+
+func NewChatFilter(blocked, allowed []string) *ChatFilter {
+	f := &ChatFilter{blocked: make([]string, 0, len(blocked)), allowed: make(map[string]bool, len(allowed))}
+	for _, w := range blocked {
+		if n := strings.Join(NormalizeChatWords(w), ""); n != "" {
+			f.blocked = append(f.blocked, n)
+		}
+	}
+	for _, w := range allowed {
+		if n := strings.Join(NormalizeChatWords(w), ""); n != "" {
+			f.allowed[n] = true
+			f.allowed[collapseRepeats(n)] = true
+		}
+	}
+	return f
+}
+
+// match blocked word in w. Blocked word is found as substring so "fucking" match "fuck".
+// Repeated letters of w are collapsed only for blocked word without repeated letters,
+// so "fuuuck" match "fuck" but "as" does not match "ass".
+func (f *ChatFilter) match(w string) (string, bool) {
+	if w == "" || f.allowed[w] {
+		return "", false
+	}
+	collapsed := collapseRepeats(w)
+	if f.allowed[collapsed] {
+		return "", false
+	}
+	for _, b := range f.blocked {
+		if strings.Contains(w, b) {
+			return b, true
+		}
+		if collapseRepeats(b) == b && strings.Contains(collapsed, b) {
+			return b, true
+		}
+	}
+	return "", false
+}
+
+// Blocked first blocked word in text. Single letters in a row are joined too, so "f.u.c.k" match "fuck".
+func (f *ChatFilter) Blocked(text string) (string, bool) {
+	if f == nil || len(f.blocked) == 0 {
+		return "", false
+	}
+	var spelled strings.Builder
+	for _, w := range NormalizeChatWords(text) {
+		if b, blocked := f.match(w); blocked {
+			return b, true
+		}
+		if utf8.RuneCountInString(w) == 1 {
+			spelled.WriteString(w)
+			if b, blocked := f.match(spelled.String()); blocked {
+				return b, true
+			}
+			continue
+		}
+		spelled.Reset()
+	}
+	return "", false
+}
+
+// CleanQuickChatTexts trim phrases, drop empty and duplicate, check limits and blocklist
+func CleanQuickChatTexts(texts []string, filter *ChatFilter) ([]string, error) {
+	ml := make([]string, 0, len(texts))
+	for _, text := range texts {
+		text = strings.Join(strings.Fields(text), " ")
+		if text == "" || containsString(ml, text) {
+			continue
+		}
+		if utf8.RuneCountInString(text) > QuickChatMaxLen {
+			return nil, ErrQuickChatLength
+		}
+		if _, blocked := filter.Blocked(text); blocked {
+			return nil, ErrQuickChatBlocked
+		}
+		ml = append(ml, text)
+	}
+	if len(ml) > QuickChatMaxPhrases {
+		return nil, ErrQuickChatCount
+	}
+	return ml, nil
+}
+
+// QuickChatPreset default phrases of a locale, managed by admin
+type QuickChatPreset struct {
+	Locale         string   `json:"locale"`
+	Texts          []string `json:"texts"`
+	UpdateTimeUnix int64    `json:"update_time_unix,omitempty"`
+}
+
+func (p *QuickChatPreset) Validate() error {
+	if p.Locale == "" {
+		return ErrQuickChatLocale
+	}
+	texts := make([]string, 0, len(p.Texts))
+	for _, text := range p.Texts {
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > QuickChatMaxLen {
+			return ErrQuickChatLength
+		}
+		texts = append(texts, text)
+	}
+	if len(texts) > QuickChatPresetMax {
+		return ErrQuickChatCount
+	}
+	p.Texts = texts
+	return nil
+}
+
+// PickQuickChatPreset preset of first locale in fallback chain of lang tag
+func PickQuickChatPreset(presets []*QuickChatPreset, langTag string) *QuickChatPreset {
+	for _, locale := range NotiLocaleFallbacks(langTag) {
+		for _, p := range presets {
+			if strings.EqualFold(p.Locale, locale) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// QuickChatPhrases custom phrases of user, saved in storage readable by other players
+type QuickChatPhrases struct {
+	Texts []string `json:"texts"`
+}
+
+type QuickChatReport struct {
+	Id             int64  `json:"id,omitempty"`
+	ReporterId     string `json:"reporter_id,omitempty"`
+	UserId         string `json:"user_id"`
+	Text           string `json:"text"`
+	Reason         string `json:"reason"`
+	CreateTimeUnix int64  `json:"create_time_unix,omitempty"`
+}
+
+func (r *QuickChatReport) Validate() error {
+	r.Text = strings.TrimSpace(r.Text)
+	if r.UserId == "" || r.Text == "" || utf8.RuneCountInString(r.Text) > QuickChatMaxLen {
+		return ErrQuickChatReport
+	}
+	if utf8.RuneCountInString(r.Reason) > QuickChatReasonMaxLen {
+		r.Reason = string([]rune(r.Reason)[:QuickChatReasonMaxLen])
+	}
+	return nil
+}
+
+// QuickChatBlocklistRequest allow words are never blocked, they fix false positive of
+// blocked word found inside a normal word, "ass" in "glass"
+type QuickChatBlocklistRequest struct {
+	Add         []string `json:"add"`
+	Remove      []string `json:"remove"`
+	AllowAdd    []string `json:"allow_add"`
+	AllowRemove []string `json:"allow_remove"`
+}
+
+type QuickChatReportRequest struct {
+	UserId string `json:"user_id"`
+	Limit  int64  `json:"limit"`
+	Offset int64  `json:"offset"`
+}
+
+type ListQuickChatReport struct {
+	Reports []*QuickChatReport `json:"reports"`
+}
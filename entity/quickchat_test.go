@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChatFilterBlocked(t *testing.T) {
+	f := NewChatFilter([]string{"bodoh", "fuck", "Anjing"}, nil)
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"good game", false},
+		{"kamu BODOH", true},
+		{"b0d0h sekali", true},
+		{"booodoooh", true},
+		{"f.u.c.k you", true},
+		{"anjíng", true},
+		{"glass class", false},
+		{"fucking", true},
+		{"motherfucker", true},
+		{"fuuuck", true},
+	}
+	for _, tt := range tests {
+		if _, got := f.Blocked(tt.text); got != tt.want {
+			t.Errorf("Blocked(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	f = NewChatFilter([]string{"ass"}, []string{"glass"})
+	for text, want := range map[string]bool{"as you wish": false, "glass": false, "asss": true, "dumbass": true} {
+		if _, got := f.Blocked(text); got != want {
+			t.Errorf("Blocked(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestCleanQuickChatTexts(t *testing.T) {
+	f := NewChatFilter([]string{"bodoh"}, nil)
+	got, err := CleanQuickChatTexts([]string{"  nice   hand ", "", "nice hand", "gg"}, f)
+	if err != nil || !reflect.DeepEqual(got, []string{"nice hand", "gg"}) {
+		t.Errorf("CleanQuickChatTexts() = %v, %v", got, err)
+	}
+	if _, err := CleanQuickChatTexts([]string{"kamu b0doh"}, f); err != ErrQuickChatBlocked {
+		t.Errorf("CleanQuickChatTexts() blocked = %v, want %v", err, ErrQuickChatBlocked)
+	}
+	long := make([]rune, QuickChatMaxLen+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if _, err := CleanQuickChatTexts([]string{string(long)}, f); err != ErrQuickChatLength {
+		t.Errorf("CleanQuickChatTexts() long = %v, want %v", err, ErrQuickChatLength)
+	}
+	many := make([]string, 0, QuickChatMaxPhrases+1)
+	for i := 0; i <= QuickChatMaxPhrases; i++ {
+		many = append(many, string(rune('a'+i))+" hi")
+	}
+	if _, err := CleanQuickChatTexts(many, f); err != ErrQuickChatCount {
+		t.Errorf("CleanQuickChatTexts() many = %v, want %v", err, ErrQuickChatCount)
+	}
+}
+
+func TestPickQuickChatPreset(t *testing.T) {
+	presets := []*QuickChatPreset{{Locale: "en"}, {Locale: "id-ID"}}
+	if p := PickQuickChatPreset(presets, "id_ID"); p == nil || p.Locale != "id-ID" {
+		t.Errorf("PickQuickChatPreset(id_ID) = %v, want id-ID", p)
+	}
+	if p := PickQuickChatPreset(presets, "vi"); p == nil || p.Locale != "en" {
+		t.Errorf("PickQuickChatPreset(vi) = %v, want en", p)
+	}
+}
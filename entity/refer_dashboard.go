@@ -0,0 +1,114 @@
+package entity
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ReferDashboardSortFee     = "fee"
+	ReferDashboardSortEarning = "earning"
+	ReferDashboardSortJoin    = "join"
+)
+
+const (
+	ReferDashboardDefaultLimit = 20
+	ReferDashboardMaxLimit     = 100
+	ReferDashboardDefaultWeeks = 8
+	ReferDashboardMaxWeeks     = 26
+)
+
+var ErrReferDashboardSort = errors.New("sort_by must be fee, earning or join")
+
+type ReferDashboardRequest struct {
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	SortBy string `json:"sort_by"`
+	Asc    bool   `json:"asc"`
+	// number of weeks in chart series, this week included
+	Weeks int `json:"weeks"`
+}
+
+// Normalize fill default and clamp limit, weeks
+func (r *ReferDashboardRequest) Normalize() error {
+	if r.SortBy == "" {
+		r.SortBy = ReferDashboardSortFee
+	}
+	if r.SortBy != ReferDashboardSortFee && r.SortBy != ReferDashboardSortEarning && r.SortBy != ReferDashboardSortJoin {
+		return ErrReferDashboardSort
+	}
+	if r.Limit <= 0 {
+		r.Limit = ReferDashboardDefaultLimit
+	}
+	if r.Limit > ReferDashboardMaxLimit {
+		r.Limit = ReferDashboardMaxLimit
+	}
+	if r.Offset < 0 {
+		r.Offset = 0
+	}
+	if r.Weeks <= 0 {
+		r.Weeks = ReferDashboardDefaultWeeks
+	}
+	if r.Weeks > ReferDashboardMaxWeeks {
+		r.Weeks = ReferDashboardMaxWeeks
+	}
+	return nil
+}
+
+type ReferDashboardInvitee struct {
+	UserId          string `json:"user_id"`
+	UserSid         int64  `json:"user_sid,omitempty"`
+	DisplayName     string `json:"display_name"`
+	AvatarId        string `json:"avatar_id,omitempty"`
+	Level           int    `json:"level"`
+	FeeThisWeek     int64  `json:"fee_this_week"`
+	LifetimeEarning int64  `json:"lifetime_earning"`
+	Active          bool   `json:"active"`
+	JoinTimeUnix    int64  `json:"join_time_unix"`
+}
+
+// ReferWeekPoint fee of invitees and reward of inviter in a week
+type ReferWeekPoint struct {
+	FromUnix       int64 `json:"from_unix"`
+	ToUnix         int64 `json:"to_unix"`
+	Fee            int64 `json:"fee"`
+	Reward         int64 `json:"reward"`
+	ActiveInvitees int   `json:"active_invitees"`
+}
+
+type ReferDashboard struct {
+	TotalInvitees   int                      `json:"total_invitees"`
+	ActiveInvitees  int                      `json:"active_invitees"`
+	FeeThisWeek     int64                    `json:"fee_this_week"`
+	LifetimeEarning int64                    `json:"lifetime_earning"`
+	Invitees        []*ReferDashboardInvitee `json:"invitees"`
+	Series          []*ReferWeekPoint        `json:"series"`
+}
+
+// ReferWeekSeries empty points of n weeks, oldest first, last point is week of now
+func ReferWeekSeries(now time.Time, n int) []*ReferWeekPoint {
+	series := make([]*ReferWeekPoint, 0, n)
+	beginWeek, _ := RangeWeek(now)
+	for i := n - 1; i >= 0; i-- {
+		from := beginWeek.AddDate(0, 0, -7*i)
+		series = append(series, &ReferWeekPoint{
+			FromUnix: from.Unix(),
+			ToUnix:   from.AddDate(0, 0, 7).Add(-1 * time.Second).Unix(),
+		})
+	}
+	return series
+}
+
+// MaskName keep first and last letter, "alice" -> "a***e"
+func MaskName(name string) string {
+	r := []rune(name)
+	switch len(r) {
+	case 0:
+		return ""
+	case 1:
+		return "*"
+	case 2:
+		return string(r[0]) + "*"
+	}
+	return string(r[0]) + "***" + string(r[len(r)-1])
+}
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReferWeekSeries(t *testing.T) {
+	// wednesday
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	series := ReferWeekSeries(now, 3)
+	if len(series) != 3 {
+		t.Fatalf("ReferWeekSeries() len = %d, want 3", len(series))
+	}
+	wantFrom := []time.Time{
+		time.Date(2024, 2, 19, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+	}
+	for idx, p := range series {
+		if p.FromUnix != wantFrom[idx].Unix() || p.ToUnix != wantFrom[idx].AddDate(0, 0, 7).Unix()-1 {
+			t.Errorf("ReferWeekSeries()[%d] = %d-%d, want from %v", idx, p.FromUnix, p.ToUnix, wantFrom[idx])
+		}
+	}
+}
+
+func TestMaskName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", ""},
+		{"a", "*"},
+		{"ab", "a*"},
+		{"alice", "a***e"},
+		{"Nguyễn", "N***n"},
+	}
+	for _, tt := range tests {
+		if got := MaskName(tt.name); got != tt.want {
+			t.Errorf("MaskName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+)
+
+const (
+	FingerprintKindDevice  = "device"
+	FingerprintKindIP      = "ip"
+	FingerprintKindSubnet  = "subnet"
+	FingerprintKindPayment = "payment"
+)
+
+// fingerprint kinds block refer if invitor and invitee share one,
+// ip is not here because subnet already cover it.
+var ReferBlockFingerprintKinds = []string{FingerprintKindDevice, FingerprintKindSubnet, FingerprintKindPayment}
+
+// fingerprint kinds count toward cluster review
+var ReferClusterFingerprintKinds = []string{FingerprintKindDevice, FingerprintKindIP, FingerprintKindSubnet, FingerprintKindPayment}
+
+// invitor has this number of invitees share a fingerprint with new invitee is flagged to review
+const ReferClusterThreshold = 3
+
+const (
+	ReferReviewStatusPending  = 0
+	ReferReviewStatusCleared  = 1
+	ReferReviewStatusRejected = 2
+)
+
+const (
+	ReferReviewReasonCluster = "cluster"
+)
+
+var (
+	ErrReferFingerprint  = errors.New("ref code owner share device, network or payment with you")
+	ErrReferReviewStatus = errors.New("status must be cleared or rejected")
+)
+
+type UserFingerprint struct {
+	UserId string `json:"user_id"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+}
+
+// ReferReview invitor flagged as suspicious, refer reward is held until admin clear (send) or reject (void)
+type ReferReview struct {
+	Id             int64                  `json:"id"`
+	UserId         string                 `json:"user_id"`
+	Reason         string                 `json:"reason"`
+	Detail         map[string]interface{} `json:"detail,omitempty"`
+	Status         int                    `json:"status"`
+	Note           string                 `json:"note,omitempty"`
+	CreateTimeUnix int64                  `json:"create_time_unix"`
+	UpdateTimeUnix int64                  `json:"update_time_unix"`
+}
+
+type ReferReviewRequest struct {
+	Id     int64  `json:"id"`
+	Status *int   `json:"status"`
+	Note   string `json:"note"`
+	Limit  int64  `json:"limit"`
+	Offset int64  `json:"offset"`
+}
+
+type ListReferReview struct {
+	Reviews []*ReferReview `json:"reviews"`
+}
+
+// IPSubnet /24 of ipv4, /64 of ipv6, empty if ip invalid
+func IPSubnet(ip string) string {
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// NetworkFingerprints ip and subnet of client ip
+func NetworkFingerprints(userId, ip string) []*UserFingerprint {
+	subnet := IPSubnet(ip)
+	if subnet == "" {
+		return nil
+	}
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return []*UserFingerprint{
+		{UserId: userId, Kind: FingerprintKindIP, Value: ip},
+		{UserId: userId, Kind: FingerprintKindSubnet, Value: subnet},
+	}
+}
+
+// PaymentFingerprint account id of google play purchase, nil if purchase does not have it.
+// Client set obfuscatedAccountId to a stable hash of store account when launch billing flow.
+func PaymentFingerprint(userId, providerResponse string) *UserFingerprint {
+	purchase := struct {
+		ObfuscatedExternalAccountId string `json:"obfuscatedExternalAccountId"`
+	}{}
+	if err := json.Unmarshal([]byte(providerResponse), &purchase); err != nil || purchase.ObfuscatedExternalAccountId == "" {
+		return nil
+	}
+	return &UserFingerprint{UserId: userId, Kind: FingerprintKindPayment, Value: purchase.ObfuscatedExternalAccountId}
+}
@@ -0,0 +1,61 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIPSubnet(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.1.2.3", "10.1.2.0/24"},
+		{"10.1.2.3:5432", "10.1.2.0/24"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"[2001:db8:1:2::1]:7350", "2001:db8:1:2::/64"},
+		{"not an ip", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := IPSubnet(tt.ip); got != tt.want {
+				t.Errorf("IPSubnet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkFingerprints(t *testing.T) {
+	got := NetworkFingerprints("u1", "10.1.2.3:5432")
+	want := []*UserFingerprint{
+		{UserId: "u1", Kind: FingerprintKindIP, Value: "10.1.2.3"},
+		{UserId: "u1", Kind: FingerprintKindSubnet, Value: "10.1.2.0/24"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NetworkFingerprints() = %v, want %v", got, want)
+	}
+	if got := NetworkFingerprints("u1", ""); got != nil {
+		t.Errorf("NetworkFingerprints() empty ip = %v, want nil", got)
+	}
+}
+
+func TestPaymentFingerprint(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     *UserFingerprint
+	}{
+		{"account id", `{"orderId":"GPA.1","obfuscatedExternalAccountId":"acc-1"}`,
+			&UserFingerprint{UserId: "u1", Kind: FingerprintKindPayment, Value: "acc-1"}},
+		{"no account id", `{"orderId":"GPA.1"}`, nil},
+		{"invalid", `not json`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PaymentFingerprint("u1", tt.response); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PaymentFingerprint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package entity
+
+import (
+	"errors"
+	"sort"
+)
+
+// ReferTreeMaxLevel depth of refer tree is saved, program can pay up to this level
+const ReferTreeMaxLevel = 5
+
+var (
+	ErrReferProgramLevel     = errors.New("levels must start at 1 and be continuous")
+	ErrReferProgramRateScale = errors.New("rate scale must be in (0, 1] and not increase by level")
+	ErrReferProgramCap       = errors.New("cap and min fee must not be negative")
+	ErrReferCycle            = errors.New("user is already an inviter of inviter")
+)
+
+// ReferLevel inviter at Level above invitee earn tier rate * RateScale
+type ReferLevel struct {
+	Level     int     `json:"level"`
+	RateScale float32 `json:"rate_scale"`
+}
+
+type ReferProgram struct {
+	Levels []*ReferLevel `json:"levels"`
+	// max chips one inviter earn in a week, 0 is no cap
+	WeeklyCap int64 `json:"weekly_cap"`
+	// invitee pay less fee than this in the week is not active, not counted
+	MinInviteeFee int64 `json:"min_invitee_fee"`
+}
+
+var DefaultReferProgram = &ReferProgram{
+	Levels: []*ReferLevel{
+		{Level: 1, RateScale: 1},
+		{Level: 2, RateScale: 0.3},
+	},
+	WeeklyCap:     0,
+	MinInviteeFee: 0,
+}
+
+// ReferTreeNode Ancestor invite UserId directly (level 1) or through level-1 users between
+type ReferTreeNode struct {
+	UserId       string `json:"user_id"`
+	AncestorId   string `json:"ancestor_id"`
+	Level        int    `json:"level"`
+	JoinTimeUnix int64  `json:"join_time_unix"`
+}
+
+// ReferInvitee fee of an invitee in the week and reward for inviter
+type ReferInvitee struct {
+	UserId string `json:"user_id"`
+	Level  int    `json:"level"`
+	Fee    int64  `json:"fee"`
+	Reward int64  `json:"reward"`
+	Active bool   `json:"active"`
+}
+
+type ReferRewardResult struct {
+	Invitees     []*ReferInvitee `json:"invitees"`
+	LevelRewards map[int]int64   `json:"level_rewards"`
+	Total        int64           `json:"total"`
+	Capped       bool            `json:"capped"`
+}
+
+func (p *ReferProgram) Validate() error {
+	if len(p.Levels) == 0 || len(p.Levels) > ReferTreeMaxLevel {
+		return ErrReferProgramLevel
+	}
+	sort.Slice(p.Levels, func(i, j int) bool { return p.Levels[i].Level < p.Levels[j].Level })
+	var lastScale float32 = 1
+	for idx, l := range p.Levels {
+		if l.Level != idx+1 {
+			return ErrReferProgramLevel
+		}
+		if l.RateScale <= 0 || l.RateScale > lastScale {
+			return ErrReferProgramRateScale
+		}
+		lastScale = l.RateScale
+	}
+	if p.WeeklyCap < 0 || p.MinInviteeFee < 0 {
+		return ErrReferProgramCap
+	}
+	return nil
+}
+
+func (p *ReferProgram) MaxLevel() int {
+	return len(p.Levels)
+}
+
+// IsActive invitee pay fee in week at least min invitee fee
+func (p *ReferProgram) IsActive(fee int64) bool {
+	return fee > 0 && fee >= p.MinInviteeFee
+}
+
+func (p *ReferProgram) rateScale(level int) float32 {
+	for _, l := range p.Levels {
+		if l.Level == level {
+			return l.RateScale
+		}
+	}
+	return 0
+}
+
+// Reward of inviter from fee of invitees, tierRate is rate by win amount of inviter.
+// When over weekly cap, lower level is paid first.
+func (p *ReferProgram) Reward(tierRate float32, invitees []*ReferInvitee) *ReferRewardResult {
+	result := &ReferRewardResult{
+		Invitees:     invitees,
+		LevelRewards: make(map[int]int64),
+	}
+	sort.SliceStable(invitees, func(i, j int) bool { return invitees[i].Level < invitees[j].Level })
+	for _, invitee := range invitees {
+		invitee.Reward = 0
+		invitee.Active = p.IsActive(invitee.Fee)
+		scale := p.rateScale(invitee.Level)
+		if !invitee.Active || scale <= 0 {
+			continue
+		}
+		reward := int64(float32(invitee.Fee) * tierRate * scale)
+		if p.WeeklyCap > 0 && result.Total+reward > p.WeeklyCap {
+			reward = p.WeeklyCap - result.Total
+			result.Capped = true
+		}
+		if reward <= 0 {
+			continue
+		}
+		invitee.Reward = reward
+		result.LevelRewards[invitee.Level] += reward
+		result.Total += reward
+	}
+	return result
+}
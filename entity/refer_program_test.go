@@ -0,0 +1,69 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReferProgramValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		program *ReferProgram
+		want    error
+	}{
+		{"default", DefaultReferProgram, nil},
+		{"unsorted", &ReferProgram{Levels: []*ReferLevel{{Level: 2, RateScale: 0.5}, {Level: 1, RateScale: 1}}}, nil},
+		{"empty", &ReferProgram{}, ErrReferProgramLevel},
+		{"gap", &ReferProgram{Levels: []*ReferLevel{{Level: 1, RateScale: 1}, {Level: 3, RateScale: 0.5}}}, ErrReferProgramLevel},
+		{"scale increase", &ReferProgram{Levels: []*ReferLevel{{Level: 1, RateScale: 0.5}, {Level: 2, RateScale: 0.6}}}, ErrReferProgramRateScale},
+		{"zero scale", &ReferProgram{Levels: []*ReferLevel{{Level: 1, RateScale: 0}}}, ErrReferProgramRateScale},
+		{"negative cap", &ReferProgram{Levels: []*ReferLevel{{Level: 1, RateScale: 1}}, WeeklyCap: -1}, ErrReferProgramCap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.program.Validate(); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferProgramReward(t *testing.T) {
+	levels := []*ReferLevel{{Level: 1, RateScale: 1}, {Level: 2, RateScale: 0.5}}
+	invitees := func() []*ReferInvitee {
+		return []*ReferInvitee{
+			{UserId: "c", Level: 2, Fee: 10000},
+			{UserId: "a", Level: 1, Fee: 10000},
+			{UserId: "b", Level: 1, Fee: 100},
+			{UserId: "d", Level: 3, Fee: 10000},
+		}
+	}
+	tests := []struct {
+		name       string
+		program    *ReferProgram
+		wantTotal  int64
+		wantLevels map[int]int64
+		wantCapped bool
+	}{
+		{"two level", &ReferProgram{Levels: levels}, 1000 + 10 + 500, map[int]int64{1: 1010, 2: 500}, false},
+		{"min fee", &ReferProgram{Levels: levels, MinInviteeFee: 1000}, 1000 + 500, map[int]int64{1: 1000, 2: 500}, false},
+		{"cap pay lower level first", &ReferProgram{Levels: levels, WeeklyCap: 1200}, 1200, map[int]int64{1: 1010, 2: 190}, true},
+		{"one level", &ReferProgram{Levels: levels[:1]}, 1010, map[int]int64{1: 1010}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.program.Reward(0.1, invitees())
+			if got.Total != tt.wantTotal || got.Capped != tt.wantCapped || !reflect.DeepEqual(got.LevelRewards, tt.wantLevels) {
+				t.Errorf("Reward() total %d capped %v levels %v, want %d %v %v",
+					got.Total, got.Capped, got.LevelRewards, tt.wantTotal, tt.wantCapped, tt.wantLevels)
+			}
+			var sum int64
+			for _, invitee := range got.Invitees {
+				sum += invitee.Reward
+			}
+			if sum != got.Total {
+				t.Errorf("Reward() sum of invitees %d, want %d", sum, got.Total)
+			}
+		})
+	}
+}
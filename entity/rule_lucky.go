@@ -0,0 +1,46 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const (
+	RuleLuckyActionAdd      = "add"
+	RuleLuckyActionUpdate   = "update"
+	RuleLuckyActionDelete   = "delete"
+	RuleLuckyActionRollback = "rollback"
+	RuleLuckyActionBackfill = "backfill"
+)
+
+const RuleLuckyVersionDefaultLimit = 100
+
+var (
+	ErrRuleLuckyRange           = errors.New("min must be less than max and re_deal must not be negative")
+	ErrRuleLuckyOverlap         = errors.New("rule overlap with other rule of game")
+	ErrRuleLuckyNotFound        = errors.New("rule lucky not found")
+	ErrRuleLuckyVersionNotFound = errors.New("rule lucky version not found")
+)
+
+// RuleLuckyVersion immutable snapshot of a rule after each change
+type RuleLuckyVersion struct {
+	Id             int64           `json:"id"`
+	RuleId         int64           `json:"rule_id"`
+	GameCode       string          `json:"game_code"`
+	Version        int             `json:"version"`
+	Action         string          `json:"action"`
+	Rule           json.RawMessage `json:"rule"`
+	CreateTimeUnix int64           `json:"create_time_unix"`
+}
+
+type RuleLuckyVersionRequest struct {
+	VersionId int64  `json:"version_id"`
+	RuleId    int64  `json:"rule_id"`
+	GameCode  string `json:"game_code"`
+	Limit     int    `json:"limit"`
+	Offset    int    `json:"offset"`
+}
+
+type ListRuleLuckyVersion struct {
+	Versions []*RuleLuckyVersion `json:"versions"`
+}
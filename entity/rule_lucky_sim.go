@@ -0,0 +1,201 @@
+package entity
+
+import "errors"
+
+const (
+	RuleLuckySimDefaultDays  = 7
+	RuleLuckySimMaxDays      = 30
+	RuleLuckySimDefaultLimit = 500
+	RuleLuckySimMaxLimit     = 5000
+)
+
+var ErrRuleLuckySimGameCode = errors.New("game_code is required")
+
+type LuckyRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// LuckyRuleCondition condition part of RuleLucky, json is same as rule lucky
+// new rule in simulate has no id yet, it is given a negative id by order
+type LuckyRuleCondition struct {
+	Id           int64      `json:"id"`
+	Rtp          LuckyRange `json:"rtp"`
+	Mark         LuckyRange `json:"mark"`
+	Vip          LuckyRange `json:"vip"`
+	WinMarkRatio LuckyRange `json:"win_mark_ratio"`
+	ReDeal       int64      `json:"re_deal"`
+}
+
+// LuckyRuleMatcher rule lucky in simulate, it match user state same as real rule
+type LuckyRuleMatcher interface {
+	RuleId() int64
+	Match(s *LuckyUserState) bool
+}
+
+// LuckyUserState state of user in a game, same unit as rule lucky:
+// rtp is percent of win on bet, mark is bet level (mcb), win_mark_ratio is net win in marks
+type LuckyUserState struct {
+	UserId       string `json:"user_id"`
+	Rtp          int64  `json:"rtp"`
+	Mark         int64  `json:"mark"`
+	Vip          int64  `json:"vip"`
+	WinMarkRatio int64  `json:"win_mark_ratio"`
+}
+
+// NewLuckyUserState state from total bet, win, lost chips and bet level of user
+func NewLuckyUserState(userId string, bet, win, lost, mark, vip int64) *LuckyUserState {
+	s := &LuckyUserState{UserId: userId, Mark: mark, Vip: vip}
+	if bet > 0 {
+		s.Rtp = win * 100 / bet
+	}
+	if mark > 0 {
+		s.WinMarkRatio = (win - lost) / mark
+	}
+	return s
+}
+
+type SimulateRuleLuckyRequest struct {
+	GameCode string                `json:"game_code"`
+	Rules    []*LuckyRuleCondition `json:"rules"`
+	// sample states, empty is load recent states of game players
+	Users []*LuckyUserState `json:"users"`
+	Days  int               `json:"days"`
+	Limit int               `json:"limit"`
+}
+
+func (r *SimulateRuleLuckyRequest) Normalize() error {
+	if r.GameCode == "" {
+		return ErrRuleLuckySimGameCode
+	}
+	if r.Days <= 0 {
+		r.Days = RuleLuckySimDefaultDays
+	}
+	if r.Days > RuleLuckySimMaxDays {
+		r.Days = RuleLuckySimMaxDays
+	}
+	if r.Limit <= 0 {
+		r.Limit = RuleLuckySimDefaultLimit
+	}
+	if r.Limit > RuleLuckySimMaxLimit {
+		r.Limit = RuleLuckySimMaxLimit
+	}
+	return nil
+}
+
+type RuleLuckySimUser struct {
+	*LuckyUserState
+	OldRuleIds []int64 `json:"old_rule_ids"`
+	NewRuleIds []int64 `json:"new_rule_ids"`
+	Changed    bool    `json:"changed"`
+	NoMatch    bool    `json:"no_match"`
+	MultiMatch bool    `json:"multi_match"`
+}
+
+// RuleLuckySimCount number of users match rule under old and new rules
+type RuleLuckySimCount struct {
+	RuleId int64 `json:"rule_id"`
+	Old    int   `json:"old"`
+	New    int   `json:"new"`
+}
+
+type SimulateRuleLuckyResult struct {
+	GameCode   string `json:"game_code"`
+	TotalUsers int    `json:"total_users"`
+	Changed    int    `json:"changed"`
+	NoMatch    int    `json:"no_match"`
+	MultiMatch int    `json:"multi_match"`
+	OldNoMatch int    `json:"old_no_match"`
+	// pairs of candidate rule ids overlap each other
+	Overlaps [][2]int64           `json:"overlaps"`
+	Counts   []*RuleLuckySimCount `json:"counts"`
+	Users    []*RuleLuckySimUser  `json:"users"`
+}
+
+func matchLuckyRules(rules []LuckyRuleMatcher, s *LuckyUserState) []int64 {
+	ids := make([]int64, 0)
+	for _, rule := range rules {
+		if rule.Match(s) {
+			ids = append(ids, rule.RuleId())
+		}
+	}
+	return ids
+}
+
+// NumberNewLuckyRules give rule without id a negative id, -1 is first rule
+func NumberNewLuckyRules(rules []*LuckyRuleCondition) {
+	for idx, rule := range rules {
+		if rule.Id <= 0 {
+			rule.Id = -int64(idx + 1)
+		}
+	}
+}
+
+// SimulateRuleLucky match each user with old and new rules, no match and multi match are flagged by new rules
+func SimulateRuleLucky(gameCode string, oldRules, newRules []LuckyRuleMatcher, users []*LuckyUserState) *SimulateRuleLuckyResult {
+	result := &SimulateRuleLuckyResult{
+		GameCode:   gameCode,
+		TotalUsers: len(users),
+		Overlaps:   make([][2]int64, 0),
+		Counts:     make([]*RuleLuckySimCount, 0),
+		Users:      make([]*RuleLuckySimUser, 0, len(users)),
+	}
+	counts := make(map[int64]*RuleLuckySimCount)
+	count := func(ruleId int64) *RuleLuckySimCount {
+		c, exist := counts[ruleId]
+		if !exist {
+			c = &RuleLuckySimCount{RuleId: ruleId}
+			counts[ruleId] = c
+			result.Counts = append(result.Counts, c)
+		}
+		return c
+	}
+	for _, rule := range oldRules {
+		count(rule.RuleId())
+	}
+	for _, rule := range newRules {
+		count(rule.RuleId())
+	}
+	for _, s := range users {
+		u := &RuleLuckySimUser{
+			LuckyUserState: s,
+			OldRuleIds:     matchLuckyRules(oldRules, s),
+			NewRuleIds:     matchLuckyRules(newRules, s),
+		}
+		u.NoMatch = len(u.NewRuleIds) == 0
+		u.MultiMatch = len(u.NewRuleIds) > 1
+		u.Changed = !equalInt64s(u.OldRuleIds, u.NewRuleIds)
+		if len(u.OldRuleIds) == 0 {
+			result.OldNoMatch++
+		}
+		for _, id := range u.OldRuleIds {
+			count(id).Old++
+		}
+		if u.NoMatch {
+			result.NoMatch++
+		}
+		for _, id := range u.NewRuleIds {
+			count(id).New++
+		}
+		if u.MultiMatch {
+			result.MultiMatch++
+		}
+		if u.Changed {
+			result.Changed++
+		}
+		result.Users = append(result.Users, u)
+	}
+	return result
+}
+
+func equalInt64s(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewLuckyUserState(t *testing.T) {
+	got := NewLuckyUserState("u1", 1000, 1200, 700, 100, 2)
+	want := &LuckyUserState{UserId: "u1", Rtp: 120, Mark: 100, Vip: 2, WinMarkRatio: 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewLuckyUserState() = %+v, want %+v", got, want)
+	}
+	if got := NewLuckyUserState("u2", 0, 0, 0, 0, 0); got.Rtp != 0 || got.WinMarkRatio != 0 {
+		t.Errorf("NewLuckyUserState() no bet = %+v", got)
+	}
+}
+
+// rtpRule match rtp in [min, max)
+type rtpRule struct {
+	id       int64
+	min, max int64
+}
+
+func (r *rtpRule) RuleId() int64 {
+	return r.id
+}
+
+func (r *rtpRule) Match(s *LuckyUserState) bool {
+	return s.Rtp >= r.min && s.Rtp < r.max
+}
+
+func TestSimulateRuleLucky(t *testing.T) {
+	oldRules := []LuckyRuleMatcher{&rtpRule{1, 0, 100}, &rtpRule{2, 100, 1000}}
+	candidates := []*LuckyRuleCondition{{Id: 1}, {}}
+	NumberNewLuckyRules(candidates)
+	if candidates[1].Id != -2 {
+		t.Fatalf("NumberNewLuckyRules() id = %d, want -2", candidates[1].Id)
+	}
+	newRules := []LuckyRuleMatcher{&rtpRule{1, 0, 81}, &rtpRule{-2, 50, 121}}
+	users := []*LuckyUserState{
+		{UserId: "low", Rtp: 10},
+		{UserId: "both", Rtp: 60},
+		{UserId: "mid", Rtp: 90},
+		{UserId: "high", Rtp: 200},
+	}
+	result := SimulateRuleLucky("sicbo", oldRules, newRules, users)
+	wantNew := map[string][]int64{"low": {1}, "both": {1, -2}, "mid": {-2}, "high": {}}
+	for _, u := range result.Users {
+		if !reflect.DeepEqual(u.NewRuleIds, wantNew[u.UserId]) {
+			t.Errorf("user %s new rules = %v, want %v", u.UserId, u.NewRuleIds, wantNew[u.UserId])
+		}
+	}
+	if result.NoMatch != 1 || result.MultiMatch != 1 || result.Changed != 3 || result.OldNoMatch != 0 {
+		t.Errorf("SimulateRuleLucky() no match %d, multi %d, changed %d, old no match %d",
+			result.NoMatch, result.MultiMatch, result.Changed, result.OldNoMatch)
+	}
+	wantCounts := []*RuleLuckySimCount{{RuleId: 1, Old: 3, New: 2}, {RuleId: 2, Old: 1, New: 0}, {RuleId: -2, Old: 0, New: 2}}
+	if !reflect.DeepEqual(result.Counts, wantCounts) {
+		t.Errorf("SimulateRuleLucky() counts = %v, want %v", result.Counts, wantCounts)
+	}
+}
@@ -0,0 +1,161 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	SanctionKindBan           = "ban"
+	SanctionKindChatMute      = "chat_mute"
+	SanctionKindTransferBlock = "transfer_block"
+	SanctionKindCashOutBlock  = "cashout_block"
+	// account flagged, login from device not used before is blocked
+	SanctionKindDeviceLock = "device_lock"
+)
+
+const (
+	SanctionReasonMaxLen  = 256
+	SanctionDefaultLimit  = 50
+	SanctionMaxDuration   = 10 * 365 * 24 * time.Hour
+	SanctionTimeLayoutMsg = "2006-01-02 15:04 MST"
+)
+
+var (
+	ErrSanctionKind     = errors.New("kind must be ban, chat_mute, transfer_block, cashout_block or device_lock")
+	ErrSanctionUser     = errors.New("user_id is required")
+	ErrSanctionReason   = errors.New("reason is required, max 256 characters")
+	ErrSanctionDuration = errors.New("duration_sec must be 0 (permanent) or up to 10 years")
+	ErrSanctionNotFound = errors.New("sanction not found or already lifted")
+)
+
+func IsSanctionKind(kind string) bool {
+	switch kind {
+	case SanctionKindBan, SanctionKindChatMute, SanctionKindTransferBlock, SanctionKindCashOutBlock, SanctionKindDeviceLock:
+		return true
+	}
+	return false
+}
+
+// Sanction restriction on an account, end time 0 is permanent, lifted sanction is kept for history
+type Sanction struct {
+	Id             int64  `json:"id"`
+	UserId         string `json:"user_id"`
+	Kind           string `json:"kind"`
+	Reason         string `json:"reason"`
+	Issuer         string `json:"issuer"`
+	StartTimeUnix  int64  `json:"start_time_unix"`
+	EndTimeUnix    int64  `json:"end_time_unix"`
+	LiftTimeUnix   int64  `json:"lift_time_unix,omitempty"`
+	LiftBy         string `json:"lift_by,omitempty"`
+	CreateTimeUnix int64  `json:"create_time_unix"`
+}
+
+// Active sanction is not lifted, started and not ended at now
+func (s *Sanction) Active(now time.Time) bool {
+	if s == nil || s.LiftTimeUnix > 0 {
+		return false
+	}
+	if s.StartTimeUnix > now.Unix() {
+		return false
+	}
+	return s.EndTimeUnix == 0 || s.EndTimeUnix > now.Unix()
+}
+
+// Message shown to user, give reason and when sanction end
+func (s *Sanction) Message() string {
+	var what string
+	switch s.Kind {
+	case SanctionKindBan:
+		what = "Your account is banned"
+	case SanctionKindChatMute:
+		what = "Your chat is muted"
+	case SanctionKindTransferBlock:
+		what = "Sending chips is blocked on your account"
+	case SanctionKindCashOutBlock:
+		what = "Cash out is blocked on your account"
+	case SanctionKindDeviceLock:
+		what = "Login from new device is blocked on your account"
+	default:
+		what = "Your account is restricted"
+	}
+	until := "permanently"
+	if s.EndTimeUnix > 0 {
+		until = "until " + time.Unix(s.EndTimeUnix, 0).UTC().Format(SanctionTimeLayoutMsg)
+	}
+	return fmt.Sprintf("%s %s. Reason: %s", what, until, s.Reason)
+}
+
+// SanctionRequest apply sanction from now, duration 0 is permanent
+type SanctionRequest struct {
+	UserId      string `json:"user_id"`
+	Kind        string `json:"kind"`
+	Reason      string `json:"reason"`
+	Issuer      string `json:"issuer"`
+	DurationSec int64  `json:"duration_sec"`
+}
+
+func (r *SanctionRequest) Validate() error {
+	if r.UserId == "" {
+		return ErrSanctionUser
+	}
+	if !IsSanctionKind(r.Kind) {
+		return ErrSanctionKind
+	}
+	if r.Reason == "" || len(r.Reason) > SanctionReasonMaxLen {
+		return ErrSanctionReason
+	}
+	if r.DurationSec < 0 || time.Duration(r.DurationSec)*time.Second > SanctionMaxDuration {
+		return ErrSanctionDuration
+	}
+	return nil
+}
+
+// Sanction new sanction start at now
+func (r *SanctionRequest) Sanction(now time.Time) *Sanction {
+	s := &Sanction{
+		UserId:        r.UserId,
+		Kind:          r.Kind,
+		Reason:        r.Reason,
+		Issuer:        r.Issuer,
+		StartTimeUnix: now.Unix(),
+	}
+	if r.DurationSec > 0 {
+		s.EndTimeUnix = now.Unix() + r.DurationSec
+	}
+	return s
+}
+
+// SanctionLiftRequest lift sanction by id, or all active sanctions of kind on user
+type SanctionLiftRequest struct {
+	Id     int64  `json:"id"`
+	UserId string `json:"user_id"`
+	Kind   string `json:"kind"`
+	LiftBy string `json:"lift_by"`
+}
+
+func (r *SanctionLiftRequest) Validate() error {
+	if r.Id > 0 {
+		return nil
+	}
+	if r.UserId == "" {
+		return ErrSanctionUser
+	}
+	if !IsSanctionKind(r.Kind) {
+		return ErrSanctionKind
+	}
+	return nil
+}
+
+type SanctionListRequest struct {
+	UserId     string `json:"user_id"`
+	Kind       string `json:"kind"`
+	ActiveOnly bool   `json:"active_only"`
+	Limit      int64  `json:"limit"`
+	Offset     int64  `json:"offset"`
+}
+
+type ListSanction struct {
+	Sanctions []*Sanction `json:"sanctions"`
+}
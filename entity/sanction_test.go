@@ -0,0 +1,65 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSanctionRequestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  SanctionRequest
+		want error
+	}{
+		{"ok", SanctionRequest{UserId: "u1", Kind: SanctionKindBan, Reason: "cheat", DurationSec: 3600}, nil},
+		{"permanent", SanctionRequest{UserId: "u1", Kind: SanctionKindCashOutBlock, Reason: "fraud"}, nil},
+		{"no user", SanctionRequest{Kind: SanctionKindBan, Reason: "cheat"}, ErrSanctionUser},
+		{"bad kind", SanctionRequest{UserId: "u1", Kind: "kick", Reason: "cheat"}, ErrSanctionKind},
+		{"no reason", SanctionRequest{UserId: "u1", Kind: SanctionKindChatMute}, ErrSanctionReason},
+		{"negative", SanctionRequest{UserId: "u1", Kind: SanctionKindChatMute, Reason: "spam", DurationSec: -1}, ErrSanctionDuration},
+		{"too long", SanctionRequest{UserId: "u1", Kind: SanctionKindChatMute, Reason: "spam", DurationSec: 11 * 365 * 24 * 3600}, ErrSanctionDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Validate(); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanctionActive(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name string
+		s    *Sanction
+		want bool
+	}{
+		{"nil", nil, false},
+		{"permanent", &Sanction{StartTimeUnix: now.Unix() - 10}, true},
+		{"running", &Sanction{StartTimeUnix: now.Unix() - 10, EndTimeUnix: now.Unix() + 10}, true},
+		{"ended", &Sanction{StartTimeUnix: now.Unix() - 10, EndTimeUnix: now.Unix()}, false},
+		{"lifted", &Sanction{StartTimeUnix: now.Unix() - 10, LiftTimeUnix: now.Unix() - 1}, false},
+		{"not started", &Sanction{StartTimeUnix: now.Unix() + 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.Active(now); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanctionMessage(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := (&SanctionRequest{UserId: "u1", Kind: SanctionKindBan, Reason: "cheat", DurationSec: 3600}).Sanction(now)
+	if msg := s.Message(); !strings.Contains(msg, "cheat") || !strings.Contains(msg, "2024-05-01 11:00 UTC") {
+		t.Errorf("Message() = %q", msg)
+	}
+	s.EndTimeUnix = 0
+	if msg := s.Message(); !strings.Contains(msg, "permanently") {
+		t.Errorf("Message() = %q", msg)
+	}
+}
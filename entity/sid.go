@@ -0,0 +1,97 @@
+package entity
+
+import "errors"
+
+// Sid short numeric user id players type to send gift or ref code.
+// Legacy sid is 9 digits hash of user id, it can collide and has no check digit.
+// New sid is 10 digits: 9 digits body permuted from a counter, so sids are unique
+// and not sequential, then a luhn check digit so typo is rejected.
+// Legacy sid is kept because players already shared it as ref code, collisions are
+// repaired at migration but a typo of legacy sid can still hit another legacy user.
+// Reissue is not planned: it would break shared ref codes, legacy users keep the gap.
+const (
+	SidLegacyMax = 999_999_999
+	SidMin       = 1_000_000_000
+	SidMax       = 9_999_999_999
+
+	sidBodyMin   = 100_000_000
+	sidBodySpace = 900_000_000
+	sidHalfBits  = 15
+	sidHalfMask  = 1<<sidHalfBits - 1
+)
+
+var (
+	ErrSidInvalid   = errors.New("invalid user id, please check it again")
+	ErrSidExhausted = errors.New("sid counter out of range")
+)
+
+var sidRoundKeys = [...]uint32{0x5bd1e995, 0x27d4eb2f, 0x165667b1, 0x9e3779b1}
+
+func sidRound(half, key uint32) uint32 {
+	x := half*0x85ebca6b ^ key
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x & sidHalfMask
+}
+
+// sidFeistel bijection on 30 bits
+func sidFeistel(v uint32) uint32 {
+	left, right := v>>sidHalfBits, v&sidHalfMask
+	for _, key := range sidRoundKeys {
+		left, right = right, left^sidRound(right, key)
+	}
+	return left<<sidHalfBits | right
+}
+
+// sidPermute bijection on [0, sid body space), cycle walk value out of space
+func sidPermute(n int64) int64 {
+	v := sidFeistel(uint32(n))
+	for v >= sidBodySpace {
+		v = sidFeistel(v)
+	}
+	return int64(v)
+}
+
+// LuhnDigit check digit of n
+func LuhnDigit(n int64) int64 {
+	sum := int64(0)
+	double := true
+	for ; n > 0; n /= 10 {
+		d := n % 10
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+// LuhnValid last digit of n is luhn check digit of the rest
+func LuhnValid(n int64) bool {
+	return n > 0 && LuhnDigit(n/10) == n%10
+}
+
+// EncodeSid sid of counter, different counters give different sids
+func EncodeSid(counter int64) (int64, error) {
+	if counter < 0 || counter >= sidBodySpace {
+		return 0, ErrSidExhausted
+	}
+	body := sidBodyMin + sidPermute(counter)
+	return body*10 + LuhnDigit(body), nil
+}
+
+// ValidSid legacy sid is accepted as is (no check digit to catch typo), new sid must pass check digit
+func ValidSid(sid int64) bool {
+	if sid <= 0 {
+		return false
+	}
+	if sid <= SidLegacyMax {
+		return true
+	}
+	return sid >= SidMin && sid <= SidMax && LuhnValid(sid)
+}
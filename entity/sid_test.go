@@ -0,0 +1,58 @@
+package entity
+
+import "testing"
+
+func TestLuhn(t *testing.T) {
+	if got := LuhnDigit(7992739871); got != 3 {
+		t.Errorf("LuhnDigit() = %d, want 3", got)
+	}
+	if !LuhnValid(79927398713) {
+		t.Error("LuhnValid(79927398713) = false")
+	}
+	if LuhnValid(79927398710) {
+		t.Error("LuhnValid(79927398710) = true")
+	}
+}
+
+func TestEncodeSidUnique(t *testing.T) {
+	seen := make(map[int64]int64)
+	for counter := int64(0); counter < 200_000; counter++ {
+		sid, err := EncodeSid(counter)
+		if err != nil {
+			t.Fatalf("EncodeSid(%d) error %v", counter, err)
+		}
+		if sid < SidMin || sid > SidMax || !ValidSid(sid) {
+			t.Fatalf("EncodeSid(%d) = %d invalid", counter, sid)
+		}
+		if prev, ok := seen[sid]; ok {
+			t.Fatalf("EncodeSid(%d) = EncodeSid(%d) = %d", counter, prev, sid)
+		}
+		seen[sid] = counter
+	}
+	if _, err := EncodeSid(sidBodySpace); err != ErrSidExhausted {
+		t.Errorf("EncodeSid(space) error = %v, want %v", err, ErrSidExhausted)
+	}
+}
+
+func TestValidSidTypo(t *testing.T) {
+	sid, _ := EncodeSid(42)
+	tests := []struct {
+		name string
+		sid  int64
+		want bool
+	}{
+		{"new", sid, true},
+		{"legacy", 123_456_789, true},
+		{"zero", 0, false},
+		{"last digit typo", sid/10*10 + (sid%10+1)%10, false},
+		{"first digit typo", sid + 1_000_000_000, false},
+		{"too long", sid * 10, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidSid(tt.sid); got != tt.want {
+				t.Errorf("ValidSid(%d) = %v, want %v", tt.sid, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package entity
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/nk-nigeria/lobby-module/constant"
 )
 
 type UserGroupListCursor struct {
@@ -27,3 +30,36 @@ type UserGroupUserInfo struct {
 	Avgtrans7   int64
 	CreateTime  int64
 }
+
+type UserGroupRange struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// UserGroupCheckCondition params is map UserGroupType -> {"min","max"},
+// empty param is always match.
+func UserGroupCheckCondition(data *UserGroupUserInfo, params map[string]string) bool {
+	verifyFunc := func(value int64, data string) bool {
+		if data == "" {
+			return true
+		}
+		condition := new(UserGroupRange)
+		if err := json.Unmarshal([]byte(data), condition); err != nil {
+			return false
+		}
+		return value >= condition.Min && value <= condition.Max
+	}
+	return verifyFunc(data.Level, params[string(constant.UserGroupType_Level)]) &&
+		verifyFunc(data.VipLevel, params[string(constant.UserGroupType_VipLevel)]) &&
+		verifyFunc(data.AG, params[string(constant.UserGroupType_WalletChips)]) &&
+		verifyFunc(data.ChipsInBank, params[string(constant.UserGroupType_WalletChipsInbank)]) &&
+		verifyFunc(data.Co, params[string(constant.UserGroupType_TotalCashOut)]) &&
+		verifyFunc(data.CO0, params[string(constant.UserGroupType_TotalCashOutInDay)]) &&
+		verifyFunc(data.LQ, params[string(constant.UserGroupType_TotalCashIn)]) &&
+		verifyFunc(data.BLQ1, params[string(constant.UserGroupType_TotalCashIn1Day)]) &&
+		verifyFunc(data.BLQ3, params[string(constant.UserGroupType_TotalCashIn3Day)]) &&
+		verifyFunc(data.BLQ5, params[string(constant.UserGroupType_TotalCashIn5Day)]) &&
+		verifyFunc(data.BLQ7, params[string(constant.UserGroupType_TotalCashIn7Day)]) &&
+		verifyFunc(data.Avgtrans7, params[string(constant.UserGroupType_AvgCashIn7Day)]) &&
+		verifyFunc(data.CreateTime, params[string(constant.UserGroupType_CreateTime)])
+}
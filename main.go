@@ -35,6 +35,16 @@ const (
 	// Bot config APIs
 	rpcGetBotConfig    = "get_bot_config"
 	rpcUpdateBotConfig = "update_bot_config"
+	rpcBotRuleSimulate = "bot_rule_simulate"
+	rpcDeleteBotRule   = "bot_rule_delete"
+	// bot pool
+	rpcBotPoolCreate    = "bot_pool_create"
+	rpcBotPoolList      = "bot_pool_list"
+	rpcBotPoolRetire    = "bot_pool_retire"
+	rpcBotPoolRebalance = "bot_pool_rebalance"
+	rpcBotLease         = "bot_lease"
+	rpcBotLeaseRenew    = "bot_lease_renew"
+	rpcBotLeaseReturn   = "bot_lease_return"
 
 	rpcIdListBet = "list_bet"
 	// bet admin
@@ -49,9 +59,22 @@ const (
 	rpcGetProfile    = "get_profile"
 	rpcUpdateProfile = "update_profile"
 	// rpcUpdatePassword  = "update_password"
-	rpcUpdateAvatar    = "update_avatar"
-	rpcUpdateQuickChat = "update_quickchat"
-	rpcGetQuickChat    = "get_quickchat"
+	rpcUpdateAvatar             = "update_avatar"
+	rpcUpdateQuickChat          = "update_quickchat"
+	rpcGetQuickChat             = "get_quickchat"
+	rpcQuickChatPresets         = "quickchat_presets"
+	rpcQuickChatReport          = "quickchat_report"
+	rpcQuickChatPresetUpsert    = "quickchat_preset_upsert"
+	rpcQuickChatPresetList      = "quickchat_preset_list"
+	rpcQuickChatBlocklistUpdate = "quickchat_blocklist_update"
+	rpcQuickChatReportList      = "quickchat_report_list"
+	rpcSanctionApply            = "sanction_apply"
+	rpcSanctionLift             = "sanction_lift"
+	rpcSanctionList             = "sanction_list"
+	rpcListDevices              = "list_devices"
+	rpcRevokeDevice             = "revoke_device"
+	rpcDevicePolicyGet          = "device_policy_get"
+	rpcDevicePolicySet          = "device_policy_set"
 
 	rpcPushToBank        = "push_to_bank"
 	rpcWithDraw          = "with_draw"
@@ -59,25 +82,38 @@ const (
 	rpcWalletTransaction = "wallet_transaction"
 
 	//FreeChip
-	rpcAddClaimableFreeChip  = "add_claimable_freechip"
-	rpcClaimFreeChip         = "claim_freechip"
-	rpcListClaimableFreeChip = "list_claimable_freechip"
-	rpcCheckClaimFreeChip    = "check_claim_freechip"
-	rpcListFreeChip          = "list_freechip"
-	rpcMarkAcceptFreeChip    = "mark_accept_freechip"
-	rpcListDeal              = "list_deal"
-	rpcListExchangeDeal      = "list_exchange_deal"
-	rpcExchangeAdd           = "exchange_add"
-	rpcCancelExchange        = "exchange_cancel"
-	rpcListExchange          = "list_exchange"
-	rpcListExchangeLock      = "exchange_lock"
-	rpcListExchangeById      = "exchange_by_id"
-	rpcUpdataStatusExchange  = "exchange_update_status"
+	rpcAddClaimableFreeChip        = "add_claimable_freechip"
+	rpcClaimFreeChip               = "claim_freechip"
+	rpcListClaimableFreeChip       = "list_claimable_freechip"
+	rpcListClaimableFreeChipExpire = "list_claimable_freechip_expire"
+	rpcCheckClaimFreeChip          = "check_claim_freechip"
+	rpcListFreeChip                = "list_freechip"
+	rpcMarkAcceptFreeChip          = "mark_accept_freechip"
+	rpcAddFreeChipCampaign         = "add_freechip_campaign"
+	rpcGetFreeChipCampaign         = "get_freechip_campaign"
+	rpcRevokeFreeChip              = "revoke_freechip"
+	rpcListDeal                    = "list_deal"
+	rpcListExchangeDeal            = "list_exchange_deal"
+	rpcExchangeAdd                 = "exchange_add"
+	rpcCancelExchange              = "exchange_cancel"
+	rpcListExchange                = "list_exchange"
+	rpcListExchangeLock            = "exchange_lock"
+	rpcListExchangeById            = "exchange_by_id"
+	rpcUpdataStatusExchange        = "exchange_update_status"
 
 	rpcIdDailyRewardTemplate = "dailyrewardtemplate"
 	rpcIdCanClaimDailyReward = "canclaimdailyreward"
 	rpcIdClaimDailyReward    = "claimdailyreward"
 
+	rpcIdAddDailyRewardTemplate      = "daily_reward_template_add"
+	rpcIdScheduleDailyRewardTemplate = "daily_reward_template_schedule"
+	rpcIdListDailyRewardTemplate     = "daily_reward_template_list"
+	rpcIdDailyRewardCatchUp          = "daily_reward_catch_up"
+	rpcIdDailyRewardBuyFreeze        = "daily_reward_buy_freeze"
+
+	rpcIdPlaytimeProgress = "playtime_progress"
+	rpcIdPlaytimeClaim    = "playtime_claim"
+
 	// UserGroup
 	rpcIdListUserGroup   = "list_user_group"
 	rpcIdAddUserGroup    = "add_user_group"
@@ -85,10 +121,17 @@ const (
 	rpcIdDeleteUserGroup = "delete_user_group"
 
 	//giftcode
-	rpcIdAddGiftCode    = "gift_code_add"
-	rpcIdClaimGiftCode  = "gift_code_claim"
-	rpcIdListGiftCode   = "gift_code_list"
-	rpcIdDeleteGiftCode = "gift_code_delete"
+	rpcIdAddGiftCode      = "gift_code_add"
+	rpcIdClaimGiftCode    = "gift_code_claim"
+	rpcIdListGiftCode     = "gift_code_list"
+	rpcIdDeleteGiftCode   = "gift_code_delete"
+	rpcIdSetGiftCodeRules = "gift_code_set_rules"
+	rpcIdGiftCodeAttempts = "gift_code_attempts"
+
+	rpcIdAddGiftCodeCampaign     = "gift_code_campaign_add"
+	rpcIdExportGiftCodeCampaign  = "gift_code_campaign_export"
+	rpcIdGiftCodeCampaignStats   = "gift_code_campaign_stats"
+	rpcIdDisableGiftCodeCampaign = "gift_code_campaign_disable"
 
 	// Notification
 	rpcIdListNotification      = "list_notification"
@@ -97,12 +140,34 @@ const (
 	rpcIdDeleteNotification    = "delete_notification"
 	rpcIdReadAllNotification   = "read_all_notification"
 	rpcIdDeleteAllNotification = "delete_all_notification"
+	// notification preference of user
+	rpcGetNotificationPreference    = "notification_preference_get"
+	rpcUpdateNotificationPreference = "notification_preference_update"
+	// mobile push token of user
+	rpcRegisterPushToken   = "push_token_register"
+	rpcUnregisterPushToken = "push_token_unregister"
+	// notification template admin
+	rpcUpsertNotificationTemplate = "notification_template_upsert"
+	rpcDeleteNotificationTemplate = "notification_template_delete"
+	rpcListNotificationTemplate   = "notification_template_list"
+	// notification campaign admin
+	rpcCreateNotificationCampaign = "notification_campaign_create"
+	rpcCancelNotificationCampaign = "notification_campaign_cancel"
+	rpcNotificationCampaignStatus = "notification_campaign_status"
 
 	// InAppMessage
 	rpcIdListInAppMessage   = "list_in_app_message"
 	rpcIdAddInAppMessage    = "add_in_app_message"
 	rpcIdUpdateInAppMessage = "update_in_app_message"
 	rpcIdDeleteInAppMessage = "delete_in_app_message"
+	// in-app message engagement
+	rpcInAppMessageEvent  = "in_app_message_event"
+	rpcSetInAppMessageCap = "in_app_message_cap_set"
+	rpcInAppMessageStats  = "in_app_message_stats"
+	// in-app message a/b variants
+	rpcSetInAppMessageVariants   = "in_app_message_variant_set"
+	rpcInAppMessageVariantAssign = "in_app_message_variant_assign"
+	rpcInAppMessageVariantReport = "in_app_message_variant_report"
 
 	rpcIdGetPreSignPush = "pre_sign_put"
 
@@ -111,6 +176,12 @@ const (
 	// refer user
 	rpcRewardReferHistory = "reward_refer_history"
 
+	rpcIdGetReferProgram   = "refer_program_get"
+	rpcIdSetReferProgram   = "refer_program_set"
+	rpcIdListReferReview   = "refer_review_list"
+	rpcIdUpdateReferReview = "refer_review_update"
+	rpcIdReferDashboard    = "refer_dashboard"
+
 	// IAP
 	rpcIAP = "iap"
 
@@ -122,6 +193,9 @@ const (
 	rpcRuleLuckyUpdate    = "rule_lucky_update"
 	rpcRuleLuckyDelete    = "rule_lucky_delete"
 	rpcRuleLuckyEmitEvent = "rule_lucky_emit_event"
+	rpcRuleLuckyVersions  = "rule_lucky_versions"
+	rpcRuleLuckyRollback  = "rule_lucky_rollback"
+	rpcSimulateRuleLucky  = "simulate_rule_lucky"
 	// Jackpot
 	rpcJackpot = "jackpot"
 )
@@ -144,10 +218,17 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	marshaler := conf.Marshaler
 	unmarshaler := conf.Unmarshaler
 	if true {
-		cgbdb.RunMigrations(ctx, logger, db)
+		if err := cgbdb.RunMigrations(ctx, logger, db); err != nil {
+			return err
+		}
 	}
 
 	api.InitListGame(ctx, logger, db, nk)
+	api.InitDailyRewardTimezone(ctx, logger)
+	api.InitPlaytime(ctx, logger, db)
+	if err := initializer.RegisterShutdown(api.ShutdownPlaytime); err != nil {
+		return err
+	}
 	// api.InitDeal(ctx, logger, nk, marshaler)
 	// api.InitDailyRewardTemplate(ctx, logger, nk)
 	// api.InitLeaderBoard(ctx, logger, nk, unmarshaler)
@@ -164,6 +245,12 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	// s.StartAsync()
 
 	ScheduleSendReferReward(ctx, logger, db, nk)
+	ScheduleExpireFreeChip(ctx, logger, db)
+	ScheduleClaimOutboxWorker(ctx, logger, db, nk)
+	ScheduleNotificationCampaignWorker(ctx, logger, db, nk)
+	ScheduleNotificationCleanup(ctx, logger, db)
+	api.InitPushProviders(ctx, logger)
+	SchedulePushWorker(ctx, logger, db)
 
 	objStorage, err := InitObjectStorage(logger)
 	if err != nil {
@@ -171,12 +258,17 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	} else {
 		objStorage.MakeBucket(entity.BucketAvatar)
 		objStorage.MakeBucket(entity.BucketBanners)
+		objStorage.MakeBucket(entity.BucketGiftCode)
 	}
 
 	if err := initializer.RegisterAfterAuthenticateDevice(api.AfterAuthDevice); err != nil {
 		return err
 	}
 
+	if err := initializer.RegisterAfterAuthenticateFacebook(api.AfterAuthFacebook); err != nil {
+		return err
+	}
+
 	// initializer.RegisterRpc(rpcTestRemoteNode, api.RpcTestProxyNode(nk))
 	if err := initializer.RegisterRpc(rpcGameAdd, api.RpcGameAdd(marshaler, unmarshaler)); err != nil {
 		return err
@@ -253,6 +345,9 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	if err := initializer.RegisterRpc(rpcListClaimableFreeChip, api.RpcListClaimableFreeChip(marshaler, unmarshaler)); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcListClaimableFreeChipExpire, api.RpcListClaimableFreeChipExpire()); err != nil {
+		return err
+	}
 	if err := initializer.RegisterRpc(rpcCheckClaimFreeChip, api.RpcCheckClaimFreeChip(marshaler, unmarshaler)); err != nil {
 		return err
 	}
@@ -262,6 +357,15 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	if err := initializer.RegisterRpc(rpcMarkAcceptFreeChip, api.RpcMarkAcceptListFreeChip(marshaler, unmarshaler)); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcAddFreeChipCampaign, api.RpcAddFreeChipCampaign()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcGetFreeChipCampaign, api.RpcGetFreeChipCampaign()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcRevokeFreeChip, api.RpcRevokeFreeChip()); err != nil {
+		return err
+	}
 
 	if err := initializer.RegisterRpc(rpcListDeal, api.RpcDealList(marshaler, unmarshaler)); err != nil {
 		return err
@@ -303,6 +407,34 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		api.RpcDailyRewardTemplate()); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcIdAddDailyRewardTemplate,
+		api.RpcAddDailyRewardTemplate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdScheduleDailyRewardTemplate,
+		api.RpcScheduleDailyRewardTemplate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdListDailyRewardTemplate,
+		api.RpcListDailyRewardTemplate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdDailyRewardCatchUp,
+		api.RpcDailyRewardCatchUp()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdDailyRewardBuyFreeze,
+		api.RpcDailyRewardBuyFreeze()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdPlaytimeProgress,
+		api.RpcPlaytimeProgress()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdPlaytimeClaim,
+		api.RpcPlaytimeClaim()); err != nil {
+		return err
+	}
 
 	// user group
 	if err := initializer.RegisterRpc(rpcIdListUserGroup,
@@ -339,6 +471,30 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		api.RpcDeleteGiftCode()); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcIdSetGiftCodeRules,
+		api.RpcSetGiftCodeRules()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdGiftCodeAttempts,
+		api.RpcGiftCodeAttempts()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdAddGiftCodeCampaign,
+		api.RpcAddGiftCodeCampaign(objStorage)); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdExportGiftCodeCampaign,
+		api.RpcExportGiftCodeCampaign(objStorage)); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdGiftCodeCampaignStats,
+		api.RpcGiftCodeCampaignStats()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdDisableGiftCodeCampaign,
+		api.RpcDisableGiftCodeCampaign()); err != nil {
+		return err
+	}
 	//end gift code
 
 	// Notification
@@ -366,6 +522,36 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		api.RpcDeleteAllNotification(marshaler, unmarshaler)); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcGetNotificationPreference, api.RpcGetNotificationPreference()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcUpdateNotificationPreference, api.RpcUpdateNotificationPreference()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcRegisterPushToken, api.RpcRegisterPushToken()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcUnregisterPushToken, api.RpcUnregisterPushToken()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcUpsertNotificationTemplate, api.RpcUpsertNotificationTemplate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcDeleteNotificationTemplate, api.RpcDeleteNotificationTemplate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcListNotificationTemplate, api.RpcListNotificationTemplate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcCreateNotificationCampaign, api.RpcCreateNotificationCampaign()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcCancelNotificationCampaign, api.RpcCancelNotificationCampaign()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcNotificationCampaignStatus, api.RpcNotificationCampaignStatus()); err != nil {
+		return err
+	}
 
 	// in app message
 	if err := initializer.RegisterRpc(rpcIdListInAppMessage,
@@ -384,6 +570,24 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		api.RpcDeleteInAppMessage(marshaler, unmarshaler)); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcInAppMessageEvent, api.RpcInAppMessageEvent()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcSetInAppMessageCap, api.RpcSetInAppMessageCap()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcInAppMessageStats, api.RpcInAppMessageStats()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcSetInAppMessageVariants, api.RpcSetInAppMessageVariants()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcInAppMessageVariantAssign, api.RpcInAppMessageVariantAssign()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcInAppMessageVariantReport, api.RpcInAppMessageVariantReport()); err != nil {
+		return err
+	}
 
 	// object storage
 	if err := initializer.RegisterRpc(rpcIdGetPreSignPush,
@@ -392,6 +596,9 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	}
 
 	if err := initializer.RegisterBeforeAuthenticateDevice(func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *nkapi.AuthenticateDeviceRequest) (*nkapi.AuthenticateDeviceRequest, error) {
+		if err := api.BeforeAuthDevice(ctx, logger, db, in); err != nil {
+			return nil, err
+		}
 		newID := node.Generate().Int64()
 		if in.Username == "" {
 			in.Username = fmt.Sprintf("%s.%d", entity.AutoPrefix, newID)
@@ -402,6 +609,9 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	}
 
 	if err := initializer.RegisterBeforeAuthenticateFacebook(func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *nkapi.AuthenticateFacebookRequest) (*nkapi.AuthenticateFacebookRequest, error) {
+		if err := api.BeforeAuthFacebook(ctx, logger, db, in); err != nil {
+			return nil, err
+		}
 		if in.Username == "" {
 			newID := node.Generate().Int64()
 			in.Username = fmt.Sprintf("%s.%d", entity.AutoPrefixFacebook, newID)
@@ -445,6 +655,97 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	); err != nil {
 		return err
 	}
+
+	if err := initializer.RegisterRpc(
+		rpcQuickChatPresets,
+		api.RpcGetQuickChatPreset(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcQuickChatReport,
+		api.RpcReportQuickChat(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcQuickChatPresetUpsert,
+		api.RpcUpsertQuickChatPreset(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcQuickChatPresetList,
+		api.RpcListQuickChatPreset(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcQuickChatBlocklistUpdate,
+		api.RpcUpdateChatBlocklist(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcQuickChatReportList,
+		api.RpcListQuickChatReport(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcSanctionApply,
+		api.RpcApplySanction(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcSanctionLift,
+		api.RpcLiftSanction(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcSanctionList,
+		api.RpcListSanction(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcListDevices,
+		api.RpcListDevices(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcRevokeDevice,
+		api.RpcRevokeDevice(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcDevicePolicyGet,
+		api.RpcGetDevicePolicy(),
+	); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(
+		rpcDevicePolicySet,
+		api.RpcSetDevicePolicy(),
+	); err != nil {
+		return err
+	}
 	if err := initializer.RegisterRpc(
 		rpcRewardReferEstInWeek,
 		api.RpcEstRewardThisWeek(),
@@ -458,6 +759,29 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcIdGetReferProgram,
+		api.RpcGetReferProgram()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcIdSetReferProgram,
+		api.RpcSetReferProgram()); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(rpcIdListReferReview,
+		api.RpcListReferReview()); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(rpcIdUpdateReferReview,
+		api.RpcUpdateReferReview()); err != nil {
+		return err
+	}
+
+	if err := initializer.RegisterRpc(rpcIdReferDashboard,
+		api.RpcReferDashboard()); err != nil {
+		return err
+	}
 
 	// leaderboard
 	if err := initializer.RegisterRpc(
@@ -483,6 +807,15 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	if err := initializer.RegisterRpc(rpcRuleLuckyEmitEvent, api.RpcRuleLuckyEmitEvemt()); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcRuleLuckyVersions, api.RpcRuleLuckyVersions()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcRuleLuckyRollback, api.RpcRuleLuckyRollback()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcSimulateRuleLucky, api.RpcSimulateRuleLucky()); err != nil {
+		return err
+	}
 
 	if err := api.RegisterSessionEvents(db, nk, initializer); err != nil {
 		return err
@@ -495,6 +828,33 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 	if err := initializer.RegisterRpc(rpcUpdateBotConfig, api.RpcUpdateBotConfig(marshaler, unmarshaler)); err != nil {
 		return err
 	}
+	if err := initializer.RegisterRpc(rpcBotRuleSimulate, api.RpcBotRuleSimulate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcDeleteBotRule, api.RpcDeleteBotRule()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotPoolCreate, api.RpcBotPoolCreate()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotPoolList, api.RpcBotPoolList()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotPoolRetire, api.RpcBotPoolRetire()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotPoolRebalance, api.RpcBotPoolRebalance()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotLease, api.RpcBotLease()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotLeaseRenew, api.RpcBotLeaseRenew()); err != nil {
+		return err
+	}
+	if err := initializer.RegisterRpc(rpcBotLeaseReturn, api.RpcBotLeaseReturn()); err != nil {
+		return err
+	}
 
 	api.RegisterValidatePurchase(db, nk, initializer)
 
@@ -546,6 +906,129 @@ func ScheduleSendReferReward(ctx context.Context, logger runtime.Logger, db *sql
 	s.Start()
 }
 
+func ScheduleExpireFreeChip(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+	s, err := gocron.NewScheduler()
+	if err != nil {
+		logger.Error("failed to create scheduler ", err)
+		return
+	}
+
+	// Chạy mỗi 5 phút
+	_, err = s.NewJob(
+		gocron.DurationJob(5*time.Minute),
+		gocron.NewTask(func() {
+			api.ExpireFreeChip(ctx, logger, db)
+		}),
+	)
+	if err != nil {
+		logger.Error("failed to schedule job ", err)
+		return
+	}
+
+	s.Start()
+}
+
+func ScheduleClaimOutboxWorker(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	s, err := gocron.NewScheduler()
+	if err != nil {
+		logger.Error("failed to create scheduler ", err)
+		return
+	}
+
+	// Cộng chip cho các claim freechip/giftcode còn pending, chạy mỗi phút
+	_, err = s.NewJob(
+		gocron.DurationJob(time.Minute),
+		gocron.NewTask(func() {
+			api.ProcessPendingClaimOutbox(ctx, logger, db, nk)
+		}),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		logger.Error("failed to schedule job ", err)
+		return
+	}
+
+	s.Start()
+}
+
+func ScheduleNotificationCampaignWorker(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	s, err := gocron.NewScheduler()
+	if err != nil {
+		logger.Error("failed to create scheduler ", err)
+		return
+	}
+
+	// Gửi các notification campaign đến giờ gửi, chạy mỗi 30 giây
+	_, err = s.NewJob(
+		gocron.DurationJob(30*time.Second),
+		gocron.NewTask(func() {
+			api.ProcessNotificationCampaigns(ctx, logger, db, nk)
+		}),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		logger.Error("failed to schedule job ", err)
+		return
+	}
+
+	s.Start()
+}
+
+func ScheduleNotificationCleanup(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+	s, err := gocron.NewScheduler()
+	if err != nil {
+		logger.Error("failed to create scheduler ", err)
+		return
+	}
+
+	// Xoá các notification đã hết hạn theo category, chạy mỗi giờ
+	_, err = s.NewJob(
+		gocron.DurationJob(time.Hour),
+		gocron.NewTask(func() {
+			deleted, err := cgbdb.DeleteExpiredNotification(ctx, logger, db, 5000)
+			if err != nil {
+				return
+			}
+			if deleted > 0 {
+				logger.Info("Deleted %d expired notifications", deleted)
+			}
+			if deleted, err := cgbdb.DeleteFinishedPush(ctx, logger, db, entity.PushKeepDays); err == nil && deleted > 0 {
+				logger.Info("Deleted %d finished push", deleted)
+			}
+		}),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		logger.Error("failed to schedule job ", err)
+		return
+	}
+
+	s.Start()
+}
+
+func SchedulePushWorker(ctx context.Context, logger runtime.Logger, db *sql.DB) {
+	s, err := gocron.NewScheduler()
+	if err != nil {
+		logger.Error("failed to create scheduler ", err)
+		return
+	}
+
+	// Gửi mobile push trong hàng đợi và retry push lỗi, chạy mỗi 10 giây
+	_, err = s.NewJob(
+		gocron.DurationJob(10*time.Second),
+		gocron.NewTask(func() {
+			api.ProcessPushQueue(ctx, logger, db)
+		}),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		logger.Error("failed to schedule job ", err)
+		return
+	}
+
+	s.Start()
+}
+
 const (
 	MinioHost      = "103.226.250.195:9000"
 	MinioKey       = "minio"
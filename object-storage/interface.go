@@ -1,11 +1,15 @@
 package objectstorage
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 type ObjStorage interface {
 	MakeBucket(bucketName string) error
 	PresignGetObject(bucketName string, objectName string, expiry time.Duration, params map[string]interface{}) (string, error)
 	PresigPutObject(bucketName string, objectName string, expiry time.Duration, params map[string]interface{}) (string, error)
+	PutObject(bucketName string, objectName string, reader io.Reader, size int64, contentType string) error
 }
 
 type EmptyStorage struct{}
@@ -20,3 +24,7 @@ func (e *EmptyStorage) PresignGetObject(bucketName string, objectName string, ex
 func (e *EmptyStorage) PresigPutObject(bucketName string, objectName string, expiry time.Duration, params map[string]interface{}) (string, error) {
 	return "", nil
 }
+
+func (e *EmptyStorage) PutObject(bucketName string, objectName string, reader io.Reader, size int64, contentType string) error {
+	return nil
+}
@@ -3,6 +3,7 @@ package objectstorage
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/url"
 	"time"
 
@@ -68,3 +69,14 @@ func (w *MinioWrapper) PresigPutObject(bucketName string, objectName string, exp
 	}
 	return url.PathUnescape(presignedURL.String())
 }
+
+func (w *MinioWrapper) PutObject(bucketName string, objectName string, reader io.Reader, size int64, contentType string) error {
+	if !w.init {
+		return fmt.Errorf("Minio wrapper not init")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := w.minioClient.PutObject(ctx, bucketName, objectName, reader, size,
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
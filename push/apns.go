@@ -0,0 +1,137 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	apnsEndpoint        = "https://api.push.apple.com"
+	apnsSandboxEndpoint = "https://api.sandbox.push.apple.com"
+	// apple reject provider token older than 1 hour and refreshed more than once per 20 minutes
+	apnsTokenTtl = 50 * time.Minute
+)
+
+// ApnsProvider send push through APNs HTTP/2 api with token based auth (.p8 key)
+type ApnsProvider struct {
+	keyId    string
+	teamId   string
+	signKey  any
+	client   *http.Client
+	endpoint string
+
+	mu       sync.Mutex
+	jwtToken string
+	issuedAt time.Time
+}
+
+func NewApnsProvider(keyId, teamId string, keyPEM []byte, sandbox bool) (*ApnsProvider, error) {
+	if keyId == "" || teamId == "" {
+		return nil, errors.New("apns key id and team id are required")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parse apns key: %w", err)
+	}
+	p := &ApnsProvider{
+		keyId:    keyId,
+		teamId:   teamId,
+		signKey:  key,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		endpoint: apnsEndpoint,
+	}
+	if sandbox {
+		p.endpoint = apnsSandboxEndpoint
+	}
+	return p, nil
+}
+
+func (p *ApnsProvider) Name() string {
+	return "apns"
+}
+
+func (p *ApnsProvider) Send(ctx context.Context, msg *Message) error {
+	if msg.Topic == "" {
+		return fmt.Errorf("%w: apns topic is empty", ErrRejected)
+	}
+	authToken, err := p.token()
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range msg.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/3/device/"+msg.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+authToken)
+	req.Header.Set("apns-topic", msg.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	_ = json.Unmarshal(respBody, &apnsErr)
+	switch {
+	case resp.StatusCode == http.StatusGone, apnsErr.Reason == "BadDeviceToken", apnsErr.Reason == "DeviceTokenNotForTopic",
+		apnsErr.Reason == "Unregistered":
+		return fmt.Errorf("%w: apns %s", ErrTokenInvalid, apnsErr.Reason)
+	case apnsErr.Reason == "ExpiredProviderToken" || apnsErr.Reason == "InvalidProviderToken":
+		p.mu.Lock()
+		p.jwtToken = ""
+		p.mu.Unlock()
+		return fmt.Errorf("apns provider token: %s", apnsErr.Reason)
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: apns %s", ErrRejected, apnsErr.Reason)
+	}
+	return fmt.Errorf("apns status %d %s", resp.StatusCode, apnsErr.Reason)
+}
+
+// token provider token signed by .p8 key, reused until apnsTokenTtl
+func (p *ApnsProvider) token() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jwtToken != "" && time.Since(p.issuedAt) < apnsTokenTtl {
+		return p.jwtToken, nil
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": p.teamId,
+		"iat": now.Unix(),
+	})
+	t.Header["kid"] = p.keyId
+	signed, err := t.SignedString(p.signKey)
+	if err != nil {
+		return "", err
+	}
+	p.jwtToken, p.issuedAt = signed, now
+	return signed, nil
+}
@@ -0,0 +1,43 @@
+package push
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeProvider keep sent messages in memory, for local run and tests
+type FakeProvider struct {
+	mu sync.Mutex
+	// token in Invalid return ErrTokenInvalid
+	Invalid map[string]bool
+	// Err is returned for every other token when set
+	Err  error
+	Sent []*Message
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{Invalid: make(map[string]bool)}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Send(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Invalid[msg.Token] {
+		return ErrTokenInvalid
+	}
+	if p.Err != nil {
+		return p.Err
+	}
+	p.Sent = append(p.Sent, msg)
+	return nil
+}
+
+func (p *FakeProvider) SentCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.Sent)
+}
@@ -0,0 +1,186 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	fcmEndpoint = "https://fcm.googleapis.com"
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+	// access token is refreshed this long before it expire
+	fcmTokenRefreshBefore = time.Minute
+)
+
+// fcmServiceAccount fields of service account json downloaded from firebase console
+type fcmServiceAccount struct {
+	ProjectId   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+// FcmProvider send push through FCM HTTP v1 api, access token is exchanged from service account
+type FcmProvider struct {
+	account  fcmServiceAccount
+	signKey  any
+	client   *http.Client
+	endpoint string
+
+	mu          sync.Mutex
+	accessToken string
+	expireAt    time.Time
+}
+
+func NewFcmProvider(credentialsJSON []byte) (*FcmProvider, error) {
+	p := &FcmProvider{client: &http.Client{Timeout: 10 * time.Second}, endpoint: fcmEndpoint}
+	if err := json.Unmarshal(credentialsJSON, &p.account); err != nil {
+		return nil, fmt.Errorf("parse fcm credentials: %w", err)
+	}
+	if p.account.ProjectId == "" || p.account.ClientEmail == "" || p.account.TokenUri == "" {
+		return nil, errors.New("fcm credentials missing project_id, client_email or token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(p.account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse fcm private key: %w", err)
+	}
+	p.signKey = key
+	return p, nil
+}
+
+func (p *FcmProvider) Name() string {
+	return "fcm"
+}
+
+func (p *FcmProvider) Send(ctx context.Context, msg *Message) error {
+	accessToken, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        msg.Token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         msg.Data,
+		},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		p.endpoint+"/v1/projects/"+p.account.ProjectId+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return p.parseError(resp.StatusCode, respBody)
+}
+
+// parseError map FCM error to invalid token, rejected or temporary error
+func (p *FcmProvider) parseError(statusCode int, body []byte) error {
+	var fcmErr struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode       string `json:"errorCode"`
+				FieldViolations []struct {
+					Field string `json:"field"`
+				} `json:"fieldViolations"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &fcmErr)
+	errorCode := fcmErr.Error.Status
+	// invalid token is INVALID_ARGUMENT with bad request detail on field message.token
+	badToken := false
+	for _, d := range fcmErr.Error.Details {
+		if d.ErrorCode != "" {
+			errorCode = d.ErrorCode
+		}
+		for _, v := range d.FieldViolations {
+			if v.Field == "message.token" {
+				badToken = true
+			}
+		}
+	}
+	switch {
+	case errorCode == "UNREGISTERED" || errorCode == "SENDER_ID_MISMATCH" || statusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: fcm %s", ErrTokenInvalid, errorCode)
+	case errorCode == "INVALID_ARGUMENT" && badToken:
+		return fmt.Errorf("%w: fcm %s %s", ErrTokenInvalid, errorCode, fcmErr.Error.Message)
+	case statusCode == http.StatusUnauthorized:
+		// access token revoked, get new one on retry
+		p.mu.Lock()
+		p.accessToken = ""
+		p.mu.Unlock()
+		return fmt.Errorf("fcm unauthorized: %s", fcmErr.Error.Message)
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: fcm %s %s", ErrRejected, errorCode, fcmErr.Error.Message)
+	}
+	return fmt.Errorf("fcm status %d %s", statusCode, errorCode)
+}
+
+// token cached access token, exchange a signed jwt for new one when it is about to expire
+func (p *FcmProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.accessToken != "" && time.Now().Before(p.expireAt) {
+		return p.accessToken, nil
+	}
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   p.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.account.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(p.signKey)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.account.TokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fcm token exchange status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil || tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("fcm token exchange invalid response: %v", err)
+	}
+	p.accessToken = tokenResp.AccessToken
+	p.expireAt = now.Add(time.Duration(tokenResp.ExpiresIn)*time.Second - fcmTokenRefreshBefore)
+	return p.accessToken, nil
+}
@@ -0,0 +1,28 @@
+package push
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrTokenInvalid token is unregistered or not for this app, caller should delete it
+	ErrTokenInvalid = errors.New("push token is invalid")
+	// ErrRejected provider reject the message itself, retry will not help
+	ErrRejected = errors.New("push message is rejected")
+)
+
+// Message push of one device token, topic is app package (bundle id on iOS)
+type Message struct {
+	Token string
+	Topic string
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Provider send push to a device. Error other than ErrTokenInvalid and ErrRejected is temporary and can be retried.
+type Provider interface {
+	Name() string
+	Send(ctx context.Context, msg *Message) error
+}
@@ -0,0 +1,116 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestFcm(t *testing.T, send http.HandlerFunc) *FcmProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"at","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/projects/p1/messages:send", send)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	credentials, _ := json.Marshal(map[string]string{
+		"project_id": "p1", "client_email": "a@p1.iam", "private_key": string(keyPEM), "token_uri": server.URL + "/token",
+	})
+	p, err := NewFcmProvider(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.endpoint = server.URL
+	return p
+}
+
+func TestFcmSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"ok", http.StatusOK, `{"name":"m1"}`, nil},
+		{"unregistered", http.StatusNotFound,
+			`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`, ErrTokenInvalid},
+		{"bad payload", http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT"}}`, ErrRejected},
+		{"bad token", http.StatusBadRequest,
+			`{"error":{"status":"INVALID_ARGUMENT","details":[{"errorCode":"INVALID_ARGUMENT"},{"fieldViolations":[{"field":"message.token"}]}]}}`, ErrTokenInvalid},
+		{"unavailable", http.StatusServiceUnavailable, `{"error":{"status":"UNAVAILABLE"}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestFcm(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer at" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			err := p.Send(context.Background(), &Message{Token: "t1", Title: "title", Body: "body"})
+			switch {
+			case tt.status == http.StatusOK && err != nil:
+				t.Errorf("Send() = %v, want nil", err)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("Send() = %v, want %v", err, tt.wantErr)
+			case tt.status == http.StatusServiceUnavailable && (err == nil || errors.Is(err, ErrTokenInvalid) || errors.Is(err, ErrRejected)):
+				t.Errorf("Send() = %v, want temporary error", err)
+			}
+		})
+	}
+}
+
+func TestApnsSend(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	p, err := NewApnsProvider("kid", "team", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("apns-topic") != "com.app.a" {
+			t.Errorf("apns-topic = %q", r.Header.Get("apns-topic"))
+		}
+		switch r.URL.Path {
+		case "/3/device/ok":
+		case "/3/device/gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"PayloadEmpty"}`))
+		}
+	}))
+	defer server.Close()
+	p.endpoint = server.URL
+	tests := []struct {
+		token   string
+		wantErr error
+	}{
+		{"ok", nil},
+		{"gone", ErrTokenInvalid},
+		{"other", ErrRejected},
+	}
+	for _, tt := range tests {
+		err := p.Send(context.Background(), &Message{Token: tt.token, Topic: "com.app.a", Title: "t", Body: "b"})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Send(%s) = %v, want %v", tt.token, err, tt.wantErr)
+		}
+	}
+}